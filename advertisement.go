@@ -0,0 +1,91 @@
+package otr3
+
+// Advertisement decides how a conversation lets the peer know that we support OTR
+// when we send plaintext messages. Some transports render whitespace tags visibly
+// or mangle query messages, so this can be chosen per peer.
+type Advertisement int
+
+const (
+	// AdvertiseByPolicy appends a whitespace tag to plaintext messages if the SendWhitespaceTag policy is set.
+	// This is the default.
+	AdvertiseByPolicy Advertisement = iota
+	// AdvertiseNone never lets the peer know that we support OTR
+	AdvertiseNone
+	// AdvertiseWhitespaceTag appends a whitespace tag to plaintext messages until the peer ignores it
+	AdvertiseWhitespaceTag
+	// AdvertiseQuery sends a query message together with the first plaintext message
+	AdvertiseQuery
+	// AdvertiseWhitespaceTagAndQuery does both AdvertiseWhitespaceTag and AdvertiseQuery
+	AdvertiseWhitespaceTagAndQuery
+)
+
+var advertisementNames = map[Advertisement]string{
+	AdvertiseByPolicy:              "policy",
+	AdvertiseNone:                  "none",
+	AdvertiseWhitespaceTag:         "whitespace",
+	AdvertiseQuery:                 "query",
+	AdvertiseWhitespaceTagAndQuery: "whitespace+query",
+}
+
+// String returns the string representation of the Advertisement
+func (a Advertisement) String() string {
+	if name, ok := advertisementNames[a]; ok {
+		return name
+	}
+	return "ADVERTISEMENT: (THIS SHOULD NEVER HAPPEN)"
+}
+
+// MarshalText returns the string representation of the Advertisement, so it can be persisted
+func (a Advertisement) MarshalText() ([]byte, error) {
+	if _, ok := advertisementNames[a]; !ok {
+		return nil, newOtrErrorf("unknown advertisement: %d", int(a))
+	}
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText sets the Advertisement from a string representation returned by MarshalText
+func (a *Advertisement) UnmarshalText(text []byte) error {
+	for adv, name := range advertisementNames {
+		if name == string(text) {
+			*a = adv
+			return nil
+		}
+	}
+	return newOtrErrorf("unknown advertisement: %q", text)
+}
+
+// SetAdvertisement sets how this conversation lets the peer know that we support OTR
+func (c *Conversation) SetAdvertisement(a Advertisement) {
+	c.advertisement = a
+}
+
+// GetAdvertisement returns how this conversation lets the peer know that we support OTR
+func (c *Conversation) GetAdvertisement() Advertisement {
+	return c.advertisement
+}
+
+func (c *Conversation) shouldAdvertiseWithWhitespaceTag() bool {
+	switch c.advertisement {
+	case AdvertiseByPolicy:
+		return c.Policies.Has(PolicySendWhitespaceTag)
+	case AdvertiseWhitespaceTag, AdvertiseWhitespaceTagAndQuery:
+		return true
+	}
+	return false
+}
+
+func (c *Conversation) shouldAdvertiseWithQuery() bool {
+	return c.advertisement == AdvertiseQuery || c.advertisement == AdvertiseWhitespaceTagAndQuery
+}
+
+// advertise returns the plaintext message to send, together with a query message if one should be sent
+func (c *Conversation) advertise(message []byte) []ValidMessage {
+	result := []ValidMessage{makeCopy(c.appendWhitespaceTag(message))}
+
+	if c.shouldAdvertiseWithQuery() && !c.sentAdvertisedQuery {
+		c.sentAdvertisedQuery = true
+		result = append(result, c.QueryMessage())
+	}
+
+	return result
+}
@@ -0,0 +1,85 @@
+package otr3
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func Test_Send_appendsWhitespaceTagByPolicyByDefault(t *testing.T) {
+	c := &Conversation{Policies: Policies(PolicyAllowV3 | PolicySendWhitespaceTag)}
+
+	toSend, _ := c.Send(ValidMessage("hi"))
+
+	assertDeepEquals(t, toSend, []ValidMessage{append(ValidMessage("hi"), genWhitespaceTag(c.Policies)...)})
+}
+
+func Test_Send_doesntAdvertiseAnythingWithAdvertiseNone(t *testing.T) {
+	c := &Conversation{Policies: Policies(PolicyAllowV3 | PolicySendWhitespaceTag)}
+	c.SetAdvertisement(AdvertiseNone)
+
+	toSend, _ := c.Send(ValidMessage("hi"))
+
+	assertDeepEquals(t, toSend, []ValidMessage{ValidMessage("hi")})
+}
+
+func Test_Send_appendsWhitespaceTagWithAdvertiseWhitespaceTagEvenWithoutThePolicy(t *testing.T) {
+	c := &Conversation{Policies: Policies(PolicyAllowV3)}
+	c.SetAdvertisement(AdvertiseWhitespaceTag)
+
+	toSend, _ := c.Send(ValidMessage("hi"))
+
+	assertDeepEquals(t, toSend, []ValidMessage{append(ValidMessage("hi"), genWhitespaceTag(c.Policies)...)})
+}
+
+func Test_Send_sendsAQueryMessageOnlyWithTheFirstMessageWithAdvertiseQuery(t *testing.T) {
+	c := &Conversation{Policies: Policies(PolicyAllowV3 | PolicySendWhitespaceTag)}
+	c.SetAdvertisement(AdvertiseQuery)
+
+	toSend, _ := c.Send(ValidMessage("hi"))
+	toSend2, _ := c.Send(ValidMessage("again"))
+
+	assertDeepEquals(t, toSend, []ValidMessage{ValidMessage("hi"), ValidMessage("?OTRv3?")})
+	assertDeepEquals(t, toSend2, []ValidMessage{ValidMessage("again")})
+}
+
+func Test_Send_sendsBothWithAdvertiseWhitespaceTagAndQuery(t *testing.T) {
+	c := &Conversation{Policies: Policies(PolicyAllowV3)}
+	c.SetAdvertisement(AdvertiseWhitespaceTagAndQuery)
+
+	toSend, _ := c.Send(ValidMessage("hi"))
+
+	assertDeepEquals(t, toSend, []ValidMessage{append(ValidMessage("hi"), genWhitespaceTag(c.Policies)...), ValidMessage("?OTRv3?")})
+}
+
+func Test_Advertisement_String_returnsTheNameOfTheAdvertisement(t *testing.T) {
+	assertEquals(t, AdvertiseByPolicy.String(), "policy")
+	assertEquals(t, AdvertiseNone.String(), "none")
+	assertEquals(t, AdvertiseWhitespaceTag.String(), "whitespace")
+	assertEquals(t, AdvertiseQuery.String(), "query")
+	assertEquals(t, AdvertiseWhitespaceTagAndQuery.String(), "whitespace+query")
+	assertEquals(t, Advertisement(20000).String(), "ADVERTISEMENT: (THIS SHOULD NEVER HAPPEN)")
+}
+
+func Test_Advertisement_canBePersistedAndRestored(t *testing.T) {
+	persisted, err := json.Marshal(map[string]Advertisement{"sms": AdvertiseQuery, "xmpp": AdvertiseWhitespaceTagAndQuery})
+	assertNil(t, err)
+	assertEquals(t, string(persisted), `{"sms":"query","xmpp":"whitespace+query"}`)
+
+	var restored map[string]Advertisement
+	err = json.Unmarshal(persisted, &restored)
+	assertNil(t, err)
+	assertDeepEquals(t, restored, map[string]Advertisement{"sms": AdvertiseQuery, "xmpp": AdvertiseWhitespaceTagAndQuery})
+}
+
+func Test_Advertisement_UnmarshalText_returnsErrorForAnUnknownAdvertisement(t *testing.T) {
+	var a Advertisement
+	err := a.UnmarshalText([]byte("smoke signals"))
+
+	assertEquals(t, err, newOtrError(`unknown advertisement: "smoke signals"`))
+}
+
+func Test_Advertisement_MarshalText_returnsErrorForAnUnknownAdvertisement(t *testing.T) {
+	_, err := Advertisement(20000).MarshalText()
+
+	assertEquals(t, err, newOtrError("unknown advertisement: 20000"))
+}
@@ -2,7 +2,6 @@ package otr3
 
 import (
 	"crypto/hmac"
-	"crypto/subtle"
 	"io"
 	"math/big"
 	"time"
@@ -25,12 +24,22 @@ type ake struct {
 	// SIZE: this should always be version.hash2Length
 	xhashedGx []byte
 
+	// ssid only becomes the ssid of the conversation once the AKE has finished
+	ssid      [8]byte
 	revealKey akeKeys
 	sigKey    akeKeys
 
 	state authState
 	keys  keyManagementContext
 
+	// version is the protocol version the AKE was started with. The signatures in the AKE don't cover it,
+	// so it is checked before they are, to make sure the AKE isn't spliced together from messages of different versions
+	version otrVersion
+	// role is the side of the AKE we are, which changes if we answer the D-H Commit of the peer instead of ours
+	role Role
+	// finished is set once the AKE has finished and everything in it has been wiped or moved to the conversation
+	finished bool
+
 	lastStateChange time.Time
 }
 
@@ -44,12 +53,13 @@ func (c *Conversation) ensureAKE() {
 
 func (c *Conversation) initAKE() {
 	c.ake = &ake{
-		state: authStateNone{},
+		state:   authStateNone{},
+		version: c.version,
 	}
 }
 
 func (c *Conversation) calcAKEKeys(s *big.Int) {
-	c.ssid, c.ake.revealKey, c.ake.sigKey = calculateAKEKeys(s, c.version)
+	c.ake.ssid, c.ake.revealKey, c.ake.sigKey = calculateAKEKeys(s, c.version)
 }
 
 func (c *Conversation) setSecretExponent(val *big.Int) {
@@ -57,12 +67,14 @@ func (c *Conversation) setSecretExponent(val *big.Int) {
 	c.ake.ourPublicValue = modExp(g1, val)
 }
 
+// calcDHSharedSecret calculates the shared secret into the secret scratch of the conversation,
+// so it has to be wiped with the scratch once the AKE keys have been derived from it
 func (c *Conversation) calcDHSharedSecret() *big.Int {
-	return modExp(c.ake.theirPublicValue, c.ake.secretExponent)
+	return c.secrets.modExp(c.ake.theirPublicValue, c.ake.secretExponent)
 }
 
 func (c *Conversation) generateEncryptedSignature(key *akeKeys) ([]byte, error) {
-	verifyData := appendAll(c.ake.ourPublicValue, c.ake.theirPublicValue, c.ourCurrentKey.PublicKey(), c.ake.keys.ourKeyID)
+	verifyData := encodeM(c.ake.ourPublicValue, c.ake.theirPublicValue, c.ourCurrentKey.PublicKey(), c.ake.keys.ourKeyID)
 
 	mb := sumHMAC(key.m1, verifyData, c.version)
 	xb, err := c.calcXb(key, mb)
@@ -73,10 +85,6 @@ func (c *Conversation) generateEncryptedSignature(key *akeKeys) ([]byte, error)
 
 	return gotrax.AppendData(nil, xb), nil
 }
-func appendAll(one, two *big.Int, publicKey PublicKey, keyID uint32) []byte {
-	return gotrax.AppendWord(append(gotrax.AppendMPI(gotrax.AppendMPI(nil, one), two), publicKey.serialize()...), keyID)
-}
-
 func fixedSize(s int, v []byte) []byte {
 	if len(v) < s {
 		vv := make([]byte, s)
@@ -87,10 +95,9 @@ func fixedSize(s int, v []byte) []byte {
 }
 
 func (c *Conversation) calcXb(key *akeKeys, mb []byte) ([]byte, error) {
-	xb := c.ourCurrentKey.PublicKey().serialize()
-	xb = gotrax.AppendWord(xb, c.ake.keys.ourKeyID)
+	xb := encodeXWithoutSignature(c.ourCurrentKey.PublicKey(), c.ake.keys.ourKeyID)
 
-	sigb, err := c.ourCurrentKey.Sign(c.rand(), mb)
+	sigb, err := c.sign(mb)
 	if err == io.ErrUnexpectedEOF || err == io.EOF {
 		return nil, errShortRandomRead
 	}
@@ -109,10 +116,11 @@ func (c *Conversation) calcXb(key *akeKeys, mb []byte) ([]byte, error) {
 // Bob ---- DH Commit -----------> Alice
 func (c *Conversation) dhCommitMessage() ([]byte, error) {
 	c.initAKE()
+	c.ake.role = RoleInitiator
+	c.timelineEvent(TimelineAKEStarted)
 	c.ake.keys.ourKeyID = 0
 
-	// TODO: where does this 40 come from?
-	x, err := c.randMPI(make([]byte, 40))
+	x, err := c.ephemeralExponent()
 	if err != nil {
 		return nil, err
 	}
@@ -125,7 +133,7 @@ func (c *Conversation) dhCommitMessage() ([]byte, error) {
 	}
 
 	// this can't return an error, since ake.r is of a fixed size that is always correct
-	c.ake.encryptedGx, _ = encrypt(c.ake.r[:], gotrax.AppendMPI(nil, c.ake.ourPublicValue))
+	c.ake.encryptedGx, _ = encrypt(c.ake.r[:], encodeGx(c.ake.ourPublicValue))
 
 	return c.serializeDHCommit(c.ake.ourPublicValue), nil
 }
@@ -133,7 +141,7 @@ func (c *Conversation) dhCommitMessage() ([]byte, error) {
 func (c *Conversation) serializeDHCommit(public *big.Int) []byte {
 	dhCommitMsg := dhCommit{
 		encryptedGx: c.ake.encryptedGx,
-		yhashedGx:   c.version.hash2(gotrax.AppendMPI(nil, public)),
+		yhashedGx:   c.version.hash2(encodeGx(public)),
 	}
 	return dhCommitMsg.serialize()
 }
@@ -143,9 +151,7 @@ func (c *Conversation) serializeDHCommit(public *big.Int) []byte {
 func (c *Conversation) dhKeyMessage() ([]byte, error) {
 	c.initAKE()
 
-	// TODO: where does this 40 come from?
-	y, err := c.randMPI(make([]byte, 40)[:])
-
+	y, err := c.ephemeralExponent()
 	if err != nil {
 		return nil, err
 	}
@@ -168,10 +174,13 @@ func (c *Conversation) serializeDHKey() []byte {
 // Bob ---- Reveal Signature ----> Alice
 func (c *Conversation) revealSigMessage() ([]byte, error) {
 	c.calcAKEKeys(c.calcDHSharedSecret())
+	// The shared secret isn't needed anymore once the keys have been derived from it
+	c.secrets.wipe()
 	c.ake.keys.ourKeyID++
 
 	encryptedSig, err := c.generateEncryptedSignature(&c.ake.revealKey)
 	if err != nil {
+		c.ake.keys.ourKeyID--
 		return nil, err
 	}
 
@@ -192,6 +201,7 @@ func (c *Conversation) sigMessage() ([]byte, error) {
 
 	encryptedSig, err := c.generateEncryptedSignature(&c.ake.sigKey)
 	if err != nil {
+		c.ake.keys.ourKeyID--
 		return nil, err
 	}
 
@@ -208,13 +218,16 @@ func (c *Conversation) sigMessage() ([]byte, error) {
 // Bob ---- DH Commit -----------> Alice
 func (c *Conversation) processDHCommit(msg []byte) error {
 	dhCommitMsg := dhCommit{}
-	err := dhCommitMsg.deserialize(msg)
+	err := dhCommitMsg.deserialize(msg, c.FieldLimits())
 	if err != nil {
 		return err
 	}
 
 	c.ake.encryptedGx = dhCommitMsg.encryptedGx
 	c.ake.xhashedGx = dhCommitMsg.yhashedGx
+	c.ake.version = c.version
+	c.ake.role = RoleResponder
+	c.timelineEvent(TimelineAKEStarted)
 
 	return err
 }
@@ -223,13 +236,13 @@ func (c *Conversation) processDHCommit(msg []byte) error {
 // Alice -- DH Key --------------> Bob
 func (c *Conversation) processDHKey(msg []byte) (isSame bool, err error) {
 	dhKeyMsg := dhKey{}
-	err = dhKeyMsg.deserialize(msg)
+	err = dhKeyMsg.deserialize(msg, c.FieldLimits())
 	if err != nil {
 		return false, err
 	}
 
 	if !isGroupElement(dhKeyMsg.gy) {
-		return false, newOtrError("DH value out of range")
+		return false, errDHValueOutOfRange
 	}
 
 	//If receive same public key twice, just retransmit the previous Reveal Signature
@@ -245,30 +258,26 @@ func (c *Conversation) processDHKey(msg []byte) (isSame bool, err error) {
 // processRevealSig = alice = y
 // Bob ---- Reveal Signature ----> Alice
 func (c *Conversation) processRevealSig(msg []byte) (err error) {
+	if err = c.checkAKEVersion(); err != nil {
+		return
+	}
+
 	revealSigMsg := revealSig{}
-	err = revealSigMsg.deserialize(msg, c.version)
+	err = revealSigMsg.deserialize(msg, c.version, c.FieldLimits())
 	if err != nil {
 		return
 	}
 
-	r := revealSigMsg.r[:]
 	theirMAC := revealSigMsg.macSig
 	encryptedSig := revealSigMsg.encryptedSig
 
-	decryptedGx := make([]byte, len(c.ake.encryptedGx))
-	if err = decrypt(r, decryptedGx, c.ake.encryptedGx); err != nil {
-		return
-	}
-
-	if err = checkDecryptedGx(decryptedGx, c.ake.xhashedGx, c.version); err != nil {
-		return
-	}
-
-	if c.ake.theirPublicValue, err = extractGx(decryptedGx); err != nil {
+	if c.ake.theirPublicValue, err = c.revealCommittedGx(revealSigMsg.r[:]); err != nil {
 		return
 	}
 
 	c.calcAKEKeys(c.calcDHSharedSecret())
+	// The shared secret isn't needed anymore once the keys have been derived from it
+	c.secrets.wipe()
 	if err = c.processEncryptedSig(encryptedSig, theirMAC, &c.ake.revealKey); err != nil {
 		return newOtrError("in reveal signature message: " + err.Error())
 	}
@@ -276,11 +285,31 @@ func (c *Conversation) processRevealSig(msg []byte) (err error) {
 	return nil
 }
 
+// revealCommittedGx decrypts the gx the peer sent in the DH-Commit message using the revealed r,
+// and checks that it hashes to the commitment in that message. If it doesn't, the peer chose gx
+// after seeing our gy, and errBadGxCommitment is returned
+func (c *Conversation) revealCommittedGx(r []byte) (*big.Int, error) {
+	decryptedGx := make([]byte, len(c.ake.encryptedGx))
+	if err := decrypt(r, decryptedGx, c.ake.encryptedGx); err != nil {
+		return nil, err
+	}
+
+	if err := checkDecryptedGx(decryptedGx, c.ake.xhashedGx, c.version); err != nil {
+		return nil, err
+	}
+
+	return extractGx(decryptedGx)
+}
+
 // processSig = bob = x
 // Alice -- Signature -----------> Bob
 func (c *Conversation) processSig(msg []byte) (err error) {
+	if err = c.checkAKEVersion(); err != nil {
+		return
+	}
+
 	sigMsg := sig{}
-	err = sigMsg.deserialize(msg)
+	err = sigMsg.deserialize(msg, c.FieldLimits())
 	if err != nil {
 		return
 	}
@@ -313,7 +342,7 @@ func verifyEncryptedSignatureMAC(encryptedSig []byte, theirMAC []byte, keys *ake
 
 	myMAC := sumHMAC(keys.m2, tomac, v)[:v.truncateLength()]
 
-	if len(myMAC) != len(theirMAC) || subtle.ConstantTimeCompare(myMAC, theirMAC) == 0 {
+	if !equalConstantTime(myMAC, theirMAC) {
 		return newOtrError("bad signature MAC in encrypted signature")
 	}
 
@@ -334,10 +363,20 @@ func (c *Conversation) parseTheirKey(key []byte) (sig []byte, keyID uint32, err
 }
 
 func (c *Conversation) expectedMessageHMAC(keyID uint32, keys *akeKeys) []byte {
-	verifyData := appendAll(c.ake.theirPublicValue, c.ake.ourPublicValue, c.theirKey, keyID)
+	verifyData := encodeM(c.ake.theirPublicValue, c.ake.ourPublicValue, c.theirKey, keyID)
 	return sumHMAC(keys.m1, verifyData, c.version)
 }
 
+// checkAKEVersion makes sure the conversation is still on the protocol version the AKE was started with,
+// before the signatures are checked. Otherwise a query message could switch the conversation to another version
+// in the middle of the AKE, and the AKE could be finished with messages spliced in from that version
+func (c *Conversation) checkAKEVersion() error {
+	if c.ake.version != nil && c.ake.version.protocolVersion() != c.version.protocolVersion() {
+		return errAKEVersionMismatch
+	}
+	return nil
+}
+
 func (c *Conversation) processEncryptedSig(encryptedSig []byte, theirMAC []byte, keys *akeKeys) error {
 	if err := verifyEncryptedSignatureMAC(encryptedSig, theirMAC, keys, c.version); err != nil {
 		return err
@@ -370,7 +409,7 @@ func extractGx(decryptedGx []byte) (*big.Int, error) {
 	}
 
 	if !isGroupElement(gx) {
-		return gx, newOtrError("DH value out of range")
+		return gx, errDHValueOutOfRange
 	}
 
 	return gx, nil
@@ -385,8 +424,8 @@ func sumHMAC(key, data []byte, v otrVersion) []byte {
 func checkDecryptedGx(decryptedGx, hashedGx []byte, v otrVersion) error {
 	digest := v.hash2(decryptedGx)
 
-	if subtle.ConstantTimeCompare(digest[:], hashedGx[:]) == 0 {
-		return newOtrError("bad commit MAC in reveal signature message")
+	if !equalConstantTime(digest[:], hashedGx[:]) {
+		return errBadGxCommitment
 	}
 
 	return nil
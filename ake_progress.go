@@ -0,0 +1,42 @@
+package otr3
+
+// AKEProgress describes how far the establishment of a private conversation has come.
+// It covers the current establishment or, once that has finished, the last one, so a
+// client can show something like "still trying to establish a private conversation (attempt 3)".
+type AKEProgress struct {
+	// Attempts is the number of AKEs started, by us or by the peer
+	Attempts int
+	// MessagesSent is the number of AKE messages we have sent, including retransmissions
+	MessagesSent int
+	// MessagesReceived is the number of AKE messages we have received
+	MessagesReceived int
+	// Finished is true once one of the attempts has led to a private conversation
+	Finished bool
+}
+
+// AKEProgress returns how far the establishment of the private conversation has come
+func (c *Conversation) AKEProgress() AKEProgress {
+	return c.akeProgress
+}
+
+func (c *Conversation) akeAttemptStarted() {
+	if c.akeProgress.Finished {
+		c.akeProgress = AKEProgress{}
+	}
+	c.akeProgress.Attempts++
+}
+
+func (c *Conversation) akeMessageSent() {
+	c.akeProgress.MessagesSent++
+}
+
+func (c *Conversation) akeMessageReceived(msgType byte) {
+	if msgType == msgTypeDHCommit {
+		c.akeAttemptStarted()
+	}
+	c.akeProgress.MessagesReceived++
+}
+
+func (c *Conversation) akeProgressFinished() {
+	c.akeProgress.Finished = true
+}
@@ -0,0 +1,44 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+func Test_AKEProgress_isEmptyForANewConversation(t *testing.T) {
+	c := &Conversation{}
+
+	assertDeepEquals(t, c.AKEProgress(), AKEProgress{})
+}
+
+func Test_AKEProgress_countsTheAttemptsAndMessagesOfAnUnansweredAKE(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.Policies = Policies(PolicyAllowV3)
+	c.SetOurKeys([]PrivateKey{alicePrivateKey})
+
+	c.Receive(ValidMessage("?OTRv3?"))
+	assertDeepEquals(t, c.AKEProgress(), AKEProgress{Attempts: 1, MessagesSent: 1})
+
+	c.ake.lastStateChange = c.ake.lastStateChange.Add(-2 * TransportProfileRealtime.AKETimeout)
+	c.Receive(ValidMessage("?OTRv3?"))
+	assertDeepEquals(t, c.AKEProgress(), AKEProgress{Attempts: 2, MessagesSent: 2})
+}
+
+func Test_AKEProgress_countsTheMessagesOfASuccessfulAKE(t *testing.T) {
+	alice, bob := benchmarkConversations()
+
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	assertDeepEquals(t, alice.AKEProgress(), AKEProgress{Attempts: 1, MessagesSent: 2, MessagesReceived: 2, Finished: true})
+	assertDeepEquals(t, bob.AKEProgress(), AKEProgress{Attempts: 1, MessagesSent: 2, MessagesReceived: 2, Finished: true})
+}
+
+func Test_AKEProgress_startsOverWithANewAttemptAfterFinishing(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	bob.lastMessageStateChange = bob.lastMessageStateChange.Add(-2 * TransportProfileRealtime.AKETimeout)
+	bob.Receive(alice.QueryMessage())
+
+	assertDeepEquals(t, bob.AKEProgress(), AKEProgress{Attempts: 1, MessagesSent: 1})
+}
@@ -374,7 +374,7 @@ func Test_calcAKEKeys(t *testing.T) {
 	bob.initAKE()
 	bob.calcAKEKeys(expectedSharedSecret)
 
-	assertDeepEquals(t, bob.ssid[:], bytesFromHex("9cee5d2c7edbc86d"))
+	assertDeepEquals(t, bob.ake.ssid[:], bytesFromHex("9cee5d2c7edbc86d"))
 	assertDeepEquals(t, bob.ake.revealKey.c, bytesFromHex("5745340b350364a02a0ac1467a318dcc"))
 	assertDeepEquals(t, bob.ake.sigKey.c, bytesFromHex("d942cc80b66503414c05e3752d9ba5c4"))
 	assertDeepEquals(t, bob.ake.revealKey.m1, bytesFromHex("d3251498fb9d977d07392a96eafb8c048d6bc67064bd7da72aa38f20f87a2e3d"))
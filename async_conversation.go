@@ -0,0 +1,202 @@
+package otr3
+
+import "sync"
+
+// AsyncConversation runs a conversation on a goroutine of its own, and delivers what the conversation
+// produces on channels instead of returning it: the messages to send to the peer on Outgoing, the
+// plaintext received from the peer on Plaintext, and the events and errors on Events. Programs built
+// around a network loop - like bots and bridges - can select on these channels instead of threading the
+// results of Send and Receive through their call sites.
+//
+// The conversation is owned by the goroutine of the AsyncConversation from the moment it is wrapped, and
+// its event handlers are replaced by ones delivering to Events. All three channels have to be read, since
+// the conversation waits for room on a channel before it goes on with the next message. Send, Receive and Do
+// never wait for that - they only queue the message - so they can be called from the same goroutine that reads
+// the channels.
+type AsyncConversation struct {
+	queueLock sync.Mutex
+	queue     []func(*Conversation)
+	queued    chan struct{}
+
+	outgoing  chan ValidMessage
+	plaintext chan MessagePlaintext
+	events    chan interface{}
+
+	closing   chan struct{}
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+// AsyncSMPEvent is delivered on Events for every SMPEvent of the conversation
+type AsyncSMPEvent struct {
+	Event           SMPEvent
+	ProgressPercent int
+	Question        string
+}
+
+// AsyncMessageEvent is delivered on Events for every MessageEvent of the conversation
+type AsyncMessageEvent struct {
+	Event   MessageEvent
+	Message []byte
+	Err     error
+	Trace   []interface{}
+}
+
+// NewAsyncConversation starts running the conversation on a goroutine of its own. The channels
+// can buffer the given number of values each. The AsyncConversation should be stopped with
+// Close when not needed anymore.
+func NewAsyncConversation(c *Conversation, buffer int) *AsyncConversation {
+	a := &AsyncConversation{
+		queued:    make(chan struct{}, 1),
+		outgoing:  make(chan ValidMessage, buffer),
+		plaintext: make(chan MessagePlaintext, buffer),
+		events:    make(chan interface{}, buffer),
+		closing:   make(chan struct{}),
+		closed:    make(chan struct{}),
+	}
+
+	c.SetSecurityEventHandler(dynamicSecurityEventHandler{func(event SecurityEvent) {
+		a.event(event)
+	}})
+	c.SetSMPEventHandler(dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		a.event(AsyncSMPEvent{Event: event, ProgressPercent: progressPercent, Question: question})
+	}})
+	c.SetMessageEventHandler(dynamicMessageEventHandler{func(event MessageEvent, message []byte, err error, trace ...interface{}) {
+		a.event(AsyncMessageEvent{Event: event, Message: makeCopy(message), Err: err, Trace: trace})
+	}})
+
+	go a.run(c)
+
+	return a
+}
+
+// Outgoing returns the channel the messages to send to the peer are delivered on, in the order they should be sent.
+// It is closed when the AsyncConversation is closed.
+func (a *AsyncConversation) Outgoing() <-chan ValidMessage {
+	return a.outgoing
+}
+
+// Plaintext returns the channel the plaintext received from the peer is delivered on.
+// It is closed when the AsyncConversation is closed.
+func (a *AsyncConversation) Plaintext() <-chan MessagePlaintext {
+	return a.plaintext
+}
+
+// Events returns the channel the events of the conversation are delivered on. Every value is one of SecurityEvent,
+// AsyncSMPEvent or AsyncMessageEvent - or an error returned by the conversation. It is closed when the
+// AsyncConversation is closed.
+func (a *AsyncConversation) Events() <-chan interface{} {
+	return a.events
+}
+
+// Send sends the message in the conversation, delivering the results on the channels.
+// It returns an error if the AsyncConversation has been closed.
+func (a *AsyncConversation) Send(m ValidMessage, trace ...interface{}) error {
+	m = makeCopy(m)
+	return a.Do(func(c *Conversation) ([]ValidMessage, error) {
+		return c.Send(m, trace...)
+	})
+}
+
+// Receive receives the message from the peer, delivering the results on the channels.
+// It returns an error if the AsyncConversation has been closed.
+func (a *AsyncConversation) Receive(m ValidMessage) error {
+	m = makeCopy(m)
+	return a.Do(func(c *Conversation) ([]ValidMessage, error) {
+		plain, toSend, err := c.Receive(m)
+		if len(plain) > 0 {
+			select {
+			case a.plaintext <- plain:
+			case <-a.closing:
+			}
+		}
+		return toSend, err
+	})
+}
+
+// Do calls the function with the conversation on the goroutine of the AsyncConversation - for example to
+// start SMP or end the conversation. The messages it returns are delivered on Outgoing and the error on Events.
+// The function is queued and Do returns right away. It returns an error if the AsyncConversation has been closed.
+func (a *AsyncConversation) Do(f func(c *Conversation) ([]ValidMessage, error)) error {
+	req := func(c *Conversation) {
+		toSend, err := f(c)
+		for _, m := range toSend {
+			select {
+			case a.outgoing <- m:
+			case <-a.closing:
+				return
+			}
+		}
+		if err != nil {
+			a.event(err)
+		}
+	}
+
+	select {
+	case <-a.closing:
+		return errAsyncConversationClosed
+	default:
+	}
+
+	a.queueLock.Lock()
+	a.queue = append(a.queue, req)
+	a.queueLock.Unlock()
+
+	select {
+	case a.queued <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// next takes the queued requests off the queue
+func (a *AsyncConversation) next() []func(*Conversation) {
+	a.queueLock.Lock()
+	defer a.queueLock.Unlock()
+
+	reqs := a.queue
+	a.queue = nil
+	return reqs
+}
+
+// Close stops the goroutine of the AsyncConversation and closes the channels. Messages that haven't
+// been handled yet are dropped.
+func (a *AsyncConversation) Close() {
+	a.closeOnce.Do(func() {
+		close(a.closing)
+	})
+	<-a.closed
+}
+
+func (a *AsyncConversation) run(c *Conversation) {
+	defer func() {
+		close(a.outgoing)
+		close(a.plaintext)
+		close(a.events)
+		close(a.closed)
+	}()
+
+	for {
+		select {
+		case <-a.queued:
+		case <-a.closing:
+			return
+		}
+
+		for _, req := range a.next() {
+			select {
+			case <-a.closing:
+				return
+			default:
+			}
+			req(c)
+		}
+	}
+}
+
+func (a *AsyncConversation) event(e interface{}) {
+	select {
+	case a.events <- e:
+	case <-a.closing:
+	}
+}
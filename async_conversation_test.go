@@ -0,0 +1,146 @@
+package otr3
+
+import (
+	"testing"
+	"time"
+)
+
+// pumpUntil passes the outgoing messages of each conversation to the other one, until the condition holds for an event
+func pumpUntil(t *testing.T, alice, bob *AsyncConversation, done func(event interface{}) bool) {
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case m := <-alice.Outgoing():
+			assertNil(t, bob.Receive(m))
+		case m := <-bob.Outgoing():
+			assertNil(t, alice.Receive(m))
+		case e := <-alice.Events():
+			if done(e) {
+				return
+			}
+		case <-timeout:
+			t.Fatal("timed out")
+		}
+	}
+}
+
+func asyncConversations(t *testing.T) (alice, bob *AsyncConversation) {
+	a, b := benchmarkConversations()
+	alice = NewAsyncConversation(a, 100)
+	bob = NewAsyncConversation(b, 100)
+
+	assertNil(t, alice.Do(func(c *Conversation) ([]ValidMessage, error) {
+		return []ValidMessage{c.QueryMessage()}, nil
+	}))
+	pumpUntil(t, alice, bob, func(e interface{}) bool { return e == GoneSecure })
+	// the signature message finishes the AKE for bob
+	assertNil(t, bob.Receive(<-alice.Outgoing()))
+	assertEquals(t, <-bob.Events(), GoneSecure)
+
+	return alice, bob
+}
+
+func Test_AsyncConversation_deliversTheResultsOfTheAKEOnTheChannels(t *testing.T) {
+	alice, bob := asyncConversations(t)
+	defer alice.Close()
+	defer bob.Close()
+
+	encrypted := make(chan bool, 1)
+	assertNil(t, bob.Do(func(c *Conversation) ([]ValidMessage, error) {
+		encrypted <- c.IsEncrypted()
+		return nil, nil
+	}))
+	assertEquals(t, <-encrypted, true)
+}
+
+func Test_AsyncConversation_deliversThePlaintextReceived(t *testing.T) {
+	alice, bob := asyncConversations(t)
+	defer alice.Close()
+	defer bob.Close()
+
+	assertNil(t, alice.Send(ValidMessage("hello")))
+	assertNil(t, bob.Receive(<-alice.Outgoing()))
+
+	assertDeepEquals(t, <-bob.Plaintext(), MessagePlaintext("hello"))
+}
+
+func Test_AsyncConversation_deliversSMPEvents(t *testing.T) {
+	alice, bob := asyncConversations(t)
+	defer alice.Close()
+	defer bob.Close()
+
+	assertNil(t, bob.Do(func(c *Conversation) ([]ValidMessage, error) {
+		return c.StartAuthenticate("where?", []byte("the park"))
+	}))
+	assertNil(t, alice.Receive(<-bob.Outgoing()))
+
+	pumpUntil(t, alice, bob, func(e interface{}) bool {
+		return e == AsyncSMPEvent{Event: SMPEventAskForAnswer, ProgressPercent: 25, Question: "where?"}
+	})
+}
+
+func Test_AsyncConversation_deliversErrorsAsEvents(t *testing.T) {
+	a, _ := benchmarkConversations()
+	a.Policies.RequireEncryption()
+	alice := NewAsyncConversation(a, 10)
+	defer alice.Close()
+
+	assertNil(t, alice.Do(func(c *Conversation) ([]ValidMessage, error) {
+		return nil, errCannotRefreshUnencrypted
+	}))
+
+	assertEquals(t, <-alice.Events(), error(errCannotRefreshUnencrypted))
+}
+
+func Test_AsyncConversation_closeClosesTheChannels(t *testing.T) {
+	a, _ := benchmarkConversations()
+	alice := NewAsyncConversation(a, 0)
+
+	alice.Close()
+
+	_, ok := <-alice.Outgoing()
+	assertEquals(t, ok, false)
+	_, ok = <-alice.Plaintext()
+	assertEquals(t, ok, false)
+	_, ok = <-alice.Events()
+	assertEquals(t, ok, false)
+	assertEquals(t, alice.Send(ValidMessage("hello")), errAsyncConversationClosed)
+}
+
+func Test_AsyncConversation_closeDoesntWaitForChannelsNobodyReads(t *testing.T) {
+	a, _ := benchmarkConversations()
+	alice := NewAsyncConversation(a, 0)
+
+	assertNil(t, alice.Do(func(c *Conversation) ([]ValidMessage, error) {
+		return []ValidMessage{c.QueryMessage()}, nil
+	}))
+	alice.Close()
+	alice.Close()
+}
+
+func Test_AsyncConversation_sendDoesntWaitForTheChannelsToBeRead(t *testing.T) {
+	a, b := benchmarkConversations()
+	exchangeUntilQuiet(t, a, b, []ValidMessage{a.QueryMessage()})
+	alice := NewAsyncConversation(a, 1)
+	defer alice.Close()
+
+	sent := make(chan struct{})
+	go func() {
+		for i := 0; i < 3; i++ {
+			alice.Send(ValidMessage("hello"))
+		}
+		close(sent)
+	}()
+
+	select {
+	case <-sent:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Send waited for Outgoing to be read")
+	}
+
+	for i := 0; i < 3; i++ {
+		plain, _, err := b.Receive(<-alice.Outgoing())
+		assertNil(t, err)
+		assertDeepEquals(t, plain, MessagePlaintext("hello"))
+	}
+}
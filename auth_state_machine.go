@@ -1,26 +1,48 @@
 package otr3
 
-import (
-	"bytes"
-	"time"
-
-	"github.com/coyim/gotrax"
-)
+import "bytes"
 
 const minimumMessageLength = 3 // length of protocol version (SHORT) and message type (BYTE)
 
 func (c *Conversation) generateNewDHKeyPair() error {
-	return c.keys.generateNewDHKeyPair(c.rand())
+	return c.keys.generateNewDHKeyPair(c.ephemeralKeys(), c.version)
 }
 
 func (c *Conversation) akeHasFinished() error {
-	c.keys.wipe()
+	// The new key pair is generated before anything changes, so the AKE can be finished again if it fails
+	next, err := randomDHKeyPair(c.ephemeralKeys(), c.version)
+	if err != nil {
+		return err
+	}
+
+	c.finishAKE(next)
+	return nil
+}
+
+func (c *Conversation) finishAKE(next dhKeyPair) {
+	if c.msgState == encrypted {
+		c.keepPreviousKeys()
+	} else {
+		c.wipePreviousKeys()
+		c.keys.wipe()
+	}
 	c.keys = c.ake.keys
+	c.ssid = c.ake.ssid
+	c.abandonSMPOfPreviousSession()
+	role := c.ake.role
 	c.ake.wipe(false)
+	c.ake.finished = true
 
 	previousMsgState := c.msgState
-	c.lastMessageStateChange = time.Now()
-	c.msgState = encrypted
+	c.lastMessageStateChange = c.now()
+	c.setMsgState(encrypted, "AKE finished")
+	c.sessionEnd = SessionEnd{}
+	c.sessionBegan(role)
+	c.timelineEvent(TimelineAKEFinished)
+	c.theirInstanceTagIsTentative = false
+	c.akeProgressFinished()
+	defer c.checkTheirFingerprint()
+	defer c.signalExpectedKey()
 	defer c.signalSecurityEventIf(previousMsgState != encrypted, GoneSecure)
 	defer c.signalSecurityEventIf(previousMsgState == encrypted, StillSecure)
 
@@ -28,31 +50,45 @@ func (c *Conversation) akeHasFinished() error {
 		c.messageEvent(MessageEventMessageReflected)
 	}
 
-	return c.generateNewDHKeyPair()
+	c.keys.useNewDHKeyPair(next)
 }
 
 func (c *Conversation) processAKE(msgType byte, msg []byte) (toSend []messageWithHeader, err error) {
 	c.ensureAKE()
+	c.akeMessageReceived(msgType)
 
 	var toSendSingle messageWithHeader
 	var toSendExtra []messageWithHeader
 
+	from := c.ake.state
+	to, trigger := from, ""
+
 	switch msgType {
 	case msgTypeDHCommit:
-		c.ake.state, toSendSingle, err = c.ake.state.receiveDHCommitMessage(c, msg)
+		trigger = "receive D-H Commit"
+		to, toSendSingle, err = from.receiveDHCommitMessage(c, msg)
 	case msgTypeDHKey:
-		c.ake.state, toSendSingle, err = c.ake.state.receiveDHKeyMessage(c, msg)
+		trigger = "receive D-H Key"
+		to, toSendSingle, err = from.receiveDHKeyMessage(c, msg)
 	case msgTypeRevealSig:
-		c.ake.state, toSendSingle, err = c.ake.state.receiveRevealSigMessage(c, msg)
+		trigger = "receive Reveal Signature"
+		to, toSendSingle, err = from.receiveRevealSigMessage(c, msg)
 		toSendExtra, _ = c.maybeRetransmit()
 	case msgTypeSig:
-		c.ake.state, toSendSingle, err = c.ake.state.receiveSigMessage(c, msg)
+		trigger = "receive Signature"
+		to, toSendSingle, err = from.receiveSigMessage(c, msg)
 		toSendExtra, _ = c.maybeRetransmit()
 	default:
 		err = newOtrErrorf("unknown message type 0x%X", msgType)
 	}
 
-	c.ake.lastStateChange = time.Now()
+	c.setAuthState(from, to, trigger)
+	c.ake.lastStateChange = c.now()
+	c.releaseFinishedAKE()
+
+	if len(toSendSingle) > 0 {
+		c.akeMessageSent()
+	}
 
 	messages := append([]messageWithHeader{toSendSingle}, toSendExtra...)
 	toSend = compactMessagesWithHeader(messages...)
@@ -60,6 +96,15 @@ func (c *Conversation) processAKE(msgType byte, msg []byte) (toSend []messageWit
 	return
 }
 
+// releaseFinishedAKE lets go of an AKE that has finished. Its keys have been moved to the conversation
+// and everything else in it has been wiped, so there is no reason to keep it for the whole private conversation.
+// A new AKE starts from scratch anyway.
+func (c *Conversation) releaseFinishedAKE() {
+	if c.ake != nil && c.ake.finished {
+		c.ake = nil
+	}
+}
+
 type authStateBase struct{}
 type authStateNone struct{ authStateBase }
 type authStateAwaitingDHKey struct{ authStateBase }
@@ -70,6 +115,74 @@ type authStateAwaitingSig struct {
 	revealSigMsg messageWithHeader
 }
 
+var authStateMachine = registerStateMachine("authentication", authStateNone{},
+	authStateNone{}, authStateAwaitingDHKey{}, authStateAwaitingRevealSig{}, authStateAwaitingSig{}).
+	on("send D-H Commit",
+		from(authStateNone{}, authStateAwaitingDHKey{}),
+		from(authStateAwaitingDHKey{}, authStateAwaitingDHKey{}),
+		from(authStateAwaitingRevealSig{}, authStateAwaitingDHKey{}),
+		from(authStateAwaitingSig{}, authStateAwaitingDHKey{})).
+	on("receive D-H Commit",
+		from(authStateNone{}, authStateAwaitingRevealSig{}),
+		from(authStateAwaitingDHKey{}, authStateAwaitingRevealSig{}),
+		from(authStateAwaitingRevealSig{}, authStateAwaitingRevealSig{}),
+		from(authStateAwaitingSig{}, authStateAwaitingRevealSig{})).
+	on("receive D-H Key",
+		from(authStateNone{}, authStateNone{}),
+		from(authStateAwaitingDHKey{}, authStateAwaitingSig{}),
+		from(authStateAwaitingRevealSig{}, authStateAwaitingRevealSig{}),
+		from(authStateAwaitingSig{}, authStateAwaitingSig{})).
+	on("receive Reveal Signature",
+		from(authStateNone{}, authStateNone{}),
+		from(authStateAwaitingDHKey{}, authStateAwaitingDHKey{}),
+		from(authStateAwaitingRevealSig{}, authStateNone{}),
+		from(authStateAwaitingSig{}, authStateAwaitingSig{})).
+	on("receive Signature",
+		from(authStateNone{}, authStateNone{}),
+		from(authStateAwaitingDHKey{}, authStateAwaitingDHKey{}),
+		from(authStateAwaitingRevealSig{}, authStateAwaitingRevealSig{}),
+		from(authStateAwaitingSig{}, authStateNone{})).
+	on("end conversation",
+		from(authStateNone{}, authStateNone{}),
+		from(authStateAwaitingDHKey{}, authStateNone{}),
+		from(authStateAwaitingRevealSig{}, authStateNone{}),
+		from(authStateAwaitingSig{}, authStateNone{})).
+	on("receive disconnected TLV",
+		from(authStateNone{}, authStateNone{}),
+		from(authStateAwaitingDHKey{}, authStateNone{}),
+		from(authStateAwaitingRevealSig{}, authStateNone{}),
+		from(authStateAwaitingSig{}, authStateNone{})).
+	on("peer offline",
+		from(authStateNone{}, authStateNone{}),
+		from(authStateAwaitingDHKey{}, authStateNone{}),
+		from(authStateAwaitingRevealSig{}, authStateNone{}),
+		from(authStateAwaitingSig{}, authStateNone{})).
+	on("hand over to instance",
+		from(authStateAwaitingDHKey{}, authStateNone{}),
+		from(authStateNone{}, authStateAwaitingDHKey{}))
+
+// authState returns the state of the AKE, which is NONE when there is no AKE
+func (c *Conversation) authState() authState {
+	if c.ake == nil {
+		return authStateNone{}
+	}
+	return c.ake.state
+}
+
+// setAuthState changes the state of the AKE from the state it was in before the trigger, which is one of
+// the events of the state graph. Handling the event can replace the AKE, so the state before is given.
+func (c *Conversation) setAuthState(from, to authState, trigger string) {
+	c.recordTransition(authStateMachine, from, to, trigger)
+	c.ake.state = to
+}
+
+// dropAKE wipes and forgets the AKE because of the trigger, which is one of the events of the state graph
+func (c *Conversation) dropAKE(trigger string) {
+	c.recordTransition(authStateMachine, c.authState(), authStateNone{}, trigger)
+	c.ake.wipe(true)
+	c.ake = nil
+}
+
 type authState interface {
 	receiveDHCommitMessage(*Conversation, []byte) (authState, messageWithHeader, error)
 	receiveDHKeyMessage(*Conversation, []byte) (authState, messageWithHeader, error)
@@ -84,18 +197,22 @@ func (authStateBase) receiveDHCommitMessage(c *Conversation, msg []byte) (authSt
 }
 
 func (s authStateNone) receiveDHCommitMessage(c *Conversation, msg []byte) (authState, messageWithHeader, error) {
-	c.ake.wipe(true)
+	previous := c.ake
 
 	dhKeyMsg, err := c.dhKeyMessage()
-	if err != nil {
-		return s, nil, err
+	if err == nil {
+		dhKeyMsg, err = c.wrapMessageHeader(msgTypeDHKey, dhKeyMsg)
 	}
 
-	dhKeyMsg, err = c.wrapMessageHeader(msgTypeDHKey, dhKeyMsg)
 	if err != nil {
-		return s, nil, err
+		// The AKE in progress, if any, continues as if nothing happened
+		c.ake.wipe(true)
+		c.ake = previous
+		return previous.state, nil, err
 	}
 
+	previous.wipe(true)
+
 	if err = c.processDHCommit(msg); err != nil {
 		return s, nil, err
 	}
@@ -122,15 +239,15 @@ func (s authStateAwaitingRevealSig) receiveDHCommitMessage(c *Conversation, msg
 }
 
 func (s authStateAwaitingDHKey) receiveDHCommitMessage(c *Conversation, msg []byte) (authState, messageWithHeader, error) {
-	newMsg, _, ok1 := gotrax.ExtractData(msg)
-	_, theirHashedGx, ok2 := gotrax.ExtractData(newMsg)
+	l := c.FieldLimits()
+	newMsg, _, err1 := l.extractData(msg)
+	_, theirHashedGx, err2 := l.extractData(newMsg)
 
-	if !ok1 || !ok2 {
-		return s, nil, errInvalidOTRMessage
+	if err := firstError(err1, err2); err != nil {
+		return s, nil, fieldError(err, errInvalidOTRMessage)
 	}
 
-	gxMPI := gotrax.AppendMPI(nil, c.ake.ourPublicValue)
-	hashedGx := c.version.hash2(gxMPI)
+	hashedGx := c.version.hash2(encodeGx(c.ake.ourPublicValue))
 	//If yours is the higher hash value:
 	//Ignore the incoming D-H Commit message, but resend your D-H Commit message.
 	if bytes.Compare(hashedGx[:], theirHashedGx) == 1 {
@@ -198,7 +315,19 @@ func (s authStateNone) receiveRevealSigMessage(c *Conversation, msg []byte) (aut
 }
 
 func (s authStateAwaitingRevealSig) receiveRevealSigMessage(c *Conversation, msg []byte) (authState, messageWithHeader, error) {
-	err := c.processRevealSig(msg)
+	// The new key pair is generated before anything changes, so a failure leaves the AKE where it was
+	next, err := randomDHKeyPair(c.ephemeralKeys(), c.version)
+	if err != nil {
+		return s, nil, err
+	}
+
+	err = c.processRevealSig(msg)
+
+	if err == errBadGxCommitment {
+		// The peer didn't reveal the gx they committed to, so nothing from this AKE can be trusted
+		c.ake.wipe(true)
+		return authStateNone{}, nil, err
+	}
 
 	if err != nil {
 		return s, nil, err
@@ -218,8 +347,9 @@ func (s authStateAwaitingRevealSig) receiveRevealSigMessage(c *Conversation, msg
 	c.ake.keys.setOurCurrentDHKeys(c.ake.secretExponent, c.ake.ourPublicValue)
 
 	c.sentRevealSig = false
+	c.finishAKE(next)
 
-	return authStateNone{}, sigMsg, c.akeHasFinished()
+	return authStateNone{}, sigMsg, nil
 }
 
 func (s authStateAwaitingDHKey) receiveRevealSigMessage(c *Conversation, msg []byte) (authState, messageWithHeader, error) {
@@ -252,7 +382,11 @@ func (s authStateAwaitingSig) receiveSigMessage(c *Conversation, msg []byte) (au
 	//gy was stored when we receive DH-Key
 	c.ake.keys.setTheirCurrentDHPubKey(c.ake.theirPublicValue)
 
-	return authStateNone{}, nil, c.akeHasFinished()
+	if err := c.akeHasFinished(); err != nil {
+		return s, nil, err
+	}
+
+	return authStateNone{}, nil, nil
 }
 
 func (authStateNone) String() string              { return "AUTHSTATE_NONE" }
@@ -262,7 +262,7 @@ func Test_receiveRevealSig_AtAwaitingRevealSig_savesAKEKeysToConversationAndGene
 	assertDeepEquals(t, c.keys.ourPreviousDHKeys.priv, fixedY())
 
 	//should wipe
-	assertDeepEquals(t, c.ake, &ake{state: c.ake.state})
+	assertDeepEquals(t, c.ake, &ake{state: c.ake.state, finished: true})
 
 	assertEquals(t, c.keys.ourKeyID, uint32(2))
 	assertEquals(t, c.keys.theirKeyID, uint32(1))
@@ -270,7 +270,7 @@ func Test_receiveRevealSig_AtAwaitingRevealSig_savesAKEKeysToConversationAndGene
 
 func Test_authStateAwaitingRevealSig_receiveRevealSigMessage_returnsErrorIfProcessRevealSigFails(t *testing.T) {
 	c := newConversation(otrV2{}, fixtureRand())
-	c.Policies.add(allowV2)
+	c.Policies.Add(PolicyAllowV2)
 	_, _, err := authStateAwaitingRevealSig{}.receiveRevealSigMessage(c, []byte{0x00, 0x00})
 	assertDeepEquals(t, err, newOtrError("corrupt reveal signature message"))
 }
@@ -490,7 +490,7 @@ func Test_authStateAwaitingSig_receiveDHKeyMessage_returnsErrorIfprocessDHKeyRet
 
 func Test_authStateAwaitingSig_receiveSigMessage_returnsErrorIfProcessSigFails(t *testing.T) {
 	c := newConversation(otrV2{}, fixtureRand())
-	c.Policies.add(allowV2)
+	c.Policies.Add(PolicyAllowV2)
 	_, _, err := authStateAwaitingSig{}.receiveSigMessage(c, []byte{0x00, 0x00})
 	assertEquals(t, err, newOtrError("corrupt signature message"))
 }
@@ -639,7 +639,7 @@ func Test_akeHasFinished_willSignalThatWeHaveGoneSecureIfWeHaveRefreshed(t *test
 }
 
 func Test_akeHasFinished_wipesAKEKeys(t *testing.T) {
-	c := &Conversation{}
+	c := &Conversation{version: otrV3{}}
 	c.ourCurrentKey = bobPrivateKey
 	c.theirKey = bobPrivateKey.PublicKey()
 
@@ -669,5 +669,59 @@ func Test_akeHasFinished_wipesAKEKeys(t *testing.T) {
 
 	c.akeHasFinished()
 
-	assertDeepEquals(t, *c.ake, ake{state: c.ake.state})
+	assertDeepEquals(t, *c.ake, ake{state: c.ake.state, finished: true})
+}
+
+func Test_processAKE_releasesTheAKEOnceItHasFinished(t *testing.T) {
+	alice, bob := benchmarkConversations()
+
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	assertTrue(t, alice.IsEncrypted())
+	assertTrue(t, bob.IsEncrypted())
+	assertNil(t, alice.ake)
+	assertNil(t, bob.ake)
+}
+
+func assertAKEIsWiped(t *testing.T, a *ake) {
+	assertNil(t, a.secretExponent)
+	assertNil(t, a.ourPublicValue)
+	assertNil(t, a.theirPublicValue)
+	assertDeepEquals(t, a.r, [16]byte{})
+	assertNil(t, a.encryptedGx)
+	assertNil(t, a.xhashedGx)
+	assertDeepEquals(t, a.ssid, [8]byte{})
+	assertDeepEquals(t, a.revealKey, akeKeys{})
+	assertDeepEquals(t, a.sigKey, akeKeys{})
+	assertDeepEquals(t, a.keys, keyManagementContext{})
+}
+
+func Test_processAKE_wipesEverythingInTheAKEOnceItHasFinished(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	_, dhCommit, _ := bob.Receive(alice.QueryMessage())
+	_, dhKey, _ := alice.Receive(dhCommit[0])
+	_, revealSig, _ := bob.Receive(dhKey[0])
+	aliceAKE := alice.ake
+
+	_, sig, _ := alice.Receive(revealSig[0])
+	bobAKE := bob.ake
+	bob.Receive(sig[0])
+
+	assertTrue(t, alice.IsEncrypted())
+	assertTrue(t, bob.IsEncrypted())
+	assertAKEIsWiped(t, aliceAKE)
+	assertAKEIsWiped(t, bobAKE)
+}
+
+func Test_processAKE_startsANewAKEFromScratchAfterTheLastOneWasReleased(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+
+	runNewAKE(t, alice, bob)
+
+	assertNil(t, alice.ake)
+	assertNil(t, bob.ake)
+	msg, _ := bob.Send(ValidMessage("after the new AKE"))
+	plain, _, err := alice.Receive(msg[0])
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("after the new AKE"))
 }
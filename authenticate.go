@@ -37,9 +37,31 @@ func (c *Conversation) AbortAuthentication() ([]ValidMessage, error) {
 	return msgs, err
 }
 
+// SMPState returns the name of the state the SMP state machine is in, such as SMPSTATE_EXPECT1 when no SMP
+// exchange is in progress. SMPSTATE_WAITINGFORSECRET means the peer has started SMP and is waiting for
+// ProvideAuthenticationSecret to be called.
+func (c *Conversation) SMPState() string {
+	if c.smp.state == nil {
+		return smpStateExpect1{}.String()
+	}
+	return c.smp.state.String()
+}
+
+// ResetSMP forgets any SMP exchange in progress without sending anything to the peer, leaving the private
+// conversation as it is. It can be used to recover when the exchange can't continue, for example because the
+// question was lost before the user answered it. If the conversation is encrypted, AbortAuthentication should
+// usually be preferred, since it also tells the peer that the exchange is over.
+func (c *Conversation) ResetSMP() {
+	c.wipeSMP("reset SMP")
+	c.smp.state = smpStateExpect1{}
+}
+
+// potentialAuthError signals an AKE that couldn't be started. The messages queued for the private
+// conversation are dropped, since there is no AKE that could lead to one.
 func (c *Conversation) potentialAuthError(toSend []messageWithHeader, err error) ([]messageWithHeader, error) {
 	if err != nil {
 		c.messageEventWithError(MessageEventSetupError, err)
+		c.dropQueuedMessages(err)
 	}
 
 	return toSend, err
@@ -7,7 +7,26 @@ func Test_StartAuthenticate_failsIfWeAreNotCurrentlyEncrypted(t *testing.T) {
 	c.msgState = plainText
 
 	_, e := c.StartAuthenticate("", []byte("hello world"))
-	assertEquals(t, e, errCantAuthenticateWithoutEncryption)
+	assertEquals(t, e, ErrAuthenticationNotInPrivate)
+}
+
+func Test_StartAuthenticate_signalsThatWeAreNotInAPrivateConversation(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	c.msgState = plainText
+
+	c.expectSMPEvent(t, func() {
+		c.StartAuthenticate("", []byte("hello world"))
+	}, SMPEventNotInPrivate, 0, "")
+}
+
+func Test_StartAuthenticate_doesNotChangeTheSMPStateIfWeAreNotCurrentlyEncrypted(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	c.msgState = finished
+
+	toSend, _ := c.StartAuthenticate("", []byte("hello world"))
+
+	assertNil(t, toSend)
+	assertEquals(t, c.smp.state, smpStateExpect1{})
 }
 
 func Test_StartAuthenticate_failsIfThereIsntEnoughRandomness(t *testing.T) {
@@ -106,7 +125,28 @@ func Test_ProvideAuthenticationSecret_failsIfWeAreNotCurrentlyEncrypted(t *testi
 	c.smp.state = smpStateWaitingForSecret{msg: fixtureMessage1()}
 
 	_, e := c.ProvideAuthenticationSecret([]byte("hello world"))
-	assertEquals(t, e, errCantAuthenticateWithoutEncryption)
+	assertEquals(t, e, ErrAuthenticationNotInPrivate)
+}
+
+func Test_ProvideAuthenticationSecret_signalsThatWeAreNotInAPrivateConversation(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = plainText
+	c.smp.state = smpStateWaitingForSecret{msg: fixtureMessage1()}
+
+	c.expectSMPEvent(t, func() {
+		c.ProvideAuthenticationSecret([]byte("hello world"))
+	}, SMPEventNotInPrivate, 0, "")
+}
+
+func Test_processSMPTLV_rejectsSMPMessagesOutsideOfAPrivateConversation(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = finished
+
+	toSend, err := c.processSMPTLV(fixtureMessage1().tlv(), dataMessageExtra{})
+
+	assertNil(t, toSend)
+	assertEquals(t, err, ErrAuthenticationNotInPrivate)
+	assertEquals(t, c.smp.state, smpStateExpect1{})
 }
 
 func Test_ProvideAuthenticationSecret_generatesAnSMPSecretFromTheSharedSecret(t *testing.T) {
@@ -172,7 +212,7 @@ func Test_ProvideAuthenticationSecret_returnsFailureFromContinueSMP(t *testing.T
 	c.smp.state = smpStateWaitingForSecret{msg: fixtureMessage1()}
 
 	_, e := c.ProvideAuthenticationSecret([]byte("hello world"))
-	assertEquals(t, e, errCantAuthenticateWithoutEncryption)
+	assertEquals(t, e, ErrAuthenticationNotInPrivate)
 }
 
 func Test_AbortAuthentication_generatesSMPAbortMessage(t *testing.T) {
@@ -203,3 +243,68 @@ func Test_AbortAuthentication_generatesErrorWhenNoEncryptedChannelExists(t *test
 
 	assertEquals(t, e, errCannotSendUnencrypted)
 }
+
+func Test_SMPState_returnsExpect1WhenNoSMPHasBeenStarted(t *testing.T) {
+	c := &Conversation{}
+
+	assertEquals(t, c.SMPState(), "SMPSTATE_EXPECT1")
+}
+
+func Test_SMPState_followsTheProgressOfTheExchange(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	toSend, _ := alice.StartAuthenticate("where did we meet?", []byte("the park"))
+	assertEquals(t, alice.SMPState(), "SMPSTATE_EXPECT2")
+
+	bob.Receive(toSend[0])
+	assertEquals(t, bob.SMPState(), "SMPSTATE_WAITINGFORSECRET")
+}
+
+func Test_ResetSMP_forgetsTheExchangeInProgressWithoutEndingThePrivateConversation(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	toSend, _ := alice.StartAuthenticate("where did we meet?", []byte("the park"))
+	bob.Receive(toSend[0])
+
+	bob.ResetSMP()
+
+	assertEquals(t, bob.SMPState(), "SMPSTATE_EXPECT1")
+	_, hasQuestion := bob.SMPQuestion()
+	assertFalse(t, hasQuestion)
+	assertNil(t, bob.smp.secret)
+	assertTrue(t, bob.IsEncrypted())
+	_, err := bob.ProvideAuthenticationSecret([]byte("the park"))
+	assertEquals(t, err, errNotWaitingForSMPSecret)
+}
+
+func Test_ResetSMP_letsANewExchangeBeStarted(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	toSend, _ := alice.StartAuthenticate("", []byte("the park"))
+	bob.Receive(toSend[0])
+	alice.ResetSMP()
+	bob.ResetSMP()
+	succeeded := false
+	alice.SetSMPEventHandler(dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		succeeded = succeeded || event == SMPEventSuccess
+	}})
+
+	toSend, _ = alice.StartAuthenticate("", []byte("the park"))
+	exchangeUntilQuiet(t, alice, bob, toSend)
+	toSend, _ = bob.ProvideAuthenticationSecret([]byte("the park"))
+	exchangeUntilQuiet(t, bob, alice, toSend)
+
+	assertTrue(t, succeeded)
+	assertEquals(t, alice.SMPState(), "SMPSTATE_EXPECT1")
+	assertEquals(t, bob.SMPState(), "SMPSTATE_EXPECT1")
+}
+
+func Test_ResetSMP_worksWhenNotEncrypted(t *testing.T) {
+	c := &Conversation{}
+	c.smp.state = smpStateExpect3{}
+
+	c.ResetSMP()
+
+	assertEquals(t, c.SMPState(), "SMPSTATE_EXPECT1")
+}
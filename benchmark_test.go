@@ -0,0 +1,110 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+// The benchmarks in this file can be run with:
+//  go test -run XXX -bench . -benchmem
+// The output is in the standard Go benchmark format, so results from two
+// revisions can be compared using a tool like benchstat. Baseline numbers
+// for the current revision can be regenerated with "make bench", which
+// writes them to bench.txt.
+
+func benchmarkEncryptedConversations(b *testing.B) (alice, bob *Conversation) {
+	alice, bob = benchmarkConversations()
+	exchangeUntilQuiet(b, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	if !alice.IsEncrypted() || !bob.IsEncrypted() {
+		b.Fatal("couldn't establish an encrypted conversation")
+	}
+
+	alice.updateLastSent()
+	bob.updateLastSent()
+
+	return alice, bob
+}
+
+func BenchmarkAKE(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		benchmarkEncryptedConversations(b)
+	}
+}
+
+func BenchmarkSendDataMessage(b *testing.B) {
+	alice, _ := benchmarkEncryptedConversations(b)
+	msg := ValidMessage("Hello, this is a message of a fairly normal length")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := alice.Send(msg); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkReceiveDataMessage(b *testing.B) {
+	alice, bob := benchmarkEncryptedConversations(b)
+	msg := ValidMessage("Hello, this is a message of a fairly normal length")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		toSend, err := alice.Send(msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+
+		if _, _, err := bob.Receive(toSend[0]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFragment(b *testing.B) {
+	c := newConversation(otrV3{}, rand.Reader)
+	data := encodedMessage(make([]byte, 10000))
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.fragment(data, 400)
+	}
+}
+
+func BenchmarkReceiveFragments(b *testing.B) {
+	alice, bob := benchmarkEncryptedConversations(b)
+	alice.SetFragmentSize(400)
+	toSend, err := alice.Send(make(ValidMessage, 5000))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, f := range toSend {
+			bob.receiveFragment(fragmentationContext{}, f)
+		}
+	}
+}
+
+func BenchmarkSMP(b *testing.B) {
+	alice, bob := benchmarkEncryptedConversations(b)
+	secret := []byte("the secret")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		toSend, err := alice.StartAuthenticate("", secret)
+		if err != nil {
+			b.Fatal(err)
+		}
+		exchangeUntilQuiet(b, alice, bob, toSend)
+
+		toSend, err = bob.ProvideAuthenticationSecret(secret)
+		if err != nil {
+			b.Fatal(err)
+		}
+		exchangeUntilQuiet(b, bob, alice, toSend)
+	}
+}
@@ -0,0 +1,48 @@
+package otr3
+
+import (
+	"math/big"
+
+	"github.com/coyim/gotrax"
+)
+
+// The functions in this file produce the encodings of all the data that is
+// signed, MACed or hashed during the AKE, the key derivations and SMP. Every
+// code path that needs one of these encodings uses the functions here, so that
+// the sending and the receiving side always work on exactly the same bytes.
+
+// encodeGx returns MPI(g^x), the value that is encrypted and hashed in the D-H Commit message
+func encodeGx(gx *big.Int) []byte {
+	return gotrax.AppendMPI(nil, gx)
+}
+
+// encodeM returns the data M_A or M_B is calculated from:
+// MPI(g^x), MPI(g^y), the public key and the key id of the signing side.
+// The public value of the signing side always comes first.
+func encodeM(signerPublicValue, otherPublicValue *big.Int, signerKey PublicKey, signerKeyID uint32) []byte {
+	out := gotrax.AppendMPI(nil, signerPublicValue)
+	out = gotrax.AppendMPI(out, otherPublicValue)
+	out = append(out, signerKey.serialize()...)
+	return gotrax.AppendWord(out, signerKeyID)
+}
+
+// encodeXWithoutSignature returns the beginning of X_A or X_B: the public key and the key id of the signing side.
+// The signature of M_A or M_B is appended to it.
+func encodeXWithoutSignature(signerKey PublicKey, signerKeyID uint32) []byte {
+	return gotrax.AppendWord(signerKey.serialize(), signerKeyID)
+}
+
+// encodeSharedSecret returns MPI(s), which all AKE and data message keys are derived from
+func encodeSharedSecret(s *big.Int) []byte {
+	return gotrax.AppendMPI(nil, s)
+}
+
+// encodeSMPHashInput returns the data hashed for the zero-knowledge proofs of SMP:
+// the version byte followed by the MPIs, in the order given
+func encodeSMPHashInput(version byte, mpis ...*big.Int) []byte {
+	out := []byte{version}
+	for _, mpi := range mpis {
+		out = gotrax.AppendMPI(out, mpi)
+	}
+	return out
+}
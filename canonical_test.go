@@ -0,0 +1,63 @@
+package otr3
+
+import (
+	"math/big"
+	"testing"
+)
+
+func Test_encodeGx_returnsTheMPIOfTheValue(t *testing.T) {
+	assertDeepEquals(t, encodeGx(big.NewInt(0x0102)), bytesFromHex("000000020102"))
+	assertDeepEquals(t, encodeGx(big.NewInt(0)), bytesFromHex("00000000"))
+}
+
+func Test_encodeM_returnsBothPublicValuesFollowedByTheKeyAndKeyIDOfTheSigner(t *testing.T) {
+	pub := alicePrivateKey.PublicKey()
+
+	expected := bytesFromHex("0000000105" + "000000020102")
+	expected = append(expected, pub.serialize()...)
+	expected = append(expected, bytesFromHex("00000003")...)
+
+	assertDeepEquals(t, encodeM(big.NewInt(5), big.NewInt(0x0102), pub, 3), expected)
+}
+
+func Test_encodeM_dependsOnTheOrderOfThePublicValues(t *testing.T) {
+	pub := alicePrivateKey.PublicKey()
+
+	assertNotEquals(t, string(encodeM(big.NewInt(5), big.NewInt(6), pub, 1)), string(encodeM(big.NewInt(6), big.NewInt(5), pub, 1)))
+}
+
+func Test_encodeXWithoutSignature_returnsTheKeyFollowedByTheKeyID(t *testing.T) {
+	pub := alicePrivateKey.PublicKey()
+
+	expected := append(pub.serialize(), bytesFromHex("00000001")...)
+
+	assertDeepEquals(t, encodeXWithoutSignature(pub, 1), expected)
+}
+
+func Test_encodeSharedSecret_returnsTheMPIOfTheSecret(t *testing.T) {
+	assertDeepEquals(t, encodeSharedSecret(big.NewInt(0xABCDEF)), bytesFromHex("00000003ABCDEF"))
+}
+
+func Test_encodeSMPHashInput_returnsTheVersionByteFollowedByTheMPIs(t *testing.T) {
+	assertDeepEquals(t, encodeSMPHashInput(1, big.NewInt(2), big.NewInt(0x0300)), bytesFromHex("01"+"0000000102"+"000000020300"))
+	assertDeepEquals(t, encodeSMPHashInput(8), []byte{0x08})
+}
+
+func Test_hashMPIs_hashesTheCanonicalSMPHashInput(t *testing.T) {
+	h := otrV3{}.hash2Instance()
+	h.Write(bytesFromHex("01" + "0000000102" + "000000020300"))
+	expected := h.Sum(nil)
+
+	assertDeepEquals(t, hashMPIs(otrV3{}.hash2Instance(), 1, big.NewInt(2), big.NewInt(0x0300)), expected)
+}
+
+func Test_serializeDHCommit_hashesTheCanonicalEncodingOfGx(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	c.initAKE()
+	gx := big.NewInt(0x0102)
+
+	dhCommitMsg := dhCommit{}
+	dhCommitMsg.deserialize(c.serializeDHCommit(gx), defaultFieldLimits)
+
+	assertDeepEquals(t, dhCommitMsg.yhashedGx, otrV3{}.hash2(bytesFromHex("000000020102")))
+}
@@ -0,0 +1,22 @@
+package otr3
+
+import "time"
+
+// Clock tells the current time. A conversation uses it to decide when to send heartbeats,
+// when to stop retransmitting messages and when an AKE has timed out, so replacing it makes
+// this timing testable.
+type Clock interface {
+	Now() time.Time
+}
+
+// SetClock sets the clock the conversation uses. If no clock is set, the system time is used.
+func (c *Conversation) SetClock(clock Clock) {
+	c.clock = clock
+}
+
+func (c *Conversation) now() time.Time {
+	if c.clock == nil {
+		return time.Now()
+	}
+	return c.clock.Now()
+}
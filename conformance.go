@@ -0,0 +1,466 @@
+package otr3
+
+import (
+	"bytes"
+	"crypto/dsa"
+	"io"
+	"regexp"
+)
+
+// ConformanceReport is the result of running the implementation against the requirements of the OTR
+// specification that it claims to follow. It is meant to be marshaled - for example to JSON - so that
+// packagers and auditors can keep it and compare it between releases.
+type ConformanceReport struct {
+	Results []ConformanceResult `json:"results"`
+	Passed  int                 `json:"passed"`
+	Failed  int                 `json:"failed"`
+}
+
+// ConformanceResult is the result of checking a single requirement. Category is one of
+// "message format", "state" and "policy".
+type ConformanceResult struct {
+	ID          string `json:"id"`
+	Category    string `json:"category"`
+	Requirement string `json:"requirement"`
+	Passed      bool   `json:"passed"`
+	Problem     string `json:"problem,omitempty"`
+}
+
+// CheckConformance runs every requirement in the checklist between two conversations kept in memory, using
+// the given keys for the two sides and the given source of randomness. Nothing is sent over the network.
+func CheckConformance(ours, theirs PrivateKey, rand io.Reader) ConformanceReport {
+	e := &conformanceEnvironment{ours: ours, theirs: theirs, rand: rand}
+	report := ConformanceReport{}
+
+	for _, cc := range conformanceChecklist {
+		result := ConformanceResult{ID: cc.id, Category: cc.category, Requirement: cc.requirement, Passed: true}
+		if err := cc.check(e); err != nil {
+			result.Passed = false
+			result.Problem = err.Error()
+			report.Failed++
+		} else {
+			report.Passed++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	return report
+}
+
+// GenerateConformanceKeys generates two DSA keys that can be used with CheckConformance.
+// The keys share their parameters, which makes generating them faster.
+func GenerateConformanceKeys(rand io.Reader) (ours, theirs PrivateKey, err error) {
+	var params dsa.Parameters
+	if err = dsa.GenerateParameters(&params, rand, dsa.L1024N160); err != nil {
+		return nil, nil, err
+	}
+
+	keys := make([]*DSAPrivateKey, 2)
+	for i := range keys {
+		keys[i] = &DSAPrivateKey{}
+		keys[i].PrivateKey.PublicKey.Parameters = params
+		if err = dsa.GenerateKey(&keys[i].PrivateKey, rand); err != nil {
+			return nil, nil, err
+		}
+		keys[i].DSAPublicKey.PublicKey = keys[i].PrivateKey.PublicKey
+	}
+
+	return keys[0], keys[1], nil
+}
+
+const (
+	conformanceMessageFormat = "message format"
+	conformanceState         = "state"
+	conformancePolicy        = "policy"
+)
+
+type conformanceCheck struct {
+	id, category, requirement string
+	check                     func(e *conformanceEnvironment) error
+}
+
+// conformanceChecklist is the embedded list of requirements that CheckConformance runs
+var conformanceChecklist = []conformanceCheck{
+	{"query-message", conformanceMessageFormat,
+		"a query message lists the allowed versions as ?OTRv23?",
+		checkQueryMessageFormat},
+	{"whitespace-tag", conformanceMessageFormat,
+		"plaintext sent with the send-whitespace-tag policy ends with the base tag followed by the tags of the allowed versions",
+		checkWhitespaceTagFormat},
+	{"data-message-encoding", conformanceMessageFormat,
+		"encoded messages start with ?OTR: followed by base64 and end with a period",
+		checkDataMessageEncoding},
+	{"v3-fragment-format", conformanceMessageFormat,
+		"OTRv3 fragments have the format ?OTR|sender|receiver,k,n,piece,",
+		checkFragmentFormat},
+	{"error-message", conformanceMessageFormat,
+		"messages starting with ?OTR Error: are reported as errors from the peer",
+		checkErrorMessage},
+	{"ake-v3", conformanceState,
+		"both sides go to the encrypted state with the same SSID after an OTRv3 AKE",
+		checkAKE(Policies(PolicyAllowV2 | PolicyAllowV3))},
+	{"ake-v2", conformanceState,
+		"both sides go to the encrypted state with the same SSID after an OTRv2 AKE",
+		checkAKE(Policies(PolicyAllowV2))},
+	{"refuse-v1", conformanceState,
+		"a peer that only offers OTRv1 is refused",
+		checkRefuseV1},
+	{"end-finishes", conformanceState,
+		"ending a private conversation puts the peer in the finished state, where messages are not sent",
+		checkEndFinishesPeer},
+	{"reject-replay", conformanceState,
+		"a data message that has already been received is rejected",
+		checkRejectReplay},
+	{"reject-tampered", conformanceState,
+		"a data message that has been changed in transit is rejected",
+		checkRejectTampered},
+	{"smp-success", conformanceState,
+		"SMP succeeds on both sides when the secrets are the same",
+		checkSMPSuccess},
+	{"smp-failure", conformanceState,
+		"SMP doesn't succeed on either side when the secrets are different",
+		checkSMPFailure},
+	{"require-encryption", conformancePolicy,
+		"with require-encryption, plaintext is never sent and a query message is sent instead",
+		checkRequireEncryption},
+	{"v2-disallowed", conformancePolicy,
+		"without allow-v2, an OTRv2 AKE is never started",
+		checkV2Disallowed},
+	{"whitespace-start-ake", conformancePolicy,
+		"with whitespace-start-ake, a whitespace tag starts the AKE",
+		checkWhitespaceStartAKE},
+	{"error-start-ake", conformancePolicy,
+		"with error-start-ake, an error message is answered with a query message",
+		checkErrorStartAKE},
+}
+
+type conformanceEnvironment struct {
+	ours, theirs PrivateKey
+	rand         io.Reader
+}
+
+func (e *conformanceEnvironment) pair(p Policies) (alice, bob *Conversation) {
+	alice = &Conversation{Rand: e.rand, Policies: p}
+	alice.SetOurKeys([]PrivateKey{e.ours})
+	bob = &Conversation{Rand: e.rand, Policies: p}
+	bob.SetOurKeys([]PrivateKey{e.theirs})
+	return alice, bob
+}
+
+// conformanceExchangeLimit bounds the number of round trips, so a broken implementation can't loop forever
+const conformanceExchangeLimit = 20
+
+// exchange delivers the messages to the receiver and keeps passing the answers back and forth until no more messages are generated
+func (e *conformanceEnvironment) exchange(from, to *Conversation, msgs []ValidMessage) error {
+	for i := 0; len(msgs) > 0; i++ {
+		if i == conformanceExchangeLimit {
+			return newOtrError("the conversations kept sending messages to each other")
+		}
+
+		var next []ValidMessage
+		for _, m := range msgs {
+			_, toSend, err := to.Receive(m)
+			if err != nil {
+				return err
+			}
+			next = append(next, toSend...)
+		}
+		msgs = next
+		from, to = to, from
+	}
+	return nil
+}
+
+func (e *conformanceEnvironment) establish(p Policies) (alice, bob *Conversation, err error) {
+	alice, bob = e.pair(p)
+	if err = e.exchange(alice, bob, []ValidMessage{alice.QueryMessage()}); err != nil {
+		return nil, nil, err
+	}
+	if !alice.IsEncrypted() || !bob.IsEncrypted() {
+		return nil, nil, newOtrError("the AKE didn't make both sides encrypted")
+	}
+	return alice, bob, nil
+}
+
+func checkQueryMessageFormat(e *conformanceEnvironment) error {
+	alice, _ := e.pair(Policies(PolicyAllowV2 | PolicyAllowV3))
+	if q := alice.QueryMessage(); !bytes.HasPrefix(q, []byte("?OTRv23?")) {
+		return newOtrErrorf("got query message %q", q)
+	}
+	return nil
+}
+
+func checkWhitespaceTagFormat(e *conformanceEnvironment) error {
+	alice, _ := e.pair(Policies(PolicyAllowV2 | PolicyAllowV3 | PolicySendWhitespaceTag))
+	toSend, err := alice.Send(ValidMessage("hello"))
+	if err != nil {
+		return err
+	}
+
+	expected := append([]byte("hello"), whitespaceTagHeader...)
+	expected = append(expected, otrV2{}.whitespaceTag()...)
+	expected = append(expected, otrV3{}.whitespaceTag()...)
+	if len(toSend) == 0 || !bytes.Equal(toSend[0], expected) {
+		return newOtrErrorf("got %q", toSend)
+	}
+	return nil
+}
+
+var conformanceEncodedMessage = regexp.MustCompile(`^\?OTR:[A-Za-z0-9+/]+=*\.$`)
+
+func checkDataMessageEncoding(e *conformanceEnvironment) error {
+	alice, _, err := e.establish(Policies(PolicyAllowV2 | PolicyAllowV3))
+	if err != nil {
+		return err
+	}
+
+	toSend, err := alice.Send(ValidMessage("hello"))
+	if err != nil {
+		return err
+	}
+	if len(toSend) != 1 || !conformanceEncodedMessage.Match(toSend[0]) {
+		return newOtrErrorf("got %q", toSend)
+	}
+	return nil
+}
+
+var conformanceV3Fragment = regexp.MustCompile(`^\?OTR\|[0-9a-f]{8}\|[0-9a-f]{8},[0-9]{5},[0-9]{5},[^,]*,$`)
+
+func checkFragmentFormat(e *conformanceEnvironment) error {
+	alice, bob, err := e.establish(Policies(PolicyAllowV3))
+	if err != nil {
+		return err
+	}
+
+	alice.SetFragmentSize(100)
+	toSend, err := alice.Send(ValidMessage("a message that is long enough to need more than one fragment"))
+	if err != nil {
+		return err
+	}
+	if len(toSend) < 2 {
+		return newOtrErrorf("the message wasn't fragmented")
+	}
+	for _, f := range toSend {
+		if !conformanceV3Fragment.Match(f) {
+			return newOtrErrorf("got fragment %q", f)
+		}
+	}
+	return e.exchange(alice, bob, toSend)
+}
+
+func checkErrorMessage(e *conformanceEnvironment) error {
+	_, bob := e.pair(Policies(PolicyAllowV3))
+	received := false
+	bob.SetMessageEventHandler(dynamicMessageEventHandler{func(event MessageEvent, message []byte, err error, trace ...interface{}) {
+		if event == MessageEventReceivedMessageGeneralError && string(message) == "something went wrong" {
+			received = true
+		}
+	}})
+
+	plain, _, _ := bob.Receive(ValidMessage("?OTR Error: something went wrong"))
+	if !received || plain != nil {
+		return newOtrErrorf("the error message wasn't reported as an error from the peer")
+	}
+	return nil
+}
+
+func checkAKE(p Policies) func(e *conformanceEnvironment) error {
+	return func(e *conformanceEnvironment) error {
+		alice, bob, err := e.establish(p)
+		if err != nil {
+			return err
+		}
+		if alice.GetSSID() != bob.GetSSID() {
+			return newOtrErrorf("the two sides have different SSIDs")
+		}
+		return nil
+	}
+}
+
+func checkRefuseV1(e *conformanceEnvironment) error {
+	_, bob := e.pair(Policies(PolicyAllowV2 | PolicyAllowV3))
+	_, toSend, err := bob.Receive(ValidMessage("?OTR?"))
+	if err == nil || len(toSend) > 0 || bob.ake != nil {
+		return newOtrErrorf("the OTRv1 query message wasn't refused")
+	}
+	return nil
+}
+
+func checkEndFinishesPeer(e *conformanceEnvironment) error {
+	alice, bob, err := e.establish(Policies(PolicyAllowV2 | PolicyAllowV3))
+	if err != nil {
+		return err
+	}
+
+	toSend, err := alice.End()
+	if err != nil {
+		return err
+	}
+	if err = e.exchange(alice, bob, toSend); err != nil {
+		return err
+	}
+	if bob.msgState != finished {
+		return newOtrErrorf("the peer is in the %s state", bob.msgState.identityString())
+	}
+	if toSend, err = bob.Send(ValidMessage("hello")); err == nil || len(toSend) > 0 {
+		return newOtrErrorf("a message was sent in the finished state")
+	}
+	return nil
+}
+
+func checkRejectReplay(e *conformanceEnvironment) error {
+	alice, bob, err := e.establish(Policies(PolicyAllowV2 | PolicyAllowV3))
+	if err != nil {
+		return err
+	}
+
+	toSend, err := alice.Send(ValidMessage("hello"))
+	if err != nil {
+		return err
+	}
+	if _, _, err = bob.Receive(toSend[0]); err != nil {
+		return err
+	}
+	if plain, _, err := bob.Receive(toSend[0]); err == nil || plain != nil {
+		return newOtrErrorf("the replayed message was accepted")
+	}
+	return nil
+}
+
+func checkRejectTampered(e *conformanceEnvironment) error {
+	alice, bob, err := e.establish(Policies(PolicyAllowV2 | PolicyAllowV3))
+	if err != nil {
+		return err
+	}
+
+	toSend, err := alice.Send(ValidMessage("hello"))
+	if err != nil {
+		return err
+	}
+	decoded, err := alice.decode(encodedMessage(toSend[0]))
+	if err != nil {
+		return err
+	}
+	decoded[len(decoded)-30] ^= 0x01
+	if plain, _, err := bob.Receive(ValidMessage(alice.encode(decoded))); err == nil || plain != nil {
+		return newOtrErrorf("the tampered message was accepted")
+	}
+	return nil
+}
+
+// runSMP runs SMP between two new private conversations and returns the events that ended it on the two sides
+func (e *conformanceEnvironment) runSMP(ourSecret, theirSecret []byte) (ours, theirs SMPEvent, err error) {
+	alice, bob, err := e.establish(Policies(PolicyAllowV2 | PolicyAllowV3))
+	if err != nil {
+		return ours, theirs, err
+	}
+
+	ours, theirs = SMPEventInProgress, SMPEventInProgress
+	askedForSecret := false
+	alice.SetSMPEventHandler(dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		if event != SMPEventInProgress {
+			ours = event
+		}
+	}})
+	bob.SetSMPEventHandler(dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		if event == SMPEventAskForSecret {
+			askedForSecret = true
+		} else if event != SMPEventInProgress {
+			theirs = event
+		}
+	}})
+
+	toSend, err := alice.StartAuthenticate("", ourSecret)
+	if err != nil {
+		return ours, theirs, err
+	}
+	if err = e.exchange(alice, bob, toSend); err != nil {
+		return ours, theirs, err
+	}
+	if !askedForSecret {
+		return ours, theirs, newOtrError("the peer wasn't asked for the secret")
+	}
+
+	if toSend, err = bob.ProvideAuthenticationSecret(theirSecret); err != nil {
+		return ours, theirs, err
+	}
+	err = e.exchange(bob, alice, toSend)
+	return ours, theirs, err
+}
+
+func checkSMPSuccess(e *conformanceEnvironment) error {
+	ours, theirs, err := e.runSMP([]byte("same"), []byte("same"))
+	if err != nil {
+		return err
+	}
+	if ours != SMPEventSuccess || theirs != SMPEventSuccess {
+		return newOtrErrorf("SMP ended with %s and %s", ours, theirs)
+	}
+	return nil
+}
+
+func checkSMPFailure(e *conformanceEnvironment) error {
+	ours, theirs, err := e.runSMP([]byte("ours"), []byte("theirs"))
+	if err != nil {
+		return err
+	}
+	// The side that finds out about the failure aborts the exchange, so the other side is told about an abort
+	if theirs != SMPEventFailure || (ours != SMPEventFailure && ours != SMPEventAbort) {
+		return newOtrErrorf("SMP ended with %s and %s", ours, theirs)
+	}
+	return nil
+}
+
+func checkRequireEncryption(e *conformanceEnvironment) error {
+	alice, _ := e.pair(Policies(PolicyAllowV2 | PolicyAllowV3 | PolicyRequireEncryption))
+	toSend, err := alice.Send(ValidMessage("a secret"))
+	if err != nil {
+		return err
+	}
+	for _, m := range toSend {
+		if bytes.Contains(m, []byte("a secret")) {
+			return newOtrErrorf("the plaintext was sent")
+		}
+	}
+	if len(toSend) != 1 || guessMessageType(toSend[0]) != msgGuessQuery {
+		return newOtrErrorf("got %q instead of a query message", toSend)
+	}
+	return nil
+}
+
+func checkV2Disallowed(e *conformanceEnvironment) error {
+	_, bob := e.pair(Policies(PolicyAllowV3))
+	_, toSend, _ := bob.Receive(ValidMessage("?OTRv2?"))
+	if len(toSend) > 0 || bob.ake != nil {
+		return newOtrErrorf("an AKE was started for OTRv2")
+	}
+	return nil
+}
+
+func checkWhitespaceStartAKE(e *conformanceEnvironment) error {
+	alice, bob := e.pair(Policies(PolicyAllowV2 | PolicyAllowV3 | PolicySendWhitespaceTag | PolicyWhitespaceStartAKE))
+	toSend, err := alice.Send(ValidMessage("hello"))
+	if err != nil {
+		return err
+	}
+	plain, answer, err := bob.Receive(toSend[0])
+	if err != nil {
+		return err
+	}
+	if string(plain) != "hello" {
+		return newOtrErrorf("the message was received as %q", plain)
+	}
+	if len(answer) == 0 || guessMessageType(answer[0]) != msgGuessDHCommit {
+		return newOtrErrorf("got %q instead of a D-H Commit message", answer)
+	}
+	return nil
+}
+
+func checkErrorStartAKE(e *conformanceEnvironment) error {
+	_, bob := e.pair(Policies(PolicyAllowV2 | PolicyAllowV3 | PolicyErrorStartAKE))
+	_, toSend, _ := bob.Receive(ValidMessage("?OTR Error: something went wrong"))
+	if len(toSend) != 1 || guessMessageType(toSend[0]) != msgGuessQuery {
+		return newOtrErrorf("got %q instead of a query message", toSend)
+	}
+	return nil
+}
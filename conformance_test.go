@@ -0,0 +1,74 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+)
+
+func Test_CheckConformance_passesEveryRequirement(t *testing.T) {
+	report := CheckConformance(alicePrivateKey, bobPrivateKey, rand.Reader)
+
+	for _, r := range report.Results {
+		if !r.Passed {
+			t.Errorf("%s failed: %s", r.ID, r.Problem)
+		}
+	}
+	assertEquals(t, report.Passed, len(conformanceChecklist))
+	assertEquals(t, report.Failed, 0)
+}
+
+func Test_CheckConformance_reportsTheRequirementsInTheOrderOfTheChecklist(t *testing.T) {
+	report := CheckConformance(alicePrivateKey, bobPrivateKey, rand.Reader)
+
+	assertEquals(t, len(report.Results), len(conformanceChecklist))
+	for i, cc := range conformanceChecklist {
+		assertEquals(t, report.Results[i].ID, cc.id)
+		assertEquals(t, report.Results[i].Category, cc.category)
+		assertEquals(t, report.Results[i].Requirement, cc.requirement)
+	}
+}
+
+func Test_CheckConformance_reportsTheProblemOfAFailedRequirement(t *testing.T) {
+	report := CheckConformance(alicePrivateKey, bobPrivateKey, fixedRand([]string{"ABCD"}))
+
+	assertTrue(t, report.Failed > 0)
+	assertEquals(t, report.Passed+report.Failed, len(conformanceChecklist))
+	for _, r := range report.Results {
+		if !r.Passed {
+			assertTrue(t, r.Problem != "")
+		}
+	}
+}
+
+func Test_ConformanceReport_canBeMarshaledToJSON(t *testing.T) {
+	report := ConformanceReport{
+		Results: []ConformanceResult{
+			{ID: "query-message", Category: conformanceMessageFormat, Requirement: "a requirement", Passed: true},
+			{ID: "ake-v3", Category: conformanceState, Requirement: "another requirement", Problem: "it failed"},
+		},
+		Passed: 1,
+		Failed: 1,
+	}
+
+	data, err := json.Marshal(report)
+
+	assertNil(t, err)
+	assertEquals(t, string(data), `{"results":[`+
+		`{"id":"query-message","category":"message format","requirement":"a requirement","passed":true},`+
+		`{"id":"ake-v3","category":"state","requirement":"another requirement","passed":false,"problem":"it failed"}],`+
+		`"passed":1,"failed":1}`)
+}
+
+func Test_GenerateConformanceKeys_generatesKeysThatPassEveryRequirement(t *testing.T) {
+	if testing.Short() {
+		t.Skip("generating DSA parameters is slow")
+	}
+
+	ours, theirs, err := GenerateConformanceKeys(rand.Reader)
+	assertNil(t, err)
+
+	report := CheckConformance(ours, theirs, rand.Reader)
+
+	assertEquals(t, report.Failed, 0)
+}
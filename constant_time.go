@@ -0,0 +1,30 @@
+package otr3
+
+import (
+	"crypto/subtle"
+	"math/big"
+)
+
+// equalConstantTime returns true if the slices are equal, in time that only depends on their lengths.
+// It is used for every comparison of MACs, hashed commitments and SMP values, so the time it takes
+// doesn't leak how much of a forged value was right.
+func equalConstantTime(l, r []byte) bool {
+	return len(l) == len(r) && subtle.ConstantTimeCompare(l, r) == 1
+}
+
+// eqConstantTime returns true if the numbers are equal, in time that only depends on their sizes
+func eqConstantTime(l, r *big.Int) bool {
+	lb, rb := l.Bytes(), r.Bytes()
+	size := len(lb)
+	if len(rb) > size {
+		size = len(rb)
+	}
+
+	return l.Sign() == r.Sign() && equalConstantTime(padBytes(lb, size), padBytes(rb, size))
+}
+
+func padBytes(b []byte, size int) []byte {
+	padded := make([]byte, size)
+	copy(padded[size-len(b):], b)
+	return padded
+}
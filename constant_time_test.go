@@ -0,0 +1,54 @@
+package otr3
+
+import (
+	"math/big"
+	"testing"
+)
+
+func Test_equalConstantTime_comparesSlices(t *testing.T) {
+	assertTrue(t, equalConstantTime([]byte{1, 2, 3}, []byte{1, 2, 3}))
+	assertFalse(t, equalConstantTime([]byte{1, 2, 3}, []byte{1, 2, 4}))
+	assertFalse(t, equalConstantTime([]byte{1, 2, 3}, []byte{1, 2}))
+	assertTrue(t, equalConstantTime(nil, []byte{}))
+}
+
+func Test_eqConstantTime_comparesNumbers(t *testing.T) {
+	assertTrue(t, eqConstantTime(big.NewInt(0x1234), big.NewInt(0x1234)))
+	assertFalse(t, eqConstantTime(big.NewInt(0x1234), big.NewInt(0x34)))
+	assertFalse(t, eqConstantTime(big.NewInt(0x34), big.NewInt(0x1234)))
+	assertFalse(t, eqConstantTime(big.NewInt(-5), big.NewInt(5)))
+	assertTrue(t, eqConstantTime(big.NewInt(0), new(big.Int)))
+}
+
+func Test_equalConstantTime_isFalseWhetherTheFirstOrTheLastByteDiffers(t *testing.T) {
+	assertFalse(t, equalConstantTime([]byte{1, 2, 3}, []byte{0, 2, 3}))
+	assertFalse(t, equalConstantTime([]byte{1, 2, 3}, []byte{1, 2, 0}))
+}
+
+func Test_Receive_rejectsADataMessageWhoseMACDiffersInAnyByte(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	toSend, _ := alice.Send(ValidMessage("hello"))
+
+	// the MAC is followed by the length of the revealed MAC keys, of which there are none
+	for _, fromTheEnd := range []int{24, 14, 5} {
+		forged := (&hostilePeer{alice}).tamper(toSend[0], func(body []byte) []byte {
+			body[len(body)-fromTheEnd] ^= 0x01
+			return body
+		})
+
+		plain, _, err := bob.Receive(forged)
+
+		assertNotNil(t, err)
+		assertNil(t, plain)
+	}
+
+	plain, _, err := bob.Receive(toSend[0])
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+}
+
+func Test_StartAuthenticate_failsForSecretsThatOnlyDifferInTheirLastByte(t *testing.T) {
+	result := runSMPWithSecrets(t, SMPSecretNormalization{}, "secret1", "secret2")
+
+	assertEquals(t, result, SMPEventFailure)
+}
@@ -13,6 +13,23 @@ const (
 	finished
 )
 
+var messageStateMachine = registerStateMachine("message", plainText,
+	plainText, encrypted, finished).
+	on("AKE finished",
+		from(plainText, encrypted),
+		from(encrypted, encrypted),
+		from(finished, encrypted)).
+	on("receive disconnected TLV",
+		from(encrypted, finished)).
+	on("end conversation",
+		from(plainText, plainText),
+		from(encrypted, plainText),
+		from(finished, plainText)).
+	on("peer offline",
+		from(plainText, plainText),
+		from(encrypted, plainText),
+		from(finished, plainText))
+
 var (
 	queryMarker = []byte("?OTR")
 	errorMarker = []byte("?OTR Error:")
@@ -20,45 +37,107 @@ var (
 )
 
 // Conversation contains all the information for a specific connection between two peers in an IM system.
-// Policies are not supposed to change once a conversation has been used
+// It is the only conversation type of this package - every message is sent and received through it, directly
+// or through a Manager. The zero value is ready to use once the keys and Policies have been set, as shown
+// in the package documentation. NewConversationWithVersion also fixes the protocol version up front.
+// Policies are not supposed to change once a conversation has been used.
+// A conversation must not be used from several goroutines at the same time - SafeConversation can be used for that
 type Conversation struct {
+	conversationSettings
+
 	version otrVersion
 	Rand    io.Reader
+	// defaultRand is used while Rand isn't set. Every conversation has its own, so a source that failed
+	// its health test only stops this conversation
+	defaultRand *HealthCheckedReader
 
 	msgState        msgState
 	whitespaceState whitespaceState
 
 	lastMessageStateChange time.Time
+	sessionEnd             SessionEnd
+	sessionHistory         []SessionRecord
+	timeline               []TimelineEvent
 
 	ourInstanceTag   uint32
 	theirInstanceTag uint32
+	// theirInstanceTagIsTentative is true while their instance tag has only been learned from unauthenticated messages
+	theirInstanceTagIsTentative bool
+
+	// previousKeys are the keys of the session replaced by an AKE while encrypted, only used for reading
+	previousKeys *keyManagementContext
 
 	ssid          [8]byte
-	ourKeys       []PrivateKey
 	ourCurrentKey PrivateKey
 	theirKey      PublicKey
 
+	verification verificationContext
+
 	ake        *ake
 	smp        smp
 	keys       keyManagementContext
-	Policies   policies
+	secrets    secretScratch
+	Policies   Policies
 	heartbeat  heartbeatContext
 	resend     resendContext
 	injections injections
 
-	fragmentSize         uint16
+	akeProgress AKEProgress
+
 	fragmentationContext fragmentationContext
+	lastFragment         time.Time
+
+	deliveries deliveries
+
+	sentRevealSig bool
+
+	sentAdvertisedQuery bool
+
+	lastRefusedPlaintextReply time.Time
+
+	lastErrorStartAKE time.Time
+
+	// receivedPrivately is true if the last call to Receive decrypted an authenticated data message
+	receivedPrivately bool
+
+	unregisteredTransitions []unregisteredTransition
+}
+
+// conversationSettings are the settings of a conversation that a Manager gives every conversation it creates
+// for an instance of the peer. They are copied as a whole, so a new setting belongs here - unless it only
+// makes sense for one conversation.
+type conversationSettings struct {
+	ourKeys []PrivateKey
+
+	expectedFingerprints [][]byte
+	trustStore           TrustStore
+	trustStorePeer       string
+	trustOnSMPSuccess    bool
+
+	smpSecretNormalization SMPSecretNormalization
+	ephemeralKeyProvider   EphemeralKeyProvider
+
+	clock            Clock
+	fragmentSize     uint16
+	padding          Padding
+	fieldLimits      FieldLimits
+	transportProfile *TransportProfile
+	fragmentLimits   FragmentLimits
+	outboxLimits     OutboxLimits
 
 	smpEventHandler      SMPEventHandler
 	errorMessageHandler  ErrorMessageHandler
 	messageEventHandler  MessageEventHandler
 	securityEventHandler SecurityEventHandler
 	receivedKeyHandler   ReceivedKeyHandler
+	replyHandler         ReplyHandler
 
-	debug         bool
-	sentRevealSig bool
+	sender Sender
 
-	friendlyQueryMessage string
+	debug                 bool
+	friendlyQueryMessage  string
+	advertisement         Advertisement
+	refusedPlaintextReply string
 }
 
 // NewConversationWithVersion creates a new conversation with the given version
@@ -104,6 +183,12 @@ func (c *Conversation) wrapMessageHeader(msgType byte, msg []byte) (messageWithH
 	return append(header, msg...), nil
 }
 
+// setMsgState changes the message state because of the trigger, which is one of the events of the state graph
+func (c *Conversation) setMsgState(to msgState, trigger string) {
+	c.recordTransition(messageStateMachine, c.msgState, to, trigger)
+	c.msgState = to
+}
+
 // IsEncrypted returns true if the current conversation is private
 func (c *Conversation) IsEncrypted() bool {
 	return c.msgState == encrypted
@@ -114,21 +199,40 @@ func (c *Conversation) IsEncrypted() bool {
 func (c *Conversation) End() (toSend []ValidMessage, err error) {
 	previousMsgState := c.msgState
 	if c.msgState == encrypted {
-		c.smp.wipe()
+		c.wipeSMP("end conversation")
 		// Error can only happen when Rand reader is broken
 		toSend, _, err = c.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, []tlv{tlv{tlvType: tlvTypeDisconnected}})
 	}
 	c.lastMessageStateChange = time.Time{}
-	c.ake = nil
-	c.msgState = plainText
+	c.dropAKE("end conversation")
+	c.setMsgState(plainText, "end conversation")
+	c.sessionEnded(previousMsgState, EndedByUs)
 	defer c.signalSecurityEventIf(previousMsgState == encrypted, GoneInsecure)
 
-	c.keys.ourCurrentDHKeys.wipe()
-	c.keys.ourPreviousDHKeys.wipe()
-	wipeBigInt(c.keys.theirCurrentDHPubKey)
+	c.keys.wipe()
+	c.secrets.wipe()
+	c.wipePreviousKeys()
+	c.deliveries.wipe()
 	return
 }
 
+// Refresh starts a new AKE while the conversation is private, to get fresh session keys and check the peer
+// again. It returns the D-H Commit message to send. The conversation stays private with the current keys
+// until the AKE has finished, and then StillSecure is signaled instead of GoneSecure.
+func (c *Conversation) Refresh() ([]ValidMessage, error) {
+	if !c.IsEncrypted() {
+		return nil, errCannotRefreshUnencrypted
+	}
+
+	dhCommit, err := c.sendDHCommit()
+	toSend, err := c.potentialAuthError(compactMessagesWithHeader(dhCommit), err)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.encodeAndCombine(toSend), nil
+}
+
 // SetOurKeys assigns our private keys to the conversation
 func (c *Conversation) SetOurKeys(ourKeys []PrivateKey) {
 	c.ourKeys = ourKeys
@@ -174,13 +278,31 @@ func (c *Conversation) SetSecurityEventHandler(handler SecurityEventHandler) {
 	c.securityEventHandler = handler
 }
 
+// SetReceivedKeyHandler assigns handler for extra symmetric keys the peer asks us to use
+func (c *Conversation) SetReceivedKeyHandler(handler ReceivedKeyHandler) {
+	c.receivedKeyHandler = handler
+}
+
+// SetReplyHandler assigns handler that decides whether the messages Receive generates on its own are returned to be sent
+func (c *Conversation) SetReplyHandler(handler ReplyHandler) {
+	c.replyHandler = handler
+}
+
 // InitializeInstanceTag sets our instance tag for this conversation. If the argument is zero we will create a new instance tag and return it
-// The instance tag created or set will be returned
+// The instance tag created or set will be returned. If no instance tag could be created because the random source failed, zero is returned
+// and the conversation keeps not having one - it will try again the next time it needs one.
 func (c *Conversation) InitializeInstanceTag(tag uint32) uint32 {
 	if tag == 0 {
-		c.generateInstanceTag()
+		_ = c.generateInstanceTag()
 	} else {
 		c.ourInstanceTag = tag
 	}
 	return c.ourInstanceTag
 }
+
+// GetTheirInstanceTag returns the instance tag of the peer, which all OTRv3 messages we send are addressed to.
+// It is zero until it has been learned from a message of the peer, and it can still change until the AKE has
+// authenticated the peer - the second return value is true once it can't change anymore.
+func (c *Conversation) GetTheirInstanceTag() (uint32, bool) {
+	return c.theirInstanceTag, c.theirInstanceTag != 0 && !c.theirInstanceTagIsTentative
+}
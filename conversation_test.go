@@ -2,15 +2,16 @@ package otr3
 
 import (
 	"crypto/rand"
-	"math/big"
 	"testing"
+
+	"github.com/coyim/gotrax"
 )
 
 func Test_receive_OTRQueryMsgRepliesWithDHCommitMessage(t *testing.T) {
 	msg := []byte("?OTRv3?")
 	c := newConversation(nil, fixtureRand())
 	c.SetOurKeys([]PrivateKey{bobPrivateKey})
-	c.Policies.add(allowV3)
+	c.Policies.Add(PolicyAllowV3)
 
 	exp := messageWithHeader{
 		0x00, 0x03, // protocol version
@@ -29,7 +30,7 @@ func Test_receive_OTRQueryMsgChangesContextProtocolVersion(t *testing.T) {
 	msg := []byte("?OTRv3?")
 	c := newConversation(nil, fixtureRand())
 	c.SetOurKeys([]PrivateKey{bobPrivateKey})
-	c.Policies.add(allowV3)
+	c.Policies.Add(PolicyAllowV3)
 
 	_, _, err := c.Receive(msg)
 
@@ -100,7 +101,7 @@ func Test_receive_DHCommitMessageReturnsDHKeyForOTR3(t *testing.T) {
 	dhCommitMsg, _ = dhCommitAKE.wrapMessageHeader(msgTypeDHCommit, dhCommitMsg)
 
 	c := newConversation(otrV3{}, fixtureRand())
-	c.Policies.add(allowV3)
+	c.Policies.Add(PolicyAllowV3)
 
 	_, dhKeyMsg, err := c.receiveDecoded(dhCommitMsg)
 
@@ -138,7 +139,7 @@ func Test_Send_returnsErrorIfFaislToGenerateDataMsg(t *testing.T) {
 
 	c := bobContextAfterAKE()
 	c.msgState = encrypted
-	c.Policies = policies(allowV3)
+	c.Policies = Policies(PolicyAllowV3)
 	c.keys.theirKeyID = 0
 	s, err := c.Send(msg)
 
@@ -154,7 +155,7 @@ func Test_send_appendWhitespaceTagsWhenAllowedbyThePolicy(t *testing.T) {
 	}
 
 	c := &Conversation{}
-	c.Policies = policies(allowV3 | sendWhitespaceTag)
+	c.Policies = Policies(PolicyAllowV3 | PolicySendWhitespaceTag)
 
 	m, _ := c.Send([]byte("hello"))
 	wsPos := len(m[0]) - len(expectedWhitespaceTag)
@@ -164,7 +165,7 @@ func Test_send_appendWhitespaceTagsWhenAllowedbyThePolicy(t *testing.T) {
 func Test_send_doesNotAppendWhitespaceTagsWhenItsNotAllowedbyThePolicy(t *testing.T) {
 	m := []byte("hello")
 	c := &Conversation{}
-	c.Policies = policies(allowV3)
+	c.Policies = Policies(PolicyAllowV3)
 
 	toSend, _ := c.Send(m)
 	assertDeepEquals(t, toSend, []ValidMessage{m})
@@ -179,7 +180,7 @@ func Test_send_appendWhitespaceTagsIfReceivesNonDHCommitMsgBeforeSendingFirstMes
 	}
 
 	c := &Conversation{}
-	c.Policies = policies(allowV3 | sendWhitespaceTag)
+	c.Policies = Policies(PolicyAllowV3 | PolicySendWhitespaceTag)
 
 	_, _, err := c.Receive(ValidMessage("hi"))
 	assertNil(t, err)
@@ -198,7 +199,7 @@ func Test_send_stopAppendingWhitespaceTagsIfReceivesNonDHCommitMsg(t *testing.T)
 	}
 
 	c := &Conversation{}
-	c.Policies = policies(allowV3 | sendWhitespaceTag)
+	c.Policies = Policies(PolicyAllowV3 | PolicySendWhitespaceTag)
 
 	m, err := c.Send(hello)
 	assertNil(t, err)
@@ -216,7 +217,7 @@ func Test_send_dataMessageWhenItsMsgStateEncrypted(t *testing.T) {
 	m := []byte("hello")
 	c := bobContextAfterAKE()
 	c.msgState = encrypted
-	c.Policies = policies(allowV3)
+	c.Policies = Policies(PolicyAllowV3)
 	toSend, _ := c.Send(m)
 
 	stub := bobContextAfterAKE()
@@ -229,7 +230,7 @@ func Test_send_dataMessageWhenItsMsgStateEncrypted(t *testing.T) {
 
 func Test_encodeWithoutFragment(t *testing.T) {
 	c := newConversation(otrV2{}, fixtureRand())
-	c.Policies = policies(allowV2 | allowV3 | whitespaceStartAKE)
+	c.Policies = Policies(PolicyAllowV2 | PolicyAllowV3 | PolicyWhitespaceStartAKE)
 	c.SetFragmentSize(64)
 
 	msg := c.fragEncode([]byte("one two three"))
@@ -242,7 +243,7 @@ func Test_encodeWithoutFragment(t *testing.T) {
 
 func Test_encodeWithoutFragmentTooSmall(t *testing.T) {
 	c := newConversation(otrV2{}, fixtureRand())
-	c.Policies = policies(allowV2 | allowV3 | whitespaceStartAKE)
+	c.Policies = Policies(PolicyAllowV2 | PolicyAllowV3 | PolicyWhitespaceStartAKE)
 	c.SetFragmentSize(18)
 
 	msg := c.fragEncode([]byte("one two three"))
@@ -255,7 +256,7 @@ func Test_encodeWithoutFragmentTooSmall(t *testing.T) {
 
 func Test_encodeWithFragment(t *testing.T) {
 	c := newConversation(otrV2{}, fixtureRand())
-	c.Policies = policies(allowV2 | allowV3 | whitespaceStartAKE)
+	c.Policies = Policies(PolicyAllowV2 | PolicyAllowV3 | PolicyWhitespaceStartAKE)
 	c.SetFragmentSize(22)
 
 	msg := c.fragEncode([]byte("one two three"))
@@ -362,14 +363,63 @@ func Test_End_wipesKeys(t *testing.T) {
 	stub := bobContextAfterAKE()
 	stub.createSerializedDataMessage(nil, messageFlagIgnoreUnreadable, []tlv{tlv{tlvType: tlvTypeDisconnected}})
 
-	assertDeepEquals(t, dhKeyPair{}, bob.keys.ourCurrentDHKeys)
-	assertDeepEquals(t, dhKeyPair{}, bob.keys.ourPreviousDHKeys)
-	assertDeepEquals(t, eq(bob.keys.theirCurrentDHPubKey, big.NewInt(0)), true)
+	assertDeepEquals(t, bob.keys, keyManagementContext{})
+	assertNil(t, bob.ake)
+}
+
+func Test_Refresh_failsIfTheConversationIsNotPrivate(t *testing.T) {
+	alice, _ := benchmarkConversations()
+
+	toSend, err := alice.Refresh()
+
+	assertNil(t, toSend)
+	assertEquals(t, err, errCannotRefreshUnencrypted)
+	assertNil(t, alice.ake)
+}
+
+func Test_Refresh_returnsADHCommitMessage(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	toSend, err := alice.Refresh()
+
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 1)
+	assertEquals(t, guessMessageType(toSend[0]), msgGuessDHCommit)
+	assertEquals(t, alice.ake.state, authStateAwaitingDHKey{})
+	assertTrue(t, alice.IsEncrypted())
+}
+
+func Test_Refresh_signalsStillSecureOnBothSidesWhenTheAKEFinishes(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	aliceEvents := collectSecurityEvents(alice)
+	bobEvents := collectSecurityEvents(bob)
+
+	toSend, _ := alice.Refresh()
+	exchangeUntilQuiet(t, alice, bob, toSend)
+
+	assertDeepEquals(t, *aliceEvents, []SecurityEvent{StillSecure})
+	assertDeepEquals(t, *bobEvents, []SecurityEvent{StillSecure})
+	assertTrue(t, alice.IsEncrypted())
+	assertTrue(t, bob.IsEncrypted())
+}
+
+func Test_Refresh_givesNewSessionKeys(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	before := alice.GetSSID()
+
+	toSend, _ := alice.Refresh()
+	exchangeUntilQuiet(t, alice, bob, toSend)
+
+	assertFalse(t, alice.GetSSID() == before)
+	assertEquals(t, alice.GetSSID(), bob.GetSSID())
 }
 
 func Test_receive_canDecodeOTRMessagesWithoutFragments(t *testing.T) {
 	c := newConversation(otrV2{}, rand.Reader)
-	c.Policies.add(allowV2)
+	c.Policies.Add(PolicyAllowV2)
 
 	dhCommitMsg := []byte("?OTR:AAICAAAAxPWaCOvRNycg72w2shQjcSEiYjcTh+w7rq+48UM9mpZIkpN08jtTAPcc8/9fcx9mmlVy/We+n6/G65RvobYWPoY+KD9Si41TFKku34gU4HaBbwwa7XpB/4u1gPCxY6EGe0IjthTUGK2e3qLf9YCkwJ1lm+X9kPOS/Jqu06V0qKysmbUmuynXG8T5Q8rAIRPtA/RYMqSGIvfNcZfrlJRIw6M784YtWlF3i2B6dmtjMrjH/8x5myN++Q2bxh69g6z/WX1rAFoAAAAg7Vwgf3JoiH5MdRznnS3aL66tjxQzN5qiwLtImE+KFnM=.")
 	_, _, err := c.Receive(dhCommitMsg)
@@ -381,7 +431,7 @@ func Test_receive_canDecodeOTRMessagesWithoutFragments(t *testing.T) {
 
 func Test_receive_ignoresMessagesWithWrongInstanceTags(t *testing.T) {
 	bob := newConversation(otrV3{}, rand.Reader)
-	bob.Policies.add(allowV3)
+	bob.Policies.Add(PolicyAllowV3)
 	bob.ourCurrentKey = bobPrivateKey
 
 	var msg []byte
@@ -398,7 +448,7 @@ func Test_receive_ignoresMessagesWithWrongInstanceTags(t *testing.T) {
 func Test_receive_doesntDisplayErrorMessageToTheUser(t *testing.T) {
 	msg := []byte("?OTR Error:You are wrong")
 	c := &Conversation{}
-	c.Policies.add(allowV3)
+	c.Policies.Add(PolicyAllowV3)
 	plain, toSend, err := c.Receive(msg)
 
 	assertNil(t, err)
@@ -409,8 +459,8 @@ func Test_receive_doesntDisplayErrorMessageToTheUser(t *testing.T) {
 func Test_receive_doesntDisplayErrorMessageToTheUserAndStartAKE(t *testing.T) {
 	msg := []byte("?OTR Error:You are wrong")
 	c := &Conversation{}
-	c.Policies.add(allowV3)
-	c.Policies.add(errorStartAKE)
+	c.Policies.Add(PolicyAllowV3)
+	c.Policies.Add(PolicyErrorStartAKE)
 	plain, toSend, err := c.Receive(msg)
 
 	assertEquals(t, err, nil)
@@ -418,6 +468,49 @@ func Test_receive_doesntDisplayErrorMessageToTheUserAndStartAKE(t *testing.T) {
 	assertDeepEquals(t, toSend[0], ValidMessage("?OTRv3?"))
 }
 
+func Test_receive_doesntStartAKEAgainForErrorMessagesReceivedShortlyAfter(t *testing.T) {
+	msg := []byte("?OTR Error:You are wrong")
+	c := &Conversation{}
+	c.Policies.Add(PolicyAllowV3)
+	c.Policies.Add(PolicyErrorStartAKE)
+	c.Receive(msg)
+
+	plain, toSend, err := c.Receive(msg)
+
+	assertNil(t, err)
+	assertNil(t, plain)
+	assertNil(t, toSend)
+}
+
+func Test_receive_startsAKEAgainForAnErrorMessageReceivedAfterTheInterval(t *testing.T) {
+	msg := []byte("?OTR Error:You are wrong")
+	c := &Conversation{}
+	c.Policies.Add(PolicyAllowV3)
+	c.Policies.Add(PolicyErrorStartAKE)
+	c.Receive(msg)
+	c.lastErrorStartAKE = c.lastErrorStartAKE.Add(-errorStartAKEInterval)
+
+	_, toSend, _ := c.Receive(msg)
+
+	assertDeepEquals(t, toSend, []ValidMessage{ValidMessage("?OTRv3?")})
+}
+
+func Test_receive_twoPeersThatOnlySendErrorsDontSendQueriesForever(t *testing.T) {
+	alice := &Conversation{Policies: Policies(PolicyAllowV3 | PolicyErrorStartAKE)}
+	bob := &Conversation{Policies: Policies(PolicyAllowV3 | PolicyErrorStartAKE)}
+	errorMessage := ValidMessage("?OTR Error: something went wrong")
+
+	queries := 0
+	for i := 0; i < 10; i++ {
+		for _, c := range []*Conversation{alice, bob} {
+			_, toSend, _ := c.Receive(errorMessage)
+			queries += len(toSend)
+		}
+	}
+
+	assertEquals(t, queries, 2)
+}
+
 func Test_Conversation_GetTheirKey_getsTheirKey(t *testing.T) {
 	c := &Conversation{theirKey: bobPrivateKey.PublicKey()}
 	assertEquals(t, c.GetTheirKey(), bobPrivateKey.PublicKey())
@@ -428,6 +521,42 @@ func Test_Conversation_GetSSID_getsTheSSID(t *testing.T) {
 	assertEquals(t, c.GetSSID(), [8]byte{0xAB, 0xCD, 0xAB, 0xCD, 0xDD, 0xDD, 0xCC, 0xC0})
 }
 
+func Test_Conversation_GetTheirInstanceTag_isZeroBeforeItIsLearned(t *testing.T) {
+	c := &Conversation{}
+
+	tag, final := c.GetTheirInstanceTag()
+
+	assertEquals(t, tag, uint32(0))
+	assertFalse(t, final)
+}
+
+func Test_Conversation_GetTheirInstanceTag_isLearnedFromTheDHKeyMessageAndFinalAfterTheAKE(t *testing.T) {
+	alice, bob, dhKey := akeUntil(2)
+	_, toBob, err := alice.Receive(dhKey)
+	assertNil(t, err)
+
+	tag, final := alice.GetTheirInstanceTag()
+	assertEquals(t, tag, bob.ourInstanceTag)
+	assertFalse(t, final)
+
+	exchangeUntilQuiet(t, alice, bob, toBob)
+
+	tag, final = alice.GetTheirInstanceTag()
+	assertEquals(t, tag, bob.ourInstanceTag)
+	assertTrue(t, final)
+}
+
+func Test_Conversation_messagesAfterTheAKEAreAddressedToTheirInstanceTag(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	toSend, _ := alice.Send(ValidMessage("hello"))
+	decoded, _ := alice.decode(encodedMessage(toSend[0]))
+	_, receiver, _ := gotrax.ExtractWord(decoded[7:])
+
+	assertEquals(t, receiver, bob.ourInstanceTag)
+}
+
 func Test_Conversation_SetSMPEventHandler_setSMPEventHandler(t *testing.T) {
 	c := &Conversation{}
 	ev := CombineSMPEventHandlers()
@@ -471,3 +600,10 @@ func Test_Conversation_InitializeInstanceTag_initializesTheInstanceTagFromRandom
 	assertEquals(t, c.ourInstanceTag, uint32(0xabcdabcd))
 	assertEquals(t, ret, uint32(0xabcdabcd))
 }
+
+func Test_Conversation_SetReceivedKeyHandler_setsReceivedKeyHandler(t *testing.T) {
+	c := &Conversation{}
+	h := dynamicReceivedKeyHandler{func(uint32, []byte, []byte) {}}
+	c.SetReceivedKeyHandler(h)
+	assertNotNil(t, c.receivedKeyHandler)
+}
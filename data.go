@@ -4,16 +4,11 @@ import (
 	"hash"
 	"math/big"
 	"strconv"
-
-	"github.com/coyim/gotrax"
 )
 
 func hashMPIs(h hash.Hash, magic byte, mpis ...*big.Int) []byte {
 	h.Reset()
-	h.Write([]byte{magic})
-	for _, mpi := range mpis {
-		h.Write(gotrax.AppendMPI(nil, mpi))
-	}
+	h.Write(encodeSMPHashInput(magic, mpis...))
 	return h.Sum(nil)
 }
 
@@ -1,6 +1,9 @@
 package otr3
 
-import "encoding/binary"
+import (
+	"bytes"
+	"encoding/binary"
+)
 
 type dataMessageExtra struct {
 	key []byte
@@ -15,7 +18,13 @@ func (c *Conversation) genDataMsgWithFlag(message []byte, flag byte, tlvs ...tlv
 		return dataMsg{}, dataMessageExtra{}, errCannotSendUnencrypted
 	}
 
-	keys, err := c.keys.calculateDHSessionKeys(c.keys.ourKeyID-1, c.keys.theirKeyID, c.version)
+	keys, err := c.keys.calculateDHSessionKeys(&c.secrets, c.keys.ourKeyID-1, c.keys.theirKeyID, c.version)
+	if err != nil {
+		return dataMsg{}, dataMessageExtra{}, err
+	}
+	defer keys.wipe()
+
+	header, err := c.messageHeader(msgTypeData)
 	if err != nil {
 		return dataMsg{}, dataMessageExtra{}, err
 	}
@@ -32,15 +41,11 @@ func (c *Conversation) genDataMsgWithFlag(message []byte, flag byte, tlvs ...tlv
 	plain := plainDataMsg{
 		message: message,
 		tlvs:    tlvs,
+		padding: c.padding,
 	}
 
 	encrypted := plain.encrypt(keys.sendingAESKey[:], topHalfCtr)
 
-	header, err := c.messageHeader(msgTypeData)
-	if err != nil {
-		return dataMsg{}, dataMessageExtra{}, err
-	}
-
 	dataMessage := dataMsg{
 		flag:           flag,
 		senderKeyID:    c.keys.ourKeyID - 1,
@@ -55,9 +60,9 @@ func (c *Conversation) genDataMsgWithFlag(message []byte, flag byte, tlvs ...tlv
 	dataMessage.sign(keys.sendingMACKey, header, c.version)
 
 	c.updateMayRetransmitTo(noRetransmit)
-	c.lastMessage(message)
+	c.lastMessage(message, false)
 
-	x := dataMessageExtra{keys.extraKey[:]}
+	x := dataMessageExtra{makeCopy(keys.extraKey)}
 
 	return dataMessage, x, nil
 }
@@ -94,6 +99,11 @@ func (c *Conversation) encode(msg messageWithHeader) encodedMessage {
 
 func (c *Conversation) processDataMessage(header, msg []byte) (plain MessagePlaintext, toSend messageWithHeader, err error) {
 	ignoreUnreadable := (extractDataMessageFlag(msg) & messageFlagIgnoreUnreadable) == messageFlagIgnoreUnreadable
+	if ignoreUnreadable && c.msgState != encrypted {
+		// Nothing the user cares about is lost, like a heartbeat or an SMP message, so the peer isn't told
+		return nil, nil, nil
+	}
+
 	plain, toSend, err = c.processDataMessageWithRawErrors(header, msg)
 	if err != nil && ignoreUnreadable {
 		err = nil
@@ -113,48 +123,74 @@ func (c *Conversation) processDataMessageWithRawErrors(header, msg []byte) (plai
 		return
 	}
 
-	if err = dataMessage.deserialize(msg, c.version); err != nil {
+	if err = dataMessage.deserialize(msg, c.version, c.FieldLimits()); err != nil {
 		return
 	}
 
-	if err = c.keys.checkMessageCounter(dataMessage); err != nil {
+	if !c.version.isGroupElement(dataMessage.y) {
+		err = ErrDataMessageBadMPI
 		return
 	}
 
-	sessionKeys, err := c.keys.calculateDHSessionKeys(dataMessage.recipientKeyID, dataMessage.senderKeyID, c.version)
+	sessionKeys, err := c.keys.calculateDHSessionKeys(&c.secrets, dataMessage.recipientKeyID, dataMessage.senderKeyID, c.version)
+	if err == nil {
+		defer sessionKeys.wipe()
+		err = dataMessage.checkSign(sessionKeys.receivingMACKey, header, c.version)
+	}
+
 	if err != nil {
+		if c.previousKeys != nil {
+			if previousPlain, previousErr := c.processDataMessageWithPreviousKeys(header, dataMessage); previousErr == nil {
+				return previousPlain, nil, nil
+			}
+		}
 		return
 	}
 
-	if err = dataMessage.checkSign(sessionKeys.receivingMACKey, header, c.version); err != nil {
+	c.retirePreviousKeys()
+
+	// The counter is only recorded once we know the message is authentic,
+	// otherwise a forged message could make us reject the real ones
+	window := c.TransportProfile().ReorderWindow
+	if err = c.keys.peekMessageCounter(dataMessage, window); err != nil {
+		c.messageEvent(MessageEventReceivedMessageReplayed)
 		return
 	}
 
+	// Rotating the keys is the last thing that can fail, so nothing is recorded before it has succeeded
+	if err = c.rotateKeys(dataMessage); err != nil {
+		return
+	}
+
+	c.keys.receivingMACKeyUsed(dataMessage.recipientKeyID, dataMessage.senderKeyID, sessionKeys)
+	c.keys.checkMessageCounter(dataMessage, window)
+
 	p := plainDataMsg{}
 	//this can't return an error since receivingAESKey is a AES-128 key
 	p.decrypt(sessionKeys.receivingAESKey[:], dataMessage.topHalfCtr, dataMessage.encryptedMsg)
+	// The message is decrypted in place, so the buffer has to be wiped once we are done with the TLVs
+	defer wipeBytes(dataMessage.encryptedMsg)
 
+	// The plaintext is delivered exactly as the peer wrote it. It must never be handed back to the protocol
+	// layer, so query messages, error messages and whitespace tags inside it are just text.
 	plain = makeCopy(p.message)
+	c.receivedPrivately = true
 	if len(plain) == 0 {
 		plain = nil
-		c.messageEvent(MessageEventLogHeartbeatReceived)
-	}
-
-	err = c.rotateKeys(dataMessage)
-	if err != nil {
-		return
+		c.signalIfHeartbeat(p.tlvs)
 	}
 
 	var tlvs []tlv
 
-	tlvs, err = c.processTLVs(p.tlvs, dataMessageExtra{sessionKeys.extraKey})
+	tlvs, err = c.processTLVs(p.tlvs, dataMessageExtra{makeCopy(sessionKeys.extraKey)})
 	if err != nil {
 		return
 	}
 
 	if len(tlvs) > 0 {
 		var reply dataMsg
-		reply, _, err = c.genDataMsgWithFlag(nil, decideFlagFrom(tlvs), tlvs...)
+		// The reply only carries TLVs, so nothing the user would see is lost if the peer can't read it
+		reply, _, err = c.genDataMsgWithFlag(nil, messageFlagIgnoreUnreadable, tlvs...)
 		if err != nil {
 			return
 		}
@@ -168,23 +204,23 @@ func (c *Conversation) processDataMessageWithRawErrors(header, msg []byte) (plai
 	return
 }
 
-func decideFlagFrom(tlvs []tlv) byte {
-	flag := byte(0x00)
-	for _, t := range tlvs {
-		if t.tlvType >= tlvTypeSMP1 && t.tlvType <= tlvTypeSMP1WithQuestion {
-			flag = messageFlagIgnoreUnreadable
-		}
-
+func (c *Conversation) processSMPTLV(t tlv, x dataMessageExtra) (toSend *tlv, err error) {
+	// SMP messages are only meaningful inside the private conversation whose keys they are bound to
+	if !c.IsEncrypted() {
+		return nil, ErrAuthenticationNotInPrivate
 	}
-	return flag
-}
 
-func (c *Conversation) processSMPTLV(t tlv, x dataMessageExtra) (toSend *tlv, err error) {
 	c.smp.ensureSMP()
 
-	smpMessage, ok := t.smpMessage()
-	if !ok {
-		return nil, newOtrError("corrupt data message")
+	smpMessage, err := t.smpMessage(c.FieldLimits())
+	if err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(smpMessage.tlv().serialize(), t.serialize()) {
+		if err := c.nonConformant(errNonConformantTLV); err != nil {
+			return nil, err
+		}
 	}
 
 	return c.receiveSMP(smpMessage)
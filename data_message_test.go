@@ -102,10 +102,11 @@ func Test_genDataMsg_setsLastMessageWhenNewMessageIsPlaintext(t *testing.T) {
 
 	c.genDataMsg(msg)
 
-	assertDeepEquals(t, c.resend.pending(),
+	assertDeepEquals(t, pendingWithoutMetadata(c),
 		[]messageToResend{
-			messageToResend{MessagePlaintext(msg), nil},
+			messageToResend{m: MessagePlaintext(msg)},
 		})
+	assertFalse(t, c.resend.pending()[0].queued)
 }
 
 func Test_genDataMsg_hasEncryptedMessage(t *testing.T) {
@@ -155,7 +156,7 @@ func Test_genDataMsg_returnsErrorIfFailsToGenerateInstanceTag(t *testing.T) {
 func Test_processDataMessage_deserializeAndDecryptDataMsg(t *testing.T) {
 	bob := newConversation(otrV3{}, rand.Reader)
 	bob.msgState = encrypted
-	bob.Policies.add(allowV3)
+	bob.Policies.Add(PolicyAllowV3)
 	bob.ourCurrentKey = bobPrivateKey
 	bob.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 
@@ -175,7 +176,7 @@ func Test_processDataMessage_deserializeAndDecryptDataMsg(t *testing.T) {
 
 func Test_processDataMessage_willGenerateAHeartBeatEventForAnEmptyMessage(t *testing.T) {
 	bob := newConversation(otrV3{}, rand.Reader)
-	bob.Policies.add(allowV3)
+	bob.Policies.Add(PolicyAllowV3)
 	bob.ourCurrentKey = bobPrivateKey
 	bob.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 
@@ -196,7 +197,7 @@ func Test_processDataMessage_willGenerateAHeartBeatEventForAnEmptyMessage(t *tes
 
 func Test_processDataMessage_processSMPMessage(t *testing.T) {
 	bob := newConversation(otrV3{}, rand.Reader)
-	bob.Policies.add(allowV3)
+	bob.Policies.Add(PolicyAllowV3)
 	bob.ourCurrentKey = bobPrivateKey
 
 	bob.smp.state = smpStateExpect2{}
@@ -228,7 +229,7 @@ func Test_processDataMessage_returnsErrorIfSomethingGoesWrongWithDeserialize(t *
 	c.msgState = encrypted
 	_, _, err := c.processDataMessage([]byte{}, []byte{})
 
-	assertEquals(t, err.Error(), "otr: dataMsg.deserialize empty message")
+	assertEquals(t, err, ErrDataMessageTruncatedHeader)
 }
 
 func Test_processDataMessage_returnsErrorIfDataMessageHasWrongCounter(t *testing.T) {
@@ -247,7 +248,7 @@ func Test_processDataMessage_returnsErrorIfDataMessageHasWrongCounter(t *testing
 	assertDeepEquals(t, err, newOtrConflictError("counter regressed"))
 }
 
-func Test_processDataMessage_signalsThatMessageIsUnreadableForAGPGConflictError(t *testing.T) {
+func Test_processDataMessage_signalsThatMessageIsReplayedWhenTheCounterRegressed(t *testing.T) {
 	c := newConversation(otrV3{}, rand.Reader)
 	c.ourCurrentKey = bobPrivateKey
 
@@ -261,7 +262,7 @@ func Test_processDataMessage_signalsThatMessageIsUnreadableForAGPGConflictError(
 
 	c.expectMessageEvent(t, func() {
 		c.receiveDecoded(msg)
-	}, MessageEventReceivedMessageUnreadable, nil, nil)
+	}, MessageEventReceivedMessageReplayed, nil, nil)
 }
 
 func Test_Receive_returnsACustomErrorMessageIfOneIsAvailable(t *testing.T) {
@@ -323,7 +324,7 @@ func Test_processDataMessage_callsErrorMessageHandlerAndReturnsTheResultAsAnOTRE
 
 func Test_processDataMessage_shouldNotRotateKeysWhenDecryptFails(t *testing.T) {
 	bob := newConversation(otrV3{}, rand.Reader)
-	bob.Policies.add(allowV3)
+	bob.Policies.Add(PolicyAllowV3)
 	bob.ourCurrentKey = bobPrivateKey
 
 	var msg []byte
@@ -349,7 +350,7 @@ func Test_processDataMessage_shouldNotRotateKeysWhenDecryptFails(t *testing.T) {
 
 func Test_processDataMessage_rotateOurKeysAfterDecryptingTheMessage(t *testing.T) {
 	bob := newConversation(otrV3{}, rand.Reader)
-	bob.Policies.add(allowV3)
+	bob.Policies.Add(PolicyAllowV3)
 	bob.ourCurrentKey = bobPrivateKey
 
 	var msg []byte
@@ -370,7 +371,7 @@ func Test_processDataMessage_rotateOurKeysAfterDecryptingTheMessage(t *testing.T
 
 func Test_processDataMessage_willReturnAHeartbeatMessageAfterAPlainTextMessage(t *testing.T) {
 	bob := newConversation(otrV3{}, rand.Reader)
-	bob.Policies.add(allowV3)
+	bob.Policies.Add(PolicyAllowV3)
 	bob.ourCurrentKey = bobPrivateKey
 	bob.heartbeat.lastSent = time.Now().Add(-61 * time.Second)
 
@@ -395,7 +396,7 @@ func Test_processDataMessage_willReturnAHeartbeatMessageAfterAPlainTextMessage(t
 
 func Test_processDataMessage_rotateTheirKeysAfterDecryptingTheMessage(t *testing.T) {
 	bob := newConversation(otrV3{}, rand.Reader)
-	bob.Policies.add(allowV3)
+	bob.Policies.Add(PolicyAllowV3)
 	bob.ourCurrentKey = bobPrivateKey
 
 	var msg []byte
@@ -415,7 +416,7 @@ func Test_processDataMessage_rotateTheirKeysAfterDecryptingTheMessage(t *testing
 
 func Test_processDataMessage_ignoresTLVsWhenFailsToRotateKeys(t *testing.T) {
 	bob := newConversation(otrV3{}, fixedRand([]string{}))
-	bob.Policies.add(allowV3)
+	bob.Policies.Add(PolicyAllowV3)
 	bob.ourCurrentKey = bobPrivateKey
 
 	// setup state for receiving a SMP message 2
@@ -444,8 +445,8 @@ func Test_processDataMessage_ignoresTLVsWhenFailsToRotateKeys(t *testing.T) {
 func Test_processDataMessage_returnErrorWhenOurKeyIDUnexpected(t *testing.T) {
 	datamsg := bytesFromHex("0003030000010100000101000000000100000001000000c03a3ca02c03bef84c7596504b7b2dee2820500bf51107e4447cfd2fddd8132a29668ef7cb3f56ff75f80e9d5a3c34e4aaa45a63beee83c058d21653e45d56ad04f6493545ad5bc3441f9a1a23fdf5ea0d812f3dfa02de9742ee9b1779dd1d84bf1bf06700a05779ff1a730c51ecdce34d251317dacdcbe865f12c2bf8e4a8a15cc10975184a7509e3f82244c8594d3df18b411648dc059cf341c50ab0d3981f186519ca3104609e89a5f4be44047068c5ba33d2b1de0e9b7d5e6aa67c148f57d70000000000000001000001007104b8684860d2eacc0d653ca9696171f5d7b03d90a06fd46305c041ab4af8313826ca82f8fc43c755c56dd62fa025822e72d9566a32fe88f189e0fb1b07128a37db49350392470cdd57f280f565ab775d58af6f5d8efca39126192efefe1f98bdfd2135b1c6ce8e68d8d3bfd50eae34187191524492193d20dd75d6b04a1e7d90fe1e71a9843b720df310119c1db82928c11308d93ed508641e73b6d579eefbcb432ab2ebf2b15a3b1c8baca86d5008c81286705b9368abec0d5cf4b6e2289be1040b5ac172cbc81f7a594d721cafd50e7cfdc2616c6d59cf445f885d8e80980a73f6a55a34be9e90b7ec25f757e212fa2b79c4c56d922a804168bfeca75199dbede31d8101018586d1f992afdd80117cf84d1000000000")
 	bob := newConversation(otrV3{}, rand.Reader)
-	bob.Policies.add(allowV2)
-	bob.Policies.add(allowV3)
+	bob.Policies.Add(PolicyAllowV2)
+	bob.Policies.Add(PolicyAllowV3)
 	bob.ourCurrentKey = bobPrivateKey
 	bob.theirKey = alicePrivateKey.PublicKey()
 	bob.keys.ourKeyID = 3
@@ -459,3 +460,132 @@ func Test_processDataMessage_returnErrorWhenOurKeyIDUnexpected(t *testing.T) {
 
 	assertDeepEquals(t, err, newOtrConflictError("mismatched key id for local peer"))
 }
+
+func Test_processDataMessage_doesntRecordTheCounterOfAMessageWithABadMAC(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.ourCurrentKey = bobPrivateKey
+	c.msgState = encrypted
+
+	var msg []byte
+	msg, c.keys = fixtureDataMsg(plainDataMsg{message: []byte("hello")})
+
+	forged := makeCopy(msg)
+	// last byte of the encrypted message, right before the authenticator and the empty revealed keys
+	forged[len(forged)-c.version.hashLength()-5] ^= 0x01
+
+	_, _, err := c.receiveDecoded(forged)
+	assertDeepEquals(t, err, newOtrConflictError("bad signature MAC in encrypted signature"))
+
+	plain, _, err := c.receiveDecoded(msg)
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+}
+
+func Test_processDataMessage_returnsErrorForATruncatedAuthenticator(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.ourCurrentKey = bobPrivateKey
+	c.msgState = encrypted
+
+	var msg []byte
+	msg, c.keys = fixtureDataMsg(plainDataMsg{message: []byte("hello")})
+
+	_, _, err := c.receiveDecoded(msg[:len(msg)-c.version.hashLength()])
+	assertDeepEquals(t, err, newOtrError("dataMsg.deserialize corrupted authenticator"))
+}
+
+func Test_processDataMessage_recordsTheReceivingMACKeyOfAnAuthenticMessage(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.ourCurrentKey = bobPrivateKey
+	c.msgState = encrypted
+
+	var msg []byte
+	msg, c.keys = fixtureDataMsg(plainDataMsg{message: []byte("hello")})
+	keys, _ := c.keys.calculateDHSessionKeys(nil, 1, 1, c.version)
+
+	c.receiveDecoded(msg)
+
+	assertEquals(t, len(c.keys.macKeyHistory.items), 1)
+	assertDeepEquals(t, c.keys.macKeyHistory.items[0].receivingKey, keys.receivingMACKey)
+}
+
+func Test_processDataMessage_doesntRecordTheReceivingMACKeyOfAMessageWithABadMAC(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.ourCurrentKey = bobPrivateKey
+	c.msgState = encrypted
+
+	var msg []byte
+	msg, c.keys = fixtureDataMsg(plainDataMsg{message: []byte("hello")})
+	msg[len(msg)-c.version.hashLength()-5] ^= 0x01
+
+	c.receiveDecoded(msg)
+
+	assertEquals(t, len(c.keys.macKeyHistory.items), 0)
+}
+
+func Test_genDataMsg_doesntRecordAnyMACKeyForRevealing(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+
+	c.genDataMsg([]byte("hello"))
+
+	assertEquals(t, len(c.keys.macKeyHistory.items), 0)
+}
+
+func errorMessageHandlerNaming(c *Conversation) {
+	c.SetErrorMessageHandler(dynamicErrorMessageHandler{func(error ErrorCode) []byte {
+		return []byte(error.String())
+	}})
+}
+
+func Test_Receive_ignoresADataMessageMarkedIgnoreUnreadableWhenNotInPrivate(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	smp1, _ := bob.StartAuthenticate("", []byte("the park"))
+	alice.End()
+	errorMessageHandlerNaming(alice)
+	events := collectMessageEvents(alice, MessageEventReceivedMessageNotInPrivate)
+
+	plain, toSend, err := alice.Receive(smp1[0])
+
+	assertNil(t, err)
+	assertNil(t, plain)
+	assertNil(t, toSend)
+	assertEquals(t, *events, 0)
+}
+
+func Test_Receive_sendsANotInPrivateErrorForADataMessageNotMarkedIgnoreUnreadable(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	msg, _ := bob.Send(ValidMessage("hello"))
+	alice.End()
+	errorMessageHandlerNaming(alice)
+
+	_, toSend, err := alice.Receive(msg[0])
+
+	assertEquals(t, err, errMessageNotInPrivate)
+	assertDeepEquals(t, toSend, []ValidMessage{ValidMessage("?OTR Error: ErrorCodeMessageNotInPrivate")})
+}
+
+func Test_Receive_doesNotSendAnUnreadableErrorForAnUnreadableDataMessageMarkedIgnoreUnreadable(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	smp1, _ := bob.StartAuthenticate("", []byte("the park"))
+	decoded, _ := alice.decode(encodedMessage(smp1[0]))
+	decoded[len(decoded)-30] ^= 0x01
+	errorMessageHandlerNaming(alice)
+
+	_, toSend, err := alice.Receive(ValidMessage(alice.encode(decoded)))
+
+	assertNil(t, err)
+	assertNil(t, toSend)
+	assertEquals(t, alice.SMPState(), "SMPSTATE_EXPECT1")
+}
+
+func Test_Receive_repliesToTLVsWithADataMessageMarkedIgnoreUnreadable(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	smp1, _ := alice.StartAuthenticate("", []byte("the park"))
+	bob.Receive(smp1[0])
+	smp2, _ := bob.ProvideAuthenticationSecret([]byte("the park"))
+
+	_, smp3, _ := alice.Receive(smp2[0])
+	decoded, _ := alice.decode(encodedMessage(smp3[0]))
+
+	assertEquals(t, decoded[11], messageFlagIgnoreUnreadable)
+}
@@ -153,12 +153,12 @@ func Test_SMP_CompleteDebug(t *testing.T) {
 	alice.ourCurrentKey = alicePrivateKey
 	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
 
-	alice.Policies = policies(allowV3)
+	alice.Policies = Policies(PolicyAllowV3)
 
 	bob := &Conversation{Rand: rand.Reader}
 	bob.ourCurrentKey = bobPrivateKey
 	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
-	bob.Policies = policies(allowV3)
+	bob.Policies = Policies(PolicyAllowV3)
 
 	var err error
 	var aliceMessages []ValidMessage
@@ -0,0 +1,120 @@
+package otr3
+
+import "github.com/coyim/gotrax"
+
+// TLV is a type-length-value record carried together with the message in an encrypted data message
+type TLV struct {
+	Type  uint16
+	Value []byte
+}
+
+// DecryptDataMessage verifies and decrypts an encoded, unfragmented data message using the keys of this conversation,
+// and returns the plaintext and TLVs inside it. Unlike Receive, it doesn't change the conversation in any way:
+// it doesn't rotate keys, record the message counter, act on the TLVs, signal events or generate messages to send.
+// This makes it useful for read-only consumers, like an archiver given a copy of an established conversation.
+// Since nothing is recorded and the message counter isn't checked, a message is decrypted again every time it is given,
+// even after Receive has handled it. Like Receive, it also reads messages sent with the keys of the session a new AKE
+// replaced, as long as the conversation still keeps those keys - but unlike Receive, it returns their TLVs too.
+func (c *Conversation) DecryptDataMessage(raw []byte) (MessagePlaintext, []TLV, error) {
+	if c.msgState != encrypted || c.version == nil {
+		return nil, nil, errMessageNotInPrivate
+	}
+
+	if guessMessageType(raw) != msgGuessData {
+		return nil, nil, errInvalidOTRMessage
+	}
+
+	msg, err := b64decode(removeOTRMsgEnvelope(raw))
+	if err != nil {
+		return nil, nil, errInvalidOTRMessage
+	}
+
+	header, body, err := c.dataMessageHeader(msg)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dataMessage := dataMsg{}
+	if err = dataMessage.deserialize(body, c.version, c.FieldLimits()); err != nil {
+		return nil, nil, err
+	}
+
+	if !c.version.isGroupElement(dataMessage.y) {
+		return nil, nil, ErrDataMessageBadMPI
+	}
+
+	sessionKeys, err := c.authenticatingSessionKeys(&c.keys, header, dataMessage)
+	if err != nil && c.previousKeys != nil {
+		if previousKeys, previousErr := c.authenticatingSessionKeys(c.previousKeys, header, dataMessage); previousErr == nil {
+			sessionKeys, err = previousKeys, nil
+		}
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	defer sessionKeys.wipe()
+
+	p := plainDataMsg{}
+	p.decrypt(sessionKeys.receivingAESKey[:], dataMessage.topHalfCtr, dataMessage.encryptedMsg)
+	defer wipeBytes(dataMessage.encryptedMsg)
+
+	var plain MessagePlaintext
+	if len(p.message) > 0 {
+		plain = makeCopy(p.message)
+	}
+
+	var tlvs []TLV
+	for _, t := range p.tlvs {
+		tlvs = append(tlvs, TLV{Type: t.tlvType, Value: makeCopy(t.tlvValue[:t.tlvLength])})
+	}
+
+	return plain, tlvs, nil
+}
+
+// authenticatingSessionKeys returns the session keys of the given key management context that the data message
+// was sent with, or an error if they don't authenticate it. The keys are calculated without using the secret scratch
+// of the conversation, and nothing is recorded.
+func (c *Conversation) authenticatingSessionKeys(keys *keyManagementContext, header []byte, dataMessage dataMsg) (sessionKeys, error) {
+	sessionKeys, err := keys.calculateDHSessionKeys(nil, dataMessage.recipientKeyID, dataMessage.senderKeyID, c.version)
+	if err != nil {
+		return sessionKeys, err
+	}
+
+	if err = dataMessage.checkSign(sessionKeys.receivingMACKey, header, c.version); err != nil {
+		sessionKeys.wipe()
+		return sessionKeys, err
+	}
+
+	return sessionKeys, nil
+}
+
+// dataMessageHeader splits a decoded data message into its header and body, checking that the message belongs to this conversation
+func (c *Conversation) dataMessageHeader(msg []byte) (header, body []byte, err error) {
+	headerLen := messageHeaderPrefix
+	if c.version.protocolVersion() == 3 {
+		headerLen = otrv3HeaderLen
+	}
+
+	if len(msg) < headerLen {
+		return nil, nil, ErrDataMessageTruncatedHeader
+	}
+
+	_, version, _ := gotrax.ExtractShort(msg)
+	if version != c.version.protocolVersion() {
+		return nil, nil, ErrDataMessageUnsupportedVersion
+	}
+
+	if msg[2] != msgTypeData {
+		return nil, nil, errInvalidOTRMessage
+	}
+
+	if headerLen == otrv3HeaderLen {
+		rest, sender, _ := gotrax.ExtractWord(msg[messageHeaderPrefix:])
+		_, receiver, _ := gotrax.ExtractWord(rest)
+		if sender != c.theirInstanceTag || receiver != c.ourInstanceTag {
+			return nil, nil, errReceivedMessageForOtherInstance
+		}
+	}
+
+	return msg[:headerLen], msg[headerLen:], nil
+}
@@ -0,0 +1,163 @@
+package otr3
+
+import (
+	"sync"
+	"testing"
+)
+
+func Test_DecryptDataMessage_returnsThePlaintextWithoutChangingTheConversation(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	toSend, _ := alice.Send(ValidMessage("hello"))
+	theirKeyID, counters := bob.keys.theirKeyID, len(bob.keys.counterHistory.counters)
+
+	var plain MessagePlaintext
+	var err error
+	bob.doesntExpectMessageEvent(t, func() {
+		plain, _, err = bob.DecryptDataMessage(toSend[0])
+	})
+
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+	assertEquals(t, bob.keys.theirKeyID, theirKeyID)
+	assertEquals(t, len(bob.keys.counterHistory.counters), counters)
+
+	bob.messageEventHandler = nil
+	plain, _, err = bob.Receive(toSend[0])
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+}
+
+func Test_DecryptDataMessage_returnsTheTLVsWithoutActingOnThem(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	toSend, _, _ := alice.createSerializedDataMessage([]byte("bye"), messageFlagNormal, []tlv{tlv{tlvType: tlvTypeDisconnected}})
+
+	plain, tlvs, err := bob.DecryptDataMessage(toSend[0])
+
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("bye"))
+	assertEquals(t, len(tlvs), 2)
+	assertDeepEquals(t, tlvs[0], TLV{Type: tlvTypeDisconnected, Value: []byte{}})
+	assertEquals(t, tlvs[1].Type, tlvTypePadding)
+	assertTrue(t, bob.IsEncrypted())
+}
+
+func Test_DecryptDataMessage_rejectsAMessageWithAForgedMAC(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	toSend, _ := alice.Send(ValidMessage("hello"))
+	forged := (&hostilePeer{alice}).tamper(toSend[0], func(body []byte) []byte {
+		body[len(body)-5] ^= 0x01
+		return body
+	})
+
+	plain, _, err := bob.DecryptDataMessage(forged)
+
+	assertNotNil(t, err)
+	assertNil(t, plain)
+}
+
+func Test_DecryptDataMessage_decryptsAMessageThatReceiveHasAlreadyHandled(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	toSend, _ := alice.Send(ValidMessage("hello"))
+	bob.Receive(toSend[0])
+
+	plain, _, err := bob.DecryptDataMessage(toSend[0])
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+
+	plain, _, err = bob.DecryptDataMessage(toSend[0])
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+}
+
+func Test_DecryptDataMessage_decryptsAMessageSentWithThePreviousKeysAfterANewAKE(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	inFlight, _ := bob.Send(ValidMessage("sent before the new AKE"))
+
+	runNewAKE(t, alice, bob)
+	plain, _, err := alice.DecryptDataMessage(inFlight[0])
+
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("sent before the new AKE"))
+	assertNotNil(t, alice.previousKeys)
+}
+
+func Test_DecryptDataMessage_doesNotDecryptMessagesWithThePreviousKeysOnceTheyAreRetired(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	inFlight, _ := bob.Send(ValidMessage("sent before the new AKE"))
+	runNewAKE(t, alice, bob)
+	msg, _ := bob.Send(ValidMessage("sent after the new AKE"))
+	alice.Receive(msg[0])
+
+	_, _, err := alice.DecryptDataMessage(inFlight[0])
+
+	assertNotNil(t, err)
+}
+
+func Test_DecryptDataMessage_canBeCalledConcurrently(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	toSend, _ := alice.Send(ValidMessage("hello"))
+
+	errs := make(chan error, 40)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				_, _, err := bob.DecryptDataMessage(toSend[0])
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assertNil(t, err)
+	}
+}
+
+func Test_DecryptDataMessage_returnsErrorWhenNotEncrypted(t *testing.T) {
+	c := &Conversation{}
+
+	_, _, err := c.DecryptDataMessage([]byte("?OTR:AAMDAAAAAQ==."))
+
+	assertEquals(t, err, errMessageNotInPrivate)
+}
+
+func Test_DecryptDataMessage_returnsErrorForMessagesThatArentDataMessages(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	_, _, err := bob.DecryptDataMessage(alice.QueryMessage())
+
+	assertEquals(t, err, errInvalidOTRMessage)
+}
+
+func Test_DecryptDataMessage_returnsErrorForMessagesFromAnotherVersion(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	toSend, _ := alice.Send(ValidMessage("hello"))
+
+	decoded, _ := alice.decode(encodedMessage(toSend[0]))
+	decoded[1] = 0x02
+	_, _, err := bob.DecryptDataMessage(alice.encode(decoded))
+
+	assertEquals(t, err, ErrDataMessageUnsupportedVersion)
+}
+
+func Test_DecryptDataMessage_returnsErrorForMessagesToAnotherInstance(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	toSend, _ := alice.Send(ValidMessage("hello"))
+	bob.ourInstanceTag++
+
+	_, _, err := bob.DecryptDataMessage(toSend[0])
+
+	assertEquals(t, err, errReceivedMessageForOtherInstance)
+}
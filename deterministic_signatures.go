@@ -0,0 +1,141 @@
+package otr3
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"hash"
+	"math/big"
+)
+
+// deterministicSigner is implemented by private keys that can derive the nonce of a signature
+// from the key and the signed data, instead of reading it from a random source
+type deterministicSigner interface {
+	SignDeterministically(hashed []byte) ([]byte, error)
+}
+
+func (c *Conversation) sign(hashed []byte) ([]byte, error) {
+	if c.Policies.Has(PolicyDeterministicSignatures) {
+		if d, ok := c.ourCurrentKey.(deterministicSigner); ok {
+			return d.SignDeterministically(hashed)
+		}
+	}
+	return c.ourCurrentKey.Sign(c.rand(), hashed)
+}
+
+// SignDeterministically generates a signature of hashed data like Sign, but derives the nonce
+// as described in RFC 6979, using HMAC-SHA256. The same key and data always give the same signature,
+// and no randomness is needed, so a broken random source can never reveal the key.
+func (priv *DSAPrivateKey) SignDeterministically(hashed []byte) ([]byte, error) {
+	params := priv.PrivateKey.Parameters
+	q, x := params.Q, priv.X
+	if q == nil || x == nil || q.BitLen()%8 != 0 {
+		return nil, newOtrError("invalid private key")
+	}
+
+	// Like crypto/dsa, which verifies the signatures of the peer, the whole of the hashed data is used
+	z := new(big.Int).SetBytes(hashed)
+	nonces := newRFC6979Nonces(sha256.New, x, q, hashed)
+
+	for {
+		k := nonces.next()
+
+		r := new(big.Int).Exp(params.G, k, params.P)
+		r.Mod(r, q)
+
+		kInv := new(big.Int).ModInverse(k, q)
+		s := new(big.Int).Mul(x, r)
+		s.Add(s, z)
+		s.Mul(s, kInv)
+		s.Mod(s, q)
+
+		wipeBigInts(k, kInv)
+
+		// Both are zero with negligible probability, in which case the RFC continues with the next nonce
+		if r.Sign() != 0 && s.Sign() != 0 {
+			out := make([]byte, 40)
+			r.FillBytes(out[:20])
+			s.FillBytes(out[20:])
+			return out, nil
+		}
+	}
+}
+
+// rfc6979Nonces generates the candidates for k as described in section 3.2 of RFC 6979
+type rfc6979Nonces struct {
+	newHash func() hash.Hash
+	q       *big.Int
+	k, v    []byte
+}
+
+func newRFC6979Nonces(newHash func() hash.Hash, x, q *big.Int, hashed []byte) *rfc6979Nonces {
+	qlen := q.BitLen()
+	rlen := (qlen + 7) / 8
+
+	h1 := bits2int(hashed, qlen)
+	if h1.Cmp(q) >= 0 {
+		h1.Sub(h1, q)
+	}
+
+	size := newHash().Size()
+	n := &rfc6979Nonces{
+		newHash: newHash,
+		q:       q,
+		k:       make([]byte, size),
+		v:       make([]byte, size),
+	}
+	for i := range n.v {
+		n.v[i] = 0x01
+	}
+
+	xOctets := make([]byte, rlen)
+	x.FillBytes(xOctets)
+	hOctets := make([]byte, rlen)
+	h1.FillBytes(hOctets)
+	defer wipeBytes(xOctets)
+
+	n.k = n.mac(n.v, []byte{0x00}, xOctets, hOctets)
+	n.v = n.mac(n.v)
+	n.k = n.mac(n.v, []byte{0x01}, xOctets, hOctets)
+	n.v = n.mac(n.v)
+
+	return n
+}
+
+func (n *rfc6979Nonces) mac(data ...[]byte) []byte {
+	m := hmac.New(n.newHash, n.k)
+	for _, d := range data {
+		m.Write(d)
+	}
+	return m.Sum(nil)
+}
+
+// next returns the next candidate in the range [1, q-1]. Every call gives a new candidate.
+func (n *rfc6979Nonces) next() *big.Int {
+	qlen := n.q.BitLen()
+	for {
+		var t []byte
+		for len(t)*8 < qlen {
+			n.v = n.mac(n.v)
+			t = append(t, n.v...)
+		}
+
+		k := bits2int(t, qlen)
+		wipeBytes(t)
+
+		n.k = n.mac(n.v, []byte{0x00})
+		n.v = n.mac(n.v)
+
+		if k.Sign() > 0 && k.Cmp(n.q) < 0 {
+			return k
+		}
+	}
+}
+
+// bits2int interprets the leftmost qlen bits of b as an integer, as described in section 2.3.2 of RFC 6979
+func bits2int(b []byte, qlen int) *big.Int {
+	v := new(big.Int).SetBytes(b)
+	if blen := len(b) * 8; blen > qlen {
+		v.Rsh(v, uint(blen-qlen))
+	}
+	return v
+}
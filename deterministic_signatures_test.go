@@ -0,0 +1,95 @@
+package otr3
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"testing"
+)
+
+// The DSA 1024 bit key from appendix A.2.1 of RFC 6979
+var (
+	rfc6979Q = bnFromHex("996F967F6C8E388D9E28D01E205FBA957A5698B1")
+	rfc6979X = bnFromHex("411602CB19A6CCC34494D79D98EF1E7ED5AF25F7")
+)
+
+func Test_rfc6979Nonces_generatesTheNonceFromTheRFCWithSHA1(t *testing.T) {
+	h := sha1.Sum([]byte("sample"))
+	k := newRFC6979Nonces(sha1.New, rfc6979X, rfc6979Q, h[:]).next()
+	assertDeepEquals(t, k, bnFromHex("7BDB6B0FF756E1BB5D53583EF979082F9AD5BD5B"))
+}
+
+func Test_rfc6979Nonces_generatesTheNonceFromTheRFCWithSHA256(t *testing.T) {
+	h := sha256.Sum256([]byte("sample"))
+	k := newRFC6979Nonces(sha256.New, rfc6979X, rfc6979Q, h[:]).next()
+	assertDeepEquals(t, k, bnFromHex("519BA0546D0C39202A7D34D7DFA5E760B318BCFB"))
+
+	h = sha256.Sum256([]byte("test"))
+	k = newRFC6979Nonces(sha256.New, rfc6979X, rfc6979Q, h[:]).next()
+	assertDeepEquals(t, k, bnFromHex("5A67592E8128E03A417B0484410FB72C0B630E1A"))
+}
+
+func Test_rfc6979Nonces_generatesANewNonceEveryTime(t *testing.T) {
+	h := sha256.Sum256([]byte("sample"))
+	n := newRFC6979Nonces(sha256.New, rfc6979X, rfc6979Q, h[:])
+	assertFalse(t, eq(n.next(), n.next()))
+}
+
+func Test_DSAPrivateKey_SignDeterministically_generatesTheSameValidSignatureEveryTime(t *testing.T) {
+	hashed := sha256.Sum256([]byte("hello"))
+
+	sig1, err := alicePrivateKey.(*DSAPrivateKey).SignDeterministically(hashed[:])
+	assertNil(t, err)
+	sig2, _ := alicePrivateKey.(*DSAPrivateKey).SignDeterministically(hashed[:])
+
+	assertDeepEquals(t, sig1, sig2)
+	rest, ok := alicePrivateKey.PublicKey().Verify(hashed[:], sig1)
+	assertTrue(t, ok)
+	assertEquals(t, len(rest), 0)
+}
+
+func Test_DSAPrivateKey_SignDeterministically_generatesDifferentSignaturesForDifferentData(t *testing.T) {
+	hashed1 := sha256.Sum256([]byte("hello"))
+	hashed2 := sha256.Sum256([]byte("goodbye"))
+
+	sig1, _ := alicePrivateKey.(*DSAPrivateKey).SignDeterministically(hashed1[:])
+	sig2, _ := alicePrivateKey.(*DSAPrivateKey).SignDeterministically(hashed2[:])
+
+	assertFalse(t, bytes.Equal(sig1, sig2))
+}
+
+func Test_sign_usesNoRandomnessWithDeterministicSignatures(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.ourCurrentKey = bobPrivateKey
+	c.Policies.Add(PolicyDeterministicSignatures)
+	c.Rand = fixedRand([]string{})
+	hashed := sha256.Sum256([]byte("hello"))
+
+	sig, err := c.sign(hashed[:])
+
+	assertNil(t, err)
+	_, ok := c.ourCurrentKey.PublicKey().Verify(hashed[:], sig)
+	assertTrue(t, ok)
+}
+
+func Test_sign_usesRandomnessByDefault(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.ourCurrentKey = bobPrivateKey
+	c.Rand = fixedRand([]string{})
+	hashed := sha256.Sum256([]byte("hello"))
+
+	_, err := c.sign(hashed[:])
+
+	assertNotNil(t, err)
+}
+
+func Test_AKE_completesWithDeterministicSignatures(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	alice.Policies.Add(PolicyDeterministicSignatures)
+	bob.Policies.Add(PolicyDeterministicSignatures)
+
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	assertTrue(t, alice.IsEncrypted())
+	assertTrue(t, bob.IsEncrypted())
+}
@@ -7,11 +7,15 @@ func (c *Conversation) processDisconnectedTLV(t tlv, x dataMessageExtra) (toSend
 
 	defer c.signalSecurityEventIf(previousMsgState == encrypted, GoneInsecure)
 	c.lastMessageStateChange = time.Time{}
-	c.msgState = finished
-	c.smp.wipe()
-	c.ake = nil
+	c.setMsgState(finished, "receive disconnected TLV")
+	c.sessionEnded(previousMsgState, EndedByThem)
+	c.wipeSMP("receive disconnected TLV")
+	c.dropAKE("receive disconnected TLV")
 
+	c.keys.wipe()
 	c.keys = keyManagementContext{}
+	c.wipePreviousKeys()
+	c.deliveries.wipe()
 
 	return nil, nil
 }
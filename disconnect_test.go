@@ -77,3 +77,45 @@ func Test_processDisconnectedTLV_wipesSMPState(t *testing.T) {
 	assertNil(t, c.smp.s2)
 	assertNil(t, c.smp.s3)
 }
+
+func Test_Receive_deliversTheMessageSentTogetherWithTheDisconnectTLV(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	bob.heartbeat.lastSent = bob.heartbeat.lastSent.Add(-2 * TransportProfileRealtime.HeartbeatInterval)
+
+	toSend, _, err := alice.createSerializedDataMessage([]byte("bye"), messageFlagNormal, []tlv{tlv{tlvType: tlvTypeDisconnected}})
+	assertNil(t, err)
+
+	plain, response, err := bob.Receive(toSend[0])
+
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("bye"))
+	assertNil(t, response)
+	assertEquals(t, bob.msgState, finished)
+}
+
+func Test_processDisconnectedTLV_wipesTheSessionKeys(t *testing.T) {
+	alice, c := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, c, []ValidMessage{alice.QueryMessage()})
+	ourKey := c.keys.ourCurrentDHKeys.priv
+	theirKey := c.keys.theirCurrentDHPubKey
+
+	c.processDisconnectedTLV(tlv{}, dataMessageExtra{})
+
+	assertEquals(t, ourKey.Sign(), 0)
+	assertEquals(t, theirKey.Sign(), 0)
+}
+
+func Test_Send_afterThePeerDisconnectedSignalsThatTheConnectionEnded(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	toSend, _ := alice.End()
+	bob.Receive(toSend[0])
+
+	var err error
+	bob.expectMessageEvent(t, func() {
+		_, err = bob.Send(ValidMessage("are you there?"))
+	}, MessageEventConnectionEnded, nil, nil)
+
+	assertNotNil(t, err)
+}
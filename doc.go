@@ -39,4 +39,45 @@
 //  // Use Authenticate to start a SMP process
 //  toSend, err := c.StartAuthenticate("My pet's name?",[]byte{"Gopher"})
 //  toSend, err := c.ProvideAuthenticationSecret([]byte{"Gopher"})
+//
+//
+// API Stability
+//
+// The core Conversation API is frozen: Send, Receive, the policy methods, the key types,
+// the event handlers and their events, SMP and the ending of conversations will keep working
+// the way they do now. New events and new policies can be added, but existing ones won't be
+// removed or change meaning.
+//
+// The following subsystems are experimental, and their API can still change between releases:
+//  Manager                                  - conversations with several instances of a peer
+//  TrustStore, MemoryTrustStore             - remembering which fingerprints are trusted
+//  PolicyProvider, PolicySetter             - deciding the policies per contact
+//  Policies text marshaling                 - keeping policies in configuration files
+//  TransportProfile, FragmentationProfile   - describing the transport
+//  Advertisement                            - letting the peer know that we support OTR
+//  KnownFingerprint, InstanceTag            - the libotr fingerprint and instance tag files
+//  TransportAction                          - deciding what to do with messages that failed
+//  Padding                                  - hiding the length of data messages
+//  VerificationLifetime                     - bounding how long a verification is relied on
+//  WorkerPool                               - processing messages for many conversations
+//  LocalFingerprint, FingerprintDisplay     - showing SHA-256 fingerprints to users
+//  StateGraph                               - describing the state machines of a conversation
+//  Sender, SendAsync, MarkDelivered         - delivering messages with feedback from the transport
+//  FragmentLimits, FragmentBudget           - bounding the memory held for reassembling fragments
+//  SessionEnd, EndedBy                      - telling who ended the private conversation
+//  Outbox, OutboxLimits, ClearOutbox        - inspecting and bounding the messages waiting to be delivered
+//  HealthCheckedReader                      - testing the source of randomness while using it
+//  CheckConformance, ConformanceReport      - checking the implementation against the specification
+//  Role, SessionHistory                     - telling which side started the private conversations
+//  SMPSecretNormalization                   - matching SMP secrets that were typed slightly differently
+//  EphemeralKeyProvider                     - generating the ephemeral Diffie-Hellman keys outside of this package
+//  SetUnsafeDebugOutput                     - printing secret values when debugging the protocol
+//  Timeline, TimelineEvent                  - reconstructing when keys changed and peers were verified
+//  NewConversation, ConversationOption      - configuring a conversation when it is created
+//  SafeConversation                         - using a conversation from several goroutines
+//  AsyncConversation                        - receiving the results of a conversation on channels
+//  DualStack, LegacyConversation            - migrating from golang.org/x/crypto/otr one peer at a time
+//  SecureConn, SecureClient, SecureServer   - private conversations over any stream, like a TCP connection
+// They only build on the core API, so using them doesn't affect the stability of code
+// that only uses the core API.
 package otr3
@@ -0,0 +1,207 @@
+package otr3
+
+import "bytes"
+
+// LegacyConversation is what a DualStack needs from a conversation of another OTR implementation - usually a
+// golang.org/x/crypto/otr Conversation. This package doesn't depend on that one, so the application adapts it:
+//
+//  type legacy struct{ *otr.Conversation }
+//
+//  func (l legacy) Receive(in []byte) ([]byte, bool, [][]byte, error) {
+//  	out, encrypted, _, toSend, err := l.Conversation.Receive(in)
+//  	return out, encrypted, toSend, err
+//  }
+//
+// Send and IsEncrypted of the x/crypto/otr Conversation already have the right signatures.
+type LegacyConversation interface {
+	// Receive handles a message from the peer. It returns the plaintext, whether the plaintext was encrypted,
+	// the messages to send to the peer and an error if the message couldn't be handled
+	Receive(in []byte) (out []byte, encrypted bool, toSend [][]byte, err error)
+	// Send returns the messages to send the message to the peer with
+	Send(msg []byte) ([][]byte, error)
+	// IsEncrypted returns true if the conversation is private
+	IsEncrypted() bool
+}
+
+// FallbackHandler is told every time a DualStack falls back to the legacy conversation, so a deployment in the
+// middle of a migration can monitor where the two implementations behave differently
+type FallbackHandler interface {
+	// HandleFallback is called with the message this package couldn't handle and the error it returned,
+	// after the legacy conversation has handled it
+	HandleFallback(msg ValidMessage, err error)
+}
+
+type dynamicFallbackHandler struct {
+	eh func(msg ValidMessage, err error)
+}
+
+func (d dynamicFallbackHandler) HandleFallback(msg ValidMessage, err error) {
+	d.eh(msg, err)
+}
+
+// DualStack runs a conversation of this package side by side with a legacy conversation of the same peer,
+// so a deployment can move its peers over gradually. Every message from the peer is first given to the
+// conversation of this package. Only if that returns an error, the legacy conversation gets the message -
+// for example a data message of a private conversation the legacy implementation had established before the
+// migration started. Fragments are kept until the message they make up is complete, and if the conversation
+// of this package can't handle that message, the legacy conversation gets all of them in order.
+// New AKEs are always handled by this package.
+//
+// Messages are sent with the legacy conversation as long as it is private and the conversation of this package isn't,
+// and with the conversation of this package otherwise. Turning the fallback off with SetFallback makes the
+// DualStack use only the conversation of this package, so the migration can be rolled out behind a flag.
+type DualStack struct {
+	conversation *Conversation
+	legacy       LegacyConversation
+	fallback     bool
+	handler      FallbackHandler
+
+	// fragments holds the fragments of the message being reassembled, to give to the legacy conversation
+	fragments     []ValidMessage
+	fragmentBytes int
+}
+
+// NewDualStack returns a DualStack that falls back to the legacy conversation
+func NewDualStack(c *Conversation, legacy LegacyConversation) *DualStack {
+	return &DualStack{
+		conversation: c,
+		legacy:       legacy,
+		fallback:     true,
+	}
+}
+
+// SetFallback decides whether the legacy conversation is used at all
+func (d *DualStack) SetFallback(enabled bool) {
+	d.fallback = enabled
+}
+
+// SetFallbackHandler assigns handler for falling back to the legacy conversation
+func (d *DualStack) SetFallbackHandler(handler FallbackHandler) {
+	d.handler = handler
+}
+
+// Conversation returns the conversation of this package
+func (d *DualStack) Conversation() *Conversation {
+	return d.conversation
+}
+
+// UsesLegacy returns true if messages are sent with the legacy conversation
+func (d *DualStack) UsesLegacy() bool {
+	return d.fallback && d.legacy.IsEncrypted() && !d.conversation.IsEncrypted()
+}
+
+// IsEncrypted returns true if messages are sent privately, by either conversation
+func (d *DualStack) IsEncrypted() bool {
+	return d.conversation.IsEncrypted() || d.UsesLegacy()
+}
+
+// Receive handles a message from the peer, like Conversation.Receive. If the conversation of this package
+// can't handle the message, the legacy conversation gets it and its results are returned instead. If the
+// legacy conversation can't handle it either, or doesn't do anything with it, the results of the conversation
+// of this package are returned. encrypted is true if the plaintext was received privately, by either conversation.
+func (d *DualStack) Receive(msg ValidMessage) (plain MessagePlaintext, encrypted bool, toSend []ValidMessage, err error) {
+	plain, toSend, err = d.conversation.Receive(msg)
+	encrypted = d.conversation.receivedPrivately
+	if !d.fallback {
+		return
+	}
+
+	pending := []ValidMessage{msg}
+	if guessMessageType(msg) == msgGuessFragment {
+		var complete bool
+		if pending, complete = d.keepFragment(msg); !complete {
+			return
+		}
+	}
+
+	if err == nil {
+		return
+	}
+
+	var out []byte
+	var legacyEncrypted bool
+	var legacyToSend [][]byte
+	for _, m := range pending {
+		o, e, ts, legacyErr := d.legacy.Receive(makeCopy(m))
+		if legacyErr != nil {
+			return
+		}
+		out, legacyEncrypted, legacyToSend = o, e, append(legacyToSend, ts...)
+	}
+
+	if len(out) == 0 && len(legacyToSend) == 0 {
+		return
+	}
+
+	if d.handler != nil {
+		d.handler.HandleFallback(msg, err)
+	}
+
+	toSend = nil
+	for _, m := range legacyToSend {
+		toSend = append(toSend, ValidMessage(m))
+	}
+	if len(out) > 0 {
+		return MessagePlaintext(out), legacyEncrypted, toSend, nil
+	}
+	return nil, false, toSend, nil
+}
+
+// keepFragment adds the fragment to the message being reassembled. It returns all fragments of the message
+// and true once the fragment completes it. Fragments that don't follow the previous one start over, like
+// they do in the conversation, and no more fragments are held than the fragment limits of the conversation allow.
+func (d *DualStack) keepFragment(msg ValidMessage) ([]ValidMessage, bool) {
+	ix, l, ok := fragmentPosition(msg)
+	if !ok || fragmentIsInvalid(ix, l) || (!fragmentIsFirstMessage(ix, l) && int(ix) != len(d.fragments)+1) {
+		d.fragments, d.fragmentBytes = nil, 0
+		return nil, false
+	}
+
+	if fragmentIsFirstMessage(ix, l) {
+		d.fragments, d.fragmentBytes = nil, 0
+	}
+
+	d.fragments = append(d.fragments, makeCopy(msg))
+	d.fragmentBytes += len(msg)
+	if d.fragmentBytes > d.conversation.FragmentLimits().MaxSize {
+		d.fragments, d.fragmentBytes = nil, 0
+		return nil, false
+	}
+
+	if ix != l {
+		return nil, false
+	}
+
+	fragments := d.fragments
+	d.fragments, d.fragmentBytes = nil, 0
+	return fragments, true
+}
+
+// fragmentPosition returns the number of the fragment and how many fragments the message has,
+// for fragments of every protocol version
+func fragmentPosition(msg ValidMessage) (ix, l uint16, ok bool) {
+	sep := bytes.IndexByte(msg, fragmentSeparator[0])
+	if sep == -1 {
+		return 0, 0, false
+	}
+	_, ix, l, ok = parseFragment(msg[sep+1:])
+	return
+}
+
+// Send sends the message with the conversation UsesLegacy decides on
+func (d *DualStack) Send(msg ValidMessage, trace ...interface{}) ([]ValidMessage, error) {
+	if !d.UsesLegacy() {
+		return d.conversation.Send(msg, trace...)
+	}
+
+	legacyToSend, err := d.legacy.Send(makeCopy(msg))
+	if err != nil {
+		return nil, err
+	}
+
+	toSend := make([]ValidMessage, len(legacyToSend))
+	for i, m := range legacyToSend {
+		toSend[i] = ValidMessage(m)
+	}
+	return toSend, nil
+}
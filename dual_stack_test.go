@@ -0,0 +1,198 @@
+package otr3
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// fakeLegacyConversation pretends to decrypt every data message while it is encrypted
+type fakeLegacyConversation struct {
+	encrypted bool
+	received  []string
+	sent      []string
+}
+
+func (l *fakeLegacyConversation) Receive(in []byte) ([]byte, bool, [][]byte, error) {
+	l.received = append(l.received, string(in))
+	if !l.encrypted || !bytes.HasPrefix(in, msgMarker) {
+		return nil, false, nil, errors.New("not a legacy message")
+	}
+	return []byte("from legacy"), true, [][]byte{[]byte("legacy:ack")}, nil
+}
+
+// dataMessageFromAnotherSession returns a data message addressed to the conversation, that only a conversation
+// with other keys can read
+func dataMessageFromAnotherSession(t *testing.T, to *Conversation) ValidMessage {
+	alice, bob := encryptedConversations(t)
+	to.ourInstanceTag, to.theirInstanceTag = bob.ourInstanceTag, bob.theirInstanceTag
+	msg, _ := alice.Send(ValidMessage("hello"))
+	return msg[0]
+}
+
+func (l *fakeLegacyConversation) Send(msg []byte) ([][]byte, error) {
+	l.sent = append(l.sent, string(msg))
+	return [][]byte{append([]byte("legacy:"), msg...)}, nil
+}
+
+func (l *fakeLegacyConversation) IsEncrypted() bool {
+	return l.encrypted
+}
+
+func Test_DualStack_receivesWithThisPackageWhenItCan(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	legacy := &fakeLegacyConversation{}
+	d := NewDualStack(bob, legacy)
+
+	msg, _ := alice.Send(ValidMessage("hello"))
+	plain, encrypted, _, err := d.Receive(msg[0])
+
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+	assertEquals(t, encrypted, true)
+	assertEquals(t, len(legacy.received), 0)
+}
+
+func Test_DualStack_fallsBackToTheLegacyConversation(t *testing.T) {
+	c := newConversation(otrV3{}, nil)
+	legacy := &fakeLegacyConversation{encrypted: true}
+	d := NewDualStack(c, legacy)
+	var fallbacks []error
+	d.SetFallbackHandler(dynamicFallbackHandler{func(_ ValidMessage, err error) {
+		fallbacks = append(fallbacks, err)
+	}})
+
+	plain, encrypted, toSend, err := d.Receive(dataMessageFromAnotherSession(t, c))
+
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("from legacy"))
+	assertEquals(t, encrypted, true)
+	assertDeepEquals(t, toSend, []ValidMessage{ValidMessage("legacy:ack")})
+	assertDeepEquals(t, fallbacks, []error{errMessageNotInPrivate})
+}
+
+func Test_DualStack_returnsTheErrorOfThisPackageWhenTheLegacyConversationFailsToo(t *testing.T) {
+	c := newConversation(otrV3{}, nil)
+	d := NewDualStack(c, &fakeLegacyConversation{})
+
+	_, _, _, err := d.Receive(dataMessageFromAnotherSession(t, c))
+
+	assertEquals(t, err, errMessageNotInPrivate)
+}
+
+// otr3AsLegacy plays the legacy conversation with a conversation of this package, that reassembles fragments
+// and decrypts data messages for real
+type otr3AsLegacy struct {
+	c *Conversation
+}
+
+func (l otr3AsLegacy) Receive(in []byte) ([]byte, bool, [][]byte, error) {
+	plain, toSend, err := l.c.Receive(ValidMessage(in))
+	var out [][]byte
+	for _, m := range toSend {
+		out = append(out, m)
+	}
+	return plain, l.c.receivedPrivately, out, err
+}
+
+func (l otr3AsLegacy) Send(msg []byte) ([][]byte, error) {
+	toSend, err := l.c.Send(ValidMessage(msg))
+	var out [][]byte
+	for _, m := range toSend {
+		out = append(out, m)
+	}
+	return out, err
+}
+
+func (l otr3AsLegacy) IsEncrypted() bool {
+	return l.c.IsEncrypted()
+}
+
+func Test_DualStack_givesAllFragmentsOfAMessageToTheLegacyConversation(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	alice.SetFragmentSize(60)
+	c := newConversation(otrV3{}, nil)
+	c.ourInstanceTag, c.theirInstanceTag = bob.ourInstanceTag, bob.theirInstanceTag
+	d := NewDualStack(c, otr3AsLegacy{bob})
+	var fallbacks []error
+	d.SetFallbackHandler(dynamicFallbackHandler{func(_ ValidMessage, err error) {
+		fallbacks = append(fallbacks, err)
+	}})
+
+	fragments, _ := alice.Send(ValidMessage("hello from before the migration"))
+	assertTrue(t, len(fragments) > 1)
+
+	for _, f := range fragments[:len(fragments)-1] {
+		plain, _, _, err := d.Receive(f)
+		assertNil(t, err)
+		assertNil(t, plain)
+	}
+	plain, encrypted, _, err := d.Receive(fragments[len(fragments)-1])
+
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello from before the migration"))
+	assertEquals(t, encrypted, true)
+	assertDeepEquals(t, fallbacks, []error{errMessageNotInPrivate})
+}
+
+// ignoringLegacyConversation handles every message without doing anything with it
+type ignoringLegacyConversation struct {
+	fakeLegacyConversation
+}
+
+func (l *ignoringLegacyConversation) Receive(in []byte) ([]byte, bool, [][]byte, error) {
+	return nil, false, nil, nil
+}
+
+func Test_DualStack_doesntFallBackWhenTheLegacyConversationDoesNothingWithTheMessage(t *testing.T) {
+	c := newConversation(otrV3{}, nil)
+	d := NewDualStack(c, &ignoringLegacyConversation{})
+	fallbacks := 0
+	d.SetFallbackHandler(dynamicFallbackHandler{func(ValidMessage, error) {
+		fallbacks++
+	}})
+
+	_, _, _, err := d.Receive(dataMessageFromAnotherSession(t, c))
+
+	assertEquals(t, err, errMessageNotInPrivate)
+	assertEquals(t, fallbacks, 0)
+}
+
+func Test_DualStack_doesntFallBackWhenTurnedOff(t *testing.T) {
+	c := newConversation(otrV3{}, nil)
+	legacy := &fakeLegacyConversation{encrypted: true}
+	d := NewDualStack(c, legacy)
+	d.SetFallback(false)
+
+	_, _, _, err := d.Receive(dataMessageFromAnotherSession(t, c))
+
+	assertEquals(t, err, errMessageNotInPrivate)
+	assertEquals(t, len(legacy.received), 0)
+	assertEquals(t, d.UsesLegacy(), false)
+}
+
+func Test_DualStack_sendsWithTheLegacyConversationWhileOnlyItIsPrivate(t *testing.T) {
+	c := newConversation(otrV3{}, nil)
+	legacy := &fakeLegacyConversation{encrypted: true}
+	d := NewDualStack(c, legacy)
+
+	toSend, err := d.Send(ValidMessage("hello"))
+
+	assertNil(t, err)
+	assertDeepEquals(t, toSend, []ValidMessage{ValidMessage("legacy:hello")})
+	assertEquals(t, d.IsEncrypted(), true)
+}
+
+func Test_DualStack_sendsWithThisPackageOnceItIsPrivate(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	legacy := &fakeLegacyConversation{encrypted: true}
+	d := NewDualStack(alice, legacy)
+
+	toSend, err := d.Send(ValidMessage("hello"))
+	assertNil(t, err)
+	plain, _, _ := bob.Receive(toSend[0])
+
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+	assertEquals(t, len(legacy.sent), 0)
+	assertEquals(t, d.UsesLegacy(), false)
+}
@@ -0,0 +1,65 @@
+package otr3
+
+import (
+	"io"
+	"math/big"
+)
+
+// EphemeralKeyProvider supplies the secret exponents of the ephemeral Diffie-Hellman keys, both for the AKE
+// and for the key rotation of a private conversation. It can be used to generate the keys somewhere else than
+// in this process, for example with a DRBG backed by a hardware security module.
+// Without a provider, the exponents are read from the Rand of the conversation.
+type EphemeralKeyProvider interface {
+	// EphemeralExponent returns a new secret exponent of at most size bytes. The conversation copies the exponent
+	// and wipes the returned one right away, so the provider shouldn't keep a reference to it.
+	EphemeralExponent(size int) (*big.Int, error)
+}
+
+// SetEphemeralKeyProvider sets the provider of the ephemeral Diffie-Hellman exponents. Setting it to nil
+// makes the conversation read the exponents from Rand again.
+func (c *Conversation) SetEphemeralKeyProvider(p EphemeralKeyProvider) {
+	c.ephemeralKeyProvider = p
+}
+
+// EphemeralKeyProvider returns the provider of the ephemeral Diffie-Hellman exponents, or nil if they are read from Rand
+func (c *Conversation) EphemeralKeyProvider() EphemeralKeyProvider {
+	return c.ephemeralKeyProvider
+}
+
+// randomExponents reads the exponents straight from a source of randomness
+type randomExponents struct {
+	io.Reader
+}
+
+func (r randomExponents) EphemeralExponent(size int) (*big.Int, error) {
+	return randSizedMPI(r.Reader, size)
+}
+
+// checkedExponents makes sure that the exponents of a provider can be used safely
+type checkedExponents struct {
+	EphemeralKeyProvider
+}
+
+func (p checkedExponents) EphemeralExponent(size int) (*big.Int, error) {
+	x, err := p.EphemeralKeyProvider.EphemeralExponent(size)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeBigInt(x)
+
+	if x == nil || x.Cmp(big.NewInt(1)) <= 0 || x.BitLen() > size*8 {
+		return nil, errInvalidEphemeralExponent
+	}
+	return new(big.Int).Set(x), nil
+}
+
+func (c *Conversation) ephemeralKeys() EphemeralKeyProvider {
+	if c.ephemeralKeyProvider != nil {
+		return checkedExponents{c.ephemeralKeyProvider}
+	}
+	return randomExponents{c.rand()}
+}
+
+func (c *Conversation) ephemeralExponent() (*big.Int, error) {
+	return c.ephemeralKeys().EphemeralExponent(c.version.dhExponentLength())
+}
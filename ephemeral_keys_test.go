@@ -0,0 +1,132 @@
+package otr3
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+)
+
+type fixedExponents struct {
+	exponents []*big.Int
+	sizes     []int
+	err       error
+}
+
+func (p *fixedExponents) EphemeralExponent(size int) (*big.Int, error) {
+	p.sizes = append(p.sizes, size)
+	if p.err != nil {
+		return nil, p.err
+	}
+	x := p.exponents[0]
+	p.exponents = p.exponents[1:]
+	return x, nil
+}
+
+func Test_dhCommitMessage_usesTheExponentFromTheEphemeralKeyProvider(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	x := bnFromHex("abcdef0123456789")
+	c.SetEphemeralKeyProvider(&fixedExponents{exponents: []*big.Int{new(big.Int).Set(x)}})
+
+	_, err := c.dhCommitMessage()
+
+	assertNil(t, err)
+	assertDeepEquals(t, c.ake.ourPublicValue, modExp(g1, x))
+}
+
+func Test_dhKeyMessage_usesTheExponentFromTheEphemeralKeyProvider(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	y := bnFromHex("0123456789abcdef")
+	c.SetEphemeralKeyProvider(&fixedExponents{exponents: []*big.Int{new(big.Int).Set(y)}})
+
+	_, err := c.dhKeyMessage()
+
+	assertNil(t, err)
+	assertDeepEquals(t, c.ake.ourPublicValue, modExp(g1, y))
+}
+
+func Test_ephemeralExponent_asksTheProviderForExponentsSizedByTheVersion(t *testing.T) {
+	for _, v := range []otrVersion{otrV2{}, otrV3{}} {
+		c := newConversation(v, fixtureRand())
+		p := &fixedExponents{exponents: []*big.Int{big.NewInt(42)}}
+		c.SetEphemeralKeyProvider(p)
+
+		c.ephemeralExponent()
+
+		assertDeepEquals(t, p.sizes, []int{v.dhExponentLength()})
+	}
+}
+
+func Test_ephemeralExponent_returnsTheErrorFromTheProvider(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	providerErr := errors.New("the HSM is unavailable")
+	c.SetEphemeralKeyProvider(&fixedExponents{err: providerErr})
+
+	_, err := c.ephemeralExponent()
+
+	assertEquals(t, err, providerErr)
+}
+
+func Test_ephemeralExponent_rejectsExponentsThatAreNotSafeToUse(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	tooLarge := new(big.Int).Lsh(big.NewInt(1), uint(otrV3{}.dhExponentLength()*8))
+
+	for _, x := range []*big.Int{nil, big.NewInt(0), big.NewInt(1), big.NewInt(-5), tooLarge} {
+		c.SetEphemeralKeyProvider(&fixedExponents{exponents: []*big.Int{x}})
+
+		_, err := c.ephemeralExponent()
+
+		assertEquals(t, err, errInvalidEphemeralExponent)
+	}
+}
+
+func Test_ephemeralExponent_wipesTheExponentOfTheProviderAfterCopyingIt(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	x := big.NewInt(42)
+	c.SetEphemeralKeyProvider(&fixedExponents{exponents: []*big.Int{x}})
+
+	res, _ := c.ephemeralExponent()
+
+	assertDeepEquals(t, res, big.NewInt(42))
+	assertEquals(t, x.Sign(), 0)
+}
+
+func Test_ephemeralExponent_wipesAnExponentItRejects(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	tooLarge := new(big.Int).Lsh(big.NewInt(1), uint(otrV3{}.dhExponentLength()*8))
+	c.SetEphemeralKeyProvider(&fixedExponents{exponents: []*big.Int{tooLarge}})
+
+	c.ephemeralExponent()
+
+	assertEquals(t, tooLarge.Sign(), 0)
+}
+
+func Test_ephemeralExponent_readsFromRandWithoutAProvider(t *testing.T) {
+	c := newConversation(otrV3{}, fixedRand([]string{"abcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcd"}))
+
+	x, err := c.ephemeralExponent()
+
+	assertNil(t, err)
+	assertDeepEquals(t, x, bnFromHex("abcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcd"))
+}
+
+func Test_ephemeralKeyProvider_isUsedForTheWholePrivateConversation(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	p := &fixedExponents{}
+	for i := 0; i < 10; i++ {
+		p.exponents = append(p.exponents, big.NewInt(int64(1000+i)))
+	}
+	alice.SetEphemeralKeyProvider(p)
+
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	for i := 0; i < 3; i++ {
+		msg, _ := bob.Send(ValidMessage("hello"))
+		alice.Receive(msg[0])
+		reply, _ := alice.Send(ValidMessage("hi"))
+		plain, _, err := bob.Receive(reply[0])
+
+		assertNil(t, err)
+		assertDeepEquals(t, plain, MessagePlaintext("hi"))
+	}
+
+	assertTrue(t, len(p.sizes) > 2)
+}
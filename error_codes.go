@@ -17,6 +17,9 @@ const (
 
 	// ErrorCodeMessageNotInPrivate means we received an encrypted message when not expecting it
 	ErrorCodeMessageNotInPrivate
+
+	// ErrorCodeUnsupportedVersion means the peer only offers protocol versions we don't support, like OTRv1
+	ErrorCodeUnsupportedVersion
 )
 
 // ErrorMessageHandler generates error messages for error codes
@@ -50,6 +53,8 @@ func (s ErrorCode) String() string {
 		return "ErrorCodeMessageMalformed"
 	case ErrorCodeMessageNotInPrivate:
 		return "ErrorCodeMessageNotInPrivate"
+	case ErrorCodeUnsupportedVersion:
+		return "ErrorCodeUnsupportedVersion"
 	default:
 		return "ERROR CODE: (THIS SHOULD NEVER HAPPEN)"
 	}
@@ -7,6 +7,7 @@ func Test_ErrorCode_hasValidStringImplementation(t *testing.T) {
 	assertEquals(t, ErrorCodeMessageUnreadable.String(), "ErrorCodeMessageUnreadable")
 	assertEquals(t, ErrorCodeMessageMalformed.String(), "ErrorCodeMessageMalformed")
 	assertEquals(t, ErrorCodeMessageNotInPrivate.String(), "ErrorCodeMessageNotInPrivate")
+	assertEquals(t, ErrorCodeUnsupportedVersion.String(), "ErrorCodeUnsupportedVersion")
 	assertEquals(t, ErrorCode(20000).String(), "ERROR CODE: (THIS SHOULD NEVER HAPPEN)")
 }
 
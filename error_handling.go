@@ -0,0 +1,56 @@
+package otr3
+
+// TransportAction tells the transport what to do with a message after Receive or Send returned an error for it.
+//
+// Errors returned from Receive and Send are meant for the transport and for logs - their text is not
+// written for the user and can reveal internal details. Everything the user should know about is
+// signaled through the event handlers instead:
+//
+//   - problems establishing a private conversation are signaled as MessageEventSetupError
+//   - encrypted messages we can't read are signaled as MessageEventReceivedMessageUnreadable,
+//     MessageEventReceivedMessageMalformed or MessageEventReceivedMessageNotInPrivate
+//   - messages we couldn't encrypt are signaled as MessageEventEncryptionError
+//   - sending after the peer ended the private conversation is signaled as MessageEventConnectionEnded
+//   - queued messages that won't be sent are signaled as MessageEventQueuedMessageNotSent
+//   - internal errors are signaled as MessageEventInternalError
+//
+// So an application should show events to the user, and use TransportActionFor to decide what to do with the message.
+type TransportAction int
+
+const (
+	// TransportNone means there was no error
+	TransportNone TransportAction = iota
+	// TransportDrop means the message can't be handled and should be dropped. Handing it in again will fail the same way
+	TransportDrop
+	// TransportRetry means the message couldn't be handled because of a temporary local problem,
+	// like the random source failing, and it can be handed in again later
+	TransportRetry
+)
+
+// String returns the string representation of the TransportAction
+func (a TransportAction) String() string {
+	switch a {
+	case TransportNone:
+		return "TransportNone"
+	case TransportDrop:
+		return "TransportDrop"
+	case TransportRetry:
+		return "TransportRetry"
+	default:
+		return "TRANSPORT ACTION: (THIS SHOULD NEVER HAPPEN)"
+	}
+}
+
+// TransportActionFor returns what the transport should do with a message that Receive or Send returned the given error for.
+// Errors that don't come from this library are returned by the random source or the keys, so they are considered temporary.
+func TransportActionFor(err error) TransportAction {
+	if err == nil {
+		return TransportNone
+	}
+
+	if oe, ok := err.(OtrError); ok && !oe.temporary {
+		return TransportDrop
+	}
+
+	return TransportRetry
+}
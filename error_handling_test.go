@@ -0,0 +1,41 @@
+package otr3
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_TransportAction_hasValidStringImplementation(t *testing.T) {
+	assertEquals(t, TransportNone.String(), "TransportNone")
+	assertEquals(t, TransportDrop.String(), "TransportDrop")
+	assertEquals(t, TransportRetry.String(), "TransportRetry")
+	assertEquals(t, TransportAction(42).String(), "TRANSPORT ACTION: (THIS SHOULD NEVER HAPPEN)")
+}
+
+func Test_TransportActionFor_returnsNoneWithoutError(t *testing.T) {
+	assertEquals(t, TransportActionFor(nil), TransportNone)
+}
+
+func Test_TransportActionFor_dropsMessagesThatCantBeHandled(t *testing.T) {
+	assertEquals(t, TransportActionFor(errInvalidOTRMessage), TransportDrop)
+	assertEquals(t, TransportActionFor(newOtrConflictError("counter regressed")), TransportDrop)
+}
+
+func Test_TransportActionFor_retriesMessagesThatFailedBecauseOfTemporaryProblems(t *testing.T) {
+	assertEquals(t, TransportActionFor(errShortRandomRead), TransportRetry)
+	assertEquals(t, TransportActionFor(errors.New("the random source is closed")), TransportRetry)
+}
+
+func Test_Receive_aMessageThatFailedBecauseOfTheRandomSourceCanBeRetried(t *testing.T) {
+	c := newConversation(nil, fixedRand([]string{"ABCD"}))
+	c.ourKeys = []PrivateKey{alicePrivateKey}
+	c.Policies = Policies(PolicyAllowV2 | PolicyAllowV3)
+
+	_, _, err := c.Receive(ValidMessage("?OTRv3?"))
+	assertEquals(t, TransportActionFor(err), TransportRetry)
+
+	c.Rand = fixtureRand()
+	_, toSend, err := c.Receive(ValidMessage("?OTRv3?"))
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 1)
+}
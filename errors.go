@@ -2,7 +2,6 @@ package otr3
 
 import "fmt"
 
-var errCantAuthenticateWithoutEncryption = newOtrError("can't authenticate a peer without a secure conversation established")
 var errCorruptEncryptedSignature = newOtrError("corrupt encrypted signature")
 var errEncryptedMessageWithNoSecureChannel = newOtrError("encrypted message received without encrypted session established")
 var errUnexpectedPlainMessage = newOtrError("plain message received when encryption was required")
@@ -10,17 +9,88 @@ var errInvalidOTRMessage = newOtrError("invalid OTR message")
 var errInvalidVersion = newOtrError("no valid version agreement could be found") //libotr ignores this situation
 var errNotWaitingForSMPSecret = newOtrError("not expected SMP secret to be provided now")
 var errReceivedMessageForOtherInstance = newOtrError("received message for other OTR instance") //not exactly an error - we should ignore these messages by default
-var errShortRandomRead = newOtrError("short read from random source")
+var errShortRandomRead = newOtrTemporaryError("short read from random source")
+var errInvalidEphemeralExponent = newOtrError("the ephemeral key provider returned an invalid exponent")
+var errRandomSourceUnhealthy = newOtrError("the random source failed its health tests and can't be used until it is reset")
 var errUnexpectedMessage = newOtrError("unexpected SMP message")
 var errUnsupportedOTRVersion = newOtrError("unsupported OTR version")
 var errWrongProtocolVersion = newOtrError("wrong protocol version")
 var errMessageNotInPrivate = newOtrError("message not in private")
 var errCannotSendUnencrypted = newOtrConflictError("cannot send message in unencrypted state")
+var errUnknownInstance = newOtrError("no conversation with the given instance")
+var errNoSecureInstance = newOtrError("no secure conversation with any instance")
+var errFragmentSizeTooSmall = newOtrError("fragment size is too small to hold a fragment")
+var errInvalidPaddingBuckets = newOtrError("padding buckets must be positive and in increasing order")
+var errVerificationExpired = newOtrError("the verification of the peer has expired and has to be done again")
+var errBadGxCommitment = newOtrError("bad commit MAC in reveal signature message")
+var errDHValueOutOfRange = newOtrError("DH value out of range")
+var errCounterRegressed = newOtrConflictError("counter regressed")
+var errWorkerPoolClosed = newOtrError("the worker pool has been closed")
+var errNonConformantQueryMessage = newOtrError("query message doesn't follow the specification")
+var errNonConformantEncoding = newOtrError("encoded OTR message doesn't follow the specification")
+var errNonConformantTLV = newOtrError("TLV doesn't follow the specification")
+var errNoAKEInProgress = newOtrError("no AKE in progress that is waiting for the peer")
+var errQueuedMessageExpired = newOtrError("the private conversation was established too long after the message was queued")
+var errCorruptSMPMessage = newOtrError("corrupt SMP message")
+var errNoSender = newOtrError("the conversation has no sender")
+var errUnknownDelivery = newOtrError("no pending delivery with the given id")
+var errInvalidFragmentLimits = newOtrError("fragment limits can't be negative")
+var errFragmentAssemblyTooLarge = newOtrError("the fragments of the message take more memory than allowed")
+var errFragmentAssemblyExpired = newOtrError("the rest of the fragmented message didn't arrive in time")
+var errFieldTooLong = newOtrError("a field in the message is longer than allowed")
+var errTruncatedField = newOtrError("a field in the message is truncated")
+var errInvalidFieldLimits = newOtrError("field limits can't be negative")
+var errInvalidOutboxLimits = newOtrError("outbox limits can't be negative")
+var errOutboxFull = newOtrError("the outbox is full")
+var errOutboxMessageExpired = newOtrError("the message waited in the outbox for too long")
+var errOutboxCleared = newOtrError("the outbox was cleared")
+var errCannotRefreshUnencrypted = newOtrError("can't refresh a conversation that isn't private")
+var errAKEVersionMismatch = newOtrError("the AKE messages are from different protocol versions")
+var errNotAnEventHandler = newOtrError("the event handler doesn't handle any kind of event")
+var errAsyncConversationClosed = newOtrError("the async conversation has been closed")
+var errUnauthenticatedPlaintext = newOtrError("received plaintext that didn't come from the private conversation")
+var errDeadlinesNotSupported = newOtrError("the stream doesn't support deadlines")
+var errUnauthenticatedPeer = newOtrError("the peer used a key that is neither expected nor trusted")
+
+// These errors are returned for data messages that can't be parsed, so an application can decide which of them
+// to show to the user and which to ignore.
+var (
+	// ErrDataMessageUnknownFlags is returned for a data message with flags set that the protocol doesn't define
+	ErrDataMessageUnknownFlags = newOtrError("data message has unknown flags set")
+	// ErrDataMessageUnsupportedVersion is returned for a data message from another protocol version than the conversation uses
+	ErrDataMessageUnsupportedVersion = newOtrError("data message has an unsupported protocol version")
+	// ErrDataMessageTruncatedHeader is returned for a data message that ends before its header does
+	ErrDataMessageTruncatedHeader = newOtrError("data message header is truncated")
+	// ErrDataMessageBadMPI is returned for a data message with a DH key that is corrupt or outside the group
+	ErrDataMessageBadMPI = newOtrError("data message has a bad MPI")
+)
+
+// ErrEmptyMessage is returned when sending an empty message that would be encrypted, either right away or once
+// it has been queued until the conversation is private. The peer would take an encrypted empty message for a
+// heartbeat, so there is no way to send one on purpose. Empty messages sent in plaintext are sent as they are
+var ErrEmptyMessage = newOtrError("can't send an empty message")
+
+// ErrAuthenticationNotInPrivate is returned when SMP is started, continued or received outside of a private conversation,
+// since the SMP messages can only be sent and received encrypted
+var ErrAuthenticationNotInPrivate = newOtrError("must be in a private conversation to authenticate")
+
+// SMPVerificationError is given with MessageEventSMPVerificationFailed when an SMP message from the peer
+// fails verification - for example because a zero knowledge proof is wrong. Message is the number of the
+// SMP message that failed, from 1 to 4. This is different from the secrets not matching, which isn't an error.
+type SMPVerificationError struct {
+	Message int
+	Reason  error
+}
+
+func (e SMPVerificationError) Error() string {
+	return fmt.Sprintf("otr: SMP message %d failed verification: %v", e.Message, e.Reason)
+}
 
 // OtrError is an error in the OTR library
 type OtrError struct {
-	msg      string
-	conflict bool
+	msg       string
+	conflict  bool
+	temporary bool
 }
 
 func newOtrError(s string) error {
@@ -31,6 +101,10 @@ func newOtrConflictError(s string) error {
 	return OtrError{msg: s, conflict: true}
 }
 
+func newOtrTemporaryError(s string) error {
+	return OtrError{msg: s, temporary: true}
+}
+
 func newOtrErrorf(format string, a ...interface{}) error {
 	return OtrError{msg: fmt.Sprintf(format, a...), conflict: false}
 }
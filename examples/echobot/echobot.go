@@ -0,0 +1,182 @@
+// Package echobot is an example of a program built on the otr3 package: a bot that talks OTR with
+// one peer over an in-memory network, verifies the peer with SMP and echoes back every private message.
+//
+// It uses a Manager for the instances of the peer, a MemoryTrustStore that remembers which
+// fingerprints have been verified, the event handlers and fragmentation, so it also shows how those
+// parts of the API fit together. Since it only uses the exported API, building it checks that they
+// still do.
+package echobot
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"github.com/coyim/otr3"
+)
+
+// Network is an in-memory network that keeps the messages sent to each participant in order, until
+// they are read. It plays the part of the IM server.
+type Network struct {
+	inboxes map[string][]otr3.ValidMessage
+}
+
+// NewNetwork returns an empty network
+func NewNetwork() *Network {
+	return &Network{inboxes: make(map[string][]otr3.ValidMessage)}
+}
+
+// Deliver puts the messages in the inbox of the given participant
+func (n *Network) Deliver(to string, msgs []otr3.ValidMessage) {
+	n.inboxes[to] = append(n.inboxes[to], msgs...)
+}
+
+// Next takes the oldest message from the inbox of the given participant, returning false if there is none
+func (n *Network) Next(to string) (otr3.ValidMessage, bool) {
+	inbox := n.inboxes[to]
+	if len(inbox) == 0 {
+		return nil, false
+	}
+	n.inboxes[to] = inbox[1:]
+	return inbox[0], true
+}
+
+// Bot is an echo bot. It requires encryption, and private messages are only echoed back once the peer
+// has proven with SMP that it knows the secret of the bot.
+type Bot struct {
+	name    string
+	peer    string
+	secret  []byte
+	network *Network
+	manager *otr3.Manager
+	trust   *otr3.MemoryTrustStore
+
+	// Log has a line for every event the bot has been told about, oldest first
+	Log []string
+}
+
+// New creates a bot with the given name, that talks to the peer with the given name over the network.
+// The bot never asks the peer anything itself - it answers the SMP exchanges the peer starts with the
+// secret, and only echoes the messages of an instance of the peer that has been verified that way.
+func New(name, peer string, key otr3.PrivateKey, secret []byte, network *Network) (*Bot, error) {
+	b := &Bot{
+		name:    name,
+		peer:    peer,
+		secret:  secret,
+		network: network,
+		trust:   otr3.NewMemoryTrustStore(),
+	}
+
+	master, err := otr3.NewConversation(
+		otr3.WithRand(rand.Reader),
+		otr3.WithPrivateKey(key),
+		otr3.WithPolicies(otr3.PolicyAllowV2, otr3.PolicyAllowV3, otr3.PolicyRequireEncryption, otr3.PolicyErrorStartAKE),
+		otr3.WithFragmentSize(otr3.IRCFragmentation.Size),
+		otr3.WithEventHandler(b),
+	)
+	if err != nil {
+		return nil, err
+	}
+	master.SetTrustStore(b.trust, peer)
+	master.SetTrustOnSMPSuccess(true)
+	master.InitializeInstanceTag(0)
+
+	b.manager = otr3.NewManager(master)
+	return b, nil
+}
+
+// Fingerprint returns the fingerprint of the key of the bot
+func (b *Bot) Fingerprint() []byte {
+	return b.manager.Master().GetOurKeys()[0].PublicKey().Fingerprint()
+}
+
+// IsPeerTrusted returns true once the peer of the bot has been verified with SMP
+func (b *Bot) IsPeerTrusted() bool {
+	for _, tag := range b.manager.Instances() {
+		if b.manager.Instance(tag).IsTheirFingerprintTrusted() {
+			return true
+		}
+	}
+	return false
+}
+
+// Step handles the oldest message waiting for the bot, and returns false if there was none
+func (b *Bot) Step() (bool, error) {
+	msg, ok := b.network.Next(b.name)
+	if !ok {
+		return false, nil
+	}
+
+	plain, toSend, err := b.manager.Receive(msg)
+	b.network.Deliver(b.peer, toSend)
+	if err != nil {
+		return true, err
+	}
+
+	if err := b.answerSMP(); err != nil {
+		return true, err
+	}
+
+	if len(plain) == 0 {
+		return true, nil
+	}
+
+	for _, tag := range b.verifiedInstances() {
+		echo, err := b.manager.Send(tag, otr3.ValidMessage(append([]byte("echo: "), plain...)))
+		if err != nil {
+			return true, err
+		}
+		b.network.Deliver(b.peer, echo)
+	}
+
+	return true, nil
+}
+
+// verifiedInstances returns the instances of the peer the bot has a private conversation with, and that
+// have been verified. The Manager gives the event handler of the bot to every instance, so the security
+// events can't tell the instances apart - the conversations are asked instead.
+func (b *Bot) verifiedInstances() []uint32 {
+	var verified []uint32
+	for _, tag := range b.manager.Instances() {
+		c := b.manager.Instance(tag)
+		if c.IsEncrypted() && c.IsTheirFingerprintTrusted() {
+			verified = append(verified, tag)
+		}
+	}
+	return verified
+}
+
+// answerSMP gives the secret to every instance of the peer that has asked for it
+func (b *Bot) answerSMP() error {
+	for _, tag := range b.manager.Instances() {
+		c := b.manager.Instance(tag)
+		if c.SMPState() != "SMPSTATE_WAITINGFORSECRET" {
+			continue
+		}
+
+		toSend, err := c.ProvideAuthenticationSecret(b.secret)
+		if err != nil {
+			return err
+		}
+		b.network.Deliver(b.peer, toSend)
+	}
+	return nil
+}
+
+func (b *Bot) logf(format string, args ...interface{}) {
+	b.Log = append(b.Log, fmt.Sprintf(format, args...))
+}
+
+// HandleSecurityEvent implements otr3.SecurityEventHandler
+func (b *Bot) HandleSecurityEvent(event otr3.SecurityEvent) {
+	b.logf("security: %v", event)
+}
+
+// HandleSMPEvent implements otr3.SMPEventHandler
+func (b *Bot) HandleSMPEvent(event otr3.SMPEvent, progressPercent int, question string) {
+	b.logf("smp: %v %d%%", event, progressPercent)
+}
+
+// HandleMessageEvent implements otr3.MessageEventHandler
+func (b *Bot) HandleMessageEvent(event otr3.MessageEvent, message []byte, err error, trace ...interface{}) {
+	b.logf("message: %v %v", event, err)
+}
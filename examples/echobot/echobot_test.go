@@ -0,0 +1,140 @@
+package echobot
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/coyim/otr3"
+)
+
+func generateKey(t *testing.T) otr3.PrivateKey {
+	key := &otr3.DSAPrivateKey{}
+	if err := key.Generate(rand.Reader); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// exchange lets the bot and the user handle the messages waiting for them until there are none left,
+// and returns the plaintexts the user received
+func exchange(t *testing.T, network *Network, bot *Bot, user *otr3.Conversation) []string {
+	var received []string
+	for {
+		handled, err := bot.Step()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		msg, ok := network.Next("user")
+		if ok {
+			plain, toSend, err := user.Receive(msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			network.Deliver("bot", toSend)
+			if len(plain) > 0 {
+				received = append(received, string(plain))
+			}
+		}
+
+		if !handled && !ok {
+			return received
+		}
+	}
+}
+
+func newUser(t *testing.T, botFingerprint []byte) *otr3.Conversation {
+	user, err := otr3.NewConversation(
+		otr3.WithRand(rand.Reader),
+		otr3.WithPrivateKey(generateKey(t)),
+		otr3.WithPolicies(otr3.PolicyAllowV3, otr3.PolicyRequireEncryption),
+		otr3.WithFragmentSize(otr3.IRCFragmentation.Size),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user.InitializeInstanceTag(0)
+	user.ExpectTheirFingerprint(botFingerprint)
+	return user
+}
+
+func Test_Bot_echoesPrivateMessagesOnceThePeerIsVerified(t *testing.T) {
+	network := NewNetwork()
+	bot, err := New("bot", "user", generateKey(t), []byte("the park"), network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := newUser(t, bot.Fingerprint())
+
+	network.Deliver("bot", []otr3.ValidMessage{user.QueryMessage()})
+	exchange(t, network, bot, user)
+	if !user.IsEncrypted() {
+		t.Fatal("the AKE didn't finish")
+	}
+
+	toSend, _ := user.Send(otr3.ValidMessage("before verifying"))
+	network.Deliver("bot", toSend)
+	if received := exchange(t, network, bot, user); len(received) != 0 {
+		t.Fatalf("expected no echo before verifying, got %v", received)
+	}
+
+	toSend, _ = user.StartAuthenticate("", []byte("the park"))
+	network.Deliver("bot", toSend)
+	exchange(t, network, bot, user)
+	if !bot.IsPeerTrusted() {
+		t.Fatalf("expected the user to be trusted after SMP, log: %v", bot.Log)
+	}
+
+	long := bytes.Repeat([]byte("a long message that has to be fragmented "), 20)
+	toSend, _ = user.Send(otr3.ValidMessage(long))
+	if len(toSend) < 2 {
+		t.Fatalf("expected the message to be fragmented, got %d messages", len(toSend))
+	}
+	network.Deliver("bot", toSend)
+	received := exchange(t, network, bot, user)
+
+	if len(received) != 1 || received[0] != "echo: "+string(long) {
+		t.Fatalf("expected the message to be echoed, got %v", received)
+	}
+}
+
+func Test_Bot_doesntTrustAPeerWithTheWrongSecret(t *testing.T) {
+	network := NewNetwork()
+	bot, _ := New("bot", "user", generateKey(t), []byte("the park"), network)
+	user := newUser(t, bot.Fingerprint())
+
+	network.Deliver("bot", []otr3.ValidMessage{user.QueryMessage()})
+	exchange(t, network, bot, user)
+	toSend, _ := user.StartAuthenticate("", []byte("the beach"))
+	network.Deliver("bot", toSend)
+	exchange(t, network, bot, user)
+
+	if bot.IsPeerTrusted() {
+		t.Fatal("expected the user not to be trusted")
+	}
+}
+
+func Test_Bot_doesntEchoToAnInstanceThatIsntVerified(t *testing.T) {
+	network := NewNetwork()
+	bot, _ := New("bot", "user", generateKey(t), []byte("the park"), network)
+	verified := newUser(t, bot.Fingerprint())
+	network.Deliver("bot", []otr3.ValidMessage{verified.QueryMessage()})
+	exchange(t, network, bot, verified)
+	toSend, _ := verified.StartAuthenticate("", []byte("the park"))
+	network.Deliver("bot", toSend)
+	exchange(t, network, bot, verified)
+
+	toSend, _ = verified.End()
+	network.Deliver("bot", toSend)
+	exchange(t, network, bot, verified)
+	other := newUser(t, bot.Fingerprint())
+	network.Deliver("bot", []otr3.ValidMessage{other.QueryMessage()})
+	exchange(t, network, bot, other)
+
+	toSend, _ = other.Send(otr3.ValidMessage("hello"))
+	network.Deliver("bot", toSend)
+	if received := exchange(t, network, bot, other); len(received) != 0 {
+		t.Fatalf("expected no echo to an instance that isn't verified, got %v", received)
+	}
+}
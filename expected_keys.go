@@ -0,0 +1,49 @@
+package otr3
+
+import "bytes"
+
+// ExpectTheirKey registers a public key we expect the peer to use, before any AKE has happened.
+// This can be called several times if the peer is known to have several keys.
+// Every time an AKE finishes, the key the peer used is checked against the expected keys,
+// and either TheirKeyExpected or TheirKeyUnexpected is signalled.
+func (c *Conversation) ExpectTheirKey(key PublicKey) {
+	c.ExpectTheirFingerprint(key.Fingerprint())
+}
+
+// ExpectTheirFingerprint works like ExpectTheirKey, for when only the fingerprint of the expected key is known
+func (c *Conversation) ExpectTheirFingerprint(fingerprint []byte) {
+	c.expectedFingerprints = append(c.expectedFingerprints, makeCopy(fingerprint))
+}
+
+// HasExpectedKeys returns true if any keys we expect the peer to use have been registered
+func (c *Conversation) HasExpectedKeys() bool {
+	return len(c.expectedFingerprints) > 0
+}
+
+// IsTheirKeyExpected returns true if the key the peer used in the last AKE is one of the keys we expect it to use
+func (c *Conversation) IsTheirKeyExpected() bool {
+	if c.theirKey == nil {
+		return false
+	}
+
+	fpr := c.theirKey.Fingerprint()
+	for _, expected := range c.expectedFingerprints {
+		if bytes.Equal(expected, fpr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *Conversation) signalExpectedKey() {
+	if !c.HasExpectedKeys() {
+		return
+	}
+
+	if c.IsTheirKeyExpected() {
+		c.securityEvent(TheirKeyExpected)
+	} else {
+		c.securityEvent(TheirKeyUnexpected)
+	}
+}
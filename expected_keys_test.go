@@ -0,0 +1,62 @@
+package otr3
+
+import "testing"
+
+func collectSecurityEvents(c *Conversation) *[]SecurityEvent {
+	events := []SecurityEvent{}
+	c.SetSecurityEventHandler(dynamicSecurityEventHandler{func(event SecurityEvent) {
+		events = append(events, event)
+	}})
+	return &events
+}
+
+func Test_ExpectTheirKey_signalsTheirKeyExpectedWhenThePeerUsesTheExpectedKey(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	bob.ExpectTheirKey(alicePrivateKey.PublicKey())
+	events := collectSecurityEvents(bob)
+
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	assertDeepEquals(t, *events, []SecurityEvent{GoneSecure, TheirKeyExpected})
+	assertEquals(t, bob.IsTheirKeyExpected(), true)
+}
+
+func Test_ExpectTheirKey_signalsTheirKeyUnexpectedWhenThePeerUsesAnotherKey(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	bob.ExpectTheirKey(bobPrivateKey.PublicKey())
+	events := collectSecurityEvents(bob)
+
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	assertDeepEquals(t, *events, []SecurityEvent{GoneSecure, TheirKeyUnexpected})
+	assertEquals(t, bob.IsEncrypted(), true)
+	assertEquals(t, bob.IsTheirKeyExpected(), false)
+}
+
+func Test_ExpectTheirFingerprint_acceptsAnyOfSeveralExpectedFingerprints(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	bob.ExpectTheirFingerprint(bobPrivateKey.PublicKey().Fingerprint())
+	bob.ExpectTheirFingerprint(alicePrivateKey.PublicKey().Fingerprint())
+	events := collectSecurityEvents(bob)
+
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	assertDeepEquals(t, *events, []SecurityEvent{GoneSecure, TheirKeyExpected})
+}
+
+func Test_akeHasFinished_doesntSignalAnythingAboutTheKeyWithoutExpectedKeys(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	events := collectSecurityEvents(bob)
+
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	assertDeepEquals(t, *events, []SecurityEvent{GoneSecure})
+	assertEquals(t, bob.HasExpectedKeys(), false)
+}
+
+func Test_IsTheirKeyExpected_returnsFalseBeforeAnyAKE(t *testing.T) {
+	c := &Conversation{}
+	c.ExpectTheirKey(alicePrivateKey.PublicKey())
+
+	assertEquals(t, c.IsTheirKeyExpected(), false)
+}
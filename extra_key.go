@@ -2,22 +2,35 @@ package otr3
 
 import "github.com/coyim/gotrax"
 
+// The usage data has to fit in a TLV together with the usage
+const maxExtraSymmetricKeyUsageDataLength = 0xFFFF - 4
+
 func (c *Conversation) processExtraSymmetricKeyTLV(t tlv, x dataMessageExtra) (toSend *tlv, err error) {
 	rest, usage, ok := gotrax.ExtractWord(t.tlvValue[:t.tlvLength])
 	if ok {
-		c.receivedSymKey(usage, rest, x.key)
+		c.receivedSymKey(usage, makeCopy(rest), x.key)
 	}
 	return nil, nil
 }
 
 // UseExtraSymmetricKey takes a usage parameter and optional usageData and returns the current symmetric key
-// and a set of messages to send in order to ask the peer to use the same symmetric key for the usage defined
+// and a set of messages to send in order to ask the peer to use the same symmetric key for the usage defined.
+// The peer receives the same key, the usage and the usage data through its ReceivedKeyHandler.
+// The extra symmetric key only exists in OTRv3.
 func (c *Conversation) UseExtraSymmetricKey(usage uint32, usageData []byte) ([]byte, []ValidMessage, error) {
 	if c.msgState != encrypted ||
 		c.keys.theirKeyID == 0 {
 		return nil, nil, newOtrError("cannot send message in current state")
 	}
 
+	if c.version.protocolVersion() < 3 {
+		return nil, nil, newOtrError("the extra symmetric key requires OTRv3")
+	}
+
+	if len(usageData) > maxExtraSymmetricKeyUsageDataLength {
+		return nil, nil, newOtrError("usage data is too long")
+	}
+
 	t := tlv{
 		tlvType:   tlvTypeExtraSymmetricKey,
 		tlvLength: 4 + uint16(len(usageData)),
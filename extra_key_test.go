@@ -100,7 +100,7 @@ func Test_UseExtraSymmetricKey_returnsErrorIfTheirKeyIDIsZero(t *testing.T) {
 
 func Test_UseExtraSymmetricKey_generatesADataMessageWithTheDataProvided(t *testing.T) {
 	c := newConversation(otrV3{}, rand.Reader)
-	c.Policies.add(allowV3)
+	c.Policies.Add(PolicyAllowV3)
 	c.ourCurrentKey = bobPrivateKey
 
 	_, c.keys = fixtureDataMsg(plainDataMsg{message: []byte("something")})
@@ -120,7 +120,7 @@ func Test_UseExtraSymmetricKey_generatesADataMessageWithTheDataProvided(t *testi
 
 func Test_UseExtraSymmetricKey_generatesADataMessageWithIgnoreUnreadableSet(t *testing.T) {
 	c := newConversation(otrV3{}, rand.Reader)
-	c.Policies.add(allowV3)
+	c.Policies.Add(PolicyAllowV3)
 	c.ourCurrentKey = bobPrivateKey
 
 	_, c.keys = fixtureDataMsg(plainDataMsg{message: []byte("something")})
@@ -132,7 +132,7 @@ func Test_UseExtraSymmetricKey_generatesADataMessageWithIgnoreUnreadableSet(t *t
 
 func Test_UseExtraSymmetricKey_returnsTheGeneratedSymmetricKey(t *testing.T) {
 	c := newConversation(otrV3{}, rand.Reader)
-	c.Policies.add(allowV3)
+	c.Policies.Add(PolicyAllowV3)
 	c.ourCurrentKey = bobPrivateKey
 
 	_, c.keys = fixtureDataMsg(plainDataMsg{message: []byte("something")})
@@ -140,3 +140,42 @@ func Test_UseExtraSymmetricKey_returnsTheGeneratedSymmetricKey(t *testing.T) {
 	k, _, _ := c.UseExtraSymmetricKey(0x1234, []byte{0xAB, 0xCD, 0xEE})
 	assertDeepEquals(t, k, bytesFromHex("0e1810c7c62c3bace6450dcbef16af8a271b5ac93030b83e9d0d80e0641e3c18"))
 }
+
+func Test_UseExtraSymmetricKey_returnsErrorForOTRv2(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.version = otrV2{}
+
+	_, _, err := c.UseExtraSymmetricKey(0x1234, nil)
+	assertDeepEquals(t, err, newOtrError("the extra symmetric key requires OTRv3"))
+}
+
+func Test_UseExtraSymmetricKey_returnsErrorIfTheUsageDataDoesntFitInATLV(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+
+	_, _, err := c.UseExtraSymmetricKey(0x1234, make([]byte, 0xFFFC))
+	assertDeepEquals(t, err, newOtrError("usage data is too long"))
+}
+
+func Test_UseExtraSymmetricKey_givesThePeerTheSameKeyAndTheUsageData(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	var receivedUsage uint32
+	var receivedUsageData, receivedKey []byte
+	bob.SetReceivedKeyHandler(dynamicReceivedKeyHandler{func(usage uint32, usageData []byte, symkey []byte) {
+		receivedUsage, receivedUsageData, receivedKey = usage, usageData, symkey
+	}})
+
+	key, toSend, err := alice.UseExtraSymmetricKey(0x1234, []byte("transfer.zip"))
+	assertNil(t, err)
+
+	plain, _, err := bob.Receive(toSend[0])
+	assertNil(t, err)
+	assertNil(t, plain)
+	assertEquals(t, receivedUsage, uint32(0x1234))
+	assertDeepEquals(t, receivedUsageData, []byte("transfer.zip"))
+	assertDeepEquals(t, receivedKey, key)
+	assertEquals(t, len(key), 32)
+}
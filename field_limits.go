@@ -0,0 +1,109 @@
+package otr3
+
+import (
+	"math/big"
+
+	"github.com/coyim/gotrax"
+)
+
+const (
+	defaultMaxMPILength  = 1024
+	defaultMaxDataLength = 1 << 20
+
+	// every MPI takes at least the four bytes of its length
+	minMPISize = 4
+)
+
+// FieldLimits are the largest MPI and DATA fields accepted in messages from the peer.
+// A message with a longer field is ignored, so a forged length prefix can't make us
+// allocate or hold on to large amounts of memory.
+type FieldLimits struct {
+	// MaxMPILength is the largest number of bytes in an MPI. Zero means the default of 1024 bytes,
+	// which is enough for DSA keys of 8192 bits
+	MaxMPILength int
+	// MaxDataLength is the largest number of bytes in a DATA field. Zero means the default of 1 MiB
+	MaxDataLength int
+}
+
+var defaultFieldLimits = FieldLimits{
+	MaxMPILength:  defaultMaxMPILength,
+	MaxDataLength: defaultMaxDataLength,
+}
+
+// SetFieldLimits sets the largest MPI and DATA fields accepted in messages from the peer.
+// It returns an error if a limit is negative.
+func (c *Conversation) SetFieldLimits(l FieldLimits) error {
+	if l.MaxMPILength < 0 || l.MaxDataLength < 0 {
+		return errInvalidFieldLimits
+	}
+
+	c.fieldLimits = l
+	return nil
+}
+
+// FieldLimits returns the largest MPI and DATA fields accepted in messages from the peer,
+// with the defaults filled in for limits that haven't been set
+func (c *Conversation) FieldLimits() FieldLimits {
+	l := c.fieldLimits
+	if l.MaxMPILength == 0 {
+		l.MaxMPILength = defaultMaxMPILength
+	}
+	if l.MaxDataLength == 0 {
+		l.MaxDataLength = defaultMaxDataLength
+	}
+	return l
+}
+
+// extractData works like gotrax.ExtractData, but returns errFieldTooLong without looking
+// further if the length prefix is larger than the limit
+func (l FieldLimits) extractData(d []byte) (rest []byte, data []byte, err error) {
+	if _, length, ok := gotrax.ExtractWord(d); ok && uint64(length) > uint64(l.MaxDataLength) {
+		return nil, nil, errFieldTooLong
+	}
+
+	rest, data, ok := gotrax.ExtractData(d)
+	if !ok {
+		return nil, nil, errTruncatedField
+	}
+	return rest, data, nil
+}
+
+// extractMPI works like gotrax.ExtractMPI, but returns errFieldTooLong without looking
+// further if the length prefix is larger than the limit
+func (l FieldLimits) extractMPI(d []byte) (rest []byte, mpi *big.Int, err error) {
+	if _, length, ok := gotrax.ExtractWord(d); ok && uint64(length) > uint64(l.MaxMPILength) {
+		return nil, nil, errFieldTooLong
+	}
+
+	rest, mpi, ok := gotrax.ExtractMPI(d)
+	if !ok {
+		return nil, nil, errTruncatedField
+	}
+	return rest, mpi, nil
+}
+
+// extractMPIs works like gotrax.ExtractMPIs, but checks every MPI against the limit. The count
+// isn't trusted either - the result is never larger than the number of MPIs that can fit in the data
+func (l FieldLimits) extractMPIs(d []byte) (rest []byte, mpis []*big.Int, err error) {
+	rest, count, ok := gotrax.ExtractWord(d)
+	if !ok || uint64(count) > uint64(len(rest)/minMPISize) {
+		return nil, nil, errTruncatedField
+	}
+
+	mpis = make([]*big.Int, int(count))
+	for i := range mpis {
+		if rest, mpis[i], err = l.extractMPI(rest); err != nil {
+			return nil, nil, err
+		}
+	}
+	return rest, mpis, nil
+}
+
+// fieldError returns errFieldTooLong if that was the reason a field couldn't be extracted,
+// and the error describing the corrupt message otherwise
+func fieldError(err, corrupt error) error {
+	if err == errFieldTooLong {
+		return err
+	}
+	return corrupt
+}
@@ -0,0 +1,107 @@
+package otr3
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/coyim/gotrax"
+)
+
+func Test_SetFieldLimits_returnsErrorForNegativeLimits(t *testing.T) {
+	c := &Conversation{}
+
+	assertEquals(t, c.SetFieldLimits(FieldLimits{MaxMPILength: -1}), errInvalidFieldLimits)
+	assertEquals(t, c.SetFieldLimits(FieldLimits{MaxDataLength: -1}), errInvalidFieldLimits)
+	assertDeepEquals(t, c.FieldLimits(), defaultFieldLimits)
+}
+
+func Test_FieldLimits_fillsInTheDefaultsForLimitsThatArentSet(t *testing.T) {
+	c := &Conversation{}
+
+	assertNil(t, c.SetFieldLimits(FieldLimits{MaxMPILength: 200}))
+
+	assertDeepEquals(t, c.FieldLimits(), FieldLimits{MaxMPILength: 200, MaxDataLength: defaultMaxDataLength})
+}
+
+func Test_extractData_returnsErrorIfTheDataIsLongerThanTheLimit(t *testing.T) {
+	d := gotrax.AppendData(nil, []byte("hello world"))
+
+	_, _, err := FieldLimits{MaxDataLength: 10}.extractData(d)
+	assertEquals(t, err, errFieldTooLong)
+
+	_, data, err := FieldLimits{MaxDataLength: 11}.extractData(d)
+	assertNil(t, err)
+	assertDeepEquals(t, data, []byte("hello world"))
+}
+
+func Test_extractData_returnsErrorForAForgedLengthWithoutTheData(t *testing.T) {
+	_, _, err := defaultFieldLimits.extractData([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0x01})
+	assertEquals(t, err, errFieldTooLong)
+
+	_, _, err = defaultFieldLimits.extractData([]byte{0x00, 0x00, 0x00, 0x02, 0x01})
+	assertEquals(t, err, errTruncatedField)
+}
+
+func Test_extractMPI_returnsErrorIfTheMPIIsLongerThanTheLimit(t *testing.T) {
+	d := gotrax.AppendMPI(nil, big.NewInt(0x010203))
+
+	_, _, err := FieldLimits{MaxMPILength: 2}.extractMPI(d)
+	assertEquals(t, err, errFieldTooLong)
+
+	_, mpi, err := FieldLimits{MaxMPILength: 3}.extractMPI(d)
+	assertNil(t, err)
+	assertDeepEquals(t, mpi, big.NewInt(0x010203))
+}
+
+func Test_extractMPIs_doesntTrustTheCount(t *testing.T) {
+	d := gotrax.AppendWord(nil, 0xFFFFFFFF)
+	d = gotrax.AppendMPI(d, big.NewInt(1))
+
+	_, _, err := defaultFieldLimits.extractMPIs(d)
+	assertEquals(t, err, errTruncatedField)
+}
+
+func Test_extractMPIs_returnsErrorIfAnyMPIIsLongerThanTheLimit(t *testing.T) {
+	d := gotrax.AppendMPIs(gotrax.AppendWord(nil, 2), big.NewInt(1), big.NewInt(0x010203))
+
+	_, _, err := FieldLimits{MaxMPILength: 2}.extractMPIs(d)
+	assertEquals(t, err, errFieldTooLong)
+
+	_, mpis, err := FieldLimits{MaxMPILength: 3}.extractMPIs(d)
+	assertNil(t, err)
+	assertDeepEquals(t, mpis, []*big.Int{big.NewInt(1), big.NewInt(0x010203)})
+}
+
+func Test_smpMessage_returnsErrorIfAnMPIIsLongerThanTheLimit(t *testing.T) {
+	tlv := fixtureMessage2().tlv()
+
+	_, err := tlv.smpMessage(FieldLimits{MaxMPILength: 10})
+	assertEquals(t, err, errFieldTooLong)
+}
+
+func Test_Receive_ignoresADataMessageWithAFieldLongerThanTheLimit(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	assertNil(t, bob.SetFieldLimits(FieldLimits{MaxDataLength: 4}))
+	before := snapshotOf(bob)
+
+	toBob, _ := alice.Send(ValidMessage("hello"))
+	plain, toSend, err := bob.Receive(toBob[0])
+
+	assertEquals(t, err, errFieldTooLong)
+	assertNil(t, plain)
+	assertNil(t, toSend)
+	assertDeepEquals(t, snapshotOf(bob), before)
+}
+
+func Test_Receive_ignoresADHCommitMessageWithAFieldLongerThanTheLimit(t *testing.T) {
+	_, bob, dhCommit := akeUntil(1)
+	assertNil(t, bob.SetFieldLimits(FieldLimits{MaxDataLength: 100}))
+	before := snapshotOf(bob)
+
+	_, toSend, err := bob.Receive(dhCommit)
+
+	assertEquals(t, err, errFieldTooLong)
+	assertNil(t, toSend)
+	assertDeepEquals(t, snapshotOf(bob), before)
+}
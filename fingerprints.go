@@ -0,0 +1,149 @@
+package otr3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"io"
+	"os"
+	"strings"
+)
+
+// These are the values of the trust column of a libotr fingerprint store that
+// Pidgin and libotr itself write. libotr considers a fingerprint trusted if the
+// column has any value at all.
+const (
+	// TrustVerified is used for fingerprints the user has verified manually
+	TrustVerified = "verified"
+	// TrustSMP is used for fingerprints verified using the Socialist Millionaires' Protocol
+	TrustSMP = "smp"
+)
+
+// KnownFingerprint is an entry of a libotr fingerprint store. It records a fingerprint
+// of a peer that one of our accounts has talked to, and how much we trust it.
+type KnownFingerprint struct {
+	Username    string
+	Account     string
+	Protocol    string
+	Fingerprint []byte
+	Trust       string
+}
+
+// IsTrusted returns true if the fingerprint has been verified in any way
+func (kf *KnownFingerprint) IsTrusted() bool {
+	return kf.Trust != ""
+}
+
+// FormatFingerprint returns the human readable rendering of a fingerprint used by libotr and most OTR clients:
+// upper case hex digits in groups of eight, separated by spaces, for example
+// "12345678 9ABCDEF0 12345678 9ABCDEF0 12345678" for a fingerprint returned by PublicKey.Fingerprint()
+func FormatFingerprint(fpr []byte) string {
+	encoded := strings.ToUpper(hex.EncodeToString(fpr))
+
+	groups := make([]string, 0, (len(encoded)+7)/8)
+	for len(encoded) > 8 {
+		groups = append(groups, encoded[:8])
+		encoded = encoded[8:]
+	}
+	if len(encoded) > 0 {
+		groups = append(groups, encoded)
+	}
+
+	return strings.Join(groups, " ")
+}
+
+// ImportFingerprintsFromFile will read the libotr formatted fingerprint file (usually called otr.fingerprints)
+// given and return all entries defined in it
+func ImportFingerprintsFromFile(fname string) ([]*KnownFingerprint, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ImportFingerprints(f)
+}
+
+// ImportFingerprints will read the libotr formatted fingerprint data given and return all entries defined in it.
+// Just like libotr, lines that can't be parsed are skipped.
+func ImportFingerprints(r io.Reader) ([]*KnownFingerprint, error) {
+	var result []*KnownFingerprint
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if kf, ok := parseFingerprintLine(line); ok {
+			result = append(result, kf)
+		}
+
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseFingerprintLine parses a line of the form "username<TAB>accountname<TAB>protocol<TAB>fingerprint[<TAB>trust]",
+// where the fingerprint is written as 40 hex digits
+func parseFingerprintLine(line string) (*KnownFingerprint, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	fields := strings.Split(line, "\t")
+	if len(fields) != 4 && len(fields) != 5 {
+		return nil, false
+	}
+
+	if len(fields[3]) != 40 {
+		return nil, false
+	}
+	fpr, err := hex.DecodeString(fields[3])
+	if err != nil {
+		return nil, false
+	}
+
+	kf := &KnownFingerprint{
+		Username:    fields[0],
+		Account:     fields[1],
+		Protocol:    fields[2],
+		Fingerprint: fpr,
+	}
+	if len(fields) == 5 {
+		kf.Trust = fields[4]
+	}
+
+	return kf, true
+}
+
+// ExportFingerprintsToFile will create the named file (or truncate it) and write all the entries to that file in libotr format
+func ExportFingerprintsToFile(fps []*KnownFingerprint, fname string) error {
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return ExportFingerprints(fps, f)
+}
+
+// ExportFingerprints will write all the entries given in libotr format
+func ExportFingerprints(fps []*KnownFingerprint, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, kf := range fps {
+		bw.Write(exportFingerprintLine(kf))
+	}
+	return bw.Flush()
+}
+
+func exportFingerprintLine(kf *KnownFingerprint) []byte {
+	var b bytes.Buffer
+	b.WriteString(kf.Username)
+	b.WriteByte('\t')
+	b.WriteString(kf.Account)
+	b.WriteByte('\t')
+	b.WriteString(kf.Protocol)
+	b.WriteByte('\t')
+	b.WriteString(hex.EncodeToString(kf.Fingerprint))
+	b.WriteByte('\t')
+	b.WriteString(kf.Trust)
+	b.WriteByte('\n')
+	return b.Bytes()
+}
@@ -0,0 +1,112 @@
+package otr3
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+const libOTRFingerprints = "bob@example.org\talice@example.com\tprpl-jabber\t0bb01c360424522e94ee9c346ce877a1a4288b2f\tverified\n" +
+	"bob@example.org/phone\talice@example.com\tprpl-jabber\t9df0a6d4c3a7e1f8bd74fac5df2ba1b3b3a24ba1\t\n" +
+	"carol\talice\tprpl-irc\tda39a3ee5e6b4b0d3255bfef95601890afd80709\tsmp\n"
+
+func Test_ImportFingerprints_readsAllEntriesInTheLibotrFormat(t *testing.T) {
+	res, err := ImportFingerprints(bytes.NewBufferString(libOTRFingerprints))
+
+	assertNil(t, err)
+	assertEquals(t, len(res), 3)
+	assertDeepEquals(t, res[0], &KnownFingerprint{
+		Username:    "bob@example.org",
+		Account:     "alice@example.com",
+		Protocol:    "prpl-jabber",
+		Fingerprint: bytesFromHex("0bb01c360424522e94ee9c346ce877a1a4288b2f"),
+		Trust:       TrustVerified,
+	})
+	assertEquals(t, res[0].IsTrusted(), true)
+	assertEquals(t, res[1].Username, "bob@example.org/phone")
+	assertEquals(t, res[1].IsTrusted(), false)
+	assertEquals(t, res[2].Trust, TrustSMP)
+	assertEquals(t, res[2].IsTrusted(), true)
+}
+
+func Test_ImportFingerprints_acceptsLinesWithoutATrustColumn(t *testing.T) {
+	res, err := ImportFingerprints(bytes.NewBufferString("bob\talice\tprpl-irc\tda39a3ee5e6b4b0d3255bfef95601890afd80709\n"))
+
+	assertNil(t, err)
+	assertEquals(t, len(res), 1)
+	assertEquals(t, res[0].Trust, "")
+}
+
+func Test_ImportFingerprints_acceptsALastLineWithoutNewlineAndWindowsLineEndings(t *testing.T) {
+	res, err := ImportFingerprints(bytes.NewBufferString(
+		"bob\talice\tprpl-irc\tda39a3ee5e6b4b0d3255bfef95601890afd80709\tverified\r\n" +
+			"carol\talice\tprpl-irc\tda39a3ee5e6b4b0d3255bfef95601890afd80709\tsmp"))
+
+	assertNil(t, err)
+	assertEquals(t, len(res), 2)
+	assertEquals(t, res[0].Trust, TrustVerified)
+	assertEquals(t, res[1].Trust, TrustSMP)
+}
+
+func Test_ImportFingerprints_skipsLinesThatCantBeParsed(t *testing.T) {
+	res, err := ImportFingerprints(bytes.NewBufferString(
+		"\n" +
+			"bob\talice\tprpl-irc\n" +
+			"bob\talice\tprpl-irc\tda39a3ee\tverified\n" +
+			"bob\talice\tprpl-irc\tzz39a3ee5e6b4b0d3255bfef95601890afd80709\tverified\n" +
+			"carol\talice\tprpl-irc\tda39a3ee5e6b4b0d3255bfef95601890afd80709\tsmp\n"))
+
+	assertNil(t, err)
+	assertEquals(t, len(res), 1)
+	assertEquals(t, res[0].Username, "carol")
+}
+
+func Test_ExportFingerprints_writesTheSameDataAsLibotr(t *testing.T) {
+	fps, _ := ImportFingerprints(bytes.NewBufferString(libOTRFingerprints))
+
+	bt := bytes.NewBuffer(make([]byte, 0, 200))
+	err := ExportFingerprints(fps, bt)
+
+	assertNil(t, err)
+	assertEquals(t, bt.String(), libOTRFingerprints)
+}
+
+func Test_ExportFingerprintsToFile_exportsFingerprintsToAFileThatCanBeImportedAgain(t *testing.T) {
+	fps, _ := ImportFingerprints(bytes.NewBufferString(libOTRFingerprints))
+
+	err := ExportFingerprintsToFile(fps, "test_resources/test_export_of_fingerprints.blah")
+	defer os.Remove("test_resources/test_export_of_fingerprints.blah")
+	assertNil(t, err)
+
+	info, _ := os.Stat("test_resources/test_export_of_fingerprints.blah")
+	assertEquals(t, info.Mode().Perm(), os.FileMode(0600))
+
+	res, err2 := ImportFingerprintsFromFile("test_resources/test_export_of_fingerprints.blah")
+	assertNil(t, err2)
+	assertDeepEquals(t, res, fps)
+}
+
+func Test_ImportFingerprintsFromFile_willReturnAnErrorIfAskedToReadAFileNameThatDoesntExist(t *testing.T) {
+	_, err := ImportFingerprintsFromFile("this_file_doesnt_exist.fingerprints")
+	assertEquals(t, err.Error(), "open this_file_doesnt_exist.fingerprints: no such file or directory")
+}
+
+func Test_FormatFingerprint_returnsTheFingerprintInGroupsOfEightHexDigits(t *testing.T) {
+	fpr := bytesFromHex("0bb01c360424522e94ee9c346ce877a1a4288b2f")
+
+	assertEquals(t, FormatFingerprint(fpr), "0BB01C36 0424522E 94EE9C34 6CE877A1 A4288B2F")
+}
+
+func Test_FormatFingerprint_formatsTheFingerprintOfAPublicKey(t *testing.T) {
+	formatted := FormatFingerprint(alicePrivateKey.PublicKey().Fingerprint())
+
+	assertEquals(t, len(formatted), 44)
+	assertEquals(t, strings.Replace(formatted, " ", "", -1), fmt.Sprintf("%X", alicePrivateKey.PublicKey().Fingerprint()))
+}
+
+func Test_FormatFingerprint_handlesFingerprintsThatArentAMultipleOfFourBytes(t *testing.T) {
+	assertEquals(t, FormatFingerprint([]byte{0x12, 0x34, 0x56, 0x78, 0x9a}), "12345678 9A")
+	assertEquals(t, FormatFingerprint(nil), "")
+}
@@ -139,7 +139,8 @@ func bobContextAtAwaitingSig() *Conversation {
 	c.ake.keys.theirCurrentDHPubKey = fixedGY()
 
 	c.version = otrV2{}
-	c.Policies.add(allowV2)
+	c.ake.version = otrV2{}
+	c.Policies.Add(PolicyAllowV2)
 	c.ake.state = authStateAwaitingSig{}
 
 	return c
@@ -159,7 +160,7 @@ func bobContextAtReceiveDHKey() *Conversation {
 func bobContextAtAwaitingDHKey() *Conversation {
 	c := newConversation(otrV3{}, fixtureRand())
 	c.initAKE()
-	c.Policies.add(allowV3)
+	c.Policies.Add(PolicyAllowV3)
 	c.ake.state = authStateAwaitingDHKey{}
 	c.ourCurrentKey = bobPrivateKey
 
@@ -179,7 +180,7 @@ func aliceContextAtReceiveRevealSig() *Conversation {
 func aliceContextAtAwaitingDHCommit() *Conversation {
 	c := newConversation(otrV2{}, fixtureRand())
 	c.initAKE()
-	c.Policies.add(allowV2)
+	c.Policies.Add(PolicyAllowV2)
 	c.ake.state = authStateNone{}
 	c.ourCurrentKey = alicePrivateKey
 	return c
@@ -188,7 +189,7 @@ func aliceContextAtAwaitingDHCommit() *Conversation {
 func aliceContextAtAwaitingRevealSig() *Conversation {
 	c := newConversation(otrV2{}, fixtureRand())
 	c.initAKE()
-	c.Policies.add(allowV2)
+	c.Policies.Add(PolicyAllowV2)
 	c.ake.state = authStateAwaitingRevealSig{}
 	c.ourCurrentKey = alicePrivateKey
 
@@ -227,7 +228,7 @@ func fixtureDataMsg(plain plainDataMsg) ([]byte, keyManagementContext) {
 	c1 := receiverContext.counterHistory.findCounterFor(recipientKeyID, senderKeyID)
 	c1.theirKeyID = 1
 
-	keys := calculateDHSessionKeys(fixedX(), fixedGX(), fixedGY(), conv.version)
+	keys := calculateDHSessionKeys(nil, fixedX(), fixedGX(), fixedGY(), conv.version)
 
 	h, _ := conv.messageHeader(msgTypeData)
 	m := dataMsg{
@@ -265,12 +266,12 @@ func fixtureDecryptDataMsgBase(encryptedDataMsg []byte) ([]byte, plainDataMsg, e
 	}
 
 	m := dataMsg{}
-	err = m.deserialize(withoutHeader, c.version)
+	err = m.deserialize(withoutHeader, c.version, defaultFieldLimits)
 	if err != nil {
 		return nil, plainDataMsg{}, err
 	}
 
-	keys := calculateDHSessionKeys(fixedX(), fixedGX(), fixedGY(), c.version)
+	keys := calculateDHSessionKeys(nil, fixedX(), fixedGX(), fixedGY(), c.version)
 
 	exp := plainDataMsg{}
 	err = m.checkSign(keys.receivingMACKey, header, c.version)
@@ -0,0 +1,123 @@
+package otr3
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultMaxFragmentAssemblySize = 1 << 20
+	defaultFragmentAssemblyTimeout = 5 * time.Minute
+)
+
+// FragmentLimits bound the memory held for incoming messages that are still being reassembled from fragments.
+// Without them, a peer could send the first fragments of a message and never finish it, and pin that memory for as long as
+// the conversation lives.
+type FragmentLimits struct {
+	// MaxSize is the largest number of bytes held for the message being reassembled. Zero means the default of 1 MiB
+	MaxSize int
+	// Timeout is how long a message being reassembled is kept after its latest fragment arrived. Zero means the default of five minutes
+	Timeout time.Duration
+	// Budget bounds the bytes held together with all other conversations that share it. Nil means only MaxSize applies
+	Budget *FragmentBudget
+}
+
+// SetFragmentLimits sets how much memory is held for incoming messages being reassembled from fragments, and for how long.
+// It returns an error if a limit is negative.
+func (c *Conversation) SetFragmentLimits(l FragmentLimits) error {
+	if l.MaxSize < 0 || l.Timeout < 0 {
+		return errInvalidFragmentLimits
+	}
+
+	c.fragmentLimits = l
+	return nil
+}
+
+// FragmentLimits returns how much memory is held for incoming messages being reassembled from fragments, and for how long,
+// with the defaults filled in for limits that haven't been set
+func (c *Conversation) FragmentLimits() FragmentLimits {
+	l := c.fragmentLimits
+	if l.MaxSize == 0 {
+		l.MaxSize = defaultMaxFragmentAssemblySize
+	}
+	if l.Timeout == 0 {
+		l.Timeout = defaultFragmentAssemblyTimeout
+	}
+	return l
+}
+
+// FragmentBudget is the number of bytes a group of conversations can hold together for messages being reassembled from fragments,
+// for example all conversations of an account. It is safe to share between goroutines.
+// A conversation gives its share back when the message is complete, when it is discarded, or when EvictStaleFragments finds it too old.
+type FragmentBudget struct {
+	sync.Mutex
+	max, used int
+}
+
+// NewFragmentBudget returns a budget of max bytes
+func NewFragmentBudget(max int) *FragmentBudget {
+	return &FragmentBudget{max: max}
+}
+
+// Used returns the number of bytes currently held by the conversations sharing the budget
+func (b *FragmentBudget) Used() int {
+	b.Lock()
+	defer b.Unlock()
+
+	return b.used
+}
+
+// reserve takes n more bytes from the budget, or gives them back if n is negative. It returns false without taking anything
+// if there aren't enough bytes left. A nil budget has no limit.
+func (b *FragmentBudget) reserve(n int) bool {
+	if b == nil {
+		return true
+	}
+
+	b.Lock()
+	defer b.Unlock()
+
+	if n > 0 && b.used+n > b.max {
+		return false
+	}
+	b.used += n
+	return true
+}
+
+// EvictStaleFragments discards the message being reassembled if its latest fragment arrived longer ago than the timeout.
+// This also happens when a fragment is received, so it only has to be called for conversations that might not receive anything anymore.
+func (c *Conversation) EvictStaleFragments() {
+	c.fragmentationContext = c.evictStaleFragments(c.fragmentationContext)
+}
+
+func (c *Conversation) evictStaleFragments(ctx fragmentationContext) fragmentationContext {
+	if ctx.currentIndex == 0 || c.lastFragment.IsZero() || !c.now().After(c.lastFragment.Add(c.FragmentLimits().Timeout)) {
+		return ctx
+	}
+
+	c.messageEventWithError(MessageEventReceivedFragmentsEvicted, errFragmentAssemblyExpired)
+	return c.releaseFragments(ctx)
+}
+
+// keepFragments replaces the message being reassembled, as long as the new one is within the limits.
+// If it isn't, the event is signaled and nothing is held anymore.
+func (c *Conversation) keepFragments(before, after fragmentationContext) fragmentationContext {
+	l := c.FragmentLimits()
+	if len(after.frag) > l.MaxSize || !l.Budget.reserve(len(after.frag)-len(before.frag)) {
+		c.messageEventWithError(MessageEventReceivedFragmentsEvicted, errFragmentAssemblyTooLarge)
+		return c.releaseFragments(before)
+	}
+
+	c.lastFragment = c.now()
+	return after
+}
+
+// releaseFragments gives the memory held for the message being reassembled back to the budget, and returns an empty context
+func (c *Conversation) releaseFragments(ctx fragmentationContext) fragmentationContext {
+	c.fragmentLimits.Budget.reserve(-len(ctx.frag))
+	return forgetFragment()
+}
+
+func (c *Conversation) dropFragments() {
+	c.fragmentationContext = c.releaseFragments(c.fragmentationContext)
+}
@@ -0,0 +1,107 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+)
+
+func Test_SetFragmentLimits_returnsErrorForNegativeLimits(t *testing.T) {
+	c := &Conversation{}
+
+	assertEquals(t, c.SetFragmentLimits(FragmentLimits{MaxSize: -1}), errInvalidFragmentLimits)
+	assertEquals(t, c.SetFragmentLimits(FragmentLimits{Timeout: -time.Second}), errInvalidFragmentLimits)
+	assertEquals(t, c.FragmentLimits().MaxSize, defaultMaxFragmentAssemblySize)
+}
+
+func Test_FragmentLimits_fillsInTheDefaultsForLimitsThatArentSet(t *testing.T) {
+	c := &Conversation{}
+
+	assertNil(t, c.SetFragmentLimits(FragmentLimits{MaxSize: 200}))
+
+	assertDeepEquals(t, c.FragmentLimits(), FragmentLimits{MaxSize: 200, Timeout: defaultFragmentAssemblyTimeout})
+}
+
+func Test_receiveFragment_evictsTheAssemblyWhenItGrowsLargerThanTheLimit(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	assertNil(t, c.SetFragmentLimits(FragmentLimits{MaxSize: 15}))
+	fctx, _ := c.receiveFragment(fragmentationContext{}, []byte("?OTR,00001,00004,blarg one two,"))
+
+	c.expectMessageEvent(t, func() {
+		fctx, _ = c.receiveFragment(fctx, []byte("?OTR,00002,00004, one,"))
+	}, MessageEventReceivedFragmentsEvicted, nil, errFragmentAssemblyTooLarge)
+
+	assertDeepEquals(t, fctx, fragmentationContext{})
+}
+
+func Test_receiveFragment_evictsTheAssemblyWhenTheNextFragmentArrivesTooLate(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+	c := newConversation(otrV2{}, rand.Reader)
+	c.SetClock(clock)
+	fctx, _ := c.receiveFragment(fragmentationContext{}, []byte("?OTR,00001,00004,blarg one two,"))
+	clock.advance(defaultFragmentAssemblyTimeout + time.Second)
+	evicted := collectMessageEvents(c, MessageEventReceivedFragmentsEvicted)
+
+	fctx, _ = c.receiveFragment(fctx, []byte("?OTR,00002,00004, one,"))
+
+	assertEquals(t, *evicted, 1)
+	assertDeepEquals(t, fctx, fragmentationContext{})
+}
+
+func Test_receiveFragment_keepsTheAssemblyWhileFragmentsArriveInTime(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+	c := newConversation(otrV2{}, rand.Reader)
+	c.SetClock(clock)
+	fctx, _ := c.receiveFragment(fragmentationContext{}, []byte("?OTR,00001,00004,blarg one two,"))
+	clock.advance(defaultFragmentAssemblyTimeout)
+
+	fctx, _ = c.receiveFragment(fctx, []byte("?OTR,00002,00004, one,"))
+
+	assertDeepEquals(t, fctx, fragmentationContext{[]byte("blarg one two one"), 2, 4})
+}
+
+func Test_EvictStaleFragments_discardsAnAssemblyThatIsTooOld(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+	budget := NewFragmentBudget(100)
+	c := newConversation(otrV2{}, rand.Reader)
+	c.SetClock(clock)
+	assertNil(t, c.SetFragmentLimits(FragmentLimits{Budget: budget}))
+	c.fragmentationContext, _ = c.receiveFragment(fragmentationContext{}, []byte("?OTR,00001,00004,blarg one two,"))
+
+	c.EvictStaleFragments()
+	assertEquals(t, budget.Used(), 13)
+
+	clock.advance(defaultFragmentAssemblyTimeout + time.Second)
+	c.EvictStaleFragments()
+
+	assertDeepEquals(t, c.fragmentationContext, fragmentationContext{})
+	assertEquals(t, budget.Used(), 0)
+}
+
+func Test_receiveFragment_evictsTheAssemblyWhenTheSharedBudgetIsUsedUp(t *testing.T) {
+	budget := NewFragmentBudget(20)
+	alice := newConversation(otrV2{}, rand.Reader)
+	bob := newConversation(otrV2{}, rand.Reader)
+	assertNil(t, alice.SetFragmentLimits(FragmentLimits{Budget: budget}))
+	assertNil(t, bob.SetFragmentLimits(FragmentLimits{Budget: budget}))
+	alice.receiveFragment(fragmentationContext{}, []byte("?OTR,00001,00004,blarg one two,"))
+
+	bob.expectMessageEvent(t, func() {
+		fctx, _ := bob.receiveFragment(fragmentationContext{}, []byte("?OTR,00001,00004,blarg one two,"))
+		assertDeepEquals(t, fctx, fragmentationContext{})
+	}, MessageEventReceivedFragmentsEvicted, nil, errFragmentAssemblyTooLarge)
+
+	assertEquals(t, budget.Used(), 13)
+}
+
+func Test_Receive_givesTheBudgetBackWhenTheMessageIsComplete(t *testing.T) {
+	budget := NewFragmentBudget(100)
+	c := newConversation(otrV2{}, rand.Reader)
+	assertNil(t, c.SetFragmentLimits(FragmentLimits{Budget: budget}))
+
+	c.Receive([]byte("?OTR,00001,00002,hello ,"))
+	assertEquals(t, budget.Used(), 6)
+
+	c.Receive([]byte("?OTR,00002,00002,world,"))
+	assertEquals(t, budget.Used(), 0)
+}
@@ -40,6 +40,37 @@ func (c *Conversation) SetFragmentSize(size uint16) {
 	c.fragmentSize = size
 }
 
+// FragmentationProfile describes the largest message a specific transport can carry
+type FragmentationProfile struct {
+	Name string
+	// Size is the maximum number of bytes in a message. Zero means the transport has no limit
+	Size uint16
+}
+
+var (
+	// IRCFragmentation leaves room for the IRC command and the target in a 512 byte IRC line
+	IRCFragmentation = FragmentationProfile{Name: "IRC", Size: 400}
+	// XMPPFragmentation doesn't fragment, since XMPP servers accept messages of any reasonable size
+	XMPPFragmentation = FragmentationProfile{Name: "XMPP", Size: 0}
+	// SMSFragmentation fits every fragment in one 160 character SMS
+	SMSFragmentation = FragmentationProfile{Name: "SMS", Size: 160}
+)
+
+// minFragmentSize is the smallest size that can hold the longest fragment header,
+// the closing separator and at least one byte of the message
+var minFragmentSize = uint16(len(otrV3{}.fragmentPrefix(0, 1, 0, 0)) + 2)
+
+// SetFragmentationProfile sets the maximum size for a message fragment from the given profile.
+// It returns an error if the size of the profile is too small to hold even one byte of a message in every fragment.
+func (c *Conversation) SetFragmentationProfile(p FragmentationProfile) error {
+	if p.Size != 0 && p.Size < minFragmentSize {
+		return errFragmentSizeTooSmall
+	}
+
+	c.SetFragmentSize(p.Size)
+	return nil
+}
+
 func (c *Conversation) fragment(data encodedMessage, fraglen uint16) []ValidMessage {
 	l := len(data)
 
@@ -92,16 +123,12 @@ func fragmentIsNextMessage(beforeCtx fragmentationContext, ix, l uint16) bool {
 	return beforeCtx.currentIndex+1 == ix && beforeCtx.currentLen == l
 }
 
-func (ctx fragmentationContext) discardFragment() fragmentationContext {
-	return ctx
-}
-
 func (ctx fragmentationContext) appendFragment(data []byte, ix, l uint16) fragmentationContext {
-	return fragmentationContext{append(ctx.frag, data...), ix, l}
+	return fragmentationContext{frag: append(ctx.frag, data...), currentIndex: ix, currentLen: l}
 }
 
 func restartFragment(data []byte, ix, l uint16) fragmentationContext {
-	return fragmentationContext{makeCopy(data), ix, l}
+	return fragmentationContext{frag: makeCopy(data), currentIndex: ix, currentLen: l}
 }
 
 func forgetFragment() fragmentationContext {
@@ -121,14 +148,19 @@ func (c *Conversation) receiveFragment(beforeCtx fragmentationContext, data Vali
 		return beforeCtx, newOtrError("invalid OTR fragment")
 	}
 
+	beforeCtx = c.evictStaleFragments(beforeCtx)
+
 	switch {
 	case fragmentIsInvalid(ix, l):
-		return beforeCtx.discardFragment(), nil
+		c.messageEventWithError(MessageEventReceivedFragmentInconsistent, newOtrErrorf("invalid fragment number %d of %d", ix, l))
+		return c.releaseFragments(beforeCtx), nil
 	case fragmentIsFirstMessage(ix, l):
-		return restartFragment(resultData, ix, l), nil
+		return c.keepFragments(beforeCtx, restartFragment(resultData, ix, l)), nil
 	case fragmentIsNextMessage(beforeCtx, ix, l):
-		return beforeCtx.appendFragment(resultData, ix, l), nil
+		return c.keepFragments(beforeCtx, beforeCtx.appendFragment(resultData, ix, l)), nil
 	default:
-		return forgetFragment(), nil
+		c.messageEventWithError(MessageEventReceivedFragmentInconsistent,
+			newOtrErrorf("fragment %d of %d doesn't follow fragment %d of %d", ix, l, beforeCtx.currentIndex, beforeCtx.currentLen))
+		return c.releaseFragments(beforeCtx), nil
 	}
 }
@@ -217,6 +217,78 @@ func Test_receiveFragment_resetsTheContextIfTheMessageNumberIsNotExactlyOnePlus(
 	assertDeepEquals(t, fctx, fragmentationContext{})
 }
 
+func Test_receiveFragment_discardsTheReassembledFragmentsWhenTheFragmentIsInvalid(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	inProgress := fragmentationContext{[]byte("blarg one two"), 2, 4}
+
+	for _, data := range []string{"?OTR,00000,00004, one,", "?OTR,00003,00000, one,", "?OTR,00005,00004, one,"} {
+		fctx, err := c.receiveFragment(inProgress, []byte(data))
+		assertNil(t, err)
+		assertDeepEquals(t, fctx, fragmentationContext{})
+	}
+}
+
+func Test_receiveFragment_signalsAnEventWhenTheFragmentNumberIsAboveTheCount(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	data := []byte("?OTR,00005,00004, one,")
+
+	c.expectMessageEvent(t, func() {
+		c.receiveFragment(fragmentationContext{[]byte("blarg one two"), 2, 4}, data)
+	}, MessageEventReceivedFragmentInconsistent, nil, newOtrError("invalid fragment number 5 of 4"))
+}
+
+func Test_receiveFragment_signalsAnEventWhenTheCountIsZero(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	data := []byte("?OTR,00001,00000, one,")
+
+	c.expectMessageEvent(t, func() {
+		c.receiveFragment(fragmentationContext{}, data)
+	}, MessageEventReceivedFragmentInconsistent, nil, newOtrError("invalid fragment number 1 of 0"))
+}
+
+func Test_receiveFragment_signalsAnEventWhenTheFragmentNumberGoesBackwards(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	data := []byte("?OTR,00002,00004, one,")
+
+	c.expectMessageEvent(t, func() {
+		fctx, _ := c.receiveFragment(fragmentationContext{[]byte("blarg one two"), 3, 4}, data)
+		assertDeepEquals(t, fctx, fragmentationContext{})
+	}, MessageEventReceivedFragmentInconsistent, nil, newOtrError("fragment 2 of 4 doesn't follow fragment 3 of 4"))
+}
+
+func Test_receiveFragment_signalsAnEventWhenTheCountChangesMidMessage(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	data := []byte("?OTR,00003,00005, one,")
+
+	c.expectMessageEvent(t, func() {
+		c.receiveFragment(fragmentationContext{[]byte("blarg one two"), 2, 4}, data)
+	}, MessageEventReceivedFragmentInconsistent, nil, newOtrError("fragment 3 of 5 doesn't follow fragment 2 of 4"))
+}
+
+func Test_receiveFragment_signalsAnEventWhenAFragmentIsRepeated(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	data := []byte("?OTR,00002,00004, two,")
+
+	c.expectMessageEvent(t, func() {
+		c.receiveFragment(fragmentationContext{[]byte("blarg one two"), 2, 4}, data)
+	}, MessageEventReceivedFragmentInconsistent, nil, newOtrError("fragment 2 of 4 doesn't follow fragment 2 of 4"))
+}
+
+func Test_receive_fragmentsOutOfOrderNeverProduceAMessage(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	alice.SetFragmentSize(100)
+
+	toSend, _ := alice.Send(ValidMessage("a message long enough to need more than two fragments, or even more than that"))
+	toSend[1], toSend[2] = toSend[2], toSend[1]
+
+	for _, f := range toSend {
+		plain, _, err := bob.Receive(f)
+		assertNil(t, err)
+		assertNil(t, plain)
+	}
+}
+
 func Test_fragmentFinished_isFalseIfThereAreNoFragments(t *testing.T) {
 	assertDeepEquals(t, fragmentsFinished(fragmentationContext{[]byte{}, 0, 0}), false)
 }
@@ -267,7 +339,7 @@ func Test_receiveFragment_returnsErrorIfTheFragmentIsNotCorrect(t *testing.T) {
 func Test_parseFragmentPrefix_resolveVersion2IfNotDefined(t *testing.T) {
 	fragment := []byte("?OTR,00001,00004,?OTR:AAICAAAAxJh7YMX8vCry1O+3ewL88,")
 
-	c := &Conversation{Policies: policies(allowV2)}
+	c := &Conversation{Policies: Policies(PolicyAllowV2)}
 	c.parseFragmentPrefix(fragment)
 
 	assertEquals(t, c.version, otrV2{})
@@ -277,7 +349,7 @@ func Test_parseFragmentPrefix_resolveVersion2IfNotDefined(t *testing.T) {
 func Test_parseFragmentPrefix_rejectsVersion2IfNotAllowedByThePolicy(t *testing.T) {
 	fragment := []byte("?OTR,00001,00004,?OTR:AAICAAAAxJh7YMX8vCry1O+3ewL88,")
 
-	c := &Conversation{Policies: policies(allowV3)}
+	c := &Conversation{Policies: Policies(PolicyAllowV3)}
 	_, ignore, ok := c.parseFragmentPrefix(fragment)
 
 	assertEquals(t, ok, false)
@@ -289,7 +361,7 @@ func Test_parseFragmentPrefix_rejectsVersion2IfNotAllowedByThePolicy(t *testing.
 func Test_parseFragmentPrefix_resolveVersion3IfNotDefined(t *testing.T) {
 	fragment := []byte("?OTR|5a73a599|27e31597,00001,00003,?OTR:AAMDJ+MVmSfjF,")
 
-	c := &Conversation{Policies: policies(allowV3)}
+	c := &Conversation{Policies: Policies(PolicyAllowV3)}
 	c.parseFragmentPrefix(fragment)
 
 	assertEquals(t, c.version, otrV3{})
@@ -298,10 +370,66 @@ func Test_parseFragmentPrefix_resolveVersion3IfNotDefined(t *testing.T) {
 func Test_parseFragmentPrefix_rejectsVersion3IfNotAllowedByThePolicy(t *testing.T) {
 	fragment := []byte("?OTR|5a73a599|27e31597,00001,00003,?OTR:AAMDJ+MVmSfjF,")
 
-	c := &Conversation{Policies: policies(allowV2)}
+	c := &Conversation{Policies: Policies(PolicyAllowV2)}
 	_, ignore, ok := c.parseFragmentPrefix(fragment)
 
 	assertEquals(t, ok, false)
 	assertEquals(t, ignore, true)
 	assertEquals(t, c.version, nil)
 }
+
+func Test_minFragmentSize_leavesRoomForTheHeaderTheSeparatorAndOneByte(t *testing.T) {
+	assertEquals(t, minFragmentSize, uint16(37))
+}
+
+func Test_SetFragmentationProfile_setsTheFragmentSizeOfTheProfile(t *testing.T) {
+	c := &Conversation{}
+
+	err := c.SetFragmentationProfile(IRCFragmentation)
+
+	assertNil(t, err)
+	assertEquals(t, c.fragmentSize, uint16(400))
+}
+
+func Test_SetFragmentationProfile_allowsAProfileWithoutLimit(t *testing.T) {
+	c := &Conversation{}
+	c.fragmentSize = 400
+
+	err := c.SetFragmentationProfile(XMPPFragmentation)
+
+	assertNil(t, err)
+	assertEquals(t, c.fragmentSize, uint16(0))
+}
+
+func Test_SetFragmentationProfile_returnsErrorIfTheSizeCantHoldAFragment(t *testing.T) {
+	c := &Conversation{}
+	c.fragmentSize = 400
+
+	err := c.SetFragmentationProfile(FragmentationProfile{Name: "tiny", Size: 36})
+
+	assertEquals(t, err, errFragmentSizeTooSmall)
+	assertEquals(t, c.fragmentSize, uint16(400))
+}
+
+func Test_fragment_canFragmentWithTheMinimumFragmentSize(t *testing.T) {
+	ctx := newConversation(otrV3{}, rand.Reader)
+	ctx.ourInstanceTag = defaultInstanceTag
+	ctx.theirInstanceTag = defaultInstanceTag
+
+	data := []byte("one one one two two two three three three")
+	fragments := ctx.fragment(data, minFragmentSize)
+
+	assertDeepEquals(t, fragments[0], ValidMessage("?OTR|00000100|00000100,00001,00042,o,"))
+	for _, f := range fragments {
+		assertTrue(t, len(f) <= int(minFragmentSize))
+	}
+}
+
+func Test_fragment_fitsEveryFragmentInAnSMS(t *testing.T) {
+	ctx := newConversation(otrV3{}, rand.Reader)
+	ctx.SetFragmentationProfile(SMSFragmentation)
+
+	for _, f := range ctx.fragment(make([]byte, 1000), ctx.fragmentSize) {
+		assertTrue(t, len(f) <= 160)
+	}
+}
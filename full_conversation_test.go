@@ -51,12 +51,12 @@ func Test_AKE_forVersion3And2InThePolicy(t *testing.T) {
 	alice := &Conversation{Rand: rand.Reader}
 	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
 	alice.ourCurrentKey = alicePrivateKey
-	alice.Policies = policies(allowV2 | allowV3)
+	alice.Policies = Policies(PolicyAllowV2 | PolicyAllowV3)
 
 	bob := &Conversation{Rand: rand.Reader}
 	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
 	bob.ourCurrentKey = bobPrivateKey
-	bob.Policies = policies(allowV2 | allowV3)
+	bob.Policies = Policies(PolicyAllowV2 | PolicyAllowV3)
 
 	var toSend []ValidMessage
 	var err error
@@ -81,12 +81,12 @@ func Test_AKE_forVersion3And2InThePolicy(t *testing.T) {
 	//Bob send Alice RevealSig
 	_, toSend, err = alice.Receive(toSend[0])
 	assertEquals(t, err, nil)
-	assertEquals(t, alice.ake.state, authStateNone{})
+	assertNil(t, alice.ake)
 
 	//Alice send Bob Sig
 	_, toSend, err = bob.Receive(toSend[0])
 	assertEquals(t, err, nil)
-	assertEquals(t, bob.ake.state, authStateNone{})
+	assertNil(t, bob.ake)
 
 	// "When starting a private Conversation [...],
 	// generate two DH key pairs for yourself, and set our_keyid = 2"
@@ -107,12 +107,12 @@ func Test_AKE_withVersion3ButWithoutVersion2InThePolicy(t *testing.T) {
 	alice := &Conversation{Rand: rand.Reader}
 	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
 	alice.ourCurrentKey = alicePrivateKey
-	alice.Policies = policies(allowV3)
+	alice.Policies = Policies(PolicyAllowV3)
 
 	bob := &Conversation{Rand: rand.Reader}
 	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
 	bob.ourCurrentKey = bobPrivateKey
-	bob.Policies = policies(allowV3)
+	bob.Policies = Policies(PolicyAllowV3)
 
 	var toSend []ValidMessage
 	var err error
@@ -137,12 +137,12 @@ func Test_AKE_withVersion3ButWithoutVersion2InThePolicy(t *testing.T) {
 	//Bob send Alice RevealSig
 	_, toSend, err = alice.Receive(toSend[0])
 	assertEquals(t, err, nil)
-	assertEquals(t, alice.ake.state, authStateNone{})
+	assertNil(t, alice.ake)
 
 	//Alice send Bob Sig
 	_, toSend, err = bob.Receive(toSend[0])
 	assertEquals(t, err, nil)
-	assertEquals(t, bob.ake.state, authStateNone{})
+	assertNil(t, bob.ake)
 
 	// "When starting a private Conversation [...],
 	// generate two DH key pairs for yourself, and set our_keyid = 2"
@@ -164,11 +164,11 @@ func Test_processDataMessageShouldExtractData(t *testing.T) {
 	var err error
 
 	alice := &Conversation{Rand: rand.Reader}
-	alice.Policies = policies(allowV2 | allowV3)
+	alice.Policies = Policies(PolicyAllowV2 | PolicyAllowV3)
 	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
 
 	bob := &Conversation{Rand: rand.Reader}
-	bob.Policies = policies(allowV2 | allowV3)
+	bob.Policies = Policies(PolicyAllowV2 | PolicyAllowV3)
 	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
 
 	msg := []byte("?OTRv3?")
@@ -193,12 +193,12 @@ func Test_processDataMessageShouldExtractData(t *testing.T) {
 	//Bob send Alice RevealSig
 	_, toSend, err = alice.Receive(toSend[0])
 	assertNil(t, err)
-	assertEquals(t, alice.ake.state, authStateNone{})
+	assertNil(t, alice.ake)
 
 	//Alice send Bob Sig
 	_, toSend, err = bob.Receive(toSend[0])
 	assertNil(t, err)
-	assertEquals(t, bob.ake.state, authStateNone{})
+	assertNil(t, bob.ake)
 
 	// Alice sends a message to bob
 	msg = []byte("hello")
@@ -219,11 +219,11 @@ func Test_startingAKE_shouldNotBreakTheEncryptedChannel(t *testing.T) {
 	var err error
 
 	alice := &Conversation{Rand: rand.Reader}
-	alice.Policies = policies(allowV2 | allowV3)
+	alice.Policies = Policies(PolicyAllowV2 | PolicyAllowV3)
 	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
 
 	bob := &Conversation{Rand: rand.Reader}
-	bob.Policies = policies(allowV2 | allowV3)
+	bob.Policies = Policies(PolicyAllowV2 | PolicyAllowV3)
 	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
 
 	//Alice send Bob queryMsg
@@ -246,12 +246,12 @@ func Test_startingAKE_shouldNotBreakTheEncryptedChannel(t *testing.T) {
 	//Bob send Alice RevealSig
 	_, toSend, err = alice.Receive(toSend[0])
 	assertNil(t, err)
-	assertEquals(t, alice.ake.state, authStateNone{})
+	assertNil(t, alice.ake)
 
 	//Alice send Bob Sig
 	_, toSend, err = bob.Receive(toSend[0])
 	assertNil(t, err)
-	assertEquals(t, bob.ake.state, authStateNone{})
+	assertNil(t, bob.ake)
 
 	// Alice sends a message to bob
 	m, err := alice.Send(hello)
@@ -269,7 +269,6 @@ func Test_startingAKE_shouldNotBreakTheEncryptedChannel(t *testing.T) {
 
 	//Alice send Bob queryMsg
 	bob.lastMessageStateChange = time.Time{}
-	bob.ake.lastStateChange = time.Time{}
 	_, toSend, err = bob.Receive(alice.QueryMessage())
 	assertNil(t, err)
 	assertEquals(t, bob.ake.state, authStateAwaitingDHKey{})
@@ -2,15 +2,24 @@ package otr3
 
 import "time"
 
-// How long after sending a packet should we wait to send a heartbeat?
-const heartbeatInterval = 60 * time.Second
-
 type heartbeatContext struct {
-	lastSent time.Time
+	lastSent     time.Time
+	lastReceived time.Time
 }
 
 func (c *Conversation) updateLastSent() {
-	c.heartbeat.lastSent = time.Now()
+	c.heartbeat.lastSent = c.now()
+}
+
+func (c *Conversation) updateLastReceived() {
+	c.heartbeat.lastReceived = c.now()
+}
+
+func (c *Conversation) lastActive() time.Time {
+	if c.heartbeat.lastReceived.After(c.heartbeat.lastSent) {
+		return c.heartbeat.lastReceived
+	}
+	return c.heartbeat.lastSent
 }
 
 func (c *Conversation) maybeHeartbeat(plain MessagePlaintext, toSend messageWithHeader, err error) (MessagePlaintext, []messageWithHeader, error) {
@@ -22,12 +31,18 @@ func (c *Conversation) maybeHeartbeat(plain MessagePlaintext, toSend messageWith
 }
 
 func (c *Conversation) potentialHeartbeat(plain MessagePlaintext) (toSend messageWithHeader, err error) {
-	if plain == nil {
+	// The message might have ended the private conversation, so there are no keys to send a heartbeat with
+	if plain == nil || c.msgState != encrypted {
 		return
 	}
 
-	now := time.Now()
-	if !c.heartbeat.lastSent.Before(now.Add(-heartbeatInterval)) {
+	interval := c.TransportProfile().HeartbeatInterval
+	if interval == 0 {
+		return
+	}
+
+	now := c.now()
+	if !c.heartbeat.lastSent.Before(now.Add(-interval)) {
 		return
 	}
 
@@ -45,3 +60,15 @@ func (c *Conversation) potentialHeartbeat(plain MessagePlaintext) (toSend messag
 	c.messageEvent(MessageEventLogHeartbeatSent)
 	return
 }
+
+// signalIfHeartbeat signals a heartbeat for a data message without plaintext, unless it carries TLVs
+// other than padding - then it was sent for the TLVs, like the messages of SMP. Either way, the empty
+// plaintext is never returned to be shown.
+func (c *Conversation) signalIfHeartbeat(tlvs []tlv) {
+	for _, t := range tlvs {
+		if t.tlvType != tlvTypePadding {
+			return
+		}
+	}
+	c.messageEvent(MessageEventLogHeartbeatReceived)
+}
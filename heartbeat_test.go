@@ -81,3 +81,114 @@ func Test_potentialHeartbeat_returnsAnErrorIfWeCantPutTogetherAMessage(t *testin
 	_, err := c.potentialHeartbeat(plain)
 	assertDeepEquals(t, err, newOtrConflictError("invalid key id for local peer"))
 }
+
+func Test_Receive_updatesTheTimeWeLastReceivedAMessage(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+
+	c.Receive(ValidMessage("hello"))
+
+	assertTrue(t, c.heartbeat.lastReceived.After(time.Now().Add(-time.Minute)))
+}
+
+func Test_lastActive_returnsTheMostRecentOfSendingAndReceiving(t *testing.T) {
+	c := &Conversation{}
+	c.heartbeat.lastSent = time.Now().Add(-time.Hour)
+	c.heartbeat.lastReceived = time.Now()
+
+	assertEquals(t, c.lastActive(), c.heartbeat.lastReceived)
+
+	c.heartbeat.lastSent = time.Now().Add(time.Hour)
+
+	assertEquals(t, c.lastActive(), c.heartbeat.lastSent)
+}
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+func receivedHeartbeat(t *testing.T, from, to *Conversation) bool {
+	toSend, err := from.Send(ValidMessage("hello"))
+	assertNil(t, err)
+
+	heartbeats := collectMessageEvents(to, MessageEventLogHeartbeatSent)
+	_, _, err = to.Receive(toSend[0])
+	assertNil(t, err)
+
+	return *heartbeats > 0
+}
+
+func collectMessageEvents(c *Conversation, event MessageEvent) *int {
+	count := 0
+	c.messageEventHandler = dynamicMessageEventHandler{func(e MessageEvent, _ []byte, _ error, _ ...interface{}) {
+		if e == event {
+			count++
+		}
+	}}
+	return &count
+}
+
+func Test_Receive_sendsAHeartbeatOnlyAfterTheIntervalHasPassedOnTheClock(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+	alice, bob := benchmarkConversations()
+	alice.SetClock(clock)
+	bob.SetClock(clock)
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	bob.updateLastSent()
+
+	clock.advance(30 * time.Second)
+	assertFalse(t, receivedHeartbeat(t, alice, bob))
+
+	clock.advance(TransportProfileRealtime.HeartbeatInterval - 29*time.Second)
+	assertTrue(t, receivedHeartbeat(t, alice, bob))
+
+	assertFalse(t, receivedHeartbeat(t, alice, bob))
+}
+
+func Test_Conversation_usesTheSystemTimeWithoutAClock(t *testing.T) {
+	c := &Conversation{}
+	before := time.Now()
+
+	assertFalse(t, c.now().Before(before))
+}
+
+func Test_Conversation_usesTheClockItWasGiven(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+	c := &Conversation{}
+	c.SetClock(clock)
+	c.updateLastSent()
+
+	assertEquals(t, c.heartbeat.lastSent, clock.now)
+}
+
+func Test_Receive_signalsAHeartbeatForAnEmptyDataMessage(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	heartbeat, _, _ := alice.genDataMsgWithFlag(nil, messageFlagIgnoreUnreadable)
+	msg, _ := alice.wrapMessageHeader(msgTypeData, heartbeat.serialize(alice.version))
+
+	heartbeats := collectMessageEvents(bob, MessageEventLogHeartbeatReceived)
+	plain, _, err := bob.Receive(ValidMessage(alice.encode(msg)))
+
+	assertNil(t, err)
+	assertNil(t, plain)
+	assertEquals(t, *heartbeats, 1)
+}
+
+func Test_Receive_doesntSignalAHeartbeatForAnSMPMessage(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	smp1, _ := alice.StartAuthenticate("", []byte("the park"))
+
+	heartbeats := collectMessageEvents(bob, MessageEventLogHeartbeatReceived)
+	plain, _, err := bob.Receive(smp1[0])
+
+	assertNil(t, err)
+	assertNil(t, plain)
+	assertEquals(t, *heartbeats, 0)
+}
@@ -1,6 +1,7 @@
 package otr3
 
 import (
+	"crypto/rand"
 	"encoding/hex"
 	"io"
 	"math/big"
@@ -102,28 +103,27 @@ func parseIntoPrivateKey(hexString string) PrivateKey {
 }
 
 func newConversation(v otrVersion, rand io.Reader) *Conversation {
-	var p policy
+	var p Policy
 	switch v {
 	case otrV3{}:
-		p = allowV3
+		p = PolicyAllowV3
 	case otrV2{}:
-		p = allowV2
+		p = PolicyAllowV2
 	}
 	akeNotStarted := new(ake)
 	akeNotStarted.state = authStateNone{}
 
-	return &Conversation{
-		version: v,
-		Rand:    rand,
-		smp: smp{
-			state: smpStateExpect1{},
-		},
-		ake:              akeNotStarted,
-		Policies:         policies(p),
-		fragmentSize:     65535, //we are not testing fragmentation by default
-		ourInstanceTag:   0x101, //every conversation should be able to talk to each other
-		theirInstanceTag: 0x101,
-	}
+	c, _ := NewConversation(
+		WithRand(rand),
+		WithPolicies(p),
+		WithFragmentSize(65535), //we are not testing fragmentation by default
+	)
+	c.version = v
+	c.smp.state = smpStateExpect1{}
+	c.ake = akeNotStarted
+	c.ourInstanceTag = 0x101 //every conversation should be able to talk to each other
+	c.theirInstanceTag = 0x101
+	return c
 }
 
 func (c *Conversation) expectMessageEvent(t *testing.T, f func(), expectedEvent MessageEvent, expectedMessage []byte, expectedError error) {
@@ -184,3 +184,50 @@ func (c *Conversation) doesntExpectSecurityEvent(t *testing.T, f func()) {
 
 	f()
 }
+
+func benchmarkConversations() (alice, bob *Conversation) {
+	alice = &Conversation{Rand: rand.Reader}
+	alice.Policies = Policies(PolicyAllowV2 | PolicyAllowV3)
+	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
+
+	bob = &Conversation{Rand: rand.Reader}
+	bob.Policies = Policies(PolicyAllowV2 | PolicyAllowV3)
+	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
+
+	return alice, bob
+}
+
+// exchangeUntilQuiet delivers the given messages to the receiver and keeps
+// passing the answers back and forth until no more messages are generated
+func exchangeUntilQuiet(tb testing.TB, from, to *Conversation, msgs []ValidMessage) {
+	for len(msgs) > 0 {
+		var next []ValidMessage
+		for _, m := range msgs {
+			_, toSend, err := to.Receive(m)
+			if err != nil {
+				tb.Fatal(err)
+			}
+			next = append(next, toSend...)
+		}
+		msgs = next
+		from, to = to, from
+	}
+}
+
+func encryptedConversations(t *testing.T) (alice, bob *Conversation) {
+	alice, bob = benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	if !alice.IsEncrypted() || !bob.IsEncrypted() {
+		t.Fatal("couldn't establish an encrypted conversation")
+	}
+	return alice, bob
+}
+
+// runNewAKE starts a new AKE from alice while the conversation is encrypted and runs it to the end
+func runNewAKE(t *testing.T, alice, bob *Conversation) {
+	dhCommit, err := alice.Refresh()
+	if err != nil {
+		t.Fatal(err)
+	}
+	exchangeUntilQuiet(t, alice, bob, dhCommit)
+}
@@ -0,0 +1,410 @@
+package otr3
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/coyim/gotrax"
+)
+
+// hostilePeer follows the protocol like a normal peer, but lets a test change any message it sends
+// before it reaches the victim. The tests in this file use it to violate the protocol in every way
+// the specification guards against, and check that the victim never ends up in a state it shouldn't.
+type hostilePeer struct {
+	*Conversation
+}
+
+func newHostilePeerAndVictim() (*hostilePeer, *Conversation) {
+	alice, bob := benchmarkConversations()
+	return &hostilePeer{alice}, bob
+}
+
+// tamper decodes an OTR encoded message, lets f change the bytes after the message header, and encodes it again
+func (h *hostilePeer) tamper(msg ValidMessage, f func(body []byte) []byte) ValidMessage {
+	decoded, err := h.decode(encodedMessage(msg))
+	if err != nil {
+		panic(err)
+	}
+
+	header := decoded[:otrv3HeaderLen]
+	body := f(makeCopy(decoded[otrv3HeaderLen:]))
+	return ValidMessage(h.encode(append(makeCopy(header), body...)))
+}
+
+// withHeader builds a message with the header of the given message and a new body
+func (h *hostilePeer) withHeader(msg ValidMessage, body []byte) ValidMessage {
+	return h.tamper(msg, func([]byte) []byte { return body })
+}
+
+func (h *hostilePeer) establish(t *testing.T, victim *Conversation) {
+	exchangeUntilQuiet(t, h.Conversation, victim, []ValidMessage{h.QueryMessage()})
+}
+
+func flipLastBit(body []byte) []byte {
+	body[len(body)-1] ^= 0x01
+	return body
+}
+
+func assertVictimIsNotEncrypted(t *testing.T, victim *Conversation) {
+	assertFalse(t, victim.IsEncrypted())
+	assertEquals(t, victim.msgState, plainText)
+}
+
+func Test_hostilePeer_truncatedDHCommitDoesntStartAnAKE(t *testing.T) {
+	hostile, victim := newHostilePeerAndVictim()
+	_, dhCommit, _ := hostile.Receive(victim.QueryMessage())
+	truncated := hostile.tamper(dhCommit[0], func(body []byte) []byte { return body[:len(body)/2] })
+
+	_, toSend, err := victim.Receive(truncated)
+
+	assertNotNil(t, err)
+	assertNil(t, toSend)
+	assertVictimIsNotEncrypted(t, victim)
+}
+
+func Test_hostilePeer_DHCommitWithWrongDataLengthDoesntStartAnAKE(t *testing.T) {
+	hostile, victim := newHostilePeerAndVictim()
+	_, dhCommit, _ := hostile.Receive(victim.QueryMessage())
+
+	wrongLength := hostile.tamper(dhCommit[0], func(body []byte) []byte {
+		return append([]byte{0xFF, 0xFF, 0xFF, 0xFF}, body[4:]...)
+	})
+
+	_, toSend, err := victim.Receive(wrongLength)
+
+	assertNotNil(t, err)
+	assertNil(t, toSend)
+	assertVictimIsNotEncrypted(t, victim)
+}
+
+func Test_hostilePeer_DHKeyWithAValueOutsideTheGroupIsRejected(t *testing.T) {
+	hostile, victim := newHostilePeerAndVictim()
+	_, dhCommit, _ := victim.Receive(hostile.QueryMessage())
+	_, dhKey, _ := hostile.Receive(dhCommit[0])
+
+	for _, gy := range []*big.Int{big.NewInt(0), big.NewInt(1), p, new(big.Int).Sub(p, big.NewInt(1))} {
+		outOfRange := hostile.withHeader(dhKey[0], gotrax.AppendMPI(nil, gy))
+		var toSend []ValidMessage
+		var err error
+
+		victim.expectMessageEvent(t, func() {
+			_, toSend, err = victim.Receive(outOfRange)
+		}, MessageEventSetupError, nil, newOtrError("DH value out of range"))
+
+		assertNotNil(t, err)
+		assertNil(t, toSend)
+		assertVictimIsNotEncrypted(t, victim)
+	}
+}
+
+func Test_hostilePeer_DHCommitWithAValueOutsideTheGroupNeverFinishesTheAKE(t *testing.T) {
+	hostile, victim := newHostilePeerAndVictim()
+	hostile.ensureAKE()
+	hostile.version = otrV3{}
+	hostile.ourCurrentKey = alicePrivateKey
+	hostile.ake.secretExponent = big.NewInt(2)
+	hostile.ake.ourPublicValue = new(big.Int).Set(p)
+	copy(hostile.ake.r[:], []byte("0123456789abcdef"))
+	hostile.ake.encryptedGx, _ = encrypt(hostile.ake.r[:], encodeGx(hostile.ake.ourPublicValue))
+	hostile.ake.state = authStateAwaitingDHKey{}
+	dhCommit, _ := hostile.wrapMessageHeader(msgTypeDHCommit, hostile.serializeDHCommit(hostile.ake.ourPublicValue))
+
+	_, toSend, _ := victim.Receive(ValidMessage(hostile.encode(dhCommit)))
+	_, toSend, _ = hostile.Receive(toSend[0])
+	_, toSend, err := victim.Receive(toSend[0])
+
+	assertNotNil(t, err)
+	assertNil(t, toSend)
+	assertVictimIsNotEncrypted(t, victim)
+}
+
+func Test_hostilePeer_revealSignatureWithForgedMACDoesntFinishTheAKE(t *testing.T) {
+	hostile, victim := newHostilePeerAndVictim()
+	_, dhCommit, _ := hostile.Receive(victim.QueryMessage())
+	_, dhKey, _ := victim.Receive(dhCommit[0])
+	_, revealSig, _ := hostile.Receive(dhKey[0])
+	forged := hostile.tamper(revealSig[0], flipLastBit)
+
+	_, toSend, err := victim.Receive(forged)
+
+	assertNotNil(t, err)
+	assertNil(t, toSend)
+	assertVictimIsNotEncrypted(t, victim)
+}
+
+func Test_hostilePeer_signatureWithForgedMACDoesntFinishTheAKE(t *testing.T) {
+	hostile, victim := newHostilePeerAndVictim()
+	_, dhCommit, _ := victim.Receive(hostile.QueryMessage())
+	_, dhKey, _ := hostile.Receive(dhCommit[0])
+	_, revealSig, _ := victim.Receive(dhKey[0])
+	_, sig, _ := hostile.Receive(revealSig[0])
+	forged := hostile.tamper(sig[0], flipLastBit)
+
+	_, toSend, err := victim.Receive(forged)
+
+	assertNotNil(t, err)
+	assertNil(t, toSend)
+	assertVictimIsNotEncrypted(t, victim)
+}
+
+func Test_hostilePeer_replayedDHCommitAfterTheAKEDoesntChangeTheSession(t *testing.T) {
+	hostile, victim := newHostilePeerAndVictim()
+	_, dhCommit, _ := hostile.Receive(victim.QueryMessage())
+	exchangeUntilQuiet(t, hostile.Conversation, victim, dhCommit)
+	ssid := victim.GetSSID()
+	keys := victim.keys.ourCurrentDHKeys.pub
+
+	victim.Receive(dhCommit[0])
+
+	assertTrue(t, victim.IsEncrypted())
+	assertEquals(t, victim.GetSSID(), ssid)
+	assertEquals(t, victim.keys.ourCurrentDHKeys.pub.Cmp(keys), 0)
+}
+
+func Test_hostilePeer_messageWithADifferentVersionThanTheSessionIsRejected(t *testing.T) {
+	hostile, victim := newHostilePeerAndVictim()
+	hostile.establish(t, victim)
+	toSend, _ := hostile.Send(ValidMessage("hello"))
+
+	decoded, _ := hostile.decode(encodedMessage(toSend[0]))
+	decoded[1] = 0x02
+	wrongVersion := ValidMessage(hostile.encode(decoded))
+
+	plain, _, err := victim.Receive(wrongVersion)
+
+	assertEquals(t, err, ErrDataMessageUnsupportedVersion)
+	assertNil(t, plain)
+	assertTrue(t, victim.IsEncrypted())
+}
+
+// asV2 splices the body of an OTRv3 message into an OTRv2 message of the same type
+func (h *hostilePeer) asV2(msg ValidMessage) ValidMessage {
+	decoded, err := h.decode(encodedMessage(msg))
+	if err != nil {
+		panic(err)
+	}
+
+	header := []byte{0x00, 0x02, decoded[2]}
+	return ValidMessage(h.encode(append(header, decoded[otrv3HeaderLen:]...)))
+}
+
+func Test_hostilePeer_AKEFinishedWithMessagesSplicedFromOTRv2IsRejected(t *testing.T) {
+	for _, n := range []int{3, 4} {
+		alice, bob, msg := akeUntil(n)
+		hostile, victim := &hostilePeer{bob}, alice
+		if n == 3 {
+			hostile, victim = &hostilePeer{alice}, bob
+		}
+
+		// Switches the victim to OTRv2 without restarting the AKE, since the AKE has just moved on
+		_, _, err := victim.Receive(ValidMessage("?OTRv2?"))
+		assertNil(t, err)
+		assertEquals(t, victim.version, otrV2{})
+
+		victim.expectMessageEvent(t, func() {
+			_, _, err = victim.Receive(hostile.asV2(msg))
+		}, MessageEventSetupError, nil, errAKEVersionMismatch)
+
+		assertEquals(t, err, errAKEVersionMismatch)
+		assertVictimIsNotEncrypted(t, victim)
+	}
+}
+
+func Test_hostilePeer_dataMessageWithUnknownFlagsIsRejected(t *testing.T) {
+	hostile, victim := newHostilePeerAndVictim()
+	hostile.establish(t, victim)
+	toSend, _ := hostile.Send(ValidMessage("hello"))
+
+	decoded, _ := hostile.decode(encodedMessage(toSend[0]))
+	decoded[otrv3HeaderLen] = 0x80
+	unknownFlags := ValidMessage(hostile.encode(decoded))
+
+	plain, _, err := victim.Receive(unknownFlags)
+
+	assertEquals(t, err, ErrDataMessageUnknownFlags)
+	assertNil(t, plain)
+	assertTrue(t, victim.IsEncrypted())
+}
+
+func Test_hostilePeer_dataMessageWithForgedMACIsUnreadable(t *testing.T) {
+	hostile, victim := newHostilePeerAndVictim()
+	hostile.establish(t, victim)
+	toSend, _ := hostile.Send(ValidMessage("hello"))
+	forged := hostile.tamper(toSend[0], func(body []byte) []byte {
+		// the old MAC keys are empty, so the MAC is right before their length
+		body[len(body)-5] ^= 0x01
+		return body
+	})
+
+	var plain MessagePlaintext
+	var err error
+	victim.expectMessageEvent(t, func() {
+		plain, _, err = victim.Receive(forged)
+	}, MessageEventReceivedMessageUnreadable, nil, nil)
+
+	assertNotNil(t, err)
+	assertNil(t, plain)
+	assertTrue(t, victim.IsEncrypted())
+}
+
+func Test_hostilePeer_dataMessageWithChangedCiphertextIsUnreadable(t *testing.T) {
+	hostile, victim := newHostilePeerAndVictim()
+	hostile.establish(t, victim)
+	toSend, _ := hostile.Send(ValidMessage("hello"))
+	// the ciphertext ends right before the 20 byte MAC and the empty old MAC keys
+	changed := hostile.tamper(toSend[0], func(body []byte) []byte {
+		body[len(body)-25] ^= 0x01
+		return body
+	})
+
+	plain, _, err := victim.Receive(changed)
+
+	assertNotNil(t, err)
+	assertNil(t, plain)
+}
+
+func Test_hostilePeer_replayedDataMessageIsDiscarded(t *testing.T) {
+	hostile, victim := newHostilePeerAndVictim()
+	hostile.establish(t, victim)
+	toSend, _ := hostile.Send(ValidMessage("hello"))
+	victim.Receive(toSend[0])
+
+	var plain MessagePlaintext
+	var err error
+	victim.expectMessageEvent(t, func() {
+		plain, _, err = victim.Receive(toSend[0])
+	}, MessageEventReceivedMessageReplayed, nil, nil)
+
+	assertEquals(t, err, errCounterRegressed)
+	assertNil(t, plain)
+}
+
+func Test_hostilePeer_dataMessageWithUnknownKeyIDsIsUnreadable(t *testing.T) {
+	hostile, victim := newHostilePeerAndVictim()
+	hostile.establish(t, victim)
+	toSend, _ := hostile.Send(ValidMessage("hello"))
+	unknownKeys := hostile.tamper(toSend[0], func(body []byte) []byte {
+		copy(body[1:9], []byte{0x00, 0x00, 0x10, 0x00, 0x00, 0x00, 0x10, 0x00})
+		return body
+	})
+
+	plain, _, err := victim.Receive(unknownKeys)
+
+	assertNotNil(t, err)
+	assertNil(t, plain)
+	assertTrue(t, victim.IsEncrypted())
+}
+
+func Test_hostilePeer_truncatedDataMessageIsMalformed(t *testing.T) {
+	hostile, victim := newHostilePeerAndVictim()
+	hostile.establish(t, victim)
+	toSend, _ := hostile.Send(ValidMessage("hello"))
+	truncated := hostile.tamper(toSend[0], func(body []byte) []byte { return body[:len(body)/2] })
+
+	var plain MessagePlaintext
+	var err error
+	victim.expectMessageEvent(t, func() {
+		plain, _, err = victim.Receive(truncated)
+	}, MessageEventReceivedMessageMalformed, nil, nil)
+
+	assertNotNil(t, err)
+	assertNil(t, plain)
+	assertTrue(t, victim.IsEncrypted())
+}
+
+func Test_hostilePeer_dataMessageBeforeTheAKEIsNotInPrivate(t *testing.T) {
+	hostile, victim := newHostilePeerAndVictim()
+	other := &Conversation{Rand: victim.Rand, Policies: victim.Policies}
+	other.SetOurKeys([]PrivateKey{bobPrivateKey})
+	other.InitializeInstanceTag(victim.InitializeInstanceTag(0))
+	hostile.establish(t, other)
+	toSend, _ := hostile.Send(ValidMessage("hello"))
+
+	var plain MessagePlaintext
+	var err error
+	victim.expectMessageEvent(t, func() {
+		plain, _, err = victim.Receive(toSend[0])
+	}, MessageEventReceivedMessageNotInPrivate, nil, nil)
+
+	assertNotNil(t, err)
+	assertNil(t, plain)
+	assertVictimIsNotEncrypted(t, victim)
+}
+
+func Test_hostilePeer_AKEWithAVersionThePoliciesDontAllowIsRejected(t *testing.T) {
+	hostile, victim := newHostilePeerAndVictim()
+	victim.Policies = Policies(PolicyAllowV3)
+	_, dhCommit, _ := hostile.Receive(ValidMessage("?OTRv2?"))
+
+	_, toSend, err := victim.Receive(dhCommit[0])
+
+	assertEquals(t, err, errUnsupportedOTRVersion)
+	assertNil(t, toSend)
+	assertNil(t, victim.ake)
+	assertVictimIsNotEncrypted(t, victim)
+}
+
+func Test_hostilePeer_replayedDataMessageThatAsksToBeIgnoredIsStillSignaled(t *testing.T) {
+	hostile, victim := newHostilePeerAndVictim()
+	hostile.establish(t, victim)
+	toSend, _, _ := hostile.createSerializedDataMessage([]byte("hello"), messageFlagIgnoreUnreadable, []tlv{})
+	victim.Receive(toSend[0])
+
+	var plain MessagePlaintext
+	var err error
+	victim.expectMessageEvent(t, func() {
+		plain, _, err = victim.Receive(toSend[0])
+	}, MessageEventReceivedMessageReplayed, nil, nil)
+
+	assertNil(t, err)
+	assertNil(t, plain)
+}
+
+func Test_hostilePeer_dataMessageWithANextDHKeyOutsideTheGroupIsRejected(t *testing.T) {
+	hostile, victim := newHostilePeerAndVictim()
+	hostile.establish(t, victim)
+	theirKey := victim.keys.theirCurrentDHPubKey
+
+	for _, y := range []*big.Int{big.NewInt(1), p} {
+		hostile.keys.ourCurrentDHKeys.pub = y
+		toSend, _ := hostile.Send(ValidMessage("hello"))
+
+		var plain MessagePlaintext
+		var err error
+		victim.expectMessageEvent(t, func() {
+			plain, _, err = victim.Receive(toSend[0])
+		}, MessageEventReceivedMessageMalformed, nil, nil)
+
+		assertEquals(t, err, ErrDataMessageBadMPI)
+		assertNil(t, plain)
+		assertEquals(t, victim.keys.theirCurrentDHPubKey, theirKey)
+	}
+}
+
+func Test_hostilePeer_revealSignatureThatDoesntRevealTheCommittedGxAbortsTheAKE(t *testing.T) {
+	hostile, victim := newHostilePeerAndVictim()
+	_, dhCommit, _ := hostile.Receive(victim.QueryMessage())
+	_, dhKey, _ := victim.Receive(dhCommit[0])
+	_, revealSig, _ := hostile.Receive(dhKey[0])
+	// r is the first field, after its 4 byte length
+	wrongR := hostile.tamper(revealSig[0], func(body []byte) []byte {
+		body[4] ^= 0x01
+		return body
+	})
+
+	var toSend []ValidMessage
+	var err error
+	victim.expectMessageEvent(t, func() {
+		_, toSend, err = victim.Receive(wrongR)
+	}, MessageEventSetupError, nil, errBadGxCommitment)
+
+	assertEquals(t, err, errBadGxCommitment)
+	assertNil(t, toSend)
+	assertDeepEquals(t, victim.ake.state, authStateNone{})
+	assertNil(t, victim.ake.theirPublicValue)
+	assertVictimIsNotEncrypted(t, victim)
+
+	_, toSend, _ = victim.Receive(revealSig[0])
+	assertNil(t, toSend)
+	assertVictimIsNotEncrypted(t, victim)
+}
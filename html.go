@@ -0,0 +1,41 @@
+package otr3
+
+import (
+	"bytes"
+	"html"
+)
+
+// stripHTMLAroundOTRMessage removes the HTML markup some clients wrap around
+// query and error messages, for example "<p>?OTRv3?</p>". Messages that don't
+// start with an OTR marker once the markup is gone are returned unchanged,
+// since they are normal messages that happen to contain HTML.
+func stripHTMLAroundOTRMessage(msg ValidMessage) ValidMessage {
+	if bytes.HasPrefix(msg, queryMarker) || bytes.IndexByte(msg, '<') == -1 {
+		return msg
+	}
+
+	stripped := bytes.TrimSpace(withoutHTMLTags(msg))
+	if !bytes.HasPrefix(stripped, queryMarker) {
+		return msg
+	}
+
+	return ValidMessage(html.UnescapeString(string(stripped)))
+}
+
+func withoutHTMLTags(msg []byte) []byte {
+	ret := make([]byte, 0, len(msg))
+	inTag := false
+
+	for _, b := range msg {
+		switch {
+		case b == '<':
+			inTag = true
+		case b == '>' && inTag:
+			inTag = false
+		case !inTag:
+			ret = append(ret, b)
+		}
+	}
+
+	return ret
+}
@@ -0,0 +1,55 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+func Test_stripHTMLAroundOTRMessage_removesTheMarkupAroundAQueryMessage(t *testing.T) {
+	msg := stripHTMLAroundOTRMessage(ValidMessage("<HTML><BODY>?OTRv23?</BODY></HTML>"))
+
+	assertDeepEquals(t, msg, ValidMessage("?OTRv23?"))
+}
+
+func Test_stripHTMLAroundOTRMessage_removesTheMarkupAroundAnErrorMessage(t *testing.T) {
+	msg := stripHTMLAroundOTRMessage(ValidMessage("<span style=\"color: red\">?OTR Error: you &amp; me</span>"))
+
+	assertDeepEquals(t, msg, ValidMessage("?OTR Error: you & me"))
+}
+
+func Test_stripHTMLAroundOTRMessage_leavesOtherHTMLMessagesAlone(t *testing.T) {
+	msg := stripHTMLAroundOTRMessage(ValidMessage("<b>hello</b> ?OTRv3?"))
+
+	assertDeepEquals(t, msg, ValidMessage("<b>hello</b> ?OTRv3?"))
+}
+
+func Test_stripHTMLAroundOTRMessage_leavesMessagesWithoutHTMLAlone(t *testing.T) {
+	msg := stripHTMLAroundOTRMessage(ValidMessage("?OTRv3? 1 < 2"))
+
+	assertDeepEquals(t, msg, ValidMessage("?OTRv3? 1 < 2"))
+}
+
+func Test_Receive_startsTheAKEForAQueryMessageWrappedInHTMLIfThePolicyAllowsIt(t *testing.T) {
+	c := &Conversation{Rand: rand.Reader}
+	c.Policies = Policies(PolicyAllowV3)
+	c.Policies.StripHTML()
+	c.SetOurKeys([]PrivateKey{bobPrivateKey})
+
+	plain, toSend, err := c.Receive(ValidMessage("<p>?OTRv3?</p>"))
+
+	assertNil(t, err)
+	assertNil(t, plain)
+	assertEquals(t, guessMessageType(toSend[0]), msgGuessDHCommit)
+}
+
+func Test_Receive_showsAQueryMessageWrappedInHTMLToTheUserByDefault(t *testing.T) {
+	c := &Conversation{Rand: rand.Reader}
+	c.Policies = Policies(PolicyAllowV3)
+	c.SetOurKeys([]PrivateKey{bobPrivateKey})
+
+	plain, toSend, err := c.Receive(ValidMessage("<p>?OTRv3?</p>"))
+
+	assertNil(t, err)
+	assertNil(t, toSend)
+	assertDeepEquals(t, plain, MessagePlaintext("<p>?OTRv3?</p>"))
+}
@@ -17,8 +17,14 @@ func (c *Conversation) withInjects(vms []ValidMessage) []ValidMessage {
 	return append(vms, msgs...)
 }
 
+// withInjectionsPlain is used when receiving, where the injected messages are replies the reply handler has to approve
 func (c *Conversation) withInjectionsPlain(plain MessagePlaintext, vms []ValidMessage, err error) (MessagePlaintext, []ValidMessage, error) {
-	return plain, c.withInjects(vms), err
+	msgs := c.injections.messages
+	c.injections.messages = c.injections.messages[0:0]
+	for _, vm := range msgs {
+		vms = append(vms, c.approvedReply(replyKindOfInjected(vm), []ValidMessage{vm})...)
+	}
+	return plain, vms, err
 }
 
 func (c *Conversation) withInjections(vms []ValidMessage, err error) ([]ValidMessage, error) {
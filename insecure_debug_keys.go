@@ -0,0 +1,51 @@
+//go:build otr3_insecure_debug
+// +build otr3_insecure_debug
+
+package otr3
+
+import "fmt"
+
+// This file is only part of the package when it is built with the otr3_insecure_debug build tag.
+// It makes it possible to get the session keys of a private conversation, which is useful when
+// debugging the protocol or checking the interoperability with libotr, and makes the private
+// conversations of such a build worthless. It should never be used in a build that is given to users.
+
+var errCannotExportKeysUnencrypted = newOtrError("cannot export session keys when not in private conversation")
+
+func init() {
+	fmt.Fprintln(standardErrorOutput, debugPrefix+"otr3 was built with otr3_insecure_debug - session keys can be exported, so nothing is private")
+}
+
+// InsecureSessionKeys are the keys used for the data messages between one of our D-H keys and one of theirs
+type InsecureSessionKeys struct {
+	OurKeyID, TheirKeyID uint32
+
+	SendingAESKey, ReceivingAESKey []byte
+	SendingMACKey, ReceivingMACKey []byte
+	ExtraKey                       []byte
+}
+
+// InsecureExportSessionKeys returns the session keys the next data message we send will use.
+// It is only available when built with the otr3_insecure_debug build tag.
+func (c *Conversation) InsecureExportSessionKeys() (InsecureSessionKeys, error) {
+	if c.msgState != encrypted {
+		return InsecureSessionKeys{}, errCannotExportKeysUnencrypted
+	}
+
+	ourKeyID, theirKeyID := c.keys.ourKeyID-1, c.keys.theirKeyID
+	keys, err := c.keys.calculateDHSessionKeys(nil, ourKeyID, theirKeyID, c.version)
+	if err != nil {
+		return InsecureSessionKeys{}, err
+	}
+	defer keys.wipe()
+
+	return InsecureSessionKeys{
+		OurKeyID:        ourKeyID,
+		TheirKeyID:      theirKeyID,
+		SendingAESKey:   makeCopy(keys.sendingAESKey),
+		ReceivingAESKey: makeCopy(keys.receivingAESKey),
+		SendingMACKey:   makeCopy(keys.sendingMACKey),
+		ReceivingMACKey: makeCopy(keys.receivingMACKey),
+		ExtraKey:        makeCopy(keys.extraKey),
+	}, nil
+}
@@ -0,0 +1,47 @@
+//go:build otr3_insecure_debug
+// +build otr3_insecure_debug
+
+package otr3
+
+import "testing"
+
+func Test_InsecureExportSessionKeys_returnsAnErrorWhenNotEncrypted(t *testing.T) {
+	c := &Conversation{}
+
+	_, err := c.InsecureExportSessionKeys()
+
+	assertEquals(t, err, errCannotExportKeysUnencrypted)
+}
+
+func Test_InsecureExportSessionKeys_returnsKeysThatMatchThePeer(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+
+	aliceKeys, err := alice.InsecureExportSessionKeys()
+	assertNil(t, err)
+	bobKeys, err := bob.InsecureExportSessionKeys()
+	assertNil(t, err)
+
+	assertEquals(t, aliceKeys.OurKeyID, bobKeys.TheirKeyID)
+	assertEquals(t, aliceKeys.TheirKeyID, bobKeys.OurKeyID)
+	assertDeepEquals(t, aliceKeys.SendingAESKey, bobKeys.ReceivingAESKey)
+	assertDeepEquals(t, aliceKeys.ReceivingAESKey, bobKeys.SendingAESKey)
+	assertDeepEquals(t, aliceKeys.SendingMACKey, bobKeys.ReceivingMACKey)
+	assertDeepEquals(t, aliceKeys.ReceivingMACKey, bobKeys.SendingMACKey)
+	assertDeepEquals(t, aliceKeys.ExtraKey, bobKeys.ExtraKey)
+}
+
+func Test_InsecureExportSessionKeys_returnsTheKeysUsedToSend(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	keys, _ := alice.InsecureExportSessionKeys()
+
+	msg, _ := alice.Send(ValidMessage("hello"))
+	decoded, _ := bob.decode(encodedMessage(msg[0]))
+	header, dataMessage, err := bob.parseMessageHeader(decoded)
+	assertNil(t, err)
+	data := dataMsg{}
+	assertNil(t, data.deserialize(dataMessage, bob.version, bob.FieldLimits()))
+
+	assertEquals(t, data.senderKeyID, keys.OurKeyID)
+	assertEquals(t, data.recipientKeyID, keys.TheirKeyID)
+	assertNil(t, data.checkSign(keys.SendingMACKey, header, alice.version))
+}
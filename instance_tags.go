@@ -0,0 +1,109 @@
+package otr3
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// InstanceTag is an entry of a libotr instance tag file. It records the instance tag
+// we use for one of our accounts, so that it stays the same when the client restarts.
+type InstanceTag struct {
+	Account  string
+	Protocol string
+	Tag      uint32
+}
+
+// ImportInstanceTagsFromFile will read the libotr formatted instance tag file (usually called otr.instag)
+// given and return all entries defined in it
+func ImportInstanceTagsFromFile(fname string) ([]*InstanceTag, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return ImportInstanceTags(f)
+}
+
+// ImportInstanceTags will read the libotr formatted instance tag data given and return all entries defined in it.
+// Just like libotr, lines that can't be parsed are skipped. Entries with instance tags that are not valid are skipped as well.
+func ImportInstanceTags(r io.Reader) ([]*InstanceTag, error) {
+	var result []*InstanceTag
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if it, ok := parseInstanceTagLine(line); ok {
+			result = append(result, it)
+		}
+
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseInstanceTagLine parses a line of the form "accountname<TAB>protocol<TAB>instag",
+// where the instance tag is written in hex
+func parseInstanceTagLine(line string) (*InstanceTag, bool) {
+	line = strings.TrimRight(line, "\r\n")
+	fields := strings.Split(line, "\t")
+	if len(fields) != 3 {
+		return nil, false
+	}
+
+	tag, err := strconv.ParseUint(fields[2], 16, 32)
+	if err != nil || uint32(tag) < minValidInstanceTag {
+		return nil, false
+	}
+
+	return &InstanceTag{
+		Account:  fields[0],
+		Protocol: fields[1],
+		Tag:      uint32(tag),
+	}, true
+}
+
+// ExportInstanceTagsToFile will create the named file (or truncate it) and write all the entries to that file in libotr format
+func ExportInstanceTagsToFile(tags []*InstanceTag, fname string) error {
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return ExportInstanceTags(tags, f)
+}
+
+// ExportInstanceTags will write all the entries given in libotr format
+func ExportInstanceTags(tags []*InstanceTag, w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, it := range tags {
+		fmt.Fprintf(bw, "%s\t%s\t%08x\n", it.Account, it.Protocol, it.Tag)
+	}
+	return bw.Flush()
+}
+
+// UseInstanceTagFrom makes the conversation use the instance tag recorded for the given account in tags.
+// If there is no instance tag for the account yet, a new one is generated and added.
+// The possibly extended list of instance tags is returned, and should be saved if it has changed.
+func (c *Conversation) UseInstanceTagFrom(tags []*InstanceTag, account, protocol string) ([]*InstanceTag, error) {
+	for _, it := range tags {
+		if it.Account == account && it.Protocol == protocol {
+			c.ourInstanceTag = it.Tag
+			return tags, nil
+		}
+	}
+
+	c.ourInstanceTag = 0
+	if err := c.generateInstanceTag(); err != nil {
+		return tags, err
+	}
+
+	return append(tags, &InstanceTag{Account: account, Protocol: protocol, Tag: c.ourInstanceTag}), nil
+}
@@ -0,0 +1,102 @@
+package otr3
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+const libOTRInstanceTags = "alice@example.com\tprpl-jabber\t4d2a13f0\n" +
+	"alice\tprpl-irc\t00000100\n"
+
+func Test_ImportInstanceTags_readsAllEntriesInTheLibotrFormat(t *testing.T) {
+	res, err := ImportInstanceTags(bytes.NewBufferString(libOTRInstanceTags))
+
+	assertNil(t, err)
+	assertDeepEquals(t, res, []*InstanceTag{
+		&InstanceTag{Account: "alice@example.com", Protocol: "prpl-jabber", Tag: 0x4d2a13f0},
+		&InstanceTag{Account: "alice", Protocol: "prpl-irc", Tag: 0x100},
+	})
+}
+
+func Test_ImportInstanceTags_skipsLinesThatCantBeParsedAndInvalidTags(t *testing.T) {
+	res, err := ImportInstanceTags(bytes.NewBufferString(
+		"\n" +
+			"alice\tprpl-irc\n" +
+			"alice\tprpl-irc\tnothex\n" +
+			"alice\tprpl-irc\t000000ff\n" +
+			"alice\tprpl-irc\t1234567890\n" +
+			"bob\tprpl-irc\t00001234\r\n"))
+
+	assertNil(t, err)
+	assertDeepEquals(t, res, []*InstanceTag{&InstanceTag{Account: "bob", Protocol: "prpl-irc", Tag: 0x1234}})
+}
+
+func Test_ExportInstanceTags_writesTheSameDataAsLibotr(t *testing.T) {
+	tags, _ := ImportInstanceTags(bytes.NewBufferString(libOTRInstanceTags))
+
+	bt := bytes.NewBuffer(make([]byte, 0, 200))
+	err := ExportInstanceTags(tags, bt)
+
+	assertNil(t, err)
+	assertEquals(t, bt.String(), libOTRInstanceTags)
+}
+
+func Test_ExportInstanceTagsToFile_exportsInstanceTagsToAFileThatCanBeImportedAgain(t *testing.T) {
+	tags, _ := ImportInstanceTags(bytes.NewBufferString(libOTRInstanceTags))
+
+	err := ExportInstanceTagsToFile(tags, "test_resources/test_export_of_instance_tags.blah")
+	defer os.Remove("test_resources/test_export_of_instance_tags.blah")
+	assertNil(t, err)
+
+	res, err2 := ImportInstanceTagsFromFile("test_resources/test_export_of_instance_tags.blah")
+	assertNil(t, err2)
+	assertDeepEquals(t, res, tags)
+}
+
+func Test_ImportInstanceTagsFromFile_willReturnAnErrorIfAskedToReadAFileNameThatDoesntExist(t *testing.T) {
+	_, err := ImportInstanceTagsFromFile("this_file_doesnt_exist.instag")
+	assertEquals(t, err.Error(), "open this_file_doesnt_exist.instag: no such file or directory")
+}
+
+func Test_UseInstanceTagFrom_usesTheRecordedInstanceTagOfTheAccount(t *testing.T) {
+	tags, _ := ImportInstanceTags(bytes.NewBufferString(libOTRInstanceTags))
+	c := &Conversation{}
+
+	res, err := c.UseInstanceTagFrom(tags, "alice@example.com", "prpl-jabber")
+
+	assertNil(t, err)
+	assertDeepEquals(t, res, tags)
+	assertEquals(t, c.ourInstanceTag, uint32(0x4d2a13f0))
+}
+
+func Test_UseInstanceTagFrom_generatesAndAddsANewInstanceTagForAnUnknownAccount(t *testing.T) {
+	tags, _ := ImportInstanceTags(bytes.NewBufferString(libOTRInstanceTags))
+	c := &Conversation{Rand: fixedRand([]string{"00001234"})}
+
+	res, err := c.UseInstanceTagFrom(tags, "alice", "prpl-jabber")
+
+	assertNil(t, err)
+	assertEquals(t, len(res), 3)
+	assertDeepEquals(t, res[2], &InstanceTag{Account: "alice", Protocol: "prpl-jabber", Tag: 0x1234})
+	assertEquals(t, c.ourInstanceTag, uint32(0x1234))
+}
+
+func Test_UseInstanceTagFrom_returnsErrorIfAnInstanceTagCantBeGenerated(t *testing.T) {
+	c := &Conversation{Rand: fixedRand([]string{"00"})}
+
+	res, err := c.UseInstanceTagFrom(nil, "alice", "prpl-jabber")
+
+	assertEquals(t, err, errShortRandomRead)
+	assertNil(t, res)
+}
+
+func Test_UseInstanceTagFrom_theInstanceTagIsUsedInMessageHeaders(t *testing.T) {
+	c := &Conversation{version: otrV3{}}
+	c.UseInstanceTagFrom([]*InstanceTag{&InstanceTag{Account: "a", Protocol: "p", Tag: 0x4d2a13f0}}, "a", "p")
+
+	header, err := c.messageHeader(msgTypeDHCommit)
+
+	assertNil(t, err)
+	assertDeepEquals(t, header[3:7], []byte{0x4d, 0x2a, 0x13, 0xf0})
+}
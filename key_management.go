@@ -3,10 +3,7 @@ package otr3
 import (
 	"encoding/binary"
 	"hash"
-	"io"
 	"math/big"
-
-	"github.com/coyim/gotrax"
 )
 
 type dhKeyPair struct {
@@ -46,7 +43,17 @@ func (h *macKeyHistory) deleteKeysAt(del ...int) {
 	}
 }
 
+// addKeys records a receiving MAC key that has been used to verify a message
+// from the peer, so that it can be revealed once the keys it was derived from
+// are retired. Every key is only recorded once, no matter how many messages
+// it verified.
 func (h *macKeyHistory) addKeys(ourKeyID uint32, theirKeyID uint32, receivingMACKey macKey) {
+	for _, k := range h.items {
+		if k.ourKeyID == ourKeyID && k.theirKeyID == theirKeyID {
+			return
+		}
+	}
+
 	macKeys := macKeyUsage{
 		ourKeyID:     ourKeyID,
 		theirKeyID:   theirKeyID,
@@ -90,6 +97,8 @@ func (h *macKeyHistory) forgetMACKeysForTheirKey(theirKeyID uint32) []macKey {
 type keyPairCounter struct {
 	ourKeyID, theirKeyID     uint32
 	ourCounter, theirCounter uint64
+	// theirSeen has bit i set when their counter theirCounter-1-i has been received
+	theirSeen uint64
 }
 
 type counterHistory struct {
@@ -136,39 +145,94 @@ func (k *keyManagementContext) setOurCurrentDHKeys(priv *big.Int, pub *big.Int)
 	k.ourCurrentDHKeys.pub = setBigInt(k.ourCurrentDHKeys.pub, pub)
 }
 
-func (k *keyManagementContext) checkMessageCounter(message dataMsg) error {
+// checkMessageCounter accepts a message if its counter is larger than any received before.
+// With a reorder window, it also accepts messages up to window counters older than the largest,
+// as long as they haven't been received before.
+func (k *keyManagementContext) checkMessageCounter(message dataMsg, window uint64) error {
 	counter := k.counterHistory.findCounterFor(message.recipientKeyID, message.senderKeyID)
 	theirNextCounter := binary.BigEndian.Uint64(message.topHalfCtr[:])
 
-	if theirNextCounter <= counter.theirCounter {
-		return newOtrConflictError("counter regressed")
+	if !counter.accepts(theirNextCounter, window) {
+		return errCounterRegressed
+	}
+
+	counter.record(theirNextCounter)
+	return nil
+}
+
+// peekMessageCounter checks the counter of the message like checkMessageCounter, without recording it
+func (k *keyManagementContext) peekMessageCounter(message dataMsg, window uint64) error {
+	counter := &keyPairCounter{}
+	for _, c := range k.counterHistory.counters {
+		if c.ourKeyID == message.recipientKeyID && c.theirKeyID == message.senderKeyID {
+			counter = c
+		}
 	}
 
-	counter.theirCounter = theirNextCounter
+	if !counter.accepts(binary.BigEndian.Uint64(message.topHalfCtr[:]), window) {
+		return errCounterRegressed
+	}
 	return nil
 }
 
+func (c *keyPairCounter) accepts(next, window uint64) bool {
+	if next > c.theirCounter {
+		return true
+	}
+
+	behind := c.theirCounter - next
+	if next == 0 || behind == 0 || behind > window || behind > maxReorderWindow {
+		return false
+	}
+
+	return c.theirSeen&(1<<(behind-1)) == 0
+}
+
+func (c *keyPairCounter) record(next uint64) {
+	if next <= c.theirCounter {
+		c.theirSeen |= 1 << (c.theirCounter - next - 1)
+		return
+	}
+
+	shift := next - c.theirCounter
+	if shift > maxReorderWindow {
+		c.theirSeen = 0
+	} else {
+		c.theirSeen = c.theirSeen<<shift | 1<<(shift-1)
+	}
+	c.theirCounter = next
+}
+
 func (k *keyManagementContext) revealMACKeys() []macKey {
 	ret := k.oldMACKeys
 	k.oldMACKeys = []macKey{}
 	return ret
 }
 
-func (k *keyManagementContext) generateNewDHKeyPair(randomness io.Reader) error {
-	newPrivKey, err := randSizedMPI(randomness, 40)
+func randomDHKeyPair(keys EphemeralKeyProvider, v otrVersion) (dhKeyPair, error) {
+	priv, err := keys.EphemeralExponent(v.dhExponentLength())
+	if err != nil {
+		return dhKeyPair{}, err
+	}
+
+	return dhKeyPair{priv: priv, pub: modExp(g1, priv)}, nil
+}
+
+func (k *keyManagementContext) generateNewDHKeyPair(keys EphemeralKeyProvider, v otrVersion) error {
+	next, err := randomDHKeyPair(keys, v)
 	if err != nil {
 		return err
 	}
 
+	k.useNewDHKeyPair(next)
+	return nil
+}
+
+func (k *keyManagementContext) useNewDHKeyPair(next dhKeyPair) {
 	k.ourPreviousDHKeys.wipe()
 	k.ourPreviousDHKeys = k.ourCurrentDHKeys
-
-	k.ourCurrentDHKeys = dhKeyPair{
-		priv: newPrivKey,
-		pub:  modExp(g1, newPrivKey),
-	}
+	k.ourCurrentDHKeys = next
 	k.ourKeyID++
-	return nil
 }
 
 func (k *keyManagementContext) revealMACKeysForOurPreviousKeyID() {
@@ -177,18 +241,28 @@ func (k *keyManagementContext) revealMACKeysForOurPreviousKeyID() {
 }
 
 func (c *Conversation) rotateKeys(dataMessage dataMsg) error {
-	if err := c.keys.rotateOurKeys(dataMessage.recipientKeyID, c.rand()); err != nil {
+	ourKeyID, theirKeyID := c.keys.ourKeyID, c.keys.theirKeyID
+	if err := c.keys.rotateOurKeys(dataMessage.recipientKeyID, c.ephemeralKeys(), c.version); err != nil {
 		return err
 	}
 	c.keys.rotateTheirKey(dataMessage.senderKeyID, dataMessage.y)
 
+	if c.keys.ourKeyID != ourKeyID || c.keys.theirKeyID != theirKeyID {
+		c.timelineEvent(TimelineKeysRotated)
+	}
+
 	return nil
 }
 
-func (k *keyManagementContext) rotateOurKeys(recipientKeyID uint32, randomness io.Reader) error {
+func (k *keyManagementContext) rotateOurKeys(recipientKeyID uint32, keys EphemeralKeyProvider, v otrVersion) error {
 	if recipientKeyID == k.ourKeyID {
+		next, err := randomDHKeyPair(keys, v)
+		if err != nil {
+			return err
+		}
+
 		k.revealMACKeysForOurPreviousKeyID()
-		return k.generateNewDHKeyPair(randomness)
+		k.useNewDHKeyPair(next)
 	}
 	return nil
 }
@@ -208,7 +282,7 @@ func (k *keyManagementContext) rotateTheirKey(senderKeyID uint32, pubDHKey *big.
 	}
 }
 
-func (k *keyManagementContext) calculateDHSessionKeys(ourKeyID, theirKeyID uint32, v otrVersion) (sessionKeys, error) {
+func (k *keyManagementContext) calculateDHSessionKeys(secrets *secretScratch, ourKeyID, theirKeyID uint32, v otrVersion) (sessionKeys, error) {
 	var ret sessionKeys
 
 	ourPrivKey, ourPubKey, err := k.pickOurKeys(ourKeyID)
@@ -221,13 +295,18 @@ func (k *keyManagementContext) calculateDHSessionKeys(ourKeyID, theirKeyID uint3
 		return ret, err
 	}
 
-	ret = calculateDHSessionKeys(ourPrivKey, ourPubKey, theirPubKey, v)
-	k.macKeyHistory.addKeys(ourKeyID, theirKeyID, ret.receivingMACKey)
+	return calculateDHSessionKeys(secrets, ourPrivKey, ourPubKey, theirPubKey, v), nil
+}
 
-	return ret, nil
+// receivingMACKeyUsed should be called once a message from the peer has been
+// verified with the given session keys. Only MAC keys that have actually been
+// used for receiving are revealed when the corresponding DH keys are retired.
+func (k *keyManagementContext) receivingMACKeyUsed(ourKeyID, theirKeyID uint32, keys sessionKeys) {
+	// The session keys are wiped after use, so the key to reveal later is kept separately
+	k.macKeyHistory.addKeys(ourKeyID, theirKeyID, macKey(makeCopy(keys.receivingMACKey)))
 }
 
-func calculateDHSessionKeys(ourPrivKey, ourPubKey, theirPubKey *big.Int, v otrVersion) sessionKeys {
+func calculateDHSessionKeys(secrets *secretScratch, ourPrivKey, ourPubKey, theirPubKey *big.Int, v otrVersion) sessionKeys {
 	var ret sessionKeys
 	var sendbyte, recvbyte byte
 
@@ -239,8 +318,10 @@ func calculateDHSessionKeys(ourPrivKey, ourPubKey, theirPubKey *big.Int, v otrVe
 		sendbyte, recvbyte = 0x02, 0x01
 	}
 
-	s := new(big.Int).Exp(theirPubKey, ourPrivKey, p)
-	secbytes := gotrax.AppendMPI(nil, s)
+	s := secrets.modExp(theirPubKey, ourPrivKey)
+	secbytes := encodeSharedSecret(s)
+	defer wipeBytes(secbytes)
+	defer wipeBigInt(s)
 
 	sha := v.hashInstance()
 
@@ -294,7 +375,8 @@ func (k *keyManagementContext) pickTheirKey(theirKeyID uint32) (pubKey *big.Int,
 }
 
 func calculateAKEKeys(s *big.Int, v otrVersion) (ssid [8]byte, revealSigKeys, signatureKeys akeKeys) {
-	secbytes := gotrax.AppendMPI(nil, s)
+	secbytes := encodeSharedSecret(s)
+	defer wipeBytes(secbytes)
 	sha := v.hash2Instance()
 	keys := h(0x01, secbytes, sha)
 
@@ -22,7 +22,7 @@ func Test_calculateDHSessionKeys(t *testing.T) {
 	receivingMACKey := bytesFromHex("03f8034b891b1e843db5bba9a41ec68a1f5f8bbf")
 	extraKey := bytesFromHex("0e1810c7c62c3bace6450dcbef16af8a271b5ac93030b83e9d0d80e0641e3c18")
 
-	keys, err := c.calculateDHSessionKeys(1, 1, otrV3{})
+	keys, err := c.calculateDHSessionKeys(nil, 1, 1, otrV3{})
 
 	assertEquals(t, err, nil)
 	assertDeepEquals(t, keys.sendingAESKey, sendingAESKey)
@@ -32,7 +32,22 @@ func Test_calculateDHSessionKeys(t *testing.T) {
 	assertDeepEquals(t, keys.extraKey, extraKey)
 }
 
-func Test_calculateDHSessionKeys_storesGeneratedMACKeys(t *testing.T) {
+func Test_calculateDHSessionKeys_doesntStoreGeneratedMACKeys(t *testing.T) {
+	c := keyManagementContext{
+		ourKeyID:             1,
+		theirKeyID:           2,
+		theirCurrentDHPubKey: big.NewInt(1),
+		ourCurrentDHKeys: dhKeyPair{
+			priv: big.NewInt(1),
+			pub:  big.NewInt(1),
+		},
+	}
+	c.calculateDHSessionKeys(nil, 1, 2, otrV3{})
+
+	assertEquals(t, len(c.macKeyHistory.items), 0)
+}
+
+func Test_receivingMACKeyUsed_storesTheReceivingMACKey(t *testing.T) {
 	ourKeyID := uint32(1)
 	theirKeyID := uint32(2)
 
@@ -45,7 +60,8 @@ func Test_calculateDHSessionKeys_storesGeneratedMACKeys(t *testing.T) {
 			pub:  big.NewInt(1),
 		},
 	}
-	keys, _ := c.calculateDHSessionKeys(ourKeyID, theirKeyID, otrV3{})
+	keys, _ := c.calculateDHSessionKeys(nil, ourKeyID, theirKeyID, otrV3{})
+	c.receivingMACKeyUsed(ourKeyID, theirKeyID, keys)
 
 	expectedMACKeys := macKeyUsage{
 		ourKeyID:     ourKeyID,
@@ -57,16 +73,31 @@ func Test_calculateDHSessionKeys_storesGeneratedMACKeys(t *testing.T) {
 	assertDeepEquals(t, c.macKeyHistory.items[0], expectedMACKeys)
 }
 
+func Test_addKeys_onlyStoresTheKeysForAKeyPairOnce(t *testing.T) {
+	k1 := macKey{0x01, 0x01, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	k2 := macKey{0x02, 0x02, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+	h := macKeyHistory{}
+
+	h.addKeys(1, 1, k1)
+	h.addKeys(1, 1, k1)
+	h.addKeys(1, 2, k2)
+
+	assertDeepEquals(t, h.items, []macKeyUsage{
+		macKeyUsage{ourKeyID: 1, theirKeyID: 1, receivingKey: k1},
+		macKeyUsage{ourKeyID: 1, theirKeyID: 2, receivingKey: k2},
+	})
+}
+
 func Test_calculateDHSessionKeys_failsWhenOurOrTheyKeyIsUnknown(t *testing.T) {
 	c := keyManagementContext{
 		ourKeyID:   1,
 		theirKeyID: 1,
 	}
 
-	_, err := c.calculateDHSessionKeys(2, 1, otrV3{})
+	_, err := c.calculateDHSessionKeys(nil, 2, 1, otrV3{})
 	assertDeepEquals(t, err, newOtrConflictError("mismatched key id for local peer"))
 
-	_, err = c.calculateDHSessionKeys(1, 3, otrV3{})
+	_, err = c.calculateDHSessionKeys(nil, 1, 3, otrV3{})
 	assertDeepEquals(t, err, newOtrConflictError("mismatched key id for remote peer"))
 }
 
@@ -75,7 +106,7 @@ func Test_calculateDHSessionKeys_failsWhenTheirPreviousPubliKeyIsNull(t *testing
 		ourKeyID:   2,
 		theirKeyID: 2,
 	}
-	_, err := c.calculateDHSessionKeys(2, 1, otrV3{})
+	_, err := c.calculateDHSessionKeys(nil, 2, 1, otrV3{})
 
 	assertEquals(t, err, newOtrConflictError("no previous key for remote peer found"))
 }
@@ -168,7 +199,7 @@ func Test_rotateOurKeys_rotateOurCurrentDHKeys(t *testing.T) {
 		},
 	}
 
-	c.rotateOurKeys(recipientKeyID, fixedRand([]string{"abcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcd"}))
+	c.rotateOurKeys(recipientKeyID, randomExponents{fixedRand([]string{"abcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcd"})}, otrV3{})
 
 	assertEquals(t, c.ourKeyID, recipientKeyID+1)
 	assertDeepEquals(t, c.ourPreviousDHKeys.priv, fixedX())
@@ -189,7 +220,7 @@ func Test_rotateOurKeys_doesNotRotateIfWeDontReceiveOurCurrentKeyID(t *testing.T
 		},
 	}
 
-	c.rotateOurKeys(recipientKeyID+1, fixedRand([]string{"abcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcd"}))
+	c.rotateOurKeys(recipientKeyID+1, randomExponents{fixedRand([]string{"abcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcd"})}, otrV3{})
 
 	assertEquals(t, c.ourKeyID, recipientKeyID)
 	assertEquals(t, c.ourPreviousDHKeys.priv, nilB)
@@ -264,7 +295,7 @@ func Test_rotateOurKey_revealAllMACKeysAssociatedWithOurPreviousPubKey(t *testin
 		},
 	}
 
-	c.rotateOurKeys(2, fixedRand([]string{"abcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcd"}))
+	c.rotateOurKeys(2, randomExponents{fixedRand([]string{"abcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcd"})}, otrV3{})
 
 	assertDeepEquals(t, c.oldMACKeys, expectedMACKeys)
 	assertDeepEquals(t, len(c.macKeyHistory.items), 1)
@@ -282,12 +313,12 @@ func Test_checkMessageCounter_messageIsInvalidWhenCounterIsNotLargerThanTheLastR
 	}
 	msg.topHalfCtr[7] = 2
 
-	err := c.checkMessageCounter(msg)
+	err := c.checkMessageCounter(msg, 0)
 	assertEquals(t, err, newOtrConflictError("counter regressed"))
 	assertEquals(t, ctr.theirCounter, uint64(2))
 
 	msg.topHalfCtr[7] = 1
-	err = c.checkMessageCounter(msg)
+	err = c.checkMessageCounter(msg, 0)
 	assertEquals(t, err, newOtrConflictError("counter regressed"))
 	assertEquals(t, ctr.theirCounter, uint64(2))
 }
@@ -303,7 +334,7 @@ func Test_checkMessageCounter_messageIsValidWhenCounterIsLargerThanTheLastReceiv
 		recipientKeyID: 1,
 	}
 	msg.topHalfCtr[7] = 3
-	err := c.checkMessageCounter(msg)
+	err := c.checkMessageCounter(msg, 0)
 	assertEquals(t, err, nil)
 	assertEquals(t, ctr.theirCounter, uint64(3))
 
@@ -315,7 +346,7 @@ func Test_checkMessageCounter_messageIsValidWhenCounterIsLargerThanTheLastReceiv
 	}
 
 	msg.topHalfCtr[7] = 1
-	err = c.checkMessageCounter(msg)
+	err = c.checkMessageCounter(msg, 0)
 	assertEquals(t, err, nil)
 	assertEquals(t, ctr.theirCounter, uint64(1))
 }
@@ -331,7 +362,7 @@ func Test_generateNewDHKeypair_wipesPreviousDHKeysBeforePointingToCurrentDHKeys(
 		},
 	}
 
-	c.generateNewDHKeyPair(fixedRand([]string{"abcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcd"}))
+	c.generateNewDHKeyPair(randomExponents{fixedRand([]string{"abcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcdabcd"})}, otrV3{})
 
 	assertEquals(t, prevPrivKey.Int64(), int64(0))
 	assertEquals(t, prevPubKey.Int64(), int64(0))
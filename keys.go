@@ -139,14 +139,14 @@ func ImportKeysFromFile(fname string) ([]*Account, error) {
 }
 
 // ExportKeysToFile will create the named file (or truncate it) and write all the accounts to that file in libotr format.
+// Like libotr, the file is created so that it's only readable by the current user.
 func ExportKeysToFile(acs []*Account, fname string) error {
-	f, err := os.Create(fname)
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	exportAccounts(acs, f)
-	return nil
+	return exportAccounts(acs, f)
 }
 
 // ImportKeys will read the libotr formatted data given and return all accounts defined in it
@@ -377,6 +377,7 @@ func (pub *DSAPublicKey) serialize() []byte {
 }
 
 // Fingerprint will generate a fingerprint of the serialized version of the key using the provided hash.
+// For OTR versions 2 and 3 this is the 20 byte SHA-1 hash. FormatFingerprint can be used to display it.
 func (pub *DSAPublicKey) Fingerprint() []byte {
 	b := pub.serialize()
 	if b == nil {
@@ -548,7 +549,17 @@ func exportDSAPrivateKey(key *DSAPrivateKey, w *bufio.Writer) {
 func exportParameter(name string, val *big.Int, w *bufio.Writer) {
 	indent := "        "
 	w.WriteString(indent)
-	w.WriteString(fmt.Sprintf("(%s #%X#)\n", name, val))
+	w.WriteString(fmt.Sprintf("(%s #%X#)\n", name, libgcryptMPI(val)))
+}
+
+// libgcrypt reads hex values in S-expressions as signed numbers,
+// so a zero byte has to be prepended if the high bit is set
+func libgcryptMPI(val *big.Int) []byte {
+	b := val.Bytes()
+	if len(b) == 0 || b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return b
 }
 
 func exportAccount(a *Account, w *bufio.Writer) {
@@ -562,12 +573,12 @@ func exportAccount(a *Account, w *bufio.Writer) {
 	w.WriteString(")\n")
 }
 
-func exportAccounts(as []*Account, w io.Writer) {
+func exportAccounts(as []*Account, w io.Writer) error {
 	bw := bufio.NewWriter(w)
 	bw.WriteString("(privkeys\n")
 	for _, a := range as {
 		exportAccount(a, bw)
 	}
 	bw.WriteString(")\n")
-	bw.Flush()
+	return bw.Flush()
 }
@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"bytes"
 	"crypto/rand"
+	"math/big"
 	"os"
 	"syscall"
 	"testing"
@@ -1044,10 +1045,10 @@ func Test_exportAccounts_exportsAccounts(t *testing.T) {
     (protocol go-xmpp)
     (private-key
       (dsa
-        (p #F24843F9447B62138AE49BF83188D1353ADA5CAC118890CFDEC01BF349D75E887B19C221665C7857CAD583AF656C67FB04A99FD8F8D69D09C9529C6C14D426F1E3924DC9243AF2970E3E4B04A23489A09E8A90E7E81EBA763AD4F0636B8A43415B6FC16A02C3624CE76272FA00783C8DB850D3A996B58136F7A0EB80AE0BC613#)
-        (q #D16B2607FCBC0EDC639F763A54F34475B1CC8473#)
-        (g #B15AFEF5F96EFEE41006F136C23A18849DA8133069A879D083F7C7AA362E187DAE3ED0C4F372D0D4E3AAE567008A1872A6E85D8F84E53A3FE1B352AF0B4E2F0CB033A6D34285ECD3E4A93653BDE99C3A8D840D9D35F82AC2FA8539DB6C7F7A1DAD77FEECD62803757FF1E2DE4CEC4A5A2AD643271514DDEEEF3D008F66FBF9DB#)
-        (y #1F9BE7DA0E4E84774048058B53202B2704BF688A306092ED533A55E68EABA814C8D62F45AAD8FF30C3055DCA461B7DBA6B78938FC4D69780A830C6457CC107F3D275C21D00E53147C14162176C77169D3BCA586DC30F15F4B482160E276869AA336F38AF7FC3686A764AB5A02C751D921A42B8B9AE8E06918059CD73C424154#)
+        (p #00F24843F9447B62138AE49BF83188D1353ADA5CAC118890CFDEC01BF349D75E887B19C221665C7857CAD583AF656C67FB04A99FD8F8D69D09C9529C6C14D426F1E3924DC9243AF2970E3E4B04A23489A09E8A90E7E81EBA763AD4F0636B8A43415B6FC16A02C3624CE76272FA00783C8DB850D3A996B58136F7A0EB80AE0BC613#)
+        (q #00D16B2607FCBC0EDC639F763A54F34475B1CC8473#)
+        (g #00B15AFEF5F96EFEE41006F136C23A18849DA8133069A879D083F7C7AA362E187DAE3ED0C4F372D0D4E3AAE567008A1872A6E85D8F84E53A3FE1B352AF0B4E2F0CB033A6D34285ECD3E4A93653BDE99C3A8D840D9D35F82AC2FA8539DB6C7F7A1DAD77FEECD62803757FF1E2DE4CEC4A5A2AD643271514DDEEEF3D008F66FBF9DB#)
+        (y #01F9BE7DA0E4E84774048058B53202B2704BF688A306092ED533A55E68EABA814C8D62F45AAD8FF30C3055DCA461B7DBA6B78938FC4D69780A830C6457CC107F3D275C21D00E53147C14162176C77169D3BCA586DC30F15F4B482160E276869AA336F38AF7FC3686A764AB5A02C751D921A42B8B9AE8E06918059CD73C424154#)
         (x #14D0345A3562C480A039E3C72764F72D79043216#)
       )
     )
@@ -1080,3 +1081,48 @@ func Test_ExportKeysToFile_returnsAnErrorIfSomethingGoesWrong(t *testing.T) {
 	err := ExportKeysToFile([]*Account{acc}, "non_existing_directory/test_export_of_keys.blah")
 	assertDeepEquals(t, err.Error(), "open non_existing_directory/test_export_of_keys.blah: no such file or directory")
 }
+
+func Test_ExportKeysToFile_createsAFileOnlyReadableByTheUser(t *testing.T) {
+	priv := &DSAPrivateKey{}
+	priv.Parse(serializedPrivateKey)
+	acc := &Account{Name: "hello", Protocol: "go-xmpp", Key: priv}
+
+	err := ExportKeysToFile([]*Account{acc}, "test_resources/test_export_of_keys.blah")
+	defer os.Remove("test_resources/test_export_of_keys.blah")
+	assertNil(t, err)
+
+	info, _ := os.Stat("test_resources/test_export_of_keys.blah")
+	assertEquals(t, info.Mode().Perm(), os.FileMode(0600))
+}
+
+func Test_exportAccounts_writesTheSameKeyDataAsLibotr(t *testing.T) {
+	const libOTRPrivateKey = `(privkeys
+  (account
+    (name "foo@example.com")
+    (protocol prpl-jabber)
+    (private-key
+      (dsa
+        (p #00FC07ABCF0DC916AFF6E9AE47BEF60C7AB9B4D6B2469E436630E36F8A489BE812486A09F30B71224508654940A835301ACC525A4FF133FC152CC53DCC59D65C30A54F1993FE13FE63E5823D4C746DB21B90F9B9C00B49EC7404AB1D929BA7FBA12F2E45C6E0A651689750E8528AB8C031D3561FECEE72EBB4A090D450A9B7A857#)
+        (q #00997BD266EF7B1F60A5C23F3A741F2AEFD07A2081#)
+        (g #535E360E8A95EBA46A4F7DE50AD6E9B2A6DB785A66B64EB9F20338D2A3E8FB0E94725848F1AA6CC567CB83A1CC517EC806F2E92EAE71457E80B2210A189B91250779434B41FC8A8873F6DB94BEA7D177F5D59E7E114EE10A49CFD9CEF88AE43387023B672927BA74B04EB6BBB5E57597766A2F9CE3857D7ACE3E1E3BC1FC6F26#)
+        (y #0AC8670AD767D7A8D9D14CC1AC6744CD7D76F993B77FFD9E39DF01E5A6536EF65E775FCEF2A983E2A19BD6415500F6979715D9FD1257E1FE2B6F5E1E74B333079E7C880D39868462A93454B41877BE62E5EF0A041C2EE9C9E76BD1E12AE25D9628DECB097025DD625EF49C3258A1A3C0FF501E3DC673B76D7BABF349009B6ECF#)
+        (x #14D0345A3562C480A039E3C72764F72D79043216#)
+      )
+    )
+  )
+)
+`
+	acs, err := ImportKeys(bytes.NewBufferString(libOTRPrivateKey))
+	assertNil(t, err)
+
+	bt := bytes.NewBuffer(make([]byte, 0, 200))
+	exportAccounts(acs, bt)
+
+	assertEquals(t, bt.String(), libOTRPrivateKey)
+}
+
+func Test_libgcryptMPI_prependsAZeroByteWhenTheHighBitIsSet(t *testing.T) {
+	assertDeepEquals(t, libgcryptMPI(big.NewInt(0x7F)), []byte{0x7F})
+	assertDeepEquals(t, libgcryptMPI(big.NewInt(0x80)), []byte{0x00, 0x80})
+	assertDeepEquals(t, libgcryptMPI(big.NewInt(0)), []byte{0x00})
+}
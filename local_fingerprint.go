@@ -0,0 +1,39 @@
+package otr3
+
+import "crypto/sha256"
+
+// localFingerprintLabel is put in front of formatted local fingerprints, so they can't be mistaken for
+// the fingerprints other OTR clients show
+const localFingerprintLabel = "SHA256 (local): "
+
+// LocalFingerprint returns a SHA-256 digest of the same public key data that PublicKey.Fingerprint hashes with SHA-1.
+// It is never sent to the peer, and other OTR clients don't know it - it is only meant to be shown to users and to pin keys
+// in applications that don't want to rely on SHA-1. Comparing it with a peer only works if the peer uses this package too.
+func LocalFingerprint(pub PublicKey) []byte {
+	b := pub.serialize()
+	if b == nil {
+		return nil
+	}
+
+	h := sha256.Sum256(b[2:]) // the key type is ignored, like for the fingerprint in the specification
+	return h[:]
+}
+
+// FingerprintDisplay decides which fingerprint of a key is shown to users
+type FingerprintDisplay int
+
+const (
+	// DisplaySpecFingerprint shows the SHA-1 fingerprint from the specification, which all OTR clients show
+	DisplaySpecFingerprint FingerprintDisplay = iota
+	// DisplayLocalFingerprint shows the SHA-256 fingerprint returned by LocalFingerprint, labeled as a local identifier
+	DisplayLocalFingerprint
+)
+
+// Format returns the fingerprint of the key to show to users. The local fingerprint is rendered like FormatFingerprint,
+// but starts with "SHA256 (local): "
+func (d FingerprintDisplay) Format(pub PublicKey) string {
+	if d == DisplayLocalFingerprint {
+		return localFingerprintLabel + FormatFingerprint(LocalFingerprint(pub))
+	}
+	return FormatFingerprint(pub.Fingerprint())
+}
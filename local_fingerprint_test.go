@@ -0,0 +1,39 @@
+package otr3
+
+import (
+	"crypto/sha256"
+	"strings"
+	"testing"
+)
+
+func Test_LocalFingerprint_isTheSHA256OfTheKeyDataThatIsFingerprinted(t *testing.T) {
+	pub := alicePrivateKey.PublicKey()
+	expected := sha256.Sum256(pub.serialize()[2:])
+
+	assertDeepEquals(t, LocalFingerprint(pub), expected[:])
+}
+
+func Test_LocalFingerprint_isDifferentForDifferentKeys(t *testing.T) {
+	assertFalse(t, string(LocalFingerprint(alicePrivateKey.PublicKey())) == string(LocalFingerprint(bobPrivateKey.PublicKey())))
+}
+
+func Test_LocalFingerprint_returnsNilForAnIncompleteKey(t *testing.T) {
+	assertNil(t, LocalFingerprint(&DSAPublicKey{}))
+}
+
+func Test_FingerprintDisplay_showsTheFingerprintOfTheSpecificationByDefault(t *testing.T) {
+	pub := alicePrivateKey.PublicKey()
+	var d FingerprintDisplay
+
+	assertEquals(t, d.Format(pub), FormatFingerprint(pub.Fingerprint()))
+}
+
+func Test_FingerprintDisplay_labelsTheLocalFingerprint(t *testing.T) {
+	pub := alicePrivateKey.PublicKey()
+
+	formatted := DisplayLocalFingerprint.Format(pub)
+
+	assertTrue(t, strings.HasPrefix(formatted, "SHA256 (local): "))
+	assertEquals(t, strings.TrimPrefix(formatted, "SHA256 (local): "), FormatFingerprint(LocalFingerprint(pub)))
+	assertEquals(t, len(formatted), len("SHA256 (local): ")+71)
+}
@@ -0,0 +1,475 @@
+package otr3
+
+import (
+	"bytes"
+	"sort"
+	"time"
+
+	"github.com/coyim/gotrax"
+)
+
+// These meta instance tags can be used to address a conversation of a Manager
+// without knowing the instance tag of the peer. They correspond to the
+// OTRL_INSTAG_* values of libotr.
+const (
+	// InstanceMaster addresses the master conversation
+	InstanceMaster uint32 = iota
+	// InstanceBest addresses the most recently active instance we have a secure conversation with
+	// or, if there is no such instance, the most recently active one
+	InstanceBest
+	// InstanceRecent addresses the instance we most recently sent a message to or received a message from
+	InstanceRecent
+	// InstanceRecentReceived addresses the instance we most recently received a message from
+	InstanceRecentReceived
+	// InstanceRecentSent addresses the instance we most recently sent a message to
+	InstanceRecentSent
+)
+
+// Manager keeps track of the conversations with all the instances of one peer.
+// An OTRv3 peer can be logged in from several clients at the same time, and
+// every one of those clients - identified by its own instance tag - needs a
+// conversation of its own. The master conversation is used to talk to the peer
+// before we know about any of its instances.
+type Manager struct {
+	master    *Conversation
+	instances map[uint32]*Conversation
+
+	policyProvider PolicyProvider
+	account        string
+	protocol       string
+	contact        string
+}
+
+// NewManager returns a manager that uses the given conversation as master.
+// Every conversation the manager creates for an instance of the peer inherits
+// the keys, policies, handlers and other settings of the master conversation.
+func NewManager(master *Conversation) *Manager {
+	return &Manager{
+		master:    master,
+		instances: make(map[uint32]*Conversation),
+	}
+}
+
+// Master returns the master conversation of this manager
+func (m *Manager) Master() *Conversation {
+	return m.master
+}
+
+// Instance returns the conversation with the instance of the peer that has the given instance tag,
+// or nil if we don't know about that instance
+func (m *Manager) Instance(tag uint32) *Conversation {
+	return m.instances[tag]
+}
+
+// Instances returns the instance tags of all the instances of the peer we currently have a conversation with
+func (m *Manager) Instances() []uint32 {
+	tags := make([]uint32, 0, len(m.instances))
+	for tag := range m.instances {
+		tags = append(tags, tag)
+	}
+	sort.Sort(instanceTags(tags))
+
+	return tags
+}
+
+type instanceTags []uint32
+
+func (t instanceTags) Len() int           { return len(t) }
+func (t instanceTags) Less(i, j int) bool { return t[i] < t[j] }
+func (t instanceTags) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+
+// SetPolicyProvider makes the manager ask the provider for the policies of every conversation it creates,
+// instead of copying the policies of the master conversation. The policies of the master conversation
+// are replaced with the ones the provider gives right away. The account, protocol and contact
+// identify this peer to the provider.
+func (m *Manager) SetPolicyProvider(provider PolicyProvider, account, protocol, contact string) {
+	m.policyProvider = provider
+	m.account = account
+	m.protocol = protocol
+	m.contact = contact
+
+	m.master.Policies = m.policiesForNewConversation()
+}
+
+func (m *Manager) policiesForNewConversation() Policies {
+	if m.policyProvider == nil {
+		return m.master.Policies
+	}
+
+	return policiesFrom(m.policyProvider, m.account, m.protocol, m.contact)
+}
+
+// SetAdvertisement sets how the conversations with this peer let it know that we support OTR.
+// It applies to the master conversation, all instances we know about and all instances we will learn about.
+// Since the setting belongs to the peer, it can be persisted using the text representation of the Advertisement.
+func (m *Manager) SetAdvertisement(a Advertisement) {
+	m.master.SetAdvertisement(a)
+	for _, c := range m.instances {
+		c.SetAdvertisement(a)
+	}
+}
+
+// Advertisement returns how the conversations with this peer let it know that we support OTR
+func (m *Manager) Advertisement() Advertisement {
+	return m.master.GetAdvertisement()
+}
+
+// SetFriendlyQueryMessage sets the human readable text that follows the query messages sent to this peer.
+// It applies to the master conversation, all instances we know about and all instances we will learn about.
+func (m *Manager) SetFriendlyQueryMessage(msg string) {
+	m.master.SetFriendlyQueryMessage(msg)
+	for _, c := range m.instances {
+		c.SetFriendlyQueryMessage(msg)
+	}
+}
+
+// ExpectTheirKey registers a public key we expect the peer to use in the master conversation,
+// all instances we know about and all instances we will learn about
+func (m *Manager) ExpectTheirKey(key PublicKey) {
+	m.ExpectTheirFingerprint(key.Fingerprint())
+}
+
+// ExpectTheirFingerprint works like ExpectTheirKey, for when only the fingerprint of the expected key is known
+func (m *Manager) ExpectTheirFingerprint(fingerprint []byte) {
+	m.master.ExpectTheirFingerprint(fingerprint)
+	for _, c := range m.instances {
+		c.ExpectTheirFingerprint(fingerprint)
+	}
+}
+
+// instance returns the conversation with the given instance of the peer, creating it if necessary
+func (m *Manager) instance(tag uint32) (*Conversation, error) {
+	if c, ok := m.instances[tag]; ok {
+		return c, nil
+	}
+
+	// All instance conversations have to use the same instance tag for us
+	if err := m.master.generateInstanceTag(); err != nil {
+		return nil, err
+	}
+
+	c := m.newInstanceConversation(tag)
+	m.instances[tag] = c
+
+	return c, nil
+}
+
+func (m *Manager) newInstanceConversation(tag uint32) *Conversation {
+	master := m.master
+
+	c := &Conversation{
+		conversationSettings: master.conversationSettings,
+
+		Rand:     master.Rand,
+		Policies: m.policiesForNewConversation(),
+
+		ourInstanceTag:   master.ourInstanceTag,
+		theirInstanceTag: tag,
+
+		verification: verificationContext{lifetime: master.verification.lifetime},
+	}
+	c.expectedFingerprints = append([][]byte(nil), master.expectedFingerprints...)
+	c.deliveries.lastID = master.deliveries.sharedLastID()
+	c.resend.messageTransform = master.resend.messageTransform
+
+	return c
+}
+
+// Receive handles a message from the peer by passing it to the conversation with the instance that sent it.
+// The conversation with an instance is created the first time we receive a message from it.
+// Messages that don't identify the instance that sent them - plaintext, query, error and OTRv2 messages -
+// are handled by the master conversation.
+func (m *Manager) Receive(msg ValidMessage) (plain MessagePlaintext, toSend []ValidMessage, err error) {
+	tag, ok := senderInstanceTagOf(msg)
+	if !ok {
+		return m.master.Receive(msg)
+	}
+
+	_, existing := m.instances[tag]
+	c, err := m.instance(tag)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !existing {
+		m.handOver(c, guessMessageType(msg))
+	}
+
+	return c.Receive(msg)
+}
+
+// handOver gives the first instance to start or answer an AKE the messages the master conversation
+// has been waiting to send until the conversation is secure. If the instance answers an AKE the master
+// conversation started, it also takes over that AKE. Since we can't know which instance of the peer
+// will answer before we know about any of them, only the first instance to do so gets these.
+func (m *Manager) handOver(c *Conversation, msgType messageTypeGuess) {
+	master := m.master
+
+	switch msgType {
+	case msgGuessDHCommit:
+	case msgGuessDHKey:
+		if master.ake != nil {
+			if _, ok := master.ake.state.(authStateAwaitingDHKey); ok {
+				c.version = master.version
+				c.ourCurrentKey = master.ourCurrentKey
+				c.recordTransition(authStateMachine, c.authState(), master.ake.state, "hand over to instance")
+				c.ake = master.ake
+				c.akeProgress = master.akeProgress
+				master.recordTransition(authStateMachine, master.ake.state, authStateNone{}, "hand over to instance")
+				master.ake = nil
+			}
+		}
+	default:
+		return
+	}
+
+	for _, msg := range master.resend.pending() {
+		c.resend.add(msg)
+	}
+	c.resend.mayRetransmit = master.resend.mayRetransmit
+	c.heartbeat.lastSent = master.heartbeat.lastSent
+	master.resend.clear()
+}
+
+// senderInstanceTagOf returns the sender instance tag of an OTRv3 message or fragment.
+// It returns false for messages that don't carry a valid sender instance tag.
+func senderInstanceTagOf(msg ValidMessage) (uint32, bool) {
+	var tag uint32
+
+	switch guessMessageType(msg) {
+	case msgGuessFragment:
+		if !bytes.HasPrefix(msg, otrv3FragmentationPrefix) {
+			return 0, false
+		}
+
+		itags := bytes.SplitN(msg[len(otrv3FragmentationPrefix):], fragmentItagsSeparator, 2)
+		if len(itags) != 2 {
+			return 0, false
+		}
+
+		t, err := parseItag(itags[0])
+		if err != nil {
+			return 0, false
+		}
+		tag = t
+	case msgGuessDHCommit, msgGuessDHKey, msgGuessRevealSig, msgGuessSignature, msgGuessData:
+		// The first 16 base64 characters are enough to decode the whole header
+		encodedHeaderLen := 16
+		if len(msg) < len(msgMarker)+encodedHeaderLen {
+			return 0, false
+		}
+
+		header, err := b64decode(msg[len(msgMarker) : len(msgMarker)+encodedHeaderLen])
+		if err != nil || len(header) < otrv3HeaderLen {
+			return 0, false
+		}
+
+		_, version, _ := gotrax.ExtractShort(header)
+		if version != 3 {
+			return 0, false
+		}
+
+		_, tag, _ = gotrax.ExtractWord(header[messageHeaderPrefix:])
+	default:
+		return 0, false
+	}
+
+	return tag, tag >= minValidInstanceTag
+}
+
+// PeerOffline tells the manager that the instance of the peer with the given instance tag
+// has gone away - for example because the IM server told us the corresponding resource went offline.
+// The conversation with that instance is ended without notifying the peer, and all its keys are wiped.
+// Messages that were waiting to be sent to that instance are sent to the remaining secure instance
+// that most recently went secure instead, or to the master conversation if there is no such instance.
+// The messages that should be sent to the peer as a result are returned.
+func (m *Manager) PeerOffline(tag uint32) ([]ValidMessage, error) {
+	c, ok := m.instances[tag]
+	if !ok {
+		return nil, nil
+	}
+	delete(m.instances, tag)
+
+	var waiting []messageToResend
+	if c.resend.shouldRetransmit() {
+		waiting = c.resend.pending()
+	}
+
+	c.expire()
+
+	if len(waiting) == 0 {
+		return nil, nil
+	}
+
+	target := m.mostRecentlySecureInstance()
+	if target == nil {
+		target = m.master
+	}
+
+	var toSend []ValidMessage
+	for _, msg := range waiting {
+		res, err := target.Send(ValidMessage(msg.m), msg.opaque...)
+		if err != nil {
+			return toSend, err
+		}
+		toSend = append(toSend, res...)
+
+		if target.IsEncrypted() {
+			target.messageEvent(MessageEventMessageSent, msg.opaque...)
+		}
+	}
+
+	return toSend, nil
+}
+
+// Send sends the message to the conversation addressed by the given instance tag.
+// The tag can either be the instance tag of one of the instances of the peer or one of the meta instance tags,
+// like InstanceBest. Meta instance tags address the master conversation if we don't know about any instances yet.
+func (m *Manager) Send(tag uint32, msg ValidMessage, trace ...interface{}) ([]ValidMessage, error) {
+	c, err := m.conversationFor(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Send(msg, trace...)
+}
+
+func (m *Manager) conversationFor(tag uint32) (*Conversation, error) {
+	switch tag {
+	case InstanceMaster:
+		return m.master, nil
+	case InstanceBest:
+		return m.best(), nil
+	case InstanceRecent:
+		return m.mostRecent(func(c *Conversation) time.Time { return c.lastActive() }), nil
+	case InstanceRecentReceived:
+		return m.mostRecent(func(c *Conversation) time.Time { return c.heartbeat.lastReceived }), nil
+	case InstanceRecentSent:
+		return m.mostRecent(func(c *Conversation) time.Time { return c.heartbeat.lastSent }), nil
+	}
+
+	c, ok := m.instances[tag]
+	if !ok {
+		return nil, errUnknownInstance
+	}
+
+	return c, nil
+}
+
+// SendToAllSecure sends the message to every instance of the peer we have a secure conversation with.
+// If there is no such instance, nothing is sent and an error is returned, so the message is never sent in plaintext.
+func (m *Manager) SendToAllSecure(msg ValidMessage, trace ...interface{}) ([]ValidMessage, error) {
+	var toSend []ValidMessage
+	sent := false
+	for _, tag := range m.Instances() {
+		c := m.instances[tag]
+		if !c.IsEncrypted() {
+			continue
+		}
+
+		res, err := c.Send(msg, trace...)
+		if err != nil {
+			return toSend, err
+		}
+		toSend = append(toSend, res...)
+		sent = true
+	}
+
+	if !sent {
+		return nil, errNoSecureInstance
+	}
+
+	return toSend, nil
+}
+
+// MarkDelivered tells the conversation that gave the messages with the id to the sender that they have arrived
+func (m *Manager) MarkDelivered(id uint64) error {
+	return m.deliveredBy(id).MarkDelivered(id)
+}
+
+// MarkFailed tells the conversation that gave the messages with the id to the sender that they could not be delivered
+func (m *Manager) MarkFailed(id uint64) error {
+	return m.deliveredBy(id).MarkFailed(id)
+}
+
+// deliveredBy returns the conversation waiting for the outcome of the delivery with the id,
+// or the master conversation if none is
+func (m *Manager) deliveredBy(id uint64) *Conversation {
+	for _, c := range m.instances {
+		if _, ok := c.deliveries.pending[id]; ok {
+			return c
+		}
+	}
+	return m.master
+}
+
+func (m *Manager) best() *Conversation {
+	var ret *Conversation
+	for _, tag := range m.Instances() {
+		c := m.instances[tag]
+		if ret == nil || isBetterInstance(c, ret) {
+			ret = c
+		}
+	}
+
+	if ret == nil {
+		return m.master
+	}
+
+	return ret
+}
+
+func isBetterInstance(c, than *Conversation) bool {
+	if c.IsEncrypted() != than.IsEncrypted() {
+		return c.IsEncrypted()
+	}
+
+	return c.lastActive().After(than.lastActive())
+}
+
+func (m *Manager) mostRecent(when func(*Conversation) time.Time) *Conversation {
+	var ret *Conversation
+	for _, tag := range m.Instances() {
+		c := m.instances[tag]
+		if ret == nil || when(c).After(when(ret)) {
+			ret = c
+		}
+	}
+
+	if ret == nil {
+		return m.master
+	}
+
+	return ret
+}
+
+func (m *Manager) mostRecentlySecureInstance() *Conversation {
+	var ret *Conversation
+	for _, c := range m.instances {
+		if c.IsEncrypted() && (ret == nil || c.lastMessageStateChange.After(ret.lastMessageStateChange)) {
+			ret = c
+		}
+	}
+
+	return ret
+}
+
+// expire forgets everything about the conversation without generating any messages for the peer,
+// since the peer is not around to receive them anymore
+func (c *Conversation) expire() {
+	previousMsgState := c.msgState
+
+	c.wipeSMP("peer offline")
+	c.dropAKE("peer offline")
+	c.keys.wipe()
+	c.wipePreviousKeys()
+	c.resend.clear()
+	c.deliveries.wipe()
+	c.dropFragments()
+
+	c.setMsgState(plainText, "peer offline")
+	c.lastMessageStateChange = time.Time{}
+	c.sessionEnded(previousMsgState, EndedByPeerOffline)
+
+	c.signalSecurityEventIf(previousMsgState == encrypted, GoneInsecure)
+}
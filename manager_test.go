@@ -0,0 +1,648 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+)
+
+func Test_NewManager_usesTheGivenConversationAsMaster(t *testing.T) {
+	master := &Conversation{}
+	m := NewManager(master)
+
+	assertEquals(t, m.Master(), master)
+	assertDeepEquals(t, m.Instances(), []uint32{})
+}
+
+func Test_Manager_Instance_returnsNilForAnUnknownInstance(t *testing.T) {
+	m := NewManager(&Conversation{})
+
+	assertNil(t, m.Instance(0x1234))
+}
+
+func Test_Manager_instance_createsAConversationInheritingTheSettingsOfTheMaster(t *testing.T) {
+	master := &Conversation{Rand: rand.Reader}
+	master.Policies = Policies(PolicyAllowV3 | PolicyRequireEncryption)
+	master.SetOurKeys([]PrivateKey{alicePrivateKey})
+	master.SetFragmentSize(400)
+	master.SetFriendlyQueryMessage("let's talk privately")
+	m := NewManager(master)
+
+	c, err := m.instance(0x1234)
+
+	assertNil(t, err)
+	assertEquals(t, m.Instance(0x1234), c)
+	assertEquals(t, c.theirInstanceTag, uint32(0x1234))
+	assertEquals(t, c.Rand, master.Rand)
+	assertEquals(t, c.Policies, master.Policies)
+	assertDeepEquals(t, c.GetOurKeys(), master.GetOurKeys())
+	assertEquals(t, c.fragmentSize, uint16(400))
+	assertEquals(t, c.friendlyQueryMessage, "let's talk privately")
+}
+
+func Test_Manager_instance_usesTheSameInstanceTagForUsInAllConversations(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader})
+
+	c1, _ := m.instance(0x1234)
+	c2, _ := m.instance(0x5678)
+
+	assertTrue(t, c1.ourInstanceTag >= minValidInstanceTag)
+	assertEquals(t, c1.ourInstanceTag, m.Master().ourInstanceTag)
+	assertEquals(t, c2.ourInstanceTag, m.Master().ourInstanceTag)
+}
+
+func Test_Manager_instance_returnsTheExistingConversation(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader})
+
+	c1, _ := m.instance(0x1234)
+	c2, _ := m.instance(0x1234)
+
+	assertEquals(t, c1, c2)
+}
+
+func Test_Manager_instance_returnsErrorIfOurInstanceTagCantBeGenerated(t *testing.T) {
+	m := NewManager(&Conversation{Rand: fixedRand([]string{"ABCD"})})
+
+	_, err := m.instance(0x1234)
+
+	assertEquals(t, err, errShortRandomRead)
+	assertNil(t, m.Instance(0x1234))
+}
+
+func Test_Manager_Instances_returnsTheSortedInstanceTags(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader})
+
+	m.instance(0x5678)
+	m.instance(0x1234)
+
+	assertDeepEquals(t, m.Instances(), []uint32{0x1234, 0x5678})
+}
+
+func Test_Manager_PeerOffline_doesNothingForAnUnknownInstance(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader})
+
+	toSend, err := m.PeerOffline(0x1234)
+
+	assertNil(t, toSend)
+	assertNil(t, err)
+}
+
+func Test_Manager_PeerOffline_forgetsTheInstanceAndWipesItsKeys(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader})
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	m.instances[0x1234] = c
+
+	var toSend []ValidMessage
+	c.expectSecurityEvent(t, func() {
+		toSend, _ = m.PeerOffline(0x1234)
+	}, GoneInsecure)
+
+	assertNil(t, toSend)
+	assertNil(t, m.Instance(0x1234))
+	assertFalse(t, c.IsEncrypted())
+	assertEquals(t, c.keys.ourKeyID, uint32(0))
+	assertNil(t, c.keys.ourCurrentDHKeys.pub)
+	assertNil(t, c.keys.theirCurrentDHPubKey)
+}
+
+func Test_Manager_PeerOffline_sendsWaitingMessagesToTheRemainingSecureInstance(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader})
+
+	offline := newConversation(otrV3{}, rand.Reader)
+	offline.Policies.Add(PolicyRequireEncryption)
+	offline.Send(ValidMessage("hello"))
+	m.instances[0x1234] = offline
+
+	remaining := bobContextAfterAKE()
+	remaining.msgState = encrypted
+	m.instances[0x5678] = remaining
+
+	var toSend []ValidMessage
+	var err error
+	remaining.expectMessageEvent(t, func() {
+		toSend, err = m.PeerOffline(0x1234)
+	}, MessageEventMessageSent, nil, nil)
+
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 1)
+	assertEquals(t, guessMessageType(toSend[0]), msgGuessData)
+	assertEquals(t, len(offline.resend.pending()), 0)
+}
+
+func Test_Manager_PeerOffline_prefersTheInstanceThatMostRecentlyWentSecure(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader})
+
+	offline := newConversation(otrV3{}, rand.Reader)
+	offline.Policies.Add(PolicyRequireEncryption)
+	offline.Send(ValidMessage("hello"))
+	m.instances[0x1234] = offline
+
+	older := bobContextAfterAKE()
+	older.msgState = encrypted
+	older.lastMessageStateChange = time.Now().Add(-time.Hour)
+	m.instances[0x5678] = older
+
+	newer := bobContextAfterAKE()
+	newer.msgState = encrypted
+	newer.lastMessageStateChange = time.Now()
+	m.instances[0x9ABC] = newer
+
+	newer.expectMessageEvent(t, func() {
+		older.doesntExpectMessageEvent(t, func() {
+			m.PeerOffline(0x1234)
+		})
+	}, MessageEventMessageSent, nil, nil)
+}
+
+func Test_Manager_PeerOffline_sendsWaitingMessagesToTheMasterIfThereIsNoSecureInstance(t *testing.T) {
+	master := newConversation(otrV3{}, rand.Reader)
+	master.Policies.Add(PolicyRequireEncryption)
+	m := NewManager(master)
+
+	offline := newConversation(otrV3{}, rand.Reader)
+	offline.Policies.Add(PolicyRequireEncryption)
+	offline.Send(ValidMessage("hello"))
+	m.instances[0x1234] = offline
+
+	toSend, err := m.PeerOffline(0x1234)
+
+	assertNil(t, err)
+	assertDeepEquals(t, toSend, []ValidMessage{master.QueryMessage()})
+	assertDeepEquals(t, master.resend.pending()[0].m, MessagePlaintext("hello"))
+}
+
+func Test_Manager_Send_usesTheMasterForInstanceBestIfThereAreNoInstances(t *testing.T) {
+	master := newConversation(otrV3{}, rand.Reader)
+	m := NewManager(master)
+
+	toSend, err := m.Send(InstanceBest, ValidMessage("hello"))
+
+	assertNil(t, err)
+	assertDeepEquals(t, toSend, []ValidMessage{ValidMessage("hello")})
+}
+
+func Test_Manager_Send_prefersASecureInstanceForInstanceBest(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader})
+
+	insecure := newConversation(otrV3{}, rand.Reader)
+	insecure.updateLastSent()
+	m.instances[0x1234] = insecure
+
+	secure := bobContextAfterAKE()
+	secure.msgState = encrypted
+	secure.heartbeat.lastSent = time.Now().Add(-time.Hour)
+	m.instances[0x5678] = secure
+
+	toSend, _ := m.Send(InstanceBest, ValidMessage("hello"))
+
+	assertEquals(t, guessMessageType(toSend[0]), msgGuessData)
+}
+
+func Test_Manager_best_prefersTheMostRecentlyActiveInstance(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader})
+
+	older := newConversation(otrV3{}, rand.Reader)
+	older.heartbeat.lastSent = time.Now().Add(-time.Hour)
+	m.instances[0x1234] = older
+
+	newer := newConversation(otrV3{}, rand.Reader)
+	newer.heartbeat.lastSent = time.Now()
+	m.instances[0x5678] = newer
+
+	assertEquals(t, m.best(), newer)
+}
+
+func Test_Manager_SendToAllSecure_sendsTheMessageToEverySecureInstance(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader})
+
+	first := bobContextAfterAKE()
+	first.msgState = encrypted
+	m.instances[0x1234] = first
+
+	second := bobContextAfterAKE()
+	second.msgState = encrypted
+	m.instances[0x5678] = second
+
+	m.instances[0x9ABC] = newConversation(otrV3{}, rand.Reader)
+
+	toSend, err := m.SendToAllSecure(ValidMessage("hello"))
+
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 2)
+	assertEquals(t, guessMessageType(toSend[0]), msgGuessData)
+	assertEquals(t, guessMessageType(toSend[1]), msgGuessData)
+}
+
+func Test_Manager_SendToAllSecure_sendsNothingIfNoInstanceIsSecure(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader})
+	m.instances[0x1234] = newConversation(otrV3{}, rand.Reader)
+
+	toSend, err := m.SendToAllSecure(ValidMessage("hello"))
+
+	assertEquals(t, err, errNoSecureInstance)
+	assertNil(t, toSend)
+}
+
+func Test_Manager_Send_sendsUsingTheMasterForInstanceMaster(t *testing.T) {
+	master := newConversation(otrV3{}, rand.Reader)
+	m := NewManager(master)
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	m.instances[0x1234] = c
+
+	toSend, err := m.Send(InstanceMaster, ValidMessage("hello"))
+
+	assertNil(t, err)
+	assertDeepEquals(t, toSend, []ValidMessage{ValidMessage("hello")})
+}
+
+func Test_Manager_Send_sendsToTheGivenInstance(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader})
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	m.instances[0x1234] = c
+
+	toSend, err := m.Send(0x1234, ValidMessage("hello"))
+
+	assertNil(t, err)
+	assertEquals(t, guessMessageType(toSend[0]), msgGuessData)
+}
+
+func Test_Manager_Send_returnsErrorForAnUnknownInstance(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader})
+
+	_, err := m.Send(0x1234, ValidMessage("hello"))
+
+	assertEquals(t, err, errUnknownInstance)
+}
+
+func Test_Manager_conversationFor_resolvesTheMetaInstanceTags(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader})
+
+	secure := bobContextAfterAKE()
+	secure.msgState = encrypted
+	secure.heartbeat.lastSent = time.Now().Add(-3 * time.Hour)
+	secure.heartbeat.lastReceived = time.Now().Add(-3 * time.Hour)
+	m.instances[0x1234] = secure
+
+	sentTo := newConversation(otrV3{}, rand.Reader)
+	sentTo.heartbeat.lastSent = time.Now().Add(-time.Hour)
+	m.instances[0x5678] = sentTo
+
+	receivedFrom := newConversation(otrV3{}, rand.Reader)
+	receivedFrom.heartbeat.lastReceived = time.Now().Add(-2 * time.Hour)
+	m.instances[0x9ABC] = receivedFrom
+
+	c, _ := m.conversationFor(InstanceMaster)
+	assertEquals(t, c, m.Master())
+
+	c, _ = m.conversationFor(InstanceBest)
+	assertEquals(t, c, secure)
+
+	c, _ = m.conversationFor(InstanceRecent)
+	assertEquals(t, c, sentTo)
+
+	c, _ = m.conversationFor(InstanceRecentReceived)
+	assertEquals(t, c, receivedFrom)
+
+	c, _ = m.conversationFor(InstanceRecentSent)
+	assertEquals(t, c, sentTo)
+}
+
+func Test_Manager_conversationFor_usesTheMasterForMetaInstanceTagsWithoutInstances(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader})
+
+	for _, tag := range []uint32{InstanceBest, InstanceRecent, InstanceRecentReceived, InstanceRecentSent} {
+		c, err := m.conversationFor(tag)
+		assertNil(t, err)
+		assertEquals(t, c, m.Master())
+	}
+}
+
+func managerFor(key PrivateKey) *Manager {
+	c := &Conversation{Rand: rand.Reader}
+	c.Policies = Policies(PolicyAllowV2 | PolicyAllowV3)
+	c.SetOurKeys([]PrivateKey{key})
+	return NewManager(c)
+}
+
+func exchangeBetweenManagers(t *testing.T, from, to *Manager, msgs []ValidMessage) {
+	for len(msgs) > 0 {
+		var next []ValidMessage
+		for _, msg := range msgs {
+			_, toSend, err := to.Receive(msg)
+			assertNil(t, err)
+			next = append(next, toSend...)
+		}
+		msgs = next
+		from, to = to, from
+	}
+}
+
+func Test_Manager_Receive_establishesASecureConversationWithTheInstanceOfThePeer(t *testing.T) {
+	alice := managerFor(alicePrivateKey)
+	bob := managerFor(bobPrivateKey)
+
+	exchangeBetweenManagers(t, alice, bob, []ValidMessage{alice.Master().QueryMessage()})
+
+	aliceTag := alice.Master().ourInstanceTag
+	bobTag := bob.Master().ourInstanceTag
+
+	assertDeepEquals(t, alice.Instances(), []uint32{bobTag})
+	assertDeepEquals(t, bob.Instances(), []uint32{aliceTag})
+	assertTrue(t, alice.Instance(bobTag).IsEncrypted())
+	assertTrue(t, bob.Instance(aliceTag).IsEncrypted())
+	assertFalse(t, alice.Master().IsEncrypted())
+	assertFalse(t, bob.Master().IsEncrypted())
+
+	toSend, _ := alice.Send(InstanceBest, ValidMessage("hello"))
+	plain, _, err := bob.Receive(toSend[0])
+
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+}
+
+func Test_Manager_Receive_keepsSeparateConversationsWithEveryInstanceOfThePeer(t *testing.T) {
+	alice := managerFor(alicePrivateKey)
+	bobAtHome := managerFor(bobPrivateKey)
+	bobAtWork := managerFor(bobPrivateKey)
+
+	exchangeBetweenManagers(t, bobAtHome, alice, []ValidMessage{bobAtHome.Master().QueryMessage()})
+	exchangeBetweenManagers(t, bobAtWork, alice, []ValidMessage{bobAtWork.Master().QueryMessage()})
+
+	homeTag := bobAtHome.Master().ourInstanceTag
+	workTag := bobAtWork.Master().ourInstanceTag
+
+	assertEquals(t, len(alice.Instances()), 2)
+	assertTrue(t, alice.Instance(homeTag).IsEncrypted())
+	assertTrue(t, alice.Instance(workTag).IsEncrypted())
+
+	toSend, _ := bobAtWork.Send(InstanceBest, ValidMessage("from work"))
+	plain, _, err := alice.Receive(toSend[0])
+
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("from work"))
+	assertEquals(t, alice.Instance(workTag).heartbeat.lastReceived.IsZero(), false)
+
+	c, _ := alice.conversationFor(InstanceRecentReceived)
+	assertEquals(t, c, alice.Instance(workTag))
+}
+
+func Test_Manager_Receive_handsMessagesWithoutInstanceTagToTheMaster(t *testing.T) {
+	m := managerFor(alicePrivateKey)
+
+	plain, _, err := m.Receive(ValidMessage("hello"))
+
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+	assertDeepEquals(t, m.Instances(), []uint32{})
+}
+
+func Test_Manager_Receive_sendsTheMessagesWaitingForEncryptionOnceTheInstanceIsSecure(t *testing.T) {
+	alice := managerFor(alicePrivateKey)
+	alice.Master().Policies.Add(PolicyRequireEncryption)
+	bob := managerFor(bobPrivateKey)
+
+	toSend, _ := alice.Send(InstanceBest, ValidMessage("secret"))
+
+	var received []MessagePlaintext
+	from, to := alice, bob
+	for len(toSend) > 0 {
+		var next []ValidMessage
+		for _, msg := range toSend {
+			plain, res, err := to.Receive(msg)
+			assertNil(t, err)
+			if plain != nil {
+				received = append(received, plain)
+			}
+			next = append(next, res...)
+		}
+		toSend = next
+		from, to = to, from
+	}
+
+	assertTrue(t, bob.Instance(alice.Master().ourInstanceTag).IsEncrypted())
+	assertTrue(t, alice.Instance(bob.Master().ourInstanceTag).IsEncrypted())
+	assertDeepEquals(t, received[len(received)-1], MessagePlaintext("secret"))
+}
+
+func Test_senderInstanceTagOf_returnsTheTagOfAV3Fragment(t *testing.T) {
+	tag, ok := senderInstanceTagOf(ValidMessage("?OTR|00000123|00000456,00001,00002,abc,"))
+
+	assertTrue(t, ok)
+	assertEquals(t, tag, uint32(0x123))
+}
+
+func Test_senderInstanceTagOf_returnsTheTagOfAV3Message(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.ourInstanceTag = 0x12345
+	toSend, _ := c.Send(ValidMessage("hello"))
+
+	tag, ok := senderInstanceTagOf(toSend[0])
+
+	assertTrue(t, ok)
+	assertEquals(t, tag, uint32(0x12345))
+}
+
+func Test_senderInstanceTagOf_returnsFalseForMessagesWithoutInstanceTags(t *testing.T) {
+	v2 := bobContextAfterAKE()
+	v2.version = otrV2{}
+	v2.msgState = encrypted
+	v2Msg, _ := v2.Send(ValidMessage("hello"))
+
+	for _, msg := range []ValidMessage{
+		ValidMessage("hello"),
+		ValidMessage("?OTRv3?"),
+		ValidMessage("?OTR Error:bla"),
+		ValidMessage("?OTR,00001,00002,abc,"),
+		ValidMessage("?OTR|00000012|00000456,00001,00002,abc,"),
+		ValidMessage("?OTR|nothex|00000456,00001,00002,abc,"),
+		ValidMessage("?OTR:AAMD"),
+		v2Msg[0],
+	} {
+		_, ok := senderInstanceTagOf(msg)
+		assertFalse(t, ok)
+	}
+}
+
+func Test_Manager_SetAdvertisement_appliesToTheMasterAndAllInstances(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader})
+	c1, _ := m.instance(0x1234)
+
+	m.SetAdvertisement(AdvertiseQuery)
+	c2, _ := m.instance(0x5678)
+
+	assertEquals(t, m.Advertisement(), AdvertiseQuery)
+	assertEquals(t, m.Master().GetAdvertisement(), AdvertiseQuery)
+	assertEquals(t, c1.GetAdvertisement(), AdvertiseQuery)
+	assertEquals(t, c2.GetAdvertisement(), AdvertiseQuery)
+}
+
+func Test_Manager_ExpectTheirKey_appliesToTheMasterAndAllInstances(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader})
+	c1, _ := m.instance(0x1234)
+
+	m.ExpectTheirKey(alicePrivateKey.PublicKey())
+	c2, _ := m.instance(0x5678)
+
+	expected := [][]byte{alicePrivateKey.PublicKey().Fingerprint()}
+	assertDeepEquals(t, m.Master().expectedFingerprints, expected)
+	assertDeepEquals(t, c1.expectedFingerprints, expected)
+	assertDeepEquals(t, c2.expectedFingerprints, expected)
+}
+
+func Test_Manager_newInstanceConversation_copiesTheTransportProfile(t *testing.T) {
+	m := NewManager(&Conversation{})
+	m.Master().SetTransportProfile(TransportProfileAsync)
+
+	c := m.newInstanceConversation(0x101)
+
+	assertDeepEquals(t, c.TransportProfile(), TransportProfileAsync)
+}
+
+func Test_Manager_newInstanceConversation_copiesTheFieldLimits(t *testing.T) {
+	m := NewManager(&Conversation{})
+	m.Master().SetFieldLimits(FieldLimits{MaxMPILength: 300})
+
+	c := m.newInstanceConversation(0x101)
+
+	assertEquals(t, c.FieldLimits().MaxMPILength, 300)
+}
+
+func Test_Manager_newInstanceConversation_sharesTheFragmentBudget(t *testing.T) {
+	m := NewManager(&Conversation{})
+	budget := NewFragmentBudget(100)
+	m.Master().SetFragmentLimits(FragmentLimits{MaxSize: 50, Budget: budget})
+
+	c := m.newInstanceConversation(0x101)
+
+	assertEquals(t, c.FragmentLimits().MaxSize, 50)
+	assertEquals(t, c.FragmentLimits().Budget, budget)
+}
+
+func Test_Manager_newInstanceConversation_copiesTheOutboxLimits(t *testing.T) {
+	m := NewManager(&Conversation{})
+	m.Master().SetOutboxLimits(OutboxLimits{MaxMessages: 5})
+
+	c := m.newInstanceConversation(0x101)
+
+	assertEquals(t, c.OutboxLimits().MaxMessages, 5)
+}
+
+func Test_Manager_newInstanceConversation_copiesTheReplyHandler(t *testing.T) {
+	m := NewManager(&Conversation{})
+	m.Master().SetReplyHandler(dynamicReplyHandler{func(ReplyKind, []ValidMessage) bool { return false }})
+
+	c := m.newInstanceConversation(0x101)
+
+	assertNotNil(t, c.replyHandler)
+}
+
+func Test_Manager_newInstanceConversation_copiesTheSMPSecretNormalization(t *testing.T) {
+	m := NewManager(&Conversation{})
+	m.Master().SetSMPSecretNormalization(SMPSecretNormalization{TrimSpace: true, FoldCase: true})
+
+	c := m.newInstanceConversation(0x101)
+
+	assertEquals(t, c.SMPSecretNormalization().TrimSpace, true)
+	assertEquals(t, c.SMPSecretNormalization().FoldCase, true)
+}
+
+func Test_Manager_newInstanceConversation_copiesTheEphemeralKeyProvider(t *testing.T) {
+	m := NewManager(&Conversation{})
+	p := &fixedExponents{}
+	m.Master().SetEphemeralKeyProvider(p)
+
+	c := m.newInstanceConversation(0x101)
+
+	assertEquals(t, c.EphemeralKeyProvider(), EphemeralKeyProvider(p))
+}
+
+func Test_Manager_newInstanceConversation_copiesTheRefusedPlaintextReply(t *testing.T) {
+	m := NewManager(&Conversation{})
+	m.Master().SetRefusedPlaintextReply("please use OTR")
+
+	c := m.newInstanceConversation(0x101)
+
+	assertEquals(t, c.refusedPlaintextReply, "please use OTR")
+}
+
+func Test_Manager_newInstanceConversation_doesntShareTheExpectedFingerprintsWithTheMaster(t *testing.T) {
+	m := NewManager(&Conversation{})
+	m.Master().expectedFingerprints = [][]byte{[]byte{0x01}}
+
+	c := m.newInstanceConversation(0x101)
+	c.expectedFingerprints[0] = []byte{0x02}
+
+	assertDeepEquals(t, m.Master().expectedFingerprints[0], []byte{0x01})
+}
+
+func Test_Manager_newInstanceConversation_copiesTheSender(t *testing.T) {
+	m := NewManager(&Conversation{})
+	s := withSender(m.Master())
+
+	c := m.newInstanceConversation(0x101)
+
+	assertEquals(t, c.sender, Sender(s))
+}
+
+func Test_Manager_MarkDelivered_reportsTheOutcomeToTheConversationThatDelivered(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader})
+	s := withSender(m.Master())
+	m.Master().SendAsync(ValidMessage("to the master"))
+	c, _ := m.instance(0x101)
+	c.SendAsync(ValidMessage("to the instance"))
+
+	assertTrue(t, s.ids[0] != s.ids[1])
+	assertNil(t, m.MarkDelivered(s.ids[1]))
+	assertEquals(t, c.PendingDeliveries(), 0)
+	assertNil(t, m.MarkFailed(s.ids[0]))
+	assertEquals(t, m.MarkDelivered(s.ids[0]), errUnknownDelivery)
+}
+
+func Test_Manager_PeerOffline_wipesThePendingDeliveriesOfTheInstance(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader})
+	withSender(m.Master())
+	c, _ := m.instance(0x101)
+	c.SendAsync(ValidMessage("hello"))
+
+	m.PeerOffline(0x101)
+
+	assertEquals(t, c.PendingDeliveries(), 0)
+}
+
+func Test_Manager_SetFriendlyQueryMessage_appliesToTheMasterAndAllInstances(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader, Policies: Policies(PolicyAllowV3)})
+	c, _ := m.instance(0x1234)
+
+	m.SetFriendlyQueryMessage("let's talk privately")
+
+	assertEquals(t, string(m.Master().QueryMessage()), "?OTRv3? let's talk privately")
+	assertEquals(t, string(c.QueryMessage()), "?OTRv3? let's talk privately")
+}
+
+func Test_Manager_keepsTheVersionOfAnOTRv2PeerApartFromItsOTRv3Instances(t *testing.T) {
+	aliceV2 := managerFor(alicePrivateKey)
+	aliceV2.Master().Policies = Policies(PolicyAllowV2)
+	aliceV3 := managerFor(alicePrivateKey)
+	aliceV3.Master().Policies = Policies(PolicyAllowV3)
+	bob := managerFor(bobPrivateKey)
+
+	exchangeBetweenManagers(t, aliceV2, bob, []ValidMessage{aliceV2.Master().QueryMessage()})
+	exchangeBetweenManagers(t, bob, aliceV3, []ValidMessage{bob.Master().QueryMessage()})
+
+	assertTrue(t, bob.Master().IsEncrypted())
+	assertEquals(t, bob.Master().version, otrV2{})
+	instance := bob.Instance(aliceV3.Master().ourInstanceTag)
+	assertTrue(t, instance.IsEncrypted())
+	assertEquals(t, instance.version, otrV3{})
+
+	bob.Master().SetFragmentSize(100)
+	toSend, _ := bob.Master().Send(ValidMessage("a message long enough to be split into several fragments for the OTRv2 peer"))
+	assertTrue(t, len(toSend) > 1)
+	for _, f := range toSend {
+		assertEquals(t, versionFromFragment(f), uint16(2))
+	}
+}
@@ -56,6 +56,44 @@ const (
 
 	// MessageEventReceivedMessageForOtherInstance is triggered when we receive and discard a message for another instance
 	MessageEventReceivedMessageForOtherInstance
+
+	// MessageEventInternalError is signaled when processing a message panicked and the panic was contained.
+	// The error passed along describes what went wrong. The message that caused it was dropped.
+	MessageEventInternalError
+
+	// MessageEventReceivedMessageNonConformant is signaled when we receive a message that doesn't follow the specification,
+	// but that we accept anyway because the StrictSpec policy is not set. The error passed along describes the problem.
+	MessageEventReceivedMessageNonConformant
+
+	// MessageEventQueuedMessageNotSent is signaled for every message that was waiting for a private conversation
+	// because of the RequireEncryption policy, but was dropped instead of being sent. This happens when the AKE
+	// can't be started or has to start over, or when it finishes too long after the message was queued.
+	// The message and its trace are passed along, together with the reason.
+	MessageEventQueuedMessageNotSent
+
+	// MessageEventReceivedFragmentInconsistent is signaled when we receive a fragment with an impossible fragment number
+	// or count, or one that doesn't follow the fragments received before. The fragments reassembled so far are discarded.
+	// The error passed along describes the problem.
+	MessageEventReceivedFragmentInconsistent
+
+	// MessageEventReceivedMessageReplayed is signaled when we receive an authentic data message whose counter
+	// doesn't increase over the messages received before with the same keys. The message might have been
+	// replayed by an attacker, and is discarded. This is signaled even if the message asks to ignore it when unreadable.
+	MessageEventReceivedMessageReplayed
+
+	// MessageEventReceivedFragmentsEvicted is signaled when the fragments of a message being reassembled are discarded,
+	// because they take more memory than the FragmentLimits allow, or because the rest of the message didn't arrive in time.
+	// The error passed along describes which.
+	MessageEventReceivedFragmentsEvicted
+
+	// MessageEventPeerRequiresUnsupportedVersion is signaled when the peer only offers in a query message, or sends
+	// messages of, protocol versions we don't support or don't allow - like OTRv1, which is never supported.
+	// Whitespace tags offering only such versions are ignored.
+	MessageEventPeerRequiresUnsupportedVersion
+
+	// MessageEventSMPVerificationFailed is signaled together with SMPEventCheated, with an SMPVerificationError
+	// telling which SMP message from the peer failed verification
+	MessageEventSMPVerificationFailed
 )
 
 // MessageEventHandler handles MessageEvents
@@ -84,6 +122,12 @@ func (c *Conversation) messageEventWithError(e MessageEvent, err error) {
 	}
 }
 
+func (c *Conversation) messageEventWithMessageAndError(e MessageEvent, msg []byte, err error, trace ...interface{}) {
+	if c.messageEventHandler != nil {
+		c.messageEventHandler.HandleMessageEvent(e, msg, err, trace...)
+	}
+}
+
 func (c *Conversation) messageEventWithMessage(e MessageEvent, msg []byte) {
 	if c.messageEventHandler != nil {
 		c.messageEventHandler.HandleMessageEvent(e, msg, nil)
@@ -125,6 +169,22 @@ func (s MessageEvent) String() string {
 		return "MessageEventReceivedMessageUnrecognized"
 	case MessageEventReceivedMessageForOtherInstance:
 		return "MessageEventReceivedMessageForOtherInstance"
+	case MessageEventInternalError:
+		return "MessageEventInternalError"
+	case MessageEventReceivedMessageNonConformant:
+		return "MessageEventReceivedMessageNonConformant"
+	case MessageEventQueuedMessageNotSent:
+		return "MessageEventQueuedMessageNotSent"
+	case MessageEventReceivedFragmentInconsistent:
+		return "MessageEventReceivedFragmentInconsistent"
+	case MessageEventReceivedMessageReplayed:
+		return "MessageEventReceivedMessageReplayed"
+	case MessageEventReceivedFragmentsEvicted:
+		return "MessageEventReceivedFragmentsEvicted"
+	case MessageEventPeerRequiresUnsupportedVersion:
+		return "MessageEventPeerRequiresUnsupportedVersion"
+	case MessageEventSMPVerificationFailed:
+		return "MessageEventSMPVerificationFailed"
 	default:
 		return "MESSAGE EVENT: (THIS SHOULD NEVER HAPPEN)"
 	}
@@ -18,6 +18,14 @@ func Test_MessageEvent_hasValidStringImplementation(t *testing.T) {
 	assertEquals(t, MessageEventReceivedMessageUnencrypted.String(), "MessageEventReceivedMessageUnencrypted")
 	assertEquals(t, MessageEventReceivedMessageUnrecognized.String(), "MessageEventReceivedMessageUnrecognized")
 	assertEquals(t, MessageEventReceivedMessageForOtherInstance.String(), "MessageEventReceivedMessageForOtherInstance")
+	assertEquals(t, MessageEventInternalError.String(), "MessageEventInternalError")
+	assertEquals(t, MessageEventReceivedMessageNonConformant.String(), "MessageEventReceivedMessageNonConformant")
+	assertEquals(t, MessageEventQueuedMessageNotSent.String(), "MessageEventQueuedMessageNotSent")
+	assertEquals(t, MessageEventReceivedFragmentInconsistent.String(), "MessageEventReceivedFragmentInconsistent")
+	assertEquals(t, MessageEventReceivedMessageReplayed.String(), "MessageEventReceivedMessageReplayed")
+	assertEquals(t, MessageEventReceivedFragmentsEvicted.String(), "MessageEventReceivedFragmentsEvicted")
+	assertEquals(t, MessageEventPeerRequiresUnsupportedVersion.String(), "MessageEventPeerRequiresUnsupportedVersion")
+	assertEquals(t, MessageEventSMPVerificationFailed.String(), "MessageEventSMPVerificationFailed")
 	assertEquals(t, MessageEvent(20000).String(), "MESSAGE EVENT: (THIS SHOULD NEVER HAPPEN)")
 }
 
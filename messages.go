@@ -3,7 +3,6 @@ package otr3
 import (
 	"crypto/aes"
 	"crypto/hmac"
-	"crypto/subtle"
 	"encoding/binary"
 	"math/big"
 
@@ -13,6 +12,7 @@ import (
 const (
 	messageFlagNormal           = byte(0x00)
 	messageFlagIgnoreUnreadable = byte(0x01)
+	messageFlagsKnown           = messageFlagIgnoreUnreadable
 
 	messageHeaderPrefix = 3
 
@@ -25,7 +25,7 @@ const (
 
 type message interface {
 	serialize() []byte
-	deserialize(msg []byte) error
+	deserialize(msg []byte, l FieldLimits) error
 }
 
 type dhCommit struct {
@@ -41,12 +41,12 @@ func (c dhCommit) serialize() []byte {
 	return out
 }
 
-func (c *dhCommit) deserialize(msg []byte) error {
-	var ok1 bool
-	msg, c.encryptedGx, ok1 = gotrax.ExtractData(msg)
-	_, h, ok2 := gotrax.ExtractData(msg)
-	if !ok1 || !ok2 {
-		return newOtrError("corrupt DH commit message")
+func (c *dhCommit) deserialize(msg []byte, l FieldLimits) error {
+	var err1 error
+	msg, c.encryptedGx, err1 = l.extractData(msg)
+	_, h, err2 := l.extractData(msg)
+	if err := firstError(err1, err2); err != nil {
+		return fieldError(err, newOtrError("corrupt DH commit message"))
 	}
 	c.yhashedGx = h
 	return nil
@@ -60,11 +60,11 @@ func (c dhKey) serialize() []byte {
 	return gotrax.AppendMPI(nil, c.gy)
 }
 
-func (c *dhKey) deserialize(msg []byte) error {
-	_, gy, ok := gotrax.ExtractMPI(msg)
+func (c *dhKey) deserialize(msg []byte, l FieldLimits) error {
+	_, gy, err := l.extractMPI(msg)
 
-	if !ok {
-		return newOtrError("corrupt DH key message")
+	if err != nil {
+		return fieldError(err, newOtrError("corrupt DH key message"))
 	}
 
 	c.gy = gy
@@ -85,10 +85,13 @@ func (c revealSig) serialize(v otrVersion) []byte {
 	return append(out, c.macSig[:v.truncateLength()]...)
 }
 
-func (c *revealSig) deserialize(msg []byte, v otrVersion) error {
-	in, r, ok1 := gotrax.ExtractData(msg)
-	macSig, encryptedSig, ok2 := gotrax.ExtractData(in)
-	if !ok1 || !ok2 || len(macSig) != v.truncateLength() {
+func (c *revealSig) deserialize(msg []byte, v otrVersion, l FieldLimits) error {
+	in, r, err1 := l.extractData(msg)
+	macSig, encryptedSig, err2 := l.extractData(in)
+	if err := firstError(err1, err2); err != nil {
+		return fieldError(err, newOtrError("corrupt reveal signature message"))
+	}
+	if len(macSig) != v.truncateLength() {
 		return newOtrError("corrupt reveal signature message")
 	}
 
@@ -109,10 +112,13 @@ func (c sig) serialize(v otrVersion) []byte {
 	return append(out, c.macSig[:v.truncateLength()]...)
 }
 
-func (c *sig) deserialize(msg []byte) error {
-	macSig, encryptedSig, ok := gotrax.ExtractData(msg)
+func (c *sig) deserialize(msg []byte, l FieldLimits) error {
+	macSig, encryptedSig, err := l.extractData(msg)
+	if err != nil {
+		return fieldError(err, newOtrError("corrupt signature message"))
+	}
 
-	if !ok || len(macSig) != 20 {
+	if len(macSig) != 20 {
 		return newOtrError("corrupt signature message")
 	}
 	c.encryptedSig = encryptedSig
@@ -148,7 +154,7 @@ func (c dataMsg) checkSign(key []byte, header []byte, v otrVersion) error {
 	mac.Write(c.serializeUnsignedCache)
 	authenticatorCalculated := mac.Sum(nil)
 
-	if subtle.ConstantTimeCompare(c.authenticator, authenticatorCalculated) == 0 {
+	if !equalConstantTime(c.authenticator, authenticatorCalculated) {
 		return newOtrConflictError("bad signature MAC in encrypted signature")
 	}
 	return nil
@@ -166,33 +172,37 @@ func (c dataMsg) serializeUnsigned() []byte {
 	return out
 }
 
-func (c *dataMsg) deserializeUnsigned(msg []byte) error {
+func (c *dataMsg) deserializeUnsigned(msg []byte, l FieldLimits) error {
 	if len(msg) == 0 {
-		return newOtrError("dataMsg.deserialize empty message")
+		return ErrDataMessageTruncatedHeader
 	}
 	in := msg
 	c.flag = in[0]
+	if c.flag&^messageFlagsKnown != 0 {
+		return ErrDataMessageUnknownFlags
+	}
 
 	in = in[1:]
 	var ok bool
 
 	in, c.senderKeyID, ok = gotrax.ExtractWord(in)
 	if !ok {
-		return newOtrError("dataMsg.deserialize corrupted senderKeyID")
+		return ErrDataMessageTruncatedHeader
 	}
 
 	in, c.recipientKeyID, ok = gotrax.ExtractWord(in)
 	if !ok {
-		return newOtrError("dataMsg.deserialize corrupted recipientKeyID")
+		return ErrDataMessageTruncatedHeader
 	}
 
-	in, c.y, ok = gotrax.ExtractMPI(in)
-	if !ok {
-		return newOtrError("dataMsg.deserialize corrupted y")
+	var err error
+	in, c.y, err = l.extractMPI(in)
+	if err != nil {
+		return fieldError(err, ErrDataMessageBadMPI)
 	}
 
 	if len(in) < len(c.topHalfCtr) {
-		return newOtrError("dataMsg.deserialize corrupted topHalfCtr")
+		return ErrDataMessageTruncatedHeader
 	}
 
 	copy(c.topHalfCtr[:], in)
@@ -202,9 +212,9 @@ func (c *dataMsg) deserializeUnsigned(msg []byte) error {
 
 	copy(c.topHalfCtr[:], in)
 	in = in[len(c.topHalfCtr):]
-	in, c.encryptedMsg, ok = gotrax.ExtractData(in)
-	if !ok {
-		return newOtrError("dataMsg.deserialize corrupted encryptedMsg")
+	in, c.encryptedMsg, err = l.extractData(in)
+	if err != nil {
+		return fieldError(err, newOtrError("dataMsg.deserialize corrupted encryptedMsg"))
 	}
 
 	c.serializeUnsignedCache = msg[:len(msg)-len(in)]
@@ -229,19 +239,22 @@ func (c dataMsg) serialize(v otrVersion) []byte {
 	return out
 }
 
-func (c *dataMsg) deserialize(msg []byte, v otrVersion) error {
-	if err := c.deserializeUnsigned(msg); err != nil {
+func (c *dataMsg) deserialize(msg []byte, v otrVersion, l FieldLimits) error {
+	if err := c.deserializeUnsigned(msg, l); err != nil {
 		return err
 	}
 
 	msg = msg[len(c.serializeUnsignedCache):]
+	if len(msg) < v.hashLength() {
+		return newOtrError("dataMsg.deserialize corrupted authenticator")
+	}
 	c.authenticator = msg[0:v.hashLength()]
 	msg = msg[len(c.authenticator):]
 
 	var revKeysBytes []byte
-	msg, revKeysBytes, ok := gotrax.ExtractData(msg)
-	if !ok {
-		return newOtrError("dataMsg.deserialize corrupted revealMACKeys")
+	msg, revKeysBytes, err := l.extractData(msg)
+	if err != nil {
+		return fieldError(err, newOtrError("dataMsg.deserialize corrupted revealMACKeys"))
 	}
 	for len(revKeysBytes) > 0 {
 		if len(revKeysBytes) < v.hashLength() {
@@ -259,6 +272,8 @@ func (c *dataMsg) deserialize(msg []byte, v otrVersion) error {
 type plainDataMsg struct {
 	message []byte
 	tlvs    []tlv
+	// padding is only used when encrypting
+	padding Padding
 }
 
 func (c *plainDataMsg) deserialize(msg []byte) error {
@@ -307,7 +322,17 @@ const (
 )
 
 func (c plainDataMsg) pad() plainDataMsg {
-	padding := paddingGranularity - ((len(c.message) + tlvHeaderLen + nulByteLen) % paddingGranularity)
+	if c.padding.Disabled {
+		return c
+	}
+
+	size := len(c.message) + tlvHeaderLen + nulByteLen
+	if len(c.padding.Buckets) > 0 {
+		for _, t := range c.tlvs {
+			size += tlvHeaderLen + len(t.tlvValue)
+		}
+	}
+	padding := c.padding.paddingLength(size)
 
 	paddingTlv := tlv{
 		tlvType:   uint16(tlvTypePadding),
@@ -87,7 +87,7 @@ func Test_dataMsg_deserializeUnsigned_failsWhenTopHalfCtrIsZero(t *testing.T) {
 	}.serializeUnsigned()
 
 	dataMessage := dataMsg{}
-	err := dataMessage.deserializeUnsigned(msg)
+	err := dataMessage.deserializeUnsigned(msg, defaultFieldLimits)
 
 	assertEquals(t, err.Error(), "otr: dataMsg.deserialize invalid topHalfCtr")
 }
@@ -145,7 +145,7 @@ func Test_dataMsgDeserialze(t *testing.T) {
 	msg = gotrax.AppendData(msg, revKeys)
 
 	dataMessage := dataMsg{}
-	err := dataMessage.deserialize(msg, otrV3{})
+	err := dataMessage.deserialize(msg, otrV3{}, defaultFieldLimits)
 	assertEquals(t, err, nil)
 	assertDeepEquals(t, dataMessage.flag, flag)
 	assertDeepEquals(t, dataMessage.senderKeyID, senderKeyID)
@@ -161,8 +161,16 @@ func Test_dataMsgDeserialzeErrorWhenEmpty(t *testing.T) {
 	var msg []byte
 
 	dataMessage := dataMsg{}
-	err := dataMessage.deserialize(msg, otrV3{})
-	assertEquals(t, err.Error(), "otr: dataMsg.deserialize empty message")
+	err := dataMessage.deserialize(msg, otrV3{}, defaultFieldLimits)
+	assertEquals(t, err, ErrDataMessageTruncatedHeader)
+}
+
+func Test_dataMsgDeserialzeErrorWhenUnknownFlagsAreSet(t *testing.T) {
+	msg := []byte{0x02, 0x00, 0x00, 0x00, 0x01}
+
+	dataMessage := dataMsg{}
+	err := dataMessage.deserialize(msg, otrV3{}, defaultFieldLimits)
+	assertEquals(t, err, ErrDataMessageUnknownFlags)
 }
 
 func Test_dataMsgDeserialzeErrorWhenCorruptedSenderKeyID(t *testing.T) {
@@ -175,8 +183,8 @@ func Test_dataMsgDeserialzeErrorWhenCorruptedSenderKeyID(t *testing.T) {
 	msg = append(msg, senderKeyID)
 
 	dataMessage := dataMsg{}
-	err := dataMessage.deserialize(msg, otrV3{})
-	assertEquals(t, err.Error(), "otr: dataMsg.deserialize corrupted senderKeyID")
+	err := dataMessage.deserialize(msg, otrV3{}, defaultFieldLimits)
+	assertEquals(t, err, ErrDataMessageTruncatedHeader)
 }
 
 func Test_dataMsgDeserialzeErrorWhenCorruptedReceiverKeyID(t *testing.T) {
@@ -191,8 +199,8 @@ func Test_dataMsgDeserialzeErrorWhenCorruptedReceiverKeyID(t *testing.T) {
 	msg = append(msg, recipientKeyID)
 
 	dataMessage := dataMsg{}
-	err := dataMessage.deserialize(msg, otrV3{})
-	assertEquals(t, err.Error(), "otr: dataMsg.deserialize corrupted recipientKeyID")
+	err := dataMessage.deserialize(msg, otrV3{}, defaultFieldLimits)
+	assertEquals(t, err, ErrDataMessageTruncatedHeader)
 }
 
 func Test_dataMsgDeserialzeErrorWhenCorruptedY(t *testing.T) {
@@ -210,8 +218,8 @@ func Test_dataMsgDeserialzeErrorWhenCorruptedY(t *testing.T) {
 	msg = append(msg, mpiY[1:]...)
 
 	dataMessage := dataMsg{}
-	err := dataMessage.deserialize(msg, otrV3{})
-	assertEquals(t, err.Error(), "otr: dataMsg.deserialize corrupted y")
+	err := dataMessage.deserialize(msg, otrV3{}, defaultFieldLimits)
+	assertEquals(t, err, ErrDataMessageBadMPI)
 }
 
 func Test_dataMsgDeserialzeErrorWhenCorruptedEncryptedMsg(t *testing.T) {
@@ -233,7 +241,7 @@ func Test_dataMsgDeserialzeErrorWhenCorruptedEncryptedMsg(t *testing.T) {
 	msg = append(msg, encryptedMsgData[1:]...)
 
 	dataMessage := dataMsg{}
-	err := dataMessage.deserialize(msg, otrV3{})
+	err := dataMessage.deserialize(msg, otrV3{}, defaultFieldLimits)
 	assertEquals(t, err.Error(), "otr: dataMsg.deserialize corrupted encryptedMsg")
 }
 
@@ -254,8 +262,8 @@ func Test_dataMsgDeserialzeErrorWhenCorruptedTopHalfCtr(t *testing.T) {
 	msg = append(msg, topHalfCtr[:]...)
 
 	dataMessage := dataMsg{}
-	err := dataMessage.deserialize(msg, otrV3{})
-	assertEquals(t, err.Error(), "otr: dataMsg.deserialize corrupted topHalfCtr")
+	err := dataMessage.deserialize(msg, otrV3{}, defaultFieldLimits)
+	assertEquals(t, err, ErrDataMessageTruncatedHeader)
 }
 
 func Test_dataMsgDeserialzeErrorWhenCorruptedRevealMACKeys(t *testing.T) {
@@ -293,7 +301,7 @@ func Test_dataMsgDeserialzeErrorWhenCorruptedRevealMACKeys(t *testing.T) {
 	msg = gotrax.AppendData(msg, revKeys)
 
 	dataMessage := dataMsg{}
-	err := dataMessage.deserialize(msg, otrV3{})
+	err := dataMessage.deserialize(msg, otrV3{}, defaultFieldLimits)
 	assertEquals(t, err.Error(), "otr: dataMsg.deserialize corrupted revealMACKeys")
 }
 
@@ -331,7 +339,7 @@ func Test_dataMsgDeserialzeErrorWhenCorruptedRevealMACKeyEnding(t *testing.T) {
 	msg = gotrax.AppendData(msg, revKeys)
 
 	dataMessage := dataMsg{}
-	err := dataMessage.deserialize(msg, otrV3{})
+	err := dataMessage.deserialize(msg, otrV3{}, defaultFieldLimits)
 	assertEquals(t, err.Error(), "otr: dataMsg.deserialize corrupted revealMACKeys")
 }
 
@@ -0,0 +1,76 @@
+package otr3
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+const fingerprintLength = 20
+
+// LegacyFingerprint is a fingerprint of a peer as applications built on golang.org/x/crypto/otr usually keep them:
+// in a format of their own choosing, together with whether the user trusts it.
+// Fingerprint can be in any of the representations ParseFingerprint accepts.
+type LegacyFingerprint struct {
+	Peer        string
+	Fingerprint string
+	Trusted     bool
+}
+
+// ParseFingerprint reads a fingerprint in one of the representations applications commonly store them in:
+// hex digits in upper or lower case, with or without spaces, colons or dashes between them,
+// or standard or URL-safe base64, with or without padding.
+// It returns an error if the text is not a fingerprint in any of these representations.
+func ParseFingerprint(s string) ([]byte, error) {
+	digits := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', ':', '-', '\t':
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(s))
+
+	if len(digits) == 2*fingerprintLength {
+		if fpr, err := hex.DecodeString(digits); err == nil {
+			return fpr, nil
+		}
+	}
+
+	encoded := strings.TrimSpace(s)
+	for _, enc := range []*base64.Encoding{base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding} {
+		if fpr, err := enc.DecodeString(encoded); err == nil && len(fpr) == fingerprintLength {
+			return fpr, nil
+		}
+	}
+
+	return nil, newOtrErrorf("invalid fingerprint: %q", s)
+}
+
+// ImportLegacyFingerprints adds the fingerprints to the trust store, with the trust the application gave them.
+// Trust that is already recorded in the store is overwritten. If any fingerprint can't be parsed,
+// an error is returned and nothing is added to the store.
+func ImportLegacyFingerprints(store TrustStore, fingerprints []LegacyFingerprint) error {
+	parsed := make([][]byte, len(fingerprints))
+	for i, lf := range fingerprints {
+		fpr, err := ParseFingerprint(lf.Fingerprint)
+		if err != nil {
+			return err
+		}
+		parsed[i] = fpr
+	}
+
+	for i, lf := range fingerprints {
+		store.SetTrusted(lf.Peer, parsed[i], lf.Trusted)
+	}
+
+	return nil
+}
+
+// ImportKnownFingerprints adds the entries of a libotr fingerprint store to the trust store.
+// The peer of each entry in the trust store is decided by the given function, since applications
+// identify peers in different ways - for example by the username alone, or together with the account.
+func ImportKnownFingerprints(store TrustStore, fingerprints []*KnownFingerprint, peer func(*KnownFingerprint) string) {
+	for _, kf := range fingerprints {
+		store.SetTrusted(peer(kf), kf.Fingerprint, kf.IsTrusted())
+	}
+}
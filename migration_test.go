@@ -0,0 +1,85 @@
+package otr3
+
+import "testing"
+
+var migrationFingerprint = bytesFromHex("0102030405060708090a0b0c0d0e0f10111213ff")
+
+func Test_ParseFingerprint_readsHex(t *testing.T) {
+	for _, s := range []string{
+		"0102030405060708090a0b0c0d0e0f10111213ff",
+		"0102030405060708090A0B0C0D0E0F10111213FF",
+		"01020304 05060708 090A0B0C 0D0E0F10 111213FF",
+		"01:02:03:04:05:06:07:08:09:0a:0b:0c:0d:0e:0f:10:11:12:13:ff",
+		"01020304-05060708-090a0b0c-0d0e0f10-111213ff\n",
+	} {
+		fpr, err := ParseFingerprint(s)
+		assertNil(t, err)
+		assertDeepEquals(t, fpr, migrationFingerprint)
+	}
+}
+
+func Test_ParseFingerprint_readsBase64(t *testing.T) {
+	for _, s := range []string{
+		"AQIDBAUGBwgJCgsMDQ4PEBESE/8=",
+		"AQIDBAUGBwgJCgsMDQ4PEBESE/8",
+		"AQIDBAUGBwgJCgsMDQ4PEBESE_8=",
+		"AQIDBAUGBwgJCgsMDQ4PEBESE_8",
+	} {
+		fpr, err := ParseFingerprint(s)
+		assertNil(t, err)
+		assertDeepEquals(t, fpr, migrationFingerprint)
+	}
+}
+
+func Test_ParseFingerprint_returnsErrorForAnythingElse(t *testing.T) {
+	for _, s := range []string{
+		"",
+		"0102030405060708090a0b0c0d0e0f10111213",
+		"0102030405060708090a0b0c0d0e0f10111213zz",
+		"AQIDBAUGBwgJCgsMDQ4PEBES",
+	} {
+		_, err := ParseFingerprint(s)
+		assertEquals(t, err, newOtrErrorf("invalid fingerprint: %q", s))
+	}
+}
+
+func Test_ImportLegacyFingerprints_addsTheFingerprintsWithTheirTrust(t *testing.T) {
+	store := NewMemoryTrustStore()
+	other := bytesFromHex("ff02030405060708090a0b0c0d0e0f1011121301")
+
+	err := ImportLegacyFingerprints(store, []LegacyFingerprint{
+		{Peer: "bob@example.org", Fingerprint: "01020304 05060708 090A0B0C 0D0E0F10 111213FF", Trusted: true},
+		{Peer: "bob@example.org", Fingerprint: "/wIDBAUGBwgJCgsMDQ4PEBESEwE=", Trusted: false},
+	})
+
+	assertNil(t, err)
+	known, trusted := store.Lookup("bob@example.org", migrationFingerprint)
+	assertTrue(t, known)
+	assertTrue(t, trusted)
+	known, trusted = store.Lookup("bob@example.org", other)
+	assertTrue(t, known)
+	assertFalse(t, trusted)
+}
+
+func Test_ImportLegacyFingerprints_addsNothingIfAFingerprintIsInvalid(t *testing.T) {
+	store := NewMemoryTrustStore()
+
+	err := ImportLegacyFingerprints(store, []LegacyFingerprint{
+		{Peer: "bob@example.org", Fingerprint: "0102030405060708090a0b0c0d0e0f10111213ff", Trusted: true},
+		{Peer: "bob@example.org", Fingerprint: "not a fingerprint"},
+	})
+
+	assertNotNil(t, err)
+	assertFalse(t, store.HasFingerprints("bob@example.org"))
+}
+
+func Test_ImportKnownFingerprints_addsTheEntriesWithTheirTrust(t *testing.T) {
+	store := NewMemoryTrustStore()
+
+	ImportKnownFingerprints(store, []*KnownFingerprint{
+		{Username: "bob@example.org", Account: "alice@example.org", Fingerprint: migrationFingerprint, Trust: TrustSMP},
+	}, func(kf *KnownFingerprint) string { return kf.Account + "/" + kf.Username })
+
+	_, trusted := store.Lookup("alice@example.org/bob@example.org", migrationFingerprint)
+	assertTrue(t, trusted)
+}
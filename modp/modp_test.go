@@ -0,0 +1,87 @@
+package modp
+
+import (
+	"math/big"
+	"testing"
+)
+
+func assertEquals(t *testing.T, actual, expected interface{}) {
+	if actual != expected {
+		t.Errorf("Expected %v to equal %v", actual, expected)
+	}
+}
+
+// This is the prime of the 1536-bit MODP group, exactly as written in section 2 of RFC 3526
+const rfc3526Prime = "FFFFFFFF FFFFFFFF C90FDAA2 2168C234 C4C6628B 80DC1CD1" +
+	"29024E08 8A67CC74 020BBEA6 3B139B22 514A0879 8E3404DD" +
+	"EF9519B3 CD3A431B 302B0A6D F25F1437 4FE1356D 6D51C245" +
+	"E485B576 625E7EC6 F44C42E9 A637ED6B 0BFF5CB6 F406B7ED" +
+	"EE386BFB 5A899FA5 AE9F2411 7C4B1FE6 49286651 ECE45B3D" +
+	"C2007CB8 A163BF05 98DA4836 1C55D39A 69163FA8 FD24CF5F" +
+	"83655D23 DCA3AD96 1C62F356 208552BB 9ED52907 7096966D" +
+	"670C354E 4ABC9804 F1746C08 CA237327 FFFFFFFF FFFFFFFF"
+
+func fromRFC(s string) *big.Int {
+	var hex []byte
+	for _, c := range []byte(s) {
+		if c != ' ' {
+			hex = append(hex, c)
+		}
+	}
+
+	n, _ := new(big.Int).SetString(string(hex), 16)
+	return n
+}
+
+func Test_P_isThePrimeFromRFC3526(t *testing.T) {
+	assertEquals(t, P().Cmp(fromRFC(rfc3526Prime)), 0)
+	assertEquals(t, P().BitLen(), Bits)
+	assertEquals(t, P().ProbablyPrime(20), true)
+}
+
+func Test_G_isTheGeneratorFromRFC3526(t *testing.T) {
+	assertEquals(t, G().Cmp(big.NewInt(2)), 0)
+}
+
+func Test_Q_isTheOrderOfTheSubgroup(t *testing.T) {
+	expected := new(big.Int).Rsh(new(big.Int).Sub(P(), big.NewInt(1)), 1)
+
+	assertEquals(t, Q().Cmp(expected), 0)
+	assertEquals(t, Q().ProbablyPrime(20), true)
+	assertEquals(t, IsInPrimeOrderSubgroup(G()), true)
+}
+
+func Test_P_returnsACopy(t *testing.T) {
+	P().SetInt64(1)
+	Q().SetInt64(1)
+	G().SetInt64(1)
+
+	assertEquals(t, P().BitLen(), Bits)
+	assertEquals(t, Q().BitLen(), Bits-1)
+	assertEquals(t, G().Int64(), int64(2))
+}
+
+func Test_IsGroupElement_disallowsThingsLessThanTwo(t *testing.T) {
+	assertEquals(t, IsGroupElement(big.NewInt(-1)), false)
+	assertEquals(t, IsGroupElement(big.NewInt(0)), false)
+	assertEquals(t, IsGroupElement(big.NewInt(1)), false)
+	assertEquals(t, IsGroupElement(big.NewInt(2)), true)
+}
+
+func Test_IsGroupElement_disallowsThingsLargerThanTheModuloMinusTwo(t *testing.T) {
+	assertEquals(t, IsGroupElement(new(big.Int).Sub(P(), big.NewInt(2))), true)
+	assertEquals(t, IsGroupElement(new(big.Int).Sub(P(), big.NewInt(1))), false)
+	assertEquals(t, IsGroupElement(P()), false)
+}
+
+func Test_IsInPrimeOrderSubgroup_disallowsElementsOutsideTheSubgroup(t *testing.T) {
+	// p-1 has order 2, so it's not in the subgroup even if it passed the range check
+	assertEquals(t, IsInPrimeOrderSubgroup(new(big.Int).Sub(P(), big.NewInt(1))), false)
+	// 2^2 is in the subgroup generated by 2
+	assertEquals(t, IsInPrimeOrderSubgroup(big.NewInt(4)), true)
+}
+
+func Test_ExponentLength_roundsUpToWholeBytes(t *testing.T) {
+	assertEquals(t, ExponentLength(MinExponentBits), 40)
+	assertEquals(t, ExponentLength(321), 41)
+}
@@ -0,0 +1,129 @@
+package otr3
+
+import "io"
+
+// ConversationOption configures a conversation created by NewConversation
+type ConversationOption func(*Conversation) error
+
+// NewConversation creates a conversation configured by the given options, applied in order.
+// It returns the first error an option returns. Every option only does what one of the setters
+// of Conversation does, so the conversation can still be changed with them afterwards.
+func NewConversation(opts ...ConversationOption) (*Conversation, error) {
+	c := &Conversation{}
+	for _, o := range opts {
+		if err := o(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// WithVersion fixes the protocol version of the conversation up front, like NewConversationWithVersion.
+// Only versions 2 and 3 are supported.
+func WithVersion(v int) ConversationOption {
+	return func(c *Conversation) error {
+		switch v {
+		case 2:
+			c.version = otrV2{}
+		case 3:
+			c.version = otrV3{}
+		default:
+			return errUnsupportedOTRVersion
+		}
+		return nil
+	}
+}
+
+// WithRand sets the random source of the conversation
+func WithRand(r io.Reader) ConversationOption {
+	return func(c *Conversation) error {
+		c.Rand = r
+		return nil
+	}
+}
+
+// WithPolicies adds the given policies to the conversation
+func WithPolicies(ps ...Policy) ConversationOption {
+	return func(c *Conversation) error {
+		for _, p := range ps {
+			c.Policies.Add(p)
+		}
+		return nil
+	}
+}
+
+// WithPrivateKey adds our private keys to the conversation
+func WithPrivateKey(keys ...PrivateKey) ConversationOption {
+	return func(c *Conversation) error {
+		c.SetOurKeys(append(c.GetOurKeys(), keys...))
+		return nil
+	}
+}
+
+// WithFragmentSize sets the maximum size of a message fragment, like SetFragmentSize
+func WithFragmentSize(size uint16) ConversationOption {
+	return func(c *Conversation) error {
+		c.SetFragmentSize(size)
+		return nil
+	}
+}
+
+// WithEventHandler assigns the handler for every kind of event it can handle - it can implement any of
+// SMPEventHandler, ErrorMessageHandler, MessageEventHandler, SecurityEventHandler, ReceivedKeyHandler and ReplyHandler.
+// It returns an error if the handler implements none of them.
+func WithEventHandler(handler interface{}) ConversationOption {
+	return func(c *Conversation) error {
+		handles := false
+		if h, ok := handler.(SMPEventHandler); ok {
+			c.SetSMPEventHandler(h)
+			handles = true
+		}
+		if h, ok := handler.(ErrorMessageHandler); ok {
+			c.SetErrorMessageHandler(h)
+			handles = true
+		}
+		if h, ok := handler.(MessageEventHandler); ok {
+			c.SetMessageEventHandler(h)
+			handles = true
+		}
+		if h, ok := handler.(SecurityEventHandler); ok {
+			c.SetSecurityEventHandler(h)
+			handles = true
+		}
+		if h, ok := handler.(ReceivedKeyHandler); ok {
+			c.SetReceivedKeyHandler(h)
+			handles = true
+		}
+		if h, ok := handler.(ReplyHandler); ok {
+			c.SetReplyHandler(h)
+			handles = true
+		}
+		if !handles {
+			return errNotAnEventHandler
+		}
+		return nil
+	}
+}
+
+// WithClock sets the clock of the conversation, like SetClock
+func WithClock(clock Clock) ConversationOption {
+	return func(c *Conversation) error {
+		c.SetClock(clock)
+		return nil
+	}
+}
+
+// WithPadding sets how the plaintext of outgoing data messages is padded, like SetPadding
+func WithPadding(p Padding) ConversationOption {
+	return func(c *Conversation) error {
+		return c.SetPadding(p)
+	}
+}
+
+// WithSender sets the sender the conversation delivers its messages through, like SetSender
+func WithSender(s Sender) ConversationOption {
+	return func(c *Conversation) error {
+		c.SetSender(s)
+		return nil
+	}
+}
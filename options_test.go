@@ -0,0 +1,84 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+)
+
+func Test_NewConversation_withoutOptionsReturnsTheZeroConversation(t *testing.T) {
+	c, err := NewConversation()
+
+	assertNil(t, err)
+	assertDeepEquals(t, c, &Conversation{})
+}
+
+func Test_NewConversation_appliesTheOptions(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+	c, err := NewConversation(
+		WithVersion(3),
+		WithRand(rand.Reader),
+		WithPolicies(PolicyAllowV3, PolicyRequireEncryption),
+		WithPrivateKey(alicePrivateKey),
+		WithFragmentSize(400),
+		WithClock(clock),
+	)
+
+	assertNil(t, err)
+	assertEquals(t, c.version, otrVersion(otrV3{}))
+	assertEquals(t, c.Rand, rand.Reader)
+	assertEquals(t, c.Policies, Policies(PolicyAllowV3|PolicyRequireEncryption))
+	assertDeepEquals(t, c.GetOurKeys(), []PrivateKey{alicePrivateKey})
+	assertEquals(t, c.fragmentSize, uint16(400))
+	assertEquals(t, c.now(), clock.now)
+}
+
+func Test_NewConversation_returnsTheErrorOfAnOption(t *testing.T) {
+	c, err := NewConversation(WithPadding(Padding{Buckets: []uint16{256, 128}}))
+
+	assertNil(t, c)
+	assertEquals(t, err, errInvalidPaddingBuckets)
+}
+
+func Test_WithVersion_rejectsUnsupportedVersions(t *testing.T) {
+	_, err := NewConversation(WithVersion(1))
+
+	assertEquals(t, err, errUnsupportedOTRVersion)
+}
+
+func Test_WithPrivateKey_addsToTheKeysOfEarlierOptions(t *testing.T) {
+	c, _ := NewConversation(WithPrivateKey(alicePrivateKey), WithPrivateKey(bobPrivateKey))
+
+	assertDeepEquals(t, c.GetOurKeys(), []PrivateKey{alicePrivateKey, bobPrivateKey})
+}
+
+type smpAndSecurityEventHandler struct {
+	dynamicSMPEventHandler
+	dynamicSecurityEventHandler
+}
+
+func Test_WithEventHandler_assignsEveryHandlerItImplements(t *testing.T) {
+	h := smpAndSecurityEventHandler{}
+	c, err := NewConversation(WithEventHandler(h))
+
+	assertNil(t, err)
+	assertDeepEquals(t, c.smpEventHandler, SMPEventHandler(h))
+	assertDeepEquals(t, c.securityEventHandler, SecurityEventHandler(h))
+	assertNil(t, c.messageEventHandler)
+}
+
+func Test_WithEventHandler_rejectsValuesThatHandleNothing(t *testing.T) {
+	_, err := NewConversation(WithEventHandler("not a handler"))
+
+	assertEquals(t, err, errNotAnEventHandler)
+}
+
+func Test_NewConversation_conversationsCanTalkPrivately(t *testing.T) {
+	alice, _ := NewConversation(WithRand(rand.Reader), WithPolicies(PolicyAllowV3), WithPrivateKey(alicePrivateKey))
+	bob, _ := NewConversation(WithRand(rand.Reader), WithPolicies(PolicyAllowV3), WithPrivateKey(bobPrivateKey))
+
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	assertEquals(t, alice.IsEncrypted(), true)
+	assertEquals(t, bob.IsEncrypted(), true)
+}
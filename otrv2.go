@@ -10,6 +10,7 @@ import (
 	"math/big"
 
 	"github.com/coyim/gotrax"
+	"github.com/coyim/otr3/modp"
 )
 
 var otrv2FragmentationPrefix = []byte("?OTR,")
@@ -22,8 +23,14 @@ func (v otrV2) parameterLength() int {
 	return 16
 }
 
+// dhExponentLength returns the number of random bytes used for AKE and data message DH exponents.
+// The spec requires at least 320 bits for these.
+func (v otrV2) dhExponentLength() int {
+	return modp.ExponentLength(modp.MinExponentBits)
+}
+
 func (v otrV2) isGroupElement(n *big.Int) bool {
-	return true
+	return isGroupElement(n)
 }
 
 func (v otrV2) isFragmented(data []byte) bool {
@@ -12,6 +12,7 @@ import (
 	"strconv"
 
 	"github.com/coyim/gotrax"
+	"github.com/coyim/otr3/modp"
 )
 
 var otrv3FragmentationPrefix = []byte("?OTR|")
@@ -27,6 +28,12 @@ func (v otrV3) parameterLength() int {
 	return 192
 }
 
+// dhExponentLength returns the number of random bytes used for AKE and data message DH exponents.
+// The spec requires at least 320 bits for these.
+func (v otrV3) dhExponentLength() int {
+	return modp.ExponentLength(modp.MinExponentBits)
+}
+
 func (v otrV3) isGroupElement(n *big.Int) bool {
 	return isGroupElement(n)
 }
@@ -128,11 +135,11 @@ func malformedMessage(c *Conversation) {
 	c.generatePotentialErrorMessage(ErrorCodeMessageMalformed)
 }
 
+// verifyInstanceTags checks that a message is from the instance of the peer we talk to, and to our instance.
+// Until an AKE has authenticated the peer, the instance tag of the peer is only learned tentatively from the
+// messages we receive, since anyone can send them. Once the AKE finishes, it is pinned, and messages
+// claiming to be from other instances are rejected.
 func (v otrV3) verifyInstanceTags(c *Conversation, their, our uint32) error {
-	if c.theirInstanceTag == 0 {
-		c.theirInstanceTag = their
-	}
-
 	if our > 0 && our < minValidInstanceTag {
 		malformedMessage(c)
 		return errInvalidOTRMessage
@@ -143,8 +150,19 @@ func (v otrV3) verifyInstanceTags(c *Conversation, their, our uint32) error {
 		return errInvalidOTRMessage
 	}
 
-	if (our != 0 && c.ourInstanceTag != our) ||
-		(c.theirInstanceTag != their) {
+	// A message for another client of ours is ignored before anything is learned from it,
+	// so it can't replace the instance tag of the peer we are talking to
+	if our != 0 && c.ourInstanceTag != our {
+		c.messageEvent(MessageEventReceivedMessageForOtherInstance)
+		return errReceivedMessageForOtherInstance
+	}
+
+	if c.theirInstanceTag == 0 || c.theirInstanceTagIsTentative {
+		c.theirInstanceTag = their
+		c.theirInstanceTagIsTentative = true
+	}
+
+	if c.theirInstanceTag != their {
 		c.messageEvent(MessageEventReceivedMessageForOtherInstance)
 		return errReceivedMessageForOtherInstance
 	}
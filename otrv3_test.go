@@ -51,6 +51,19 @@ func Test_verifyInstanceTags_signalsAMessageEventWhenOurInstanceTagDoesNotMatch(
 	}, MessageEventReceivedMessageForOtherInstance, nil, nil)
 }
 
+func Test_verifyInstanceTags_doesntLearnTheirInstanceTagFromAMessageForAnotherInstanceOfOurs(t *testing.T) {
+	v := otrV3{}
+	c := &Conversation{version: v}
+	c.theirInstanceTag = 0x100
+	c.theirInstanceTagIsTentative = true
+	c.ourInstanceTag = 0x122
+
+	err := v.verifyInstanceTags(c, 0x133, 0x121)
+
+	assertEquals(t, err, errReceivedMessageForOtherInstance)
+	assertEquals(t, c.theirInstanceTag, uint32(0x100))
+}
+
 func Test_verifyInstanceTags_savesTheirInstanceTag(t *testing.T) {
 	v := otrV3{}
 	c := &Conversation{}
@@ -149,3 +162,62 @@ func Test_messageHeader_generatesOurInstanceTagLazily(t *testing.T) {
 	assertEquals(t, err, nil)
 	assertEquals(t, c.ourInstanceTag, previousInstanceTag)
 }
+
+func Test_verifyInstanceTags_learnsTheirInstanceTagTentativelyUntilTheAKEFinishes(t *testing.T) {
+	v := otrV3{}
+	c := &Conversation{}
+
+	assertNil(t, v.verifyInstanceTags(c, 0x101, 0))
+	assertNil(t, v.verifyInstanceTags(c, 0x102, 0))
+
+	assertEquals(t, c.theirInstanceTag, uint32(0x102))
+	assertTrue(t, c.theirInstanceTagIsTentative)
+}
+
+func Test_verifyInstanceTags_doesntLearnAnInvalidInstanceTag(t *testing.T) {
+	v := otrV3{}
+	c := &Conversation{}
+
+	v.verifyInstanceTags(c, 0x99, 0)
+
+	assertEquals(t, c.theirInstanceTag, uint32(0))
+}
+
+func Test_Receive_pinsTheirInstanceTagWhenTheAKEFinishes(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	spoofer := &Conversation{Rand: alice.Rand, Policies: alice.Policies}
+	spoofer.SetOurKeys([]PrivateKey{alicePrivateKey})
+
+	_, spoofed, _ := spoofer.Receive(bob.QueryMessage())
+	bob.Receive(spoofed[0])
+
+	exchangeUntilQuiet(t, bob, alice, []ValidMessage{bob.QueryMessage()})
+	assertTrue(t, bob.IsEncrypted())
+	assertEquals(t, bob.theirInstanceTag, alice.ourInstanceTag)
+	assertFalse(t, bob.theirInstanceTagIsTentative)
+
+	_, spoofed, _ = spoofer.Receive(bob.QueryMessage())
+	bob.expectMessageEvent(t, func() {
+		_, toSend, _ := bob.Receive(spoofed[0])
+		assertNil(t, toSend)
+	}, MessageEventReceivedMessageForOtherInstance, nil, nil)
+	assertTrue(t, bob.IsEncrypted())
+}
+
+func Test_Receive_ignoresADataMessageForAnotherInstanceOfOurs(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	toSend, _ := alice.Send(ValidMessage("hello"))
+	bob.ourInstanceTag++
+	before := snapshotOf(bob)
+
+	var plain MessagePlaintext
+	var err error
+	bob.expectMessageEvent(t, func() {
+		plain, _, err = bob.Receive(toSend[0])
+	}, MessageEventReceivedMessageForOtherInstance, nil, nil)
+
+	assertNil(t, err)
+	assertNil(t, plain)
+	assertDeepEquals(t, snapshotOf(bob), before)
+}
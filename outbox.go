@@ -0,0 +1,139 @@
+package otr3
+
+import "time"
+
+const defaultMaxOutboxMessages = 100
+
+// OutboxKind tells why a message is waiting in the outbox
+type OutboxKind int
+
+const (
+	// OutboxQueued is a message from the user that waits for a private conversation, because of the RequireEncryption policy
+	OutboxQueued OutboxKind = iota
+	// OutboxSent is a message that has been sent, and is kept so it can be sent again if the peer couldn't read it
+	OutboxSent
+	// OutboxAKE is the last message of the AKE in progress, which ResumeAKE sends again
+	OutboxAKE
+)
+
+// String returns the string representation of the OutboxKind
+func (k OutboxKind) String() string {
+	switch k {
+	case OutboxQueued:
+		return "OutboxQueued"
+	case OutboxSent:
+		return "OutboxSent"
+	case OutboxAKE:
+		return "OutboxAKE"
+	default:
+		return "OUTBOX KIND: (THIS SHOULD NEVER HAPPEN)"
+	}
+}
+
+// OutboxEntry is a message the conversation has generated, and might still have to deliver
+type OutboxEntry struct {
+	Kind OutboxKind
+	// Message is the plaintext of a message from the user. It is nil for the AKE, since that message is generated again by ResumeAKE
+	Message []byte
+	// Since is when the message was sent or queued, by the clock of the conversation. For the AKE it is when
+	// the last AKE message was received or resumed, and zero if that hasn't happened yet
+	Since time.Time
+	// Trace is what was passed along when the message was sent
+	Trace []interface{}
+}
+
+// OutboxLimits bound the messages kept in the outbox. When a limit is exceeded, the oldest messages are dropped,
+// and MessageEventQueuedMessageNotSent is signaled for the ones that were never sent.
+type OutboxLimits struct {
+	// MaxMessages is the largest number of messages from the user kept. Zero means the default of 100
+	MaxMessages int
+	// MaxAge is how long a message from the user is kept. Zero means messages are kept until they are sent again or dropped
+	MaxAge time.Duration
+}
+
+// SetOutboxLimits sets how many messages are kept in the outbox, and for how long.
+// It returns an error if a limit is negative.
+func (c *Conversation) SetOutboxLimits(l OutboxLimits) error {
+	if l.MaxMessages < 0 || l.MaxAge < 0 {
+		return errInvalidOutboxLimits
+	}
+
+	c.outboxLimits = l
+	c.trimOutbox()
+	return nil
+}
+
+// OutboxLimits returns how many messages are kept in the outbox, and for how long,
+// with the defaults filled in for limits that haven't been set
+func (c *Conversation) OutboxLimits() OutboxLimits {
+	l := c.outboxLimits
+	if l.MaxMessages == 0 {
+		l.MaxMessages = defaultMaxOutboxMessages
+	}
+	return l
+}
+
+// Outbox returns the messages the conversation has generated and might still have to deliver, oldest first.
+// It doesn't change the outbox - messages older than MaxAge are only dropped the next time a message is sent
+// or received, so they can still be returned until then.
+func (c *Conversation) Outbox() []OutboxEntry {
+	var entries []OutboxEntry
+	for _, msg := range c.resend.pending() {
+		kind := OutboxSent
+		if msg.queued {
+			kind = OutboxQueued
+		}
+		entries = append(entries, OutboxEntry{Kind: kind, Message: makeCopy(msg.m), Since: msg.since, Trace: msg.opaque})
+	}
+
+	if c.akeWaitingForPeer() {
+		entries = append(entries, OutboxEntry{Kind: OutboxAKE, Since: c.ake.lastStateChange})
+	}
+
+	return entries
+}
+
+// ClearOutbox drops the messages from the user in the outbox. MessageEventQueuedMessageNotSent is signaled
+// for the ones that were never sent. The AKE in progress is left alone.
+func (c *Conversation) ClearOutbox() {
+	c.dropFromOutbox(errOutboxCleared, func(int, messageToResend) bool { return false })
+}
+
+func (c *Conversation) akeWaitingForPeer() bool {
+	if c.ake == nil {
+		return false
+	}
+
+	switch c.ake.state.(type) {
+	case authStateAwaitingDHKey, authStateAwaitingRevealSig, authStateAwaitingSig:
+		return true
+	}
+	return false
+}
+
+// trimOutbox drops the messages that are too old, and then the oldest messages until the outbox is within its limits
+func (c *Conversation) trimOutbox() {
+	l := c.OutboxLimits()
+
+	if l.MaxAge > 0 {
+		oldest := c.now().Add(-l.MaxAge)
+		c.dropFromOutbox(errOutboxMessageExpired, func(_ int, msg messageToResend) bool {
+			return msg.since.IsZero() || !msg.since.Before(oldest)
+		})
+	}
+
+	if excess := len(c.resend.pending()) - l.MaxMessages; excess > 0 {
+		c.dropFromOutbox(errOutboxFull, func(i int, _ messageToResend) bool {
+			return i >= excess
+		})
+	}
+}
+
+func (c *Conversation) dropFromOutbox(reason error, keep func(int, messageToResend) bool) {
+	for _, msg := range c.resend.keep(keep) {
+		if msg.queued {
+			c.messageEventWithMessageAndError(MessageEventQueuedMessageNotSent, msg.m, reason, msg.opaque...)
+		}
+		wipeBytes(msg.m)
+	}
+}
@@ -0,0 +1,155 @@
+package otr3
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_SetOutboxLimits_returnsErrorForNegativeLimits(t *testing.T) {
+	c := &Conversation{}
+
+	assertEquals(t, c.SetOutboxLimits(OutboxLimits{MaxMessages: -1}), errInvalidOutboxLimits)
+	assertEquals(t, c.SetOutboxLimits(OutboxLimits{MaxAge: -time.Second}), errInvalidOutboxLimits)
+	assertDeepEquals(t, c.OutboxLimits(), OutboxLimits{MaxMessages: defaultMaxOutboxMessages})
+}
+
+func Test_Outbox_isEmptyForANewConversation(t *testing.T) {
+	c := &Conversation{}
+
+	assertEquals(t, len(c.Outbox()), 0)
+}
+
+func Test_Outbox_containsQueuedMessages(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+	alice, _ := benchmarkConversations()
+	alice.SetClock(clock)
+	alice.Policies.RequireEncryption()
+
+	alice.Send(ValidMessage("hello"), "first")
+
+	assertDeepEquals(t, alice.Outbox(), []OutboxEntry{
+		OutboxEntry{Kind: OutboxQueued, Message: []byte("hello"), Since: clock.now, Trace: []interface{}{"first"}},
+	})
+}
+
+func Test_Outbox_containsTheAKEWaitingForThePeer(t *testing.T) {
+	alice, _, _ := akeUntil(1)
+
+	entries := alice.Outbox()
+
+	assertEquals(t, len(entries), 1)
+	assertEquals(t, entries[0].Kind, OutboxAKE)
+	assertNil(t, entries[0].Message)
+}
+
+func Test_Outbox_containsSentMessages(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	alice.ClearOutbox()
+
+	alice.Send(ValidMessage("hello"))
+
+	entries := alice.Outbox()
+	assertEquals(t, len(entries), 1)
+	assertEquals(t, entries[0].Kind, OutboxSent)
+	assertDeepEquals(t, entries[0].Message, []byte("hello"))
+}
+
+func Test_Outbox_dropsTheOldestMessagesWhenItIsFull(t *testing.T) {
+	alice, _ := benchmarkConversations()
+	alice.Policies.RequireEncryption()
+	assertNil(t, alice.SetOutboxLimits(OutboxLimits{MaxMessages: 2}))
+	events := recordMessageEvents(alice)
+
+	alice.Send(ValidMessage("one"), 1)
+	alice.Send(ValidMessage("two"), 2)
+	alice.Send(ValidMessage("three"), 3)
+
+	assertDeepEquals(t, pendingWithoutMetadata(alice), []messageToResend{
+		messageToResend{m: MessagePlaintext("two"), opaque: []interface{}{2}},
+		messageToResend{m: MessagePlaintext("three"), opaque: []interface{}{3}},
+	})
+	assertTrue(t, containsMessageEvent(*events, recordedMessageEvent{MessageEventQueuedMessageNotSent, "one", errOutboxFull, []interface{}{1}}))
+}
+
+func Test_Outbox_dropsMessagesOlderThanTheMaximumAge(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+	alice, _ := benchmarkConversations()
+	alice.SetClock(clock)
+	alice.Policies.RequireEncryption()
+	assertNil(t, alice.SetOutboxLimits(OutboxLimits{MaxAge: time.Hour}))
+	events := recordMessageEvents(alice)
+
+	alice.Send(ValidMessage("old"), 1)
+	clock.advance(2 * time.Hour)
+	alice.Send(ValidMessage("new"), 2)
+
+	assertDeepEquals(t, pendingWithoutMetadata(alice), []messageToResend{
+		messageToResend{m: MessagePlaintext("new"), opaque: []interface{}{2}},
+	})
+	assertTrue(t, containsMessageEvent(*events, recordedMessageEvent{MessageEventQueuedMessageNotSent, "old", errOutboxMessageExpired, []interface{}{1}}))
+}
+
+func Test_Outbox_doesntDropOrSignalAnything(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+	alice, _ := benchmarkConversations()
+	alice.SetClock(clock)
+	alice.Policies.RequireEncryption()
+	assertNil(t, alice.SetOutboxLimits(OutboxLimits{MaxAge: time.Hour}))
+	alice.Send(ValidMessage("old"), 1)
+	events := recordMessageEvents(alice)
+	clock.advance(2 * time.Hour)
+
+	alice.Outbox()
+	entries := alice.Outbox()
+
+	assertEquals(t, len(entries), 1)
+	assertEquals(t, len(*events), 0)
+}
+
+func Test_Receive_dropsMessagesOlderThanTheMaximumAgeFromTheOutbox(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+	alice, _ := benchmarkConversations()
+	alice.SetClock(clock)
+	alice.Policies.RequireEncryption()
+	assertNil(t, alice.SetOutboxLimits(OutboxLimits{MaxAge: time.Hour}))
+	events := recordMessageEvents(alice)
+	alice.Send(ValidMessage("old"), 1)
+	clock.advance(2 * time.Hour)
+
+	alice.Receive(ValidMessage("hello"))
+
+	assertEquals(t, len(alice.Outbox()), 0)
+	assertTrue(t, containsMessageEvent(*events, recordedMessageEvent{MessageEventQueuedMessageNotSent, "old", errOutboxMessageExpired, []interface{}{1}}))
+}
+
+func Test_Outbox_keepsSentMessagesBoundedDuringALongSession(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	assertNil(t, alice.SetOutboxLimits(OutboxLimits{MaxMessages: 10}))
+
+	for i := 0; i < 50; i++ {
+		alice.Send(ValidMessage("hello"))
+	}
+
+	assertEquals(t, len(alice.resend.pending()), 10)
+}
+
+func Test_ClearOutbox_signalsTheQueuedMessagesAsNotSent(t *testing.T) {
+	alice, _ := benchmarkConversations()
+	alice.Policies.RequireEncryption()
+	events := recordMessageEvents(alice)
+
+	alice.Send(ValidMessage("hello"), 1)
+	alice.ClearOutbox()
+
+	assertEquals(t, len(alice.resend.pending()), 0)
+	assertTrue(t, containsMessageEvent(*events, recordedMessageEvent{MessageEventQueuedMessageNotSent, "hello", errOutboxCleared, []interface{}{1}}))
+}
+
+func Test_OutboxKind_String(t *testing.T) {
+	assertEquals(t, OutboxQueued.String(), "OutboxQueued")
+	assertEquals(t, OutboxSent.String(), "OutboxSent")
+	assertEquals(t, OutboxAKE.String(), "OutboxAKE")
+	assertEquals(t, OutboxKind(42).String(), "OUTBOX KIND: (THIS SHOULD NEVER HAPPEN)")
+}
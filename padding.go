@@ -1,5 +1,54 @@
 package otr3
 
+// Padding describes how the plaintext of outgoing data messages is padded with a padding TLV,
+// so the length of an encrypted data message says less about the length of what was said
+type Padding struct {
+	// Disabled turns padding off, so data messages are only as long as their content
+	Disabled bool
+	// Buckets are the sizes, in increasing order, that the plaintext is padded up to.
+	// A plaintext longer than the largest bucket is padded up to a multiple of it.
+	// Without buckets, the plaintext is padded up to a multiple of 256 bytes
+	Buckets []uint16
+}
+
+// SetPadding sets how the plaintext of outgoing data messages is padded.
+// It returns an error if the buckets are not positive and in increasing order.
+func (c *Conversation) SetPadding(p Padding) error {
+	for i, b := range p.Buckets {
+		if b == 0 || (i > 0 && b <= p.Buckets[i-1]) {
+			return errInvalidPaddingBuckets
+		}
+	}
+
+	p.Buckets = append([]uint16(nil), p.Buckets...)
+	c.padding = p
+	return nil
+}
+
+// Padding returns how the plaintext of outgoing data messages is padded
+func (c *Conversation) Padding() Padding {
+	p := c.padding
+	p.Buckets = append([]uint16(nil), p.Buckets...)
+	return p
+}
+
+// paddingLength returns how many bytes of padding to add to a plaintext of the given size,
+// which includes the header of the padding TLV
+func (p Padding) paddingLength(size int) int {
+	if len(p.Buckets) == 0 {
+		return paddingGranularity - (size % paddingGranularity)
+	}
+
+	for _, b := range p.Buckets {
+		if size <= int(b) {
+			return int(b) - size
+		}
+	}
+
+	largest := int(p.Buckets[len(p.Buckets)-1])
+	return (largest - size%largest) % largest
+}
+
 func (c *Conversation) processPaddingTLV(tlv, dataMessageExtra) (toSend *tlv, err error) {
 	return nil, nil
 }
@@ -0,0 +1,72 @@
+package otr3
+
+import "testing"
+
+func Test_SetPadding_returnsErrorForBucketsThatAreNotIncreasing(t *testing.T) {
+	c := &Conversation{}
+
+	assertEquals(t, c.SetPadding(Padding{Buckets: []uint16{512, 256}}), errInvalidPaddingBuckets)
+	assertEquals(t, c.SetPadding(Padding{Buckets: []uint16{256, 256}}), errInvalidPaddingBuckets)
+	assertEquals(t, c.SetPadding(Padding{Buckets: []uint16{0, 256}}), errInvalidPaddingBuckets)
+	assertDeepEquals(t, c.Padding(), Padding{})
+}
+
+func Test_SetPadding_setsThePadding(t *testing.T) {
+	c := &Conversation{}
+	buckets := []uint16{160, 1024}
+
+	assertNil(t, c.SetPadding(Padding{Buckets: buckets}))
+	buckets[0] = 1
+
+	assertDeepEquals(t, c.Padding(), Padding{Buckets: []uint16{160, 1024}})
+}
+
+func Test_pad_padsUpToTheSmallestBucketThatFits(t *testing.T) {
+	plain := plainDataMsg{
+		message: []byte("123456"),
+		tlvs:    []tlv{smpMessageAbort{}.tlv()},
+		padding: Padding{Buckets: []uint16{10, 100, 1000}},
+	}
+
+	assertEquals(t, len(plain.pad().serialize()), 100)
+}
+
+func Test_pad_padsUpToAMultipleOfTheLargestBucket(t *testing.T) {
+	plain := plainDataMsg{
+		message: make([]byte, 250),
+		padding: Padding{Buckets: []uint16{64, 128}},
+	}
+
+	assertEquals(t, len(plain.pad().serialize()), 256)
+
+	plain.message = make([]byte, 251)
+	assertEquals(t, len(plain.pad().serialize()), 256)
+
+	plain.message = make([]byte, 252)
+	assertEquals(t, len(plain.pad().serialize()), 384)
+}
+
+func Test_pad_doesntPadWhenDisabled(t *testing.T) {
+	plain := plainDataMsg{
+		message: []byte("123456"),
+		padding: Padding{Disabled: true},
+	}
+
+	assertEquals(t, len(plain.pad().tlvs), 0)
+	assertEquals(t, len(plain.pad().serialize()), 7)
+}
+
+func Test_Send_padsDataMessagesToTheBucketsOfTheConversation(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	alice.SetPadding(Padding{Buckets: []uint16{512}})
+
+	short, _ := alice.Send(ValidMessage("hi"))
+	long, _ := alice.Send(ValidMessage("a somewhat longer message"))
+
+	assertEquals(t, len(short[0]), len(long[0]))
+
+	plain, _, err := bob.Receive(long[0])
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("a somewhat longer message"))
+}
@@ -0,0 +1,23 @@
+package otr3
+
+// containPanic is deferred by the entry points that process messages. If the
+// ContainPanics policy is set, a panic caused by a malformed message or by a
+// bug in this library is turned into an error and a MessageEventInternalError,
+// instead of taking down the whole process. Without the policy the panic is
+// left alone.
+func (c *Conversation) containPanic(err *error) {
+	if !c.Policies.Has(PolicyContainPanics) {
+		return
+	}
+
+	r := recover()
+	if r == nil {
+		return
+	}
+
+	// Whatever was being reassembled might be what caused the panic
+	c.dropFragments()
+
+	*err = newOtrErrorf("internal error while processing message: %v", r)
+	c.messageEventWithError(MessageEventInternalError, *err)
+}
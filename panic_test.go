@@ -0,0 +1,70 @@
+package otr3
+
+import "testing"
+
+type panickingReader struct{}
+
+func (panickingReader) Read(p []byte) (int, error) {
+	panic("the random source exploded")
+}
+
+func Test_Receive_returnsAnErrorInsteadOfPanickingWhenContainingPanics(t *testing.T) {
+	c := newConversation(otrV3{}, panickingReader{})
+	c.Policies.Add(PolicyAllowV3)
+	c.Policies.ContainPanics()
+
+	var err error
+	c.expectMessageEvent(t, func() {
+		_, _, err = c.Receive(ValidMessage("?OTRv3?"))
+	}, MessageEventInternalError, nil, newOtrError("internal error while processing message: the random source exploded"))
+
+	assertEquals(t, err, newOtrError("internal error while processing message: the random source exploded"))
+}
+
+type panickingWriter struct{}
+
+func (panickingWriter) Write(p []byte) (int, error) {
+	panic("the output exploded")
+}
+
+func Test_Send_returnsAnErrorInsteadOfPanickingWhenContainingPanics(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.theirKey = alicePrivateKey.PublicKey()
+	c.Policies.Add(PolicyAllowV3)
+	c.Policies.ContainPanics()
+	c.debug = true
+
+	originalStdErr := standardErrorOutput
+	standardErrorOutput = panickingWriter{}
+	defer func() {
+		standardErrorOutput = originalStdErr
+	}()
+
+	toSend, err := c.Send(ValidMessage("hel?OTR!lo"))
+
+	assertNil(t, toSend)
+	assertEquals(t, err, newOtrError("internal error while processing message: the output exploded"))
+}
+
+func Test_Receive_forgetsFragmentsAfterAContainedPanic(t *testing.T) {
+	c := newConversation(otrV3{}, panickingReader{})
+	c.Policies.Add(PolicyAllowV3)
+	c.Policies.ContainPanics()
+	c.fragmentationContext = fragmentationContext{frag: []byte("?OTRv"), currentIndex: 1, currentLen: 2}
+
+	c.Receive(ValidMessage("?OTRv3?"))
+
+	assertDeepEquals(t, c.fragmentationContext, forgetFragment())
+}
+
+func Test_Receive_doesntContainPanicsWithoutThePolicy(t *testing.T) {
+	c := newConversation(otrV3{}, panickingReader{})
+	c.Policies.Add(PolicyAllowV3)
+
+	defer func() {
+		assertEquals(t, recover(), "the random source exploded")
+	}()
+
+	c.Receive(ValidMessage("?OTRv3?"))
+	t.Errorf("expected Receive to panic")
+}
@@ -0,0 +1,157 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"testing"
+)
+
+// failingReader reads from r until failAt reads have been made, and fails every read after that
+type failingReader struct {
+	r             io.Reader
+	reads, failAt int
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	if f.reads >= f.failAt {
+		return 0, io.ErrUnexpectedEOF
+	}
+	f.reads++
+	return f.r.Read(p)
+}
+
+type conversationSnapshot struct {
+	akeState             string
+	akeKeyID             uint32
+	ourKeyID, theirKeyID uint32
+	ssid                 [8]byte
+	msgState             msgState
+	counters             []keyPairCounter
+	oldMACKeys           int
+}
+
+func snapshotOf(c *Conversation) conversationSnapshot {
+	s := conversationSnapshot{
+		ourKeyID:   c.keys.ourKeyID,
+		theirKeyID: c.keys.theirKeyID,
+		ssid:       c.ssid,
+		msgState:   c.msgState,
+		oldMACKeys: len(c.keys.oldMACKeys),
+	}
+	// A missing AKE and one that hasn't started are the same thing
+	var state authState = authStateNone{}
+	if c.ake != nil {
+		if c.ake.state != nil {
+			state = c.ake.state
+		}
+		s.akeKeyID = c.ake.keys.ourKeyID
+	}
+	s.akeState = fmt.Sprintf("%T", state)
+	for _, ctr := range c.keys.counterHistory.counters {
+		s.counters = append(s.counters, *ctr)
+	}
+	return s
+}
+
+// assertFailuresLeaveNoTrace runs the step with randomness that fails at every point it is read in turn.
+// Every failure must leave the conversation exactly as it was, so running the step again afterwards succeeds.
+func assertFailuresLeaveNoTrace(t *testing.T, setup func() (*Conversation, func() ([]ValidMessage, error))) {
+	for failAt := 0; failAt < 100; failAt++ {
+		c, step := setup()
+		c.Rand = &failingReader{r: rand.Reader, failAt: failAt}
+		before := snapshotOf(c)
+
+		toSend, err := step()
+		c.Rand = rand.Reader
+		if err == nil {
+			if failAt == 0 {
+				t.Errorf("the step doesn't use any randomness")
+			}
+			return
+		}
+
+		assertDeepEquals(t, len(toSend), 0)
+		assertDeepEquals(t, snapshotOf(c), before)
+
+		_, err = step()
+		assertNil(t, err)
+	}
+
+	t.Errorf("the step keeps failing")
+}
+
+func receiveStep(c *Conversation, m ValidMessage) func() ([]ValidMessage, error) {
+	return func() ([]ValidMessage, error) {
+		_, toSend, err := c.Receive(m)
+		return toSend, err
+	}
+}
+
+// akeUntil runs an AKE started by alice, and returns the message number n that is sent during it,
+// without delivering it
+func akeUntil(n int) (alice, bob *Conversation, msg ValidMessage) {
+	alice, bob = benchmarkConversations()
+	msg = bob.QueryMessage()
+	from, to := bob, alice
+	for i := 0; i < n; i++ {
+		_, toSend, err := to.Receive(msg)
+		if err != nil {
+			panic(err)
+		}
+		msg = toSend[0]
+		from, to = to, from
+	}
+	return alice, bob, msg
+}
+
+func Test_failingRandomness_whenSendingTheDHCommitMessage(t *testing.T) {
+	assertFailuresLeaveNoTrace(t, func() (*Conversation, func() ([]ValidMessage, error)) {
+		alice, _, query := akeUntil(0)
+		return alice, receiveStep(alice, query)
+	})
+}
+
+func Test_failingRandomness_whenSendingTheDHKeyMessage(t *testing.T) {
+	assertFailuresLeaveNoTrace(t, func() (*Conversation, func() ([]ValidMessage, error)) {
+		_, bob, dhCommit := akeUntil(1)
+		return bob, receiveStep(bob, dhCommit)
+	})
+}
+
+func Test_failingRandomness_whenSendingTheRevealSignatureMessage(t *testing.T) {
+	assertFailuresLeaveNoTrace(t, func() (*Conversation, func() ([]ValidMessage, error)) {
+		alice, _, dhKey := akeUntil(2)
+		return alice, receiveStep(alice, dhKey)
+	})
+}
+
+func Test_failingRandomness_whenSendingTheSignatureMessage(t *testing.T) {
+	assertFailuresLeaveNoTrace(t, func() (*Conversation, func() ([]ValidMessage, error)) {
+		_, bob, revealSig := akeUntil(3)
+		return bob, receiveStep(bob, revealSig)
+	})
+}
+
+func Test_failingRandomness_whenReceivingTheSignatureMessage(t *testing.T) {
+	assertFailuresLeaveNoTrace(t, func() (*Conversation, func() ([]ValidMessage, error)) {
+		alice, _, sig := akeUntil(4)
+		return alice, receiveStep(alice, sig)
+	})
+}
+
+func Test_failingRandomness_whenRotatingKeysForADataMessage(t *testing.T) {
+	assertFailuresLeaveNoTrace(t, func() (*Conversation, func() ([]ValidMessage, error)) {
+		alice, bob, sig := akeUntil(4)
+		exchangeUntilQuiet(t, bob, alice, []ValidMessage{sig})
+
+		// Alice only uses the newest key of bob after bob has told her about it in a data message
+		toBob, _ := alice.Send(ValidMessage("hello"))
+		exchangeUntilQuiet(t, alice, bob, toBob)
+		toAlice, _ := bob.Send(ValidMessage("hi"))
+		exchangeUntilQuiet(t, bob, alice, toAlice)
+		toBob, _ = alice.Send(ValidMessage("how are you?"))
+
+		return bob, receiveStep(bob, toBob[0])
+	})
+}
@@ -0,0 +1,43 @@
+package otr3
+
+import (
+	"bytes"
+	"time"
+)
+
+const defaultRefusedPlaintextReply = "I didn't receive your message, since I only accept encrypted messages. Please start an Off-the-Record private conversation and send it again."
+
+// We only send the reply this often, so that two peers replying to each other can't get stuck in a loop
+const refusedPlaintextReplyInterval = 60 * time.Second
+
+// SetRefusedPlaintextReply sets the text sent to the peer when we receive an unencrypted message
+// while encryption is required. The reply is only sent if the ReplyToRefusedPlaintext policy is set.
+func (c *Conversation) SetRefusedPlaintextReply(msg string) {
+	c.refusedPlaintextReply = msg
+}
+
+func (c *Conversation) refusedPlaintextReplyText() []byte {
+	if c.refusedPlaintextReply == "" {
+		return []byte(defaultRefusedPlaintextReply)
+	}
+	return []byte(c.refusedPlaintextReply)
+}
+
+func (c *Conversation) maybeReplyToRefusedPlaintext(plain MessagePlaintext) {
+	if !c.Policies.Has(PolicyReplyToRefusedPlaintext) {
+		return
+	}
+
+	reply := c.refusedPlaintextReplyText()
+	if bytes.Equal(bytes.TrimSpace(plain), reply) {
+		return
+	}
+
+	now := c.now()
+	if now.Before(c.lastRefusedPlaintextReply.Add(refusedPlaintextReplyInterval)) {
+		return
+	}
+
+	c.lastRefusedPlaintextReply = now
+	c.injectMessage(ValidMessage(reply))
+}
@@ -0,0 +1,74 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+)
+
+func refusingConversation() *Conversation {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.Policies.RequireEncryption()
+	c.Policies.ReplyToRefusedPlaintext()
+	return c
+}
+
+func Test_Receive_repliesToPlaintextWhenEncryptionIsRequired(t *testing.T) {
+	c := refusingConversation()
+
+	_, toSend, err := c.Receive(ValidMessage("hello"))
+
+	assertNil(t, err)
+	assertDeepEquals(t, toSend, []ValidMessage{ValidMessage(defaultRefusedPlaintextReply)})
+}
+
+func Test_Receive_repliesWithTheConfiguredText(t *testing.T) {
+	c := refusingConversation()
+	c.SetRefusedPlaintextReply("Please enable OTR")
+
+	_, toSend, _ := c.Receive(ValidMessage("hello"))
+
+	assertDeepEquals(t, toSend, []ValidMessage{ValidMessage("Please enable OTR")})
+}
+
+func Test_Receive_doesntReplyToPlaintextWithoutThePolicy(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.Policies.RequireEncryption()
+
+	_, toSend, _ := c.Receive(ValidMessage("hello"))
+
+	assertNil(t, toSend)
+}
+
+func Test_Receive_doesntReplyToPlaintextIfEncryptionIsNotRequired(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.Policies.ReplyToRefusedPlaintext()
+
+	_, toSend, _ := c.Receive(ValidMessage("hello"))
+
+	assertNil(t, toSend)
+}
+
+func Test_Receive_onlyRepliesToPlaintextOncePerInterval(t *testing.T) {
+	c := refusingConversation()
+
+	c.Receive(ValidMessage("hello"))
+	_, toSend, _ := c.Receive(ValidMessage("hello again"))
+
+	assertNil(t, toSend)
+
+	c.lastRefusedPlaintextReply = time.Now().Add(-refusedPlaintextReplyInterval)
+	_, toSend, _ = c.Receive(ValidMessage("hello again"))
+
+	assertDeepEquals(t, toSend, []ValidMessage{ValidMessage(defaultRefusedPlaintextReply)})
+}
+
+func Test_Receive_doesntReplyToTheReplyOfThePeer(t *testing.T) {
+	alice := refusingConversation()
+	bob := refusingConversation()
+
+	_, toSend, _ := alice.Receive(ValidMessage("hello"))
+	_, toSend, _ = bob.Receive(toSend[0])
+
+	assertNil(t, toSend)
+}
@@ -1,50 +1,193 @@
 package otr3
 
-type policies int
+import (
+	"fmt"
+	"strings"
+)
+
+// Policies is a set of policies deciding how a conversation behaves.
+// It can be marshaled to and from text - and therefore JSON - as a comma separated list of policy names,
+// so applications can keep the policies for a contact directly in their configuration
+type Policies int
 
-type policy int
+// Policy is a single policy that can be part of Policies
+type Policy int
 
 const (
-	allowV2 policy = 2 << iota
-	allowV3
-	requireEncryption
-	sendWhitespaceTag
-	whitespaceStartAKE
-	errorStartAKE
+	// PolicyAllowV2 allows version 2 of the protocol
+	PolicyAllowV2 Policy = 2 << iota
+	// PolicyAllowV3 allows version 3 of the protocol
+	PolicyAllowV3
+	// PolicyRequireEncryption refuses to send or accept unencrypted messages
+	PolicyRequireEncryption
+	// PolicySendWhitespaceTag advertises support for OTR by adding a whitespace tag to plaintext messages
+	PolicySendWhitespaceTag
+	// PolicyWhitespaceStartAKE starts the AKE when a whitespace tag is received
+	PolicyWhitespaceStartAKE
+	// PolicyErrorStartAKE starts the AKE when an OTR error message is received
+	PolicyErrorStartAKE
+	// PolicyStripHTML removes the HTML markup some clients wrap around received OTR messages, like "<p>?OTRv3?</p>".
+	// Other received messages are left alone
+	PolicyStripHTML
+	// PolicyReplyToRefusedPlaintext answers plaintext refused because of PolicyRequireEncryption with a plaintext reply,
+	// set with SetRefusedPlaintextReply
+	PolicyReplyToRefusedPlaintext
+	// PolicyContainPanics returns panics while handling a message as errors
+	PolicyContainPanics
+	// PolicyStrictSpec rejects data that doesn't follow the specification
+	PolicyStrictSpec
+	// PolicyDeterministicSignatures derives the nonces of the signatures in the AKE from the key and the signed data (RFC 6979),
+	// so a weak or repeating Rand can't reveal our long-term key
+	PolicyDeterministicSignatures
 )
 
-func (p *policies) isOTREnabled() bool {
-	return p.has(allowV2) || p.has(allowV3)
+var policyNames = []struct {
+	p    Policy
+	name string
+}{
+	{PolicyAllowV2, "allow-v2"},
+	{PolicyAllowV3, "allow-v3"},
+	{PolicyRequireEncryption, "require-encryption"},
+	{PolicySendWhitespaceTag, "send-whitespace-tag"},
+	{PolicyWhitespaceStartAKE, "whitespace-start-ake"},
+	{PolicyErrorStartAKE, "error-start-ake"},
+	{PolicyStripHTML, "strip-html"},
+	{PolicyReplyToRefusedPlaintext, "reply-to-refused-plaintext"},
+	{PolicyContainPanics, "contain-panics"},
+	{PolicyStrictSpec, "strict-spec"},
+	{PolicyDeterministicSignatures, "deterministic-signatures"},
+}
+
+// String returns the name of the policy
+func (p Policy) String() string {
+	for _, n := range policyNames {
+		if n.p == p {
+			return n.name
+		}
+	}
+	return fmt.Sprintf("Policy(%d)", int(p))
 }
 
-func (p *policies) has(c policy) bool {
+func (p *Policies) isOTREnabled() bool {
+	return p.Has(PolicyAllowV2) || p.Has(PolicyAllowV3)
+}
+
+// Has returns true if the policy is set
+func (p *Policies) Has(c Policy) bool {
 	return int(*p)&int(c) == int(c)
 }
 
-func (p *policies) add(c policy) {
-	*p = policies(int(*p) | int(c))
+// Add sets the policy
+func (p *Policies) Add(c Policy) {
+	*p = Policies(int(*p) | int(c))
+}
+
+// Remove unsets the policy
+func (p *Policies) Remove(c Policy) {
+	*p = Policies(int(*p) &^ int(c))
+}
+
+// String returns the names of the policies that are set, separated by commas
+func (p Policies) String() string {
+	var names []string
+	for _, n := range policyNames {
+		if p.Has(n.p) {
+			names = append(names, n.name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (p Policies) MarshalText() ([]byte, error) {
+	unknown := p
+	for _, n := range policyNames {
+		unknown.Remove(n.p)
+	}
+	if unknown != 0 {
+		return nil, newOtrErrorf("unknown policies: %d", int(unknown))
+	}
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler. Unknown policy names are an error
+func (p *Policies) UnmarshalText(text []byte) error {
+	result := Policies(0)
+	for _, name := range strings.Split(string(text), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		c, ok := policyNamed(name)
+		if !ok {
+			return newOtrErrorf("unknown policy: %q", name)
+		}
+		result.Add(c)
+	}
+	*p = result
+	return nil
+}
+
+func policyNamed(name string) (Policy, bool) {
+	for _, n := range policyNames {
+		if n.name == name {
+			return n.p, true
+		}
+	}
+	return 0, false
+}
+
+// AllowV2 sets PolicyAllowV2
+func (p *Policies) AllowV2() {
+	p.Add(PolicyAllowV2)
+}
+
+// AllowV3 sets PolicyAllowV3
+func (p *Policies) AllowV3() {
+	p.Add(PolicyAllowV3)
+}
+
+// RequireEncryption sets PolicyRequireEncryption
+func (p *Policies) RequireEncryption() {
+	p.Add(PolicyRequireEncryption)
+}
+
+// SendWhitespaceTag sets PolicySendWhitespaceTag
+func (p *Policies) SendWhitespaceTag() {
+	p.Add(PolicySendWhitespaceTag)
+}
+
+// WhitespaceStartAKE sets PolicyWhitespaceStartAKE
+func (p *Policies) WhitespaceStartAKE() {
+	p.Add(PolicyWhitespaceStartAKE)
 }
 
-func (p *policies) AllowV2() {
-	p.add(allowV2)
+// ErrorStartAKE sets PolicyErrorStartAKE
+func (p *Policies) ErrorStartAKE() {
+	p.Add(PolicyErrorStartAKE)
 }
 
-func (p *policies) AllowV3() {
-	p.add(allowV3)
+// StripHTML sets PolicyStripHTML
+func (p *Policies) StripHTML() {
+	p.Add(PolicyStripHTML)
 }
 
-func (p *policies) RequireEncryption() {
-	p.add(requireEncryption)
+// ReplyToRefusedPlaintext sets PolicyReplyToRefusedPlaintext
+func (p *Policies) ReplyToRefusedPlaintext() {
+	p.Add(PolicyReplyToRefusedPlaintext)
 }
 
-func (p *policies) SendWhitespaceTag() {
-	p.add(sendWhitespaceTag)
+// ContainPanics sets PolicyContainPanics
+func (p *Policies) ContainPanics() {
+	p.Add(PolicyContainPanics)
 }
 
-func (p *policies) WhitespaceStartAKE() {
-	p.add(whitespaceStartAKE)
+// StrictSpec sets PolicyStrictSpec
+func (p *Policies) StrictSpec() {
+	p.Add(PolicyStrictSpec)
 }
 
-func (p *policies) ErrorStartAKE() {
-	p.add(errorStartAKE)
+// DeterministicSignatures sets PolicyDeterministicSignatures
+func (p *Policies) DeterministicSignatures() {
+	p.Add(PolicyDeterministicSignatures)
 }
@@ -0,0 +1,31 @@
+package otr3
+
+// PolicyProvider decides which policies to use for conversations with a specific contact,
+// like the policy callback of libotr. This makes it possible to require encryption for
+// some contacts and be opportunistic with others in the same process.
+type PolicyProvider interface {
+	// ApplyPolicies sets the policies to use for conversations between our account on the given protocol
+	// and the given contact. The policies start out empty.
+	ApplyPolicies(account, protocol, contact string, p PolicySetter)
+}
+
+// PolicySetter is used by a PolicyProvider to set the policies of a conversation
+type PolicySetter interface {
+	AllowV2()
+	AllowV3()
+	RequireEncryption()
+	SendWhitespaceTag()
+	WhitespaceStartAKE()
+	ErrorStartAKE()
+	StripHTML()
+	ReplyToRefusedPlaintext()
+	ContainPanics()
+	StrictSpec()
+	DeterministicSignatures()
+}
+
+func policiesFrom(provider PolicyProvider, account, protocol, contact string) Policies {
+	p := Policies(0)
+	provider.ApplyPolicies(account, protocol, contact, &p)
+	return p
+}
@@ -0,0 +1,69 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+type contactPolicyProvider struct {
+	asked [][3]string
+}
+
+func (p *contactPolicyProvider) ApplyPolicies(account, protocol, contact string, ps PolicySetter) {
+	p.asked = append(p.asked, [3]string{account, protocol, contact})
+
+	ps.AllowV2()
+	ps.AllowV3()
+	if contact == "boss@example.com" {
+		ps.RequireEncryption()
+	}
+	if contact == "auditor@example.com" {
+		ps.DeterministicSignatures()
+	}
+}
+
+func Test_policiesFrom_startsWithNoPoliciesAndAppliesTheProvidedOnes(t *testing.T) {
+	provider := &contactPolicyProvider{}
+
+	p := policiesFrom(provider, "alice@example.com", "xmpp", "boss@example.com")
+
+	assertEquals(t, p, Policies(PolicyAllowV2|PolicyAllowV3|PolicyRequireEncryption))
+	assertDeepEquals(t, provider.asked, [][3]string{{"alice@example.com", "xmpp", "boss@example.com"}})
+}
+
+func Test_policiesFrom_canSetDeterministicSignatures(t *testing.T) {
+	p := policiesFrom(&contactPolicyProvider{}, "alice@example.com", "xmpp", "auditor@example.com")
+
+	assertEquals(t, p, Policies(PolicyAllowV2|PolicyAllowV3|PolicyDeterministicSignatures))
+}
+
+func Test_Manager_SetPolicyProvider_replacesThePoliciesOfTheMaster(t *testing.T) {
+	master := &Conversation{Rand: rand.Reader}
+	master.Policies = Policies(PolicyAllowV2 | PolicySendWhitespaceTag)
+	m := NewManager(master)
+
+	m.SetPolicyProvider(&contactPolicyProvider{}, "alice@example.com", "xmpp", "boss@example.com")
+
+	assertEquals(t, master.Policies, Policies(PolicyAllowV2|PolicyAllowV3|PolicyRequireEncryption))
+}
+
+func Test_Manager_SetPolicyProvider_asksTheProviderForThePoliciesOfNewInstances(t *testing.T) {
+	provider := &contactPolicyProvider{}
+	m := NewManager(&Conversation{Rand: rand.Reader})
+	m.SetPolicyProvider(provider, "alice@example.com", "xmpp", "friend@example.com")
+
+	c, _ := m.instance(0x1234)
+
+	assertEquals(t, c.Policies, Policies(PolicyAllowV2|PolicyAllowV3))
+	assertEquals(t, len(provider.asked), 2)
+}
+
+func Test_Manager_instance_copiesThePoliciesOfTheMasterWithoutAPolicyProvider(t *testing.T) {
+	master := &Conversation{Rand: rand.Reader}
+	master.Policies = Policies(PolicyAllowV3 | PolicyStripHTML)
+	m := NewManager(master)
+
+	c, _ := m.instance(0x1234)
+
+	assertEquals(t, c.Policies, Policies(PolicyAllowV3|PolicyStripHTML))
+}
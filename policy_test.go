@@ -1,41 +1,121 @@
 package otr3
 
-import "testing"
+import (
+	"encoding/json"
+	"testing"
+)
 
 func Test_policies_requireEncryption_addsRequirementOfEncryption(t *testing.T) {
-	p := policies(0)
+	p := Policies(0)
 	p.RequireEncryption()
-	assertEquals(t, p.has(requireEncryption), true)
+	assertEquals(t, p.Has(PolicyRequireEncryption), true)
 }
 
 func Test_policies_sendWhitespaceTag_addsPolicyForSendingWhitespaceTag(t *testing.T) {
-	p := policies(0)
+	p := Policies(0)
 	p.SendWhitespaceTag()
-	assertEquals(t, p.has(sendWhitespaceTag), true)
+	assertEquals(t, p.Has(PolicySendWhitespaceTag), true)
 }
 
 func Test_policies_whitespaceStartAKE_addsWhitespaceStartAKEPolicy(t *testing.T) {
-	p := policies(0)
+	p := Policies(0)
 	p.WhitespaceStartAKE()
-	assertEquals(t, p.has(whitespaceStartAKE), true)
+	assertEquals(t, p.Has(PolicyWhitespaceStartAKE), true)
 }
 
 func Test_policies_errorStartAKE_addsErrorStartAKEPolicy(t *testing.T) {
-	p := policies(0)
+	p := Policies(0)
 	p.ErrorStartAKE()
-	assertEquals(t, p.has(errorStartAKE), true)
+	assertEquals(t, p.Has(PolicyErrorStartAKE), true)
 }
 
 func Test_policies_Allowv2_addsV2Policy(t *testing.T) {
-	p := policies(allowV3)
+	p := Policies(PolicyAllowV3)
 	p.AllowV2()
-	assertEquals(t, p.has(allowV2), true)
-	assertEquals(t, p.has(allowV3), true)
+	assertEquals(t, p.Has(PolicyAllowV2), true)
+	assertEquals(t, p.Has(PolicyAllowV3), true)
 }
 
 func Test_policies_Allowv3_addsV3Policy(t *testing.T) {
-	p := policies(allowV2)
+	p := Policies(PolicyAllowV2)
 	p.AllowV3()
-	assertEquals(t, p.has(allowV3), true)
-	assertEquals(t, p.has(allowV2), true)
+	assertEquals(t, p.Has(PolicyAllowV3), true)
+	assertEquals(t, p.Has(PolicyAllowV2), true)
+}
+
+func Test_policies_ContainPanics_addsContainPanicsPolicy(t *testing.T) {
+	p := Policies(0)
+	p.ContainPanics()
+	assertEquals(t, p.Has(PolicyContainPanics), true)
+}
+
+func Test_policies_StrictSpec_addsStrictSpecPolicy(t *testing.T) {
+	p := Policies(0)
+	p.StrictSpec()
+	assertEquals(t, p.Has(PolicyStrictSpec), true)
+}
+
+func Test_policies_DeterministicSignatures_addsDeterministicSignaturesPolicy(t *testing.T) {
+	p := Policies(0)
+	p.DeterministicSignatures()
+	assertEquals(t, p.Has(PolicyDeterministicSignatures), true)
+}
+
+func Test_policies_Remove_removesOnlyThatPolicy(t *testing.T) {
+	p := Policies(0)
+	p.AllowV3()
+	p.RequireEncryption()
+	p.Remove(PolicyRequireEncryption)
+	assertFalse(t, p.Has(PolicyRequireEncryption))
+	assertTrue(t, p.Has(PolicyAllowV3))
+}
+
+func Test_policies_MarshalText_returnsTheNamesOfThePolicies(t *testing.T) {
+	p := Policies(0)
+	p.AllowV3()
+	p.RequireEncryption()
+	text, err := p.MarshalText()
+	assertNil(t, err)
+	assertEquals(t, string(text), "allow-v3,require-encryption")
+}
+
+func Test_policies_MarshalText_returnsErrorForUnknownPolicies(t *testing.T) {
+	p := Policies(1)
+	_, err := p.MarshalText()
+	assertEquals(t, err, newOtrError("unknown policies: 1"))
+}
+
+func Test_policies_UnmarshalText_readsTheNamesOfThePolicies(t *testing.T) {
+	p := Policies(PolicyStrictSpec)
+	err := p.UnmarshalText([]byte("allow-v2, allow-v3,error-start-ake"))
+	assertNil(t, err)
+	assertEquals(t, p, Policies(PolicyAllowV2|PolicyAllowV3|PolicyErrorStartAKE))
+}
+
+func Test_policies_UnmarshalText_returnsErrorForUnknownNames(t *testing.T) {
+	p := Policies(PolicyStrictSpec)
+	err := p.UnmarshalText([]byte("allow-v3,allow-v4"))
+	assertEquals(t, err, newOtrError("unknown policy: \"allow-v4\""))
+	assertEquals(t, p, Policies(PolicyStrictSpec))
+}
+
+func Test_policies_canBeKeptInJSON(t *testing.T) {
+	type config struct {
+		Policies Policies
+	}
+	c := config{}
+	c.Policies.AllowV3()
+	c.Policies.StripHTML()
+
+	data, _ := json.Marshal(c)
+	assertEquals(t, string(data), `{"Policies":"allow-v3,strip-html"}`)
+
+	read := config{}
+	assertNil(t, json.Unmarshal(data, &read))
+	assertEquals(t, read.Policies, c.Policies)
+}
+
+func Test_Policy_String_returnsTheNameOfThePolicy(t *testing.T) {
+	assertEquals(t, PolicyReplyToRefusedPlaintext.String(), "reply-to-refused-plaintext")
+	assertEquals(t, Policy(1).String(), "Policy(1)")
 }
@@ -33,13 +33,13 @@ func parseOTRQueryMessage(msg ValidMessage) []int {
 	return ret
 }
 
-func extractVersionsFromQueryMessage(p policies, msg ValidMessage) int {
+func extractVersionsFromQueryMessage(p Policies, msg ValidMessage) int {
 	versions := 0
 	for _, v := range parseOTRQueryMessage(msg) {
 		switch {
-		case v == 3 && p.has(allowV3):
+		case v == 3 && p.Has(PolicyAllowV3):
 			versions |= (1 << 3)
-		case v == 2 && p.has(allowV2):
+		case v == 2 && p.Has(PolicyAllowV2):
 			versions |= (1 << 2)
 		}
 	}
@@ -47,22 +47,28 @@ func extractVersionsFromQueryMessage(p policies, msg ValidMessage) int {
 	return versions
 }
 
-var timeoutLength = time.Duration(1) * time.Minute
-
-func isWithinTimeToIgnoreQueryMessage(t time.Time) bool {
-	return t.Add(timeoutLength).After(time.Now())
-
+func (c *Conversation) isWithinTimeToIgnoreQueryMessage(t time.Time) bool {
+	return t.Add(c.TransportProfile().AKETimeout).After(c.now())
 }
 
 func (c *Conversation) receiveQueryMessage(msg ValidMessage) ([]messageWithHeader, error) {
+	if !isConformantQueryMessage(msg) {
+		if err := c.nonConformant(errNonConformantQueryMessage); err != nil {
+			return nil, err
+		}
+	}
+
 	versions := extractVersionsFromQueryMessage(c.Policies, msg)
-	err := c.commitToVersionFrom(versions)
+	err := c.resolveVersionFrom(versions)
+	if err == errUnsupportedOTRVersion {
+		return nil, c.refuseUnsupportedVersion()
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	if dontIgnoreFastRepeatQueryMessage != "true" && ((c.msgState == encrypted && isWithinTimeToIgnoreQueryMessage(c.lastMessageStateChange)) ||
-		(c.ake != nil && isWithinTimeToIgnoreQueryMessage(c.ake.lastStateChange))) {
+	if dontIgnoreFastRepeatQueryMessage != "true" && ((c.msgState == encrypted && c.isWithinTimeToIgnoreQueryMessage(c.lastMessageStateChange)) ||
+		(c.ake != nil && c.isWithinTimeToIgnoreQueryMessage(c.ake.lastStateChange))) {
 		return nil, nil
 	}
 
@@ -70,15 +76,16 @@ func (c *Conversation) receiveQueryMessage(msg ValidMessage) ([]messageWithHeade
 	return c.potentialAuthError(compactMessagesWithHeader(ts), err)
 }
 
-//QueryMessage will return a QueryMessage determined by Conversation Policies
-func (c Conversation) QueryMessage() ValidMessage {
+//QueryMessage will return a QueryMessage determined by Conversation Policies,
+//followed by the friendly query message if one has been set
+func (c *Conversation) QueryMessage() ValidMessage {
 	queryMessage := []byte("?OTRv")
 
-	if c.Policies.has(allowV2) {
+	if c.Policies.Has(PolicyAllowV2) {
 		queryMessage = append(queryMessage, '2')
 	}
 
-	if c.Policies.has(allowV3) {
+	if c.Policies.Has(PolicyAllowV3) {
 		queryMessage = append(queryMessage, '3')
 	}
 
@@ -90,7 +97,13 @@ func (c Conversation) QueryMessage() ValidMessage {
 	return append(queryMessage, suffix...)
 }
 
-//SetFriendlyQueryMessage will set a new message as query message
+//SetFriendlyQueryMessage will set the human readable text that follows the query message.
+//Clients that don't support OTR will show this text, so it should invite the peer to get an OTR capable client
 func (c *Conversation) SetFriendlyQueryMessage(msg string) {
 	c.friendlyQueryMessage = msg
 }
+
+//FriendlyQueryMessage returns the human readable text that follows the query message
+func (c *Conversation) FriendlyQueryMessage() string {
+	return c.friendlyQueryMessage
+}
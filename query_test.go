@@ -5,7 +5,7 @@ import "testing"
 func Test_receiveQueryMessage_sendDHCommitv3AndTransitToStateAwaitingDHKey(t *testing.T) {
 	queryMsg := []byte("?OTRv?23?")
 
-	c := &Conversation{Policies: policies(allowV3)}
+	c := &Conversation{Policies: Policies(PolicyAllowV3)}
 	c.SetOurKeys([]PrivateKey{bobPrivateKey})
 	msg, err := c.receiveQueryMessage(queryMsg)
 
@@ -18,7 +18,7 @@ func Test_receiveQueryMessage_sendDHCommitv3AndTransitToStateAwaitingDHKey(t *te
 func Test_receiveQueryMessageV2_sendDHCommitv2(t *testing.T) {
 	queryMsg := []byte("?OTRv?23?")
 
-	c := &Conversation{Policies: policies(allowV2)}
+	c := &Conversation{Policies: Policies(PolicyAllowV2)}
 	c.SetOurKeys([]PrivateKey{bobPrivateKey})
 	msg, err := c.receiveQueryMessage(queryMsg)
 
@@ -31,7 +31,7 @@ func Test_receiveQueryMessageV2_sendDHCommitv2(t *testing.T) {
 func Test_receiveQueryMessageV2V3_sendDHCommitv3WhenV2AndV3AreAllowed(t *testing.T) {
 	queryMsg := []byte("?OTRv?23?")
 
-	c := &Conversation{Policies: policies(allowV2 | allowV3)}
+	c := &Conversation{Policies: Policies(PolicyAllowV2 | PolicyAllowV3)}
 	c.SetOurKeys([]PrivateKey{bobPrivateKey})
 	msg, err := c.receiveQueryMessage(queryMsg)
 
@@ -64,22 +64,30 @@ func Test_receiveQueryMessage_signalsMessageEventOnFailure(t *testing.T) {
 
 	c := newConversation(nil, fixedRand([]string{"ABCD"}))
 	c.SetOurKeys([]PrivateKey{bobPrivateKey})
-	c.Policies.add(allowV3)
+	c.Policies.Add(PolicyAllowV3)
 	c.expectMessageEvent(t, func() {
 		c.receiveQueryMessage(queryMsg)
 	}, MessageEventSetupError, nil, errShortRandomRead)
 }
 
 func Test_receiveQueryMessage_returnsErrorIfNoCompatibleVersionCouldBeFound(t *testing.T) {
-	c := &Conversation{Policies: policies(allowV3)}
+	c := &Conversation{Policies: Policies(PolicyAllowV3)}
 	c.SetOurKeys([]PrivateKey{bobPrivateKey})
 	_, err := c.receiveQueryMessage([]byte("?OTRv?2?"))
 	assertEquals(t, err, errUnsupportedOTRVersion)
 }
 
+func Test_receiveQueryMessage_signalsThatThePeerRequiresAnUnsupportedVersionIfItOnlyOffersVersion1(t *testing.T) {
+	c := &Conversation{Policies: Policies(PolicyAllowV2 | PolicyAllowV3)}
+	c.SetOurKeys([]PrivateKey{bobPrivateKey})
+	c.expectMessageEvent(t, func() {
+		c.receiveQueryMessage([]byte("?OTR?"))
+	}, MessageEventPeerRequiresUnsupportedVersion, nil, nil)
+}
+
 func Test_receiveQueryMessage_returnsErrorIfDhCommitMessageGeneratesError(t *testing.T) {
 	c := &Conversation{
-		Policies: policies(allowV2),
+		Policies: Policies(PolicyAllowV2),
 		Rand:     fixedRand([]string{"ABCDABCD"}),
 	}
 	c.SetOurKeys([]PrivateKey{bobPrivateKey})
@@ -105,7 +113,7 @@ func Test_parseOTRQueryMessage(t *testing.T) {
 }
 
 func Test_extractVersionsFromQueryMessage_returnsNilForUnsupportedVersions(t *testing.T) {
-	p := policies(0)
+	p := Policies(0)
 	msg := []byte("?OTR?")
 	versions := extractVersionsFromQueryMessage(p, msg)
 
@@ -114,7 +122,7 @@ func Test_extractVersionsFromQueryMessage_returnsNilForUnsupportedVersions(t *te
 
 func Test_extractVersionsFromQueryMessage_acceptsBothV2AndV3IfThePolicyAllows(t *testing.T) {
 	msg := []byte("?OTRv32?")
-	p := policies(allowV2 | allowV3)
+	p := Policies(PolicyAllowV2 | PolicyAllowV3)
 	versions := extractVersionsFromQueryMessage(p, msg)
 
 	assertEquals(t, versions, 1<<2|1<<3)
@@ -122,19 +130,30 @@ func Test_extractVersionsFromQueryMessage_acceptsBothV2AndV3IfThePolicyAllows(t
 
 func Test_extractVersionsFromQueryMessage_acceptsOTRV2IfHasOnlyAllowV2Policy(t *testing.T) {
 	msg := []byte("?OTRv32?")
-	p := policies(allowV2)
+	p := Policies(PolicyAllowV2)
 	versions := extractVersionsFromQueryMessage(p, msg)
 
 	assertEquals(t, versions, 1<<2)
 }
 
 func Test_QueryMessage_returnsARegularQueryMessage(t *testing.T) {
-	c := &Conversation{Policies: policies(allowV3)}
+	c := &Conversation{Policies: Policies(PolicyAllowV3)}
 	assertEquals(t, string(c.QueryMessage()), "?OTRv3?")
 }
 
 func Test_QueryMessage_returnsAQueryMessageWithExtraMessage(t *testing.T) {
-	c := &Conversation{Policies: policies(allowV3)}
+	c := &Conversation{Policies: Policies(PolicyAllowV3)}
 	c.SetFriendlyQueryMessage("hello foobarium")
 	assertEquals(t, string(c.QueryMessage()), "?OTRv3? hello foobarium")
 }
+
+func Test_QueryMessage_advertisesTheVersionsOfThePoliciesBeforeTheExtraMessage(t *testing.T) {
+	c := &Conversation{Policies: Policies(PolicyAllowV2 | PolicyAllowV3)}
+	c.SetFriendlyQueryMessage("I'd like to chat privately")
+
+	msg := c.QueryMessage()
+
+	assertEquals(t, string(msg), "?OTRv23? I'd like to chat privately")
+	assertEquals(t, extractVersionsFromQueryMessage(c.Policies, msg), 1<<2|1<<3)
+	assertEquals(t, c.FriendlyQueryMessage(), "I'd like to chat privately")
+}
@@ -10,11 +10,17 @@ func (c *Conversation) rand() io.Reader {
 	if c.Rand != nil {
 		return c.Rand
 	}
-	return rand.Reader
+	if c.defaultRand == nil {
+		c.defaultRand = NewHealthCheckedReader(rand.Reader)
+	}
+	return c.defaultRand
 }
 
 func randomInto(r io.Reader, b []byte) error {
 	if _, err := io.ReadFull(r, b); err != nil {
+		if err == errRandomSourceUnhealthy {
+			return err
+		}
 		return errShortRandomRead
 	}
 	return nil
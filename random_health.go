@@ -0,0 +1,96 @@
+package otr3
+
+import (
+	"crypto/sha256"
+	"io"
+	"sync"
+)
+
+// healthCheckBlockSize is the size of the samples compared by the continuous health test.
+// Two samples of this size from a working source are equal with a probability of 2^-128
+const healthCheckBlockSize = 16
+
+// HealthCheckedReader is a source of randomness that continuously tests the source it reads from.
+// Every read also reads a sample of 16 bytes that is only used for the test - it is compared to the sample of the
+// read before, and if they are the same, or the source returns an error or a short read, the source is considered
+// broken. The output itself is never kept, and only a hash of the last sample is. Once the source is broken every
+// read fails with the same error until Reset is called, since a broken source can't be trusted to have recovered
+// on its own. A Conversation that has no Rand set uses one of its own, wrapping crypto/rand.
+// It is safe to share between goroutines.
+type HealthCheckedReader struct {
+	sync.Mutex
+	source io.Reader
+	// lastSample is the hash of the sample read last, valid if hasSample is true
+	lastSample [sha256.Size]byte
+	hasSample  bool
+	err        error
+}
+
+// NewHealthCheckedReader returns a reader that tests the given source of randomness while reading from it
+func NewHealthCheckedReader(source io.Reader) *HealthCheckedReader {
+	return &HealthCheckedReader{source: source}
+}
+
+// Read fills p from the source, or fails with an error if the source failed this time or before
+func (r *HealthCheckedReader) Read(p []byte) (int, error) {
+	r.Lock()
+	defer r.Unlock()
+
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	if !r.hasSample {
+		if r.err = r.sample(); r.err != nil {
+			return 0, r.err
+		}
+	}
+
+	if _, err := io.ReadFull(r.source, p); err != nil {
+		r.err = errRandomSourceUnhealthy
+		return 0, r.err
+	}
+
+	if r.err = r.sample(); r.err != nil {
+		wipeBytes(p)
+		return 0, r.err
+	}
+
+	return len(p), nil
+}
+
+// sample reads a new sample from the source and compares it to the one before
+func (r *HealthCheckedReader) sample() error {
+	var sample [healthCheckBlockSize]byte
+	defer wipeBytes(sample[:])
+
+	if _, err := io.ReadFull(r.source, sample[:]); err != nil {
+		return errRandomSourceUnhealthy
+	}
+
+	hash := sha256.Sum256(sample[:])
+	if r.hasSample && hash == r.lastSample {
+		return errRandomSourceUnhealthy
+	}
+	r.lastSample, r.hasSample = hash, true
+
+	return nil
+}
+
+// Reset makes the reader use the source again after it has failed, and starts the health test over.
+// It should only be called once the reason the source failed is known to be gone.
+func (r *HealthCheckedReader) Reset() {
+	r.Lock()
+	defer r.Unlock()
+
+	r.err = nil
+	r.hasSample = false
+}
+
+// Err returns the error every read fails with because the source has failed, or nil if it is healthy
+func (r *HealthCheckedReader) Err() error {
+	r.Lock()
+	defer r.Unlock()
+
+	return r.err
+}
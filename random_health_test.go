@@ -0,0 +1,115 @@
+package otr3
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+)
+
+func Test_HealthCheckedReader_readsFromAHealthySource(t *testing.T) {
+	r := NewHealthCheckedReader(rand.Reader)
+	var buf [64]byte
+
+	n, err := r.Read(buf[:])
+
+	assertNil(t, err)
+	assertEquals(t, n, 64)
+	assertNil(t, r.Err())
+}
+
+func Test_HealthCheckedReader_failsForGoodWhenTheSourceRepeatsASample(t *testing.T) {
+	r := NewHealthCheckedReader(bytes.NewReader(make([]byte, 64)))
+	var buf [32]byte
+
+	_, err := r.Read(buf[:])
+	assertEquals(t, err, errRandomSourceUnhealthy)
+
+	_, err = r.Read(buf[:1])
+	assertEquals(t, err, errRandomSourceUnhealthy)
+	assertEquals(t, r.Err(), errRandomSourceUnhealthy)
+}
+
+func Test_HealthCheckedReader_testsReadsShorterThanASample(t *testing.T) {
+	r := NewHealthCheckedReader(bytes.NewReader(bytes.Repeat([]byte{0x42}, 2*healthCheckBlockSize+1)))
+	buf := []byte{0x01}
+
+	_, err := r.Read(buf)
+
+	assertEquals(t, err, errRandomSourceUnhealthy)
+	assertDeepEquals(t, buf, []byte{0x00})
+}
+
+func Test_HealthCheckedReader_comparesTheSampleToTheSampleOfTheReadBefore(t *testing.T) {
+	first := bytes.Repeat([]byte{0x41}, healthCheckBlockSize)
+	second := bytes.Repeat([]byte{0x42}, healthCheckBlockSize)
+	var source []byte
+	for _, b := range [][]byte{first, {0x01}, second, {0x02}, second} {
+		source = append(source, b...)
+	}
+	r := NewHealthCheckedReader(bytes.NewReader(source))
+	var buf [1]byte
+
+	_, err := r.Read(buf[:])
+	assertNil(t, err)
+
+	_, err = r.Read(buf[:])
+	assertEquals(t, err, errRandomSourceUnhealthy)
+}
+
+func Test_HealthCheckedReader_doesntKeepWhatItRead(t *testing.T) {
+	sample := bytes.Repeat([]byte{0x01}, healthCheckBlockSize)
+	output := bytes.Repeat([]byte{0x02}, healthCheckBlockSize)
+	r := NewHealthCheckedReader(bytes.NewReader(append(append(makeCopy(sample), output...), 0x03)))
+	buf := make([]byte, healthCheckBlockSize)
+
+	r.Read(buf)
+
+	assertFalse(t, bytes.Contains(r.lastSample[:], output))
+	assertFalse(t, bytes.Contains(r.lastSample[:], sample))
+}
+
+func Test_HealthCheckedReader_Reset_makesTheReaderReadFromTheSourceAgain(t *testing.T) {
+	r := NewHealthCheckedReader(bytes.NewReader(make([]byte, 64)))
+	var buf [32]byte
+	r.Read(buf[:])
+	r.source = rand.Reader
+
+	r.Reset()
+	n, err := r.Read(buf[:])
+
+	assertNil(t, err)
+	assertEquals(t, n, 32)
+	assertNil(t, r.Err())
+}
+
+func Test_HealthCheckedReader_failsForGoodWhenTheSourceRunsOut(t *testing.T) {
+	r := NewHealthCheckedReader(fixedRand([]string{"ABCD"}))
+	var buf [3]byte
+
+	_, err := r.Read(buf[:])
+
+	assertEquals(t, err, errRandomSourceUnhealthy)
+	assertEquals(t, r.Err(), errRandomSourceUnhealthy)
+}
+
+func Test_randomInto_returnsTheUnhealthySourceError(t *testing.T) {
+	r := NewHealthCheckedReader(bytes.NewReader(nil))
+	var buf [4]byte
+
+	err := randomInto(r, buf[:])
+
+	assertEquals(t, err, errRandomSourceUnhealthy)
+	assertEquals(t, TransportActionFor(err), TransportDrop)
+}
+
+func Test_startAuthenticate_returnsTheUnhealthySourceError(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.ourCurrentKey = bobPrivateKey
+	c.theirKey = alicePrivateKey.PublicKey()
+	c.Rand = NewHealthCheckedReader(bytes.NewReader(nil))
+
+	_, err := c.StartAuthenticate("", []byte("secret"))
+
+	assertEquals(t, err, errRandomSourceUnhealthy)
+}
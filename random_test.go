@@ -2,6 +2,7 @@ package otr3
 
 import (
 	"crypto/rand"
+	"io"
 	"testing"
 )
 
@@ -11,9 +12,20 @@ func Test_conversation_rand_returnsTheSetRandomIfThereIsOne(t *testing.T) {
 	assertEquals(t, c.rand(), r)
 }
 
-func Test_conversation_rand_returnsRandReaderIfNoRandomnessIsSet(t *testing.T) {
+func Test_conversation_rand_returnsTheHealthCheckedRandReaderIfNoRandomnessIsSet(t *testing.T) {
 	c := &Conversation{}
-	assertEquals(t, c.rand(), rand.Reader)
+
+	r := c.rand()
+
+	assertEquals(t, r, io.Reader(c.defaultRand))
+	assertEquals(t, c.defaultRand.source, rand.Reader)
+	assertEquals(t, c.rand(), r)
+}
+
+func Test_conversation_rand_doesntShareTheHealthCheckedRandReaderBetweenConversations(t *testing.T) {
+	c1, c2 := &Conversation{}, &Conversation{}
+
+	assertTrue(t, c1.rand() != c2.rand())
 }
 
 func Test_randMPI_returnsNilForARealRead(t *testing.T) {
@@ -1,7 +1,15 @@
 package otr3
 
+import "time"
+
 // Receive handles a message from a peer. It returns a human readable message and zero or more messages to send back to the peer.
+// If the ContainPanics policy is set, a panic while handling the message is returned as an error.
 func (c *Conversation) Receive(m ValidMessage) (plain MessagePlaintext, toSend []ValidMessage, err error) {
+	defer c.containPanic(&err)
+
+	c.updateLastReceived()
+	c.receivedPrivately = false
+	c.trimOutbox()
 	return c.receiveUnit(m, true)
 }
 
@@ -14,6 +22,10 @@ func (c *Conversation) receiveUnit(m ValidMessage, forgetFragments bool) (plain
 		return c.receiveWithoutOTR(message)
 	}
 
+	if c.Policies.Has(PolicyStripHTML) {
+		message = stripHTMLAroundOTRMessage(message)
+	}
+
 	msgType := guessMessageType(message)
 	var messagesToSend []messageWithHeader
 	shouldForgetFragment := true
@@ -27,12 +39,16 @@ func (c *Conversation) receiveUnit(m ValidMessage, forgetFragments bool) (plain
 	case msgGuessNotOTR:
 		plain, messagesToSend, err = c.receivePlaintext(message)
 	case msgGuessV1KeyExch:
-		return nil, nil, errUnsupportedOTRVersion
+		return c.withInjectionsPlain(nil, nil, c.refuseUnsupportedVersion())
 	case msgGuessFragment:
 		shouldForgetFragment = false
 		c.fragmentationContext, err = c.receiveFragment(c.fragmentationContext, message)
 		if fragmentsFinished(c.fragmentationContext) {
-			return c.withInjectionsPlain(c.receiveUnit(c.fragmentationContext.frag, false))
+			// The reassembled message is handed back in as if it had arrived in one piece,
+			// so the buffer is not needed anymore
+			assembled := ValidMessage(c.fragmentationContext.frag)
+			c.dropFragments()
+			return c.withInjectionsPlain(c.receiveUnit(assembled, false))
 		}
 	case msgGuessUnknown:
 		c.messageEvent(MessageEventReceivedMessageUnrecognized)
@@ -41,7 +57,7 @@ func (c *Conversation) receiveUnit(m ValidMessage, forgetFragments bool) (plain
 	}
 
 	if shouldForgetFragment && forgetFragments {
-		c.fragmentationContext = forgetFragment()
+		c.dropFragments()
 	}
 
 	return c.withInjectionsPlain(c.toSendEncoded(plain, messagesToSend, err))
@@ -61,8 +77,8 @@ func withoutPotentialSpaceStart(msg []byte) []byte {
 func (c *Conversation) receiveErrorMessage(message ValidMessage) (plain MessagePlaintext, toSend []ValidMessage, err error) {
 	msg := MessagePlaintext(makeCopy(message[len(errorMarker):]))
 
-	if c.Policies.has(errorStartAKE) {
-		toSend = []ValidMessage{c.QueryMessage()}
+	if c.shouldStartAKEAfterError() {
+		toSend = c.approvedReply(ReplyPlaintext, []ValidMessage{c.QueryMessage()})
 	}
 
 	if c.msgState == encrypted {
@@ -73,11 +89,29 @@ func (c *Conversation) receiveErrorMessage(message ValidMessage) (plain MessageP
 	return
 }
 
+// We only answer an error message with a query message this often, so that two peers
+// that keep failing to talk to each other can't get stuck sending errors and queries forever
+const errorStartAKEInterval = 60 * time.Second
+
+func (c *Conversation) shouldStartAKEAfterError() bool {
+	if !c.Policies.Has(PolicyErrorStartAKE) {
+		return false
+	}
+
+	now := c.now()
+	if now.Before(c.lastErrorStartAKE.Add(errorStartAKEInterval)) {
+		return false
+	}
+
+	c.lastErrorStartAKE = now
+	return true
+}
+
 func (c *Conversation) encodeAndCombine(toSend []messageWithHeader) []ValidMessage {
 	var result []ValidMessage
 
 	for _, ts := range toSend {
-		result = append(result, c.fragEncode(ts)...)
+		result = append(result, c.approvedReply(replyKindOf(ts), c.fragEncode(ts))...)
 	}
 
 	return result
@@ -104,9 +138,13 @@ func (c *Conversation) checkPlaintextPolicies(plain MessagePlaintext) {
 		c.whitespaceState = whitespaceRejected
 	}
 
-	if c.msgState != plainText || c.Policies.has(requireEncryption) {
+	if c.msgState != plainText || c.Policies.Has(PolicyRequireEncryption) {
 		c.messageEventWithMessage(MessageEventReceivedMessageUnencrypted, plain)
 	}
+
+	if c.Policies.Has(PolicyRequireEncryption) {
+		c.maybeReplyToRefusedPlaintext(plain)
+	}
 }
 
 func (c *Conversation) receivePlaintext(message ValidMessage) (plain MessagePlaintext, toSend []messageWithHeader, err error) {
@@ -127,6 +165,12 @@ func removeOTRMsgEnvelope(msg encodedMessage) []byte {
 }
 
 func (c *Conversation) decode(encoded encodedMessage) (messageWithHeader, error) {
+	if !isConformantEncoding(encoded) {
+		if err := c.nonConformant(errNonConformantEncoding); err != nil {
+			return nil, err
+		}
+	}
+
 	encoded = removeOTRMsgEnvelope(encoded)
 	msg, err := b64decode(encoded)
 
@@ -139,6 +183,12 @@ func (c *Conversation) decode(encoded encodedMessage) (messageWithHeader, error)
 
 func (c *Conversation) receiveDecoded(message messageWithHeader) (plain MessagePlaintext, toSend []messageWithHeader, err error) {
 	if err = c.checkVersion(message); err != nil {
+		if err == errWrongProtocolVersion && isDataMessage(message) {
+			err = ErrDataMessageUnsupportedVersion
+		}
+		if err == errUnsupportedOTRVersion {
+			err = c.refuseUnsupportedVersion()
+		}
 		return
 	}
 
@@ -160,14 +210,29 @@ func (c *Conversation) receiveDecoded(message messageWithHeader) (plain MessageP
 }
 
 func (c *Conversation) receiveAKEMessage(msgType byte, messageBody []byte) (plain MessagePlaintext, toSend []messageWithHeader, err error) {
-	toSend, err = c.potentialAuthError(c.processAKE(msgType, messageBody))
+	wasInProgress := c.akeWaitingForPeer()
+	toSend, err = c.processAKE(msgType, messageBody)
+	if err != nil {
+		c.messageEventWithError(MessageEventSetupError, err)
+		// A message the AKE can't use is only dropped, and the AKE keeps waiting for the right one.
+		// The queued messages are only given up on if that made the AKE start over.
+		if wasInProgress && !c.akeWaitingForPeer() {
+			c.dropQueuedMessages(err)
+		}
+	}
 	return
 }
 
+func isDataMessage(message messageWithHeader) bool {
+	return len(message) > 2 && message[2] == msgTypeData
+}
+
 func (c *Conversation) receiveDataMessage(messageHeader, messageBody []byte) (plain MessagePlaintext, toSend []messageWithHeader, err error) {
 	plain, toSend, err = c.maybeHeartbeat(c.processDataMessage(messageHeader, messageBody))
 	if err != nil {
 		c.notifyDataMessageError(err)
+	} else if len(plain) > 0 {
+		c.verifiedMessageExchanged()
 	}
 
 	return
@@ -176,14 +241,17 @@ func (c *Conversation) receiveDataMessage(messageHeader, messageBody []byte) (pl
 func (c *Conversation) notifyDataMessageError(err error) {
 	var e ErrorCode
 
-	if err == errMessageNotInPrivate {
-		return
-	}
-
-	if isConflict(err) {
+	switch {
+	case err == errMessageNotInPrivate:
+		// MessageEventReceivedMessageNotInPrivate has already been signaled
+		e = ErrorCodeMessageNotInPrivate
+	case err == errCounterRegressed:
+		// MessageEventReceivedMessageReplayed has already been signaled
+		e = ErrorCodeMessageUnreadable
+	case isConflict(err):
 		c.messageEvent(MessageEventReceivedMessageUnreadable)
 		e = ErrorCodeMessageUnreadable
-	} else {
+	default:
 		c.messageEvent(MessageEventReceivedMessageMalformed)
 		e = ErrorCodeMessageMalformed
 	}
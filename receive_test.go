@@ -8,7 +8,7 @@ import (
 func Test_receiveDecoded_resolveProtocolVersion(t *testing.T) {
 	c := &Conversation{}
 	c.SetOurKeys([]PrivateKey{bobPrivateKey})
-	c.Policies = policies(allowV3)
+	c.Policies = Policies(PolicyAllowV3)
 	_, _, err := c.receiveDecoded(fixtureDHCommitMsg())
 
 	assertNil(t, err)
@@ -16,7 +16,7 @@ func Test_receiveDecoded_resolveProtocolVersion(t *testing.T) {
 
 	c = &Conversation{}
 	c.SetOurKeys([]PrivateKey{bobPrivateKey})
-	c.Policies = policies(allowV2)
+	c.Policies = Policies(PolicyAllowV2)
 	_, _, err = c.receiveDecoded(fixtureDHCommitMsgV2())
 
 	assertNil(t, err)
@@ -69,7 +69,7 @@ func Test_receivePlaintext_signalsAMessageEventThatItWasUnencryptedIfRequiringEn
 	c := &Conversation{}
 	c.SetOurKeys([]PrivateKey{bobPrivateKey})
 	c.msgState = plainText
-	c.Policies = policies(requireEncryption)
+	c.Policies = Policies(PolicyRequireEncryption)
 
 	c.expectMessageEvent(t, func() {
 		c.receivePlaintext(ValidMessage("Hello world"))
@@ -100,7 +100,7 @@ func Test_receiveTaggedPlaintext_signalsAMessageEventThatItWasUnencryptedIfRequi
 	c := &Conversation{}
 	c.SetOurKeys([]PrivateKey{bobPrivateKey})
 	c.msgState = plainText
-	c.Policies = policies(requireEncryption)
+	c.Policies = Policies(PolicyRequireEncryption)
 
 	c.expectMessageEvent(t, func() {
 		c.receiveTaggedPlaintext(ValidMessage("Hello \t  \t\t\t\t \t \t \t   world"))
@@ -120,7 +120,7 @@ func Test_receiveTaggedPlaintext_doesntSignalAMessageEventThatItWasUnencryptedIf
 func Test_Receive_signalsAMessageEventWhenWeReceiveAMessageThatLooksLikeAnOTRMessageButWeCantUnderstandIt(t *testing.T) {
 	c := &Conversation{}
 	c.SetOurKeys([]PrivateKey{bobPrivateKey})
-	c.Policies = policies(allowV3)
+	c.Policies = Policies(PolicyAllowV3)
 
 	c.expectMessageEvent(t, func() {
 		c.Receive(ValidMessage("?OTR Something: strange"))
@@ -133,7 +133,7 @@ func Test_Receive_signalsAMessageEventWhenWeReceiveADataMessageForAnotherInstanc
 	alice.theirInstanceTag = 0x301
 	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
 	alice.ourCurrentKey = alicePrivateKey
-	alice.Policies = policies(allowV3)
+	alice.Policies = Policies(PolicyAllowV3)
 	alice.theirKey = bobPrivateKey.PublicKey()
 
 	bob := &Conversation{Rand: rand.Reader}
@@ -141,7 +141,7 @@ func Test_Receive_signalsAMessageEventWhenWeReceiveADataMessageForAnotherInstanc
 	bob.theirInstanceTag = 0x201
 	bob.SetOurKeys([]PrivateKey{bobPrivateKey})
 	bob.ourCurrentKey = bobPrivateKey
-	bob.Policies = policies(allowV3)
+	bob.Policies = Policies(PolicyAllowV3)
 	bob.theirKey = alicePrivateKey.PublicKey()
 
 	var toSend []ValidMessage
@@ -227,13 +227,110 @@ func Test_receiveErrorMessage_willSignalAnEventWithTheErrorMessageWithoutLeading
 
 func Test_Receive_returnsAnErrorIfWeReceiveARequestToStartAVersion1KeyExchange(t *testing.T) {
 	c := &Conversation{}
-	c.Policies = policies(allowV3)
+	c.Policies = Policies(PolicyAllowV3)
 
 	_, _, err := c.Receive(ValidMessage("?OTR:AAEK"))
 
 	assertEquals(t, err, errUnsupportedOTRVersion)
 }
 
+func Test_Receive_signalsThatThePeerRequiresAnUnsupportedVersionForAVersion1KeyExchange(t *testing.T) {
+	c := &Conversation{}
+	c.Policies = Policies(PolicyAllowV3)
+
+	c.expectMessageEvent(t, func() {
+		c.Receive(ValidMessage("?OTR:AAEK"))
+	}, MessageEventPeerRequiresUnsupportedVersion, nil, nil)
+}
+
+func Test_Receive_repliesWithAnErrorMessageForAVersion1KeyExchangeIfAnErrorMessageHandlerIsSet(t *testing.T) {
+	c := &Conversation{}
+	c.Policies = Policies(PolicyAllowV3)
+	c.errorMessageHandler = dynamicErrorMessageHandler{
+		func(error ErrorCode) []byte {
+			if error == ErrorCodeUnsupportedVersion {
+				return []byte("I only speak OTRv3")
+			}
+			return []byte("something else happened")
+		}}
+
+	_, toSend, err := c.Receive(ValidMessage("?OTR:AAEK"))
+
+	assertEquals(t, err, errUnsupportedOTRVersion)
+	assertEquals(t, len(toSend), 1)
+	assertDeepEquals(t, string(toSend[0]), "?OTR Error: I only speak OTRv3")
+}
+
+func Test_Receive_doesNotReplyToAVersion1KeyExchangeWithoutAnErrorMessageHandler(t *testing.T) {
+	c := &Conversation{}
+	c.Policies = Policies(PolicyAllowV3)
+
+	_, toSend, _ := c.Receive(ValidMessage("?OTR:AAEK"))
+
+	assertEquals(t, len(toSend), 0)
+}
+
+func Test_Receive_signalsThatThePeerRequiresAnUnsupportedVersionForAVersion1DataMessage(t *testing.T) {
+	c := &Conversation{}
+	c.Policies = Policies(PolicyAllowV3)
+
+	ev := collectMessageEvents(c, MessageEventPeerRequiresUnsupportedVersion)
+	_, _, err := c.Receive(ValidMessage("?OTR:AAEDAAAAAQAAAAE=."))
+	if err == nil {
+		t.Errorf("Expected an error when receiving an OTRv1 data message")
+	}
+	assertEquals(t, *ev, 1)
+}
+
+func Test_Receive_deliversProtocolMarkersInsideEncryptedPlaintextVerbatim(t *testing.T) {
+	policies := Policies(PolicyAllowV2 | PolicyAllowV3 | PolicyWhitespaceStartAKE | PolicyErrorStartAKE)
+	payloads := []string{
+		"?OTRv3?",
+		"?OTRv23? let's talk privately",
+		"?OTR?",
+		"?OTR Error: something went wrong",
+		"hello" + string(genWhitespaceTag(policies)),
+		"?OTR:AAMDAAAAAQAAAAE=.",
+		"?OTR:AAEK",
+		"?OTR|00000101|00000102,00001,00002,?OTR:AAMD,",
+		"?OTR,00001,00002,?OTR:AAMD,",
+	}
+
+	for _, payload := range payloads {
+		alice, bob := benchmarkConversations()
+		alice.Policies, bob.Policies = policies, policies
+		exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+		whitespaceState := alice.whitespaceState
+		events := collectMessageEvents(alice, MessageEventReceivedMessageGeneralError)
+
+		msg, err := bob.Send(ValidMessage(payload))
+		assertNil(t, err)
+		plain, toSend, err := alice.Receive(msg[0])
+
+		assertNil(t, err)
+		assertDeepEquals(t, plain, MessagePlaintext(payload))
+		// Only heartbeats can be sent back, since nothing in the plaintext is acted on
+		for _, m := range toSend {
+			assertEquals(t, guessMessageType(m), msgGuessData)
+		}
+		assertEquals(t, *events, 0)
+		assertEquals(t, alice.whitespaceState, whitespaceState)
+		assertDeepEquals(t, alice.fragmentationContext, fragmentationContext{})
+		assertTrue(t, alice.IsEncrypted())
+	}
+}
+
+func Test_Send_encryptsProtocolMarkersLikeAnyOtherText(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	toSend, err := alice.Send(ValidMessage("?OTRv3?"))
+
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 1)
+	assertEquals(t, guessMessageType(toSend[0]), msgGuessData)
+}
+
 func Test_Receive_willResetFragmentationContextIfWeReceiveAnUnfragmentedMessage(t *testing.T) {
 	c := aliceContextAfterAKE()
 	c.fragmentationContext = fragmentationContext{[]byte("hello"), 2, 5}
@@ -243,3 +340,47 @@ func Test_Receive_willResetFragmentationContextIfWeReceiveAnUnfragmentedMessage(
 	assertEquals(t, c.fragmentationContext.currentIndex, uint16(0))
 	assertEquals(t, c.fragmentationContext.currentLen, uint16(0))
 }
+
+func Test_Receive_forgetsTheFragmentsOnceTheMessageHasBeenReassembled(t *testing.T) {
+	alice := aliceContextAfterAKE()
+	alice.msgState = encrypted
+	alice.SetFragmentSize(200)
+
+	bob := bobContextAfterAKE()
+	bob.msgState = encrypted
+	fragments, _, _ := alice.createSerializedDataMessage(MessagePlaintext("hello!"), messageFlagNormal, []tlv{})
+
+	for _, fragment := range fragments {
+		bob.Receive(fragment)
+	}
+
+	assertNil(t, bob.fragmentationContext.frag)
+	assertEquals(t, bob.fragmentationContext.currentIndex, uint16(0))
+	assertEquals(t, bob.fragmentationContext.currentLen, uint16(0))
+}
+
+func Test_Receive_reassemblesV2Fragments(t *testing.T) {
+	alice := aliceContextAfterAKE()
+	alice.version = otrV2{}
+	alice.Policies = Policies(PolicyAllowV2)
+	alice.msgState = encrypted
+	alice.SetFragmentSize(100)
+
+	bob := bobContextAfterAKE()
+	bob.version = otrV2{}
+	bob.Policies = Policies(PolicyAllowV2)
+	bob.msgState = encrypted
+	fragments, _, _ := alice.createSerializedDataMessage(MessagePlaintext("hello!"), messageFlagNormal, []tlv{})
+
+	assertTrue(t, len(fragments) > 1)
+	assertDeepEquals(t, fragments[0][:5], ValidMessage("?OTR,"))
+
+	var err error
+	var plain MessagePlaintext
+	for _, fragment := range fragments {
+		plain, _, err = bob.Receive(fragment)
+		assertNil(t, err)
+	}
+
+	assertDeepEquals(t, plain, MessagePlaintext("hello!"))
+}
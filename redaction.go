@@ -0,0 +1,198 @@
+package otr3
+
+import (
+	"fmt"
+	"io"
+	"math/big"
+	"reflect"
+	"sync/atomic"
+)
+
+// Printing the internal state of this package with the fmt package, for example when logging or in a debugger,
+// would print secret exponents, random values and keys. The types holding them format themselves with the
+// secrets redacted, unless unsafe debug output has been explicitly allowed.
+
+const redactedSecret = "[REDACTED]"
+
+var unsafeDebugOutput int32
+
+// SetUnsafeDebugOutput decides whether secret values - exponents, random values and keys - are included
+// when the internal state of this package is printed with the fmt package. They are redacted by default.
+// Including them makes every private conversation of the process worthless to anyone who can read the
+// output, so this should only be enabled in a controlled environment, such as when debugging the protocol.
+func SetUnsafeDebugOutput(include bool) {
+	v := int32(0)
+	if include {
+		v = 1
+	}
+	atomic.StoreInt32(&unsafeDebugOutput, v)
+}
+
+func unsafeDebugOutputAllowed() bool {
+	return atomic.LoadInt32(&unsafeDebugOutput) == 1
+}
+
+// formatSecret formats a value holding secrets as name{[REDACTED]}, or with everything in it
+// when unsafe debug output is allowed
+func formatSecret(s fmt.State, name string, v interface{}) {
+	if !unsafeDebugOutputAllowed() {
+		io.WriteString(s, name+"{"+redactedSecret+"}")
+		return
+	}
+
+	writeDebugValue(s, reflect.ValueOf(v), 0)
+}
+
+const maxDebugValueDepth = 12
+
+var bigIntType = reflect.TypeOf(big.Int{})
+
+// writeDebugValue writes everything in the value, including unexported fields, which the fmt package
+// only prints as pointers - and never as the numbers they point to - when they are nested in a struct
+func writeDebugValue(w io.Writer, v reflect.Value, depth int) {
+	if depth > maxDebugValueDepth {
+		io.WriteString(w, "...")
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Invalid:
+		io.WriteString(w, "<nil>")
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			io.WriteString(w, "<nil>")
+			return
+		}
+		writeDebugValue(w, v.Elem(), depth+1)
+	case reflect.Struct:
+		if v.Type() == bigIntType {
+			io.WriteString(w, "0x"+bigIntFromValue(v).Text(16))
+			return
+		}
+		io.WriteString(w, v.Type().Name()+"{")
+		for i := 0; i < v.NumField(); i++ {
+			if i > 0 {
+				io.WriteString(w, " ")
+			}
+			io.WriteString(w, v.Type().Field(i).Name+":")
+			writeDebugValue(w, v.Field(i), depth+1)
+		}
+		io.WriteString(w, "}")
+	case reflect.Slice, reflect.Array:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			for i := range b {
+				b[i] = byte(v.Index(i).Uint())
+			}
+			fmt.Fprintf(w, "%x", b)
+			return
+		}
+		io.WriteString(w, "[")
+		for i := 0; i < v.Len(); i++ {
+			if i > 0 {
+				io.WriteString(w, " ")
+			}
+			writeDebugValue(w, v.Index(i), depth+1)
+		}
+		io.WriteString(w, "]")
+	case reflect.Map:
+		io.WriteString(w, "map[")
+		for i, k := range v.MapKeys() {
+			if i > 0 {
+				io.WriteString(w, " ")
+			}
+			writeDebugValue(w, k, depth+1)
+			io.WriteString(w, ":")
+			writeDebugValue(w, v.MapIndex(k), depth+1)
+		}
+		io.WriteString(w, "]")
+	case reflect.Bool:
+		fmt.Fprint(w, v.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		fmt.Fprint(w, v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		fmt.Fprint(w, v.Uint())
+	case reflect.String:
+		fmt.Fprintf(w, "%q", v.String())
+	default:
+		io.WriteString(w, v.Type().String())
+	}
+}
+
+// bigIntFromValue reads a big.Int through reflection, since values in unexported fields can't be used directly
+func bigIntFromValue(v reflect.Value) *big.Int {
+	abs := v.FieldByName("abs")
+	neg := v.FieldByName("neg")
+	if !abs.IsValid() || !neg.IsValid() {
+		return new(big.Int)
+	}
+
+	words := make([]big.Word, abs.Len())
+	for i := range words {
+		words[i] = big.Word(abs.Index(i).Uint())
+	}
+	res := new(big.Int).SetBits(words)
+	if neg.Bool() {
+		res.Neg(res)
+	}
+	return res
+}
+
+// Format formats the conversation with its secrets redacted, unless SetUnsafeDebugOutput allows them
+func (c *Conversation) Format(s fmt.State, verb rune) {
+	formatSecret(s, "Conversation", c)
+}
+
+// Format formats the private key with its secrets redacted, unless SetUnsafeDebugOutput allows them
+func (priv DSAPrivateKey) Format(s fmt.State, verb rune) {
+	formatSecret(s, "DSAPrivateKey", priv)
+}
+
+// Format formats the plaintext redacted, unless SetUnsafeDebugOutput allows it
+func (p SecretPlaintext) Format(s fmt.State, verb rune) {
+	formatSecret(s, "SecretPlaintext", p)
+}
+
+func (a ake) Format(s fmt.State, verb rune) {
+	formatSecret(s, "ake", a)
+}
+
+func (k akeKeys) Format(s fmt.State, verb rune) {
+	formatSecret(s, "akeKeys", k)
+}
+
+func (k dhKeyPair) Format(s fmt.State, verb rune) {
+	formatSecret(s, "dhKeyPair", k)
+}
+
+func (k sessionKeys) Format(s fmt.State, verb rune) {
+	formatSecret(s, "sessionKeys", k)
+}
+
+func (k macKey) Format(s fmt.State, verb rune) {
+	formatSecret(s, "macKey", k)
+}
+
+func (k keyManagementContext) Format(s fmt.State, verb rune) {
+	formatSecret(s, "keyManagementContext", k)
+}
+
+func (sm smp) Format(s fmt.State, verb rune) {
+	formatSecret(s, "smp", sm)
+}
+
+func (st smp1State) Format(s fmt.State, verb rune) {
+	formatSecret(s, "smp1State", st)
+}
+
+func (st smp2State) Format(s fmt.State, verb rune) {
+	formatSecret(s, "smp2State", st)
+}
+
+func (st smp3State) Format(s fmt.State, verb rune) {
+	formatSecret(s, "smp3State", st)
+}
+
+func (st smp4State) Format(s fmt.State, verb rune) {
+	formatSecret(s, "smp4State", st)
+}
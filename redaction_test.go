@@ -0,0 +1,91 @@
+package otr3
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// secretFixture is a value that is easy to recognize in formatted output, both in decimal and in hex
+var secretFixture = big.NewInt(0x5ec7e7)
+
+func secretFixtureBytes() []byte {
+	return []byte{0x5e, 0xc7, 0xe7, 0x5e, 0xc7, 0xe7}
+}
+
+func valuesWithSecrets() map[string]interface{} {
+	priv := &DSAPrivateKey{}
+	priv.PrivateKey.X = secretFixture
+	c := &Conversation{}
+	c.keys.ourCurrentDHKeys.priv = secretFixture
+	a := ake{secretExponent: secretFixture}
+	copy(a.r[:], secretFixtureBytes())
+
+	return map[string]interface{}{
+		"Conversation":         c,
+		"DSAPrivateKey":        priv,
+		"SecretPlaintext":      &SecretPlaintext{data: secretFixtureBytes()},
+		"ake":                  a,
+		"akeKeys":              akeKeys{c: secretFixtureBytes(), m1: secretFixtureBytes(), m2: secretFixtureBytes()},
+		"dhKeyPair":            dhKeyPair{priv: secretFixture},
+		"sessionKeys":          sessionKeys{sendingAESKey: secretFixtureBytes(), receivingMACKey: secretFixtureBytes()},
+		"macKey":               macKey(secretFixtureBytes()),
+		"keyManagementContext": c.keys,
+		"smp":                  smp{secret: secretFixture},
+		"smp1State":            &smp1State{a2: secretFixture},
+		"smp2State":            &smp2State{b3: secretFixture},
+		"smp3State":            &smp3State{x: secretFixture},
+		"smp4State":            &smp4State{r7: secretFixture},
+	}
+}
+
+func containsSecretFixture(s string) bool {
+	return strings.Contains(s, secretFixture.String()) ||
+		strings.Contains(strings.ToLower(s), "5ec7e7") ||
+		strings.Contains(s, "94 199 231")
+}
+
+func Test_formattingValuesWithSecrets_redactsTheSecretsByDefault(t *testing.T) {
+	for name, v := range valuesWithSecrets() {
+		for _, format := range []string{"%v", "%+v", "%#v", "%s", "%x", "%X", "%d"} {
+			res := fmt.Sprintf(format, v)
+
+			if containsSecretFixture(res) {
+				t.Errorf("formatting %s with %s revealed the secret: %s", name, format, res)
+			}
+			assertTrue(t, strings.Contains(res, redactedSecret))
+		}
+	}
+}
+
+func Test_formattingValuesWithSecrets_includesTheSecretsWhenUnsafeDebugOutputIsAllowed(t *testing.T) {
+	SetUnsafeDebugOutput(true)
+	defer SetUnsafeDebugOutput(false)
+
+	for name, v := range valuesWithSecrets() {
+		res := fmt.Sprintf("%+v", v)
+
+		if !containsSecretFixture(res) {
+			t.Errorf("formatting %s didn't include the secret: %s", name, res)
+		}
+		assertFalse(t, strings.Contains(res, redactedSecret))
+	}
+}
+
+func Test_formattingValuesWithSecrets_redactsNestedValues(t *testing.T) {
+	a := Account{Name: "alice", Key: &DSAPrivateKey{}}
+	a.Key.(*DSAPrivateKey).PrivateKey.X = secretFixture
+
+	res := fmt.Sprintf("%+v", a)
+
+	assertFalse(t, containsSecretFixture(res))
+	assertTrue(t, strings.Contains(res, "alice"))
+}
+
+func Test_SetUnsafeDebugOutput_canBeTurnedOffAgain(t *testing.T) {
+	SetUnsafeDebugOutput(true)
+	SetUnsafeDebugOutput(false)
+
+	assertEquals(t, fmt.Sprintf("%v", dhKeyPair{priv: secretFixture}), "dhKeyPair{[REDACTED]}")
+}
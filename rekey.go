@@ -0,0 +1,77 @@
+package otr3
+
+// When a new AKE finishes while we are already encrypted, the peer might still have data messages
+// in flight that were encrypted with the keys of the session being replaced. Those keys are kept
+// around, only for reading, until the peer shows that it has switched to the new keys.
+
+// keepPreviousKeys is called when an AKE finishes while encrypted, and keeps the keys of the session
+// that is being replaced so messages already sent with them can still be read
+func (c *Conversation) keepPreviousKeys() {
+	c.wipePreviousKeys()
+	previous := c.keys
+	c.previousKeys = &previous
+	c.keys = keyManagementContext{}
+}
+
+// wipePreviousKeys forgets the keys of the previous session, if any
+func (c *Conversation) wipePreviousKeys() {
+	c.previousKeys.wipe()
+	c.previousKeys = nil
+}
+
+// retirePreviousKeys is called once a message using the new keys has been authenticated. After that, the
+// peer will not use the previous keys anymore, so the MAC keys used to read with them are revealed
+// in the next message we send
+func (c *Conversation) retirePreviousKeys() {
+	if c.previousKeys == nil {
+		return
+	}
+
+	for _, k := range c.previousKeys.macKeyHistory.items {
+		c.keys.oldMACKeys = append(c.keys.oldMACKeys, makeCopy(k.receivingKey))
+	}
+	for _, k := range c.previousKeys.oldMACKeys {
+		c.keys.oldMACKeys = append(c.keys.oldMACKeys, makeCopy(k))
+	}
+
+	c.wipePreviousKeys()
+}
+
+// processDataMessageWithPreviousKeys tries to read a data message that was sent using the keys of the
+// session a new AKE replaced. The keys are never rotated and any TLVs are ignored, since they
+// belong to a session that has already ended.
+func (c *Conversation) processDataMessageWithPreviousKeys(header []byte, dataMessage dataMsg) (plain MessagePlaintext, err error) {
+	keys := c.previousKeys
+
+	sessionKeys, err := keys.calculateDHSessionKeys(&c.secrets, dataMessage.recipientKeyID, dataMessage.senderKeyID, c.version)
+	if err != nil {
+		return nil, err
+	}
+	defer sessionKeys.wipe()
+
+	if err = dataMessage.checkSign(sessionKeys.receivingMACKey, header, c.version); err != nil {
+		return nil, err
+	}
+
+	window := c.TransportProfile().ReorderWindow
+	if err = keys.peekMessageCounter(dataMessage, window); err != nil {
+		c.messageEvent(MessageEventReceivedMessageReplayed)
+		return nil, err
+	}
+
+	keys.receivingMACKeyUsed(dataMessage.recipientKeyID, dataMessage.senderKeyID, sessionKeys)
+	keys.checkMessageCounter(dataMessage, window)
+
+	p := plainDataMsg{}
+	p.decrypt(sessionKeys.receivingAESKey[:], dataMessage.topHalfCtr, dataMessage.encryptedMsg)
+	defer wipeBytes(dataMessage.encryptedMsg)
+
+	plain = makeCopy(p.message)
+	c.receivedPrivately = true
+	if len(plain) == 0 {
+		plain = nil
+		c.signalIfHeartbeat(p.tlvs)
+	}
+
+	return plain, nil
+}
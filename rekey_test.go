@@ -0,0 +1,115 @@
+package otr3
+
+import "testing"
+
+func Test_finishAKE_keepsThePreviousKeysWhenAlreadyEncrypted(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+
+	runNewAKE(t, alice, bob)
+
+	assertNotNil(t, alice.previousKeys)
+	assertNotNil(t, bob.previousKeys)
+}
+
+func Test_finishAKE_doesNotKeepAnyKeysWhenNotEncrypted(t *testing.T) {
+	alice, bob := benchmarkConversations()
+
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	assertNil(t, alice.previousKeys)
+	assertNil(t, bob.previousKeys)
+}
+
+func Test_Receive_keepsDecryptingMessagesWhileANewAKEIsInProgress(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	dhCommit, _ := alice.sendDHCommit()
+	bob.Receive(alice.fragEncode(dhCommit)[0])
+
+	msg, _ := bob.Send(ValidMessage("sent during the new AKE"))
+	plain, _, err := alice.Receive(msg[0])
+
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("sent during the new AKE"))
+}
+
+func Test_Receive_decryptsMessagesSentWithThePreviousKeysAfterANewAKE(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	inFlight, _ := bob.Send(ValidMessage("sent before the new AKE"))
+
+	runNewAKE(t, alice, bob)
+	plain, _, err := alice.Receive(inFlight[0])
+
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("sent before the new AKE"))
+	assertTrue(t, alice.IsEncrypted())
+}
+
+func Test_Receive_decryptsMessagesSentWithTheNewKeysAfterANewAKE(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+
+	runNewAKE(t, alice, bob)
+	msg, _ := bob.Send(ValidMessage("sent after the new AKE"))
+	plain, _, err := alice.Receive(msg[0])
+
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("sent after the new AKE"))
+}
+
+func Test_Receive_retiresThePreviousKeysOnceTheNewKeysAreUsed(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	inFlight, _ := bob.Send(ValidMessage("sent before the new AKE"))
+
+	runNewAKE(t, alice, bob)
+	alice.Receive(inFlight[0])
+	msg, _ := bob.Send(ValidMessage("sent after the new AKE"))
+	alice.Receive(msg[0])
+
+	assertNil(t, alice.previousKeys)
+	assertEquals(t, len(alice.keys.oldMACKeys) > 0, true)
+}
+
+func Test_Receive_doesNotDecryptMessagesWithThePreviousKeysOnceTheyAreRetired(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	inFlight, _ := bob.Send(ValidMessage("sent before the new AKE"))
+
+	runNewAKE(t, alice, bob)
+	msg, _ := bob.Send(ValidMessage("sent after the new AKE"))
+	alice.Receive(msg[0])
+	plain, _, err := alice.Receive(inFlight[0])
+
+	assertNil(t, plain)
+	assertNotNil(t, err)
+}
+
+func Test_Receive_doesNotDecryptATamperedMessageWithThePreviousKeys(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	inFlight, _ := bob.Send(ValidMessage("sent before the new AKE"))
+
+	runNewAKE(t, alice, bob)
+	decoded, _ := alice.decode(encodedMessage(inFlight[0]))
+	decoded[len(decoded)-30] ^= 0x01
+	plain, _, err := alice.Receive(ValidMessage(alice.encode(decoded)))
+
+	assertNil(t, plain)
+	assertNotNil(t, err)
+	assertNotNil(t, alice.previousKeys)
+}
+
+func Test_End_forgetsThePreviousKeys(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	runNewAKE(t, alice, bob)
+
+	alice.End()
+
+	assertNil(t, alice.previousKeys)
+}
+
+func Test_processDisconnectedTLV_forgetsThePreviousKeys(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	runNewAKE(t, alice, bob)
+
+	toSend, _ := alice.End()
+	bob.Receive(toSend[0])
+
+	assertNil(t, bob.previousKeys)
+}
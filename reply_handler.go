@@ -0,0 +1,79 @@
+package otr3
+
+import "bytes"
+
+// ReplyKind describes a message that Receive generated on its own, without the application asking for it
+type ReplyKind int
+
+const (
+	// ReplyAKE is a message of the authenticated key exchange: a D-H Commit, D-H Key, Reveal Signature or Signature message
+	ReplyAKE ReplyKind = iota
+	// ReplyData is a data message, like an answer in the Socialist Millionaires' Protocol, a heartbeat or a message sent again after the AKE
+	ReplyData
+	// ReplyError is an OTR error message
+	ReplyError
+	// ReplyPlaintext is a plaintext message, like a query message or the reply to a refused plaintext message
+	ReplyPlaintext
+)
+
+// ReplyHandler is consulted with every message Receive generates on its own, before it is returned to be sent
+type ReplyHandler interface {
+	// HandleReply returns true if the reply should be returned from Receive as usual. If it returns false, the reply is left out,
+	// and the application has taken over sending it - for example by keeping it in an outbox until sending it has been approved.
+	// The messages are the encoded fragments of one reply, ready to be sent in order.
+	HandleReply(kind ReplyKind, msgs []ValidMessage) bool
+}
+
+type dynamicReplyHandler struct {
+	eh func(kind ReplyKind, msgs []ValidMessage) bool
+}
+
+func (d dynamicReplyHandler) HandleReply(kind ReplyKind, msgs []ValidMessage) bool {
+	return d.eh(kind, msgs)
+}
+
+// approveReply returns true if the reply should be returned from Receive. A reply the reply handler
+// lets through is handed to the sender instead, if there is one.
+func (c *Conversation) approveReply(kind ReplyKind, msgs []ValidMessage) bool {
+	if c.replyHandler != nil && !c.replyHandler.HandleReply(kind, msgs) {
+		return false
+	}
+	return !c.deliverReply(kind, msgs)
+}
+
+// approvedReply returns the reply if the reply handler lets Receive send it, and nothing otherwise
+func (c *Conversation) approvedReply(kind ReplyKind, msgs []ValidMessage) []ValidMessage {
+	if !c.approveReply(kind, msgs) {
+		return nil
+	}
+	return msgs
+}
+
+func replyKindOf(msg messageWithHeader) ReplyKind {
+	if len(msg) > 2 && msg[2] == msgTypeData {
+		return ReplyData
+	}
+	return ReplyAKE
+}
+
+func replyKindOfInjected(msg ValidMessage) ReplyKind {
+	if bytes.HasPrefix(msg, errorMarker) {
+		return ReplyError
+	}
+	return ReplyPlaintext
+}
+
+func (k ReplyKind) String() string {
+	switch k {
+	case ReplyAKE:
+		return "ReplyAKE"
+	case ReplyData:
+		return "ReplyData"
+	case ReplyError:
+		return "ReplyError"
+	case ReplyPlaintext:
+		return "ReplyPlaintext"
+	default:
+		return "REPLY KIND: (THIS SHOULD NEVER HAPPEN)"
+	}
+}
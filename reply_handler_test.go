@@ -0,0 +1,112 @@
+package otr3
+
+import "testing"
+
+type heldReply struct {
+	kind ReplyKind
+	msgs []ValidMessage
+}
+
+// holdReplies makes the conversation hand every reply to the returned outbox instead of returning it from Receive
+func holdReplies(c *Conversation) *[]heldReply {
+	outbox := &[]heldReply{}
+	c.SetReplyHandler(dynamicReplyHandler{func(kind ReplyKind, msgs []ValidMessage) bool {
+		*outbox = append(*outbox, heldReply{kind, msgs})
+		return false
+	}})
+	return outbox
+}
+
+func Test_ReplyKind_hasValidStringImplementation(t *testing.T) {
+	assertEquals(t, ReplyAKE.String(), "ReplyAKE")
+	assertEquals(t, ReplyData.String(), "ReplyData")
+	assertEquals(t, ReplyError.String(), "ReplyError")
+	assertEquals(t, ReplyPlaintext.String(), "ReplyPlaintext")
+	assertEquals(t, ReplyKind(20000).String(), "REPLY KIND: (THIS SHOULD NEVER HAPPEN)")
+}
+
+func Test_Conversation_SetReplyHandler_setsReplyHandler(t *testing.T) {
+	c := &Conversation{}
+	h := dynamicReplyHandler{func(ReplyKind, []ValidMessage) bool { return true }}
+	c.SetReplyHandler(h)
+	assertNotNil(t, c.replyHandler)
+}
+
+func Test_Receive_returnsRepliesTheReplyHandlerApproves(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	var kinds []ReplyKind
+	alice.SetReplyHandler(dynamicReplyHandler{func(kind ReplyKind, msgs []ValidMessage) bool {
+		kinds = append(kinds, kind)
+		return true
+	}})
+
+	_, toSend, err := alice.Receive(bob.QueryMessage())
+
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 1)
+	assertDeepEquals(t, kinds, []ReplyKind{ReplyAKE})
+}
+
+func Test_Receive_leavesOutAKERepliesTheReplyHandlerTakesOver(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	outbox := holdReplies(alice)
+
+	_, toSend, err := alice.Receive(bob.QueryMessage())
+
+	assertNil(t, err)
+	assertNil(t, toSend)
+	assertEquals(t, len(*outbox), 1)
+	assertEquals(t, (*outbox)[0].kind, ReplyAKE)
+
+	// The application can send the reply later, and the AKE continues as usual
+	alice.SetReplyHandler(nil)
+	exchangeUntilQuiet(t, alice, bob, (*outbox)[0].msgs)
+	assertEquals(t, bob.IsEncrypted(), true)
+}
+
+func Test_Receive_leavesOutDataRepliesTheReplyHandlerTakesOver(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	outbox := holdReplies(bob)
+
+	toBob, _ := alice.StartAuthenticate("", []byte("secret"))
+	_, toSend, err := bob.Receive(toBob[0])
+	assertNil(t, err)
+	toAlice, _ := bob.ProvideAuthenticationSecret([]byte("secret"))
+	_, toSend, err = alice.Receive(toAlice[0])
+	assertNil(t, err)
+	_, toSend, err = bob.Receive(toSend[0])
+
+	assertNil(t, err)
+	assertNil(t, toSend)
+	assertEquals(t, len(*outbox), 1)
+	assertEquals(t, (*outbox)[0].kind, ReplyData)
+}
+
+func Test_Receive_leavesOutErrorMessagesTheReplyHandlerTakesOver(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	bob.SetErrorMessageHandler(dynamicErrorMessageHandler{func(ErrorCode) []byte { return []byte("oops") }})
+	toBob, _ := alice.Send(ValidMessage("hello"))
+	bob.Receive(toBob[0])
+	outbox := holdReplies(bob)
+
+	// Receiving the message again makes bob answer with an error message
+	_, toSend, _ := bob.Receive(toBob[0])
+
+	assertNil(t, toSend)
+	assertEquals(t, len(*outbox), 1)
+	assertEquals(t, (*outbox)[0].kind, ReplyError)
+	assertDeepEquals(t, (*outbox)[0].msgs, []ValidMessage{ValidMessage("?OTR Error: oops")})
+}
+
+func Test_Receive_leavesOutPlaintextRepliesTheReplyHandlerTakesOver(t *testing.T) {
+	c := refusingConversation()
+	outbox := holdReplies(c)
+
+	_, toSend, _ := c.Receive(ValidMessage("hello"))
+
+	assertNil(t, toSend)
+	assertEquals(t, len(*outbox), 1)
+	assertEquals(t, (*outbox)[0].kind, ReplyPlaintext)
+}
@@ -5,8 +5,6 @@ import (
 	"time"
 )
 
-const resendInterval = 60 * time.Second
-
 type retransmitFlag int
 
 var defaultResentPrefix = []byte("[resent] ")
@@ -20,6 +18,9 @@ const (
 type messageToResend struct {
 	m      MessagePlaintext
 	opaque []interface{}
+	// queued is true for a message waiting for a private conversation, and false for one that has been sent
+	queued bool
+	since  time.Time
 }
 
 type resendContext struct {
@@ -34,6 +35,10 @@ type resendContext struct {
 }
 
 func (r *resendContext) later(msg MessagePlaintext, opaque ...interface{}) {
+	r.add(messageToResend{m: msg, opaque: opaque})
+}
+
+func (r *resendContext) add(msg messageToResend) {
 	if r.retransmitting {
 		return
 	}
@@ -44,7 +49,28 @@ func (r *resendContext) later(msg MessagePlaintext, opaque ...interface{}) {
 	if r.messages.m == nil {
 		r.messages.m = make([]messageToResend, 0, 5)
 	}
-	r.messages.m = append(r.messages.m, messageToResend{makeCopy(msg), opaque})
+	msg.m = makeCopy(msg.m)
+	r.messages.m = append(r.messages.m, msg)
+}
+
+// keep keeps only the messages f returns true for, and returns the others
+func (r *resendContext) keep(f func(int, messageToResend) bool) []messageToResend {
+	r.messages.Lock()
+	defer r.messages.Unlock()
+
+	var kept, dropped []messageToResend
+	for i, msg := range r.messages.m {
+		if f(i, msg) {
+			kept = append(kept, msg)
+		} else {
+			dropped = append(dropped, msg)
+		}
+	}
+
+	if len(dropped) > 0 {
+		r.messages.m = kept
+	}
+	return dropped
 }
 
 func (r *resendContext) pending() []messageToResend {
@@ -87,8 +113,9 @@ func (c *Conversation) resendMessageTransformer() func([]byte) []byte {
 	return c.resend.messageTransform
 }
 
-func (c *Conversation) lastMessage(msg MessagePlaintext, opaque ...interface{}) {
-	c.resend.later(msg, opaque...)
+func (c *Conversation) lastMessage(msg MessagePlaintext, queued bool, opaque ...interface{}) {
+	c.resend.add(messageToResend{m: msg, opaque: opaque, queued: queued, since: c.now()})
+	c.trimOutbox()
 }
 
 func (c *Conversation) updateMayRetransmitTo(f retransmitFlag) {
@@ -97,11 +124,15 @@ func (c *Conversation) updateMayRetransmitTo(f retransmitFlag) {
 
 func (c *Conversation) shouldRetransmit() bool {
 	return c.resend.shouldRetransmit() &&
-		c.heartbeat.lastSent.After(time.Now().Add(-resendInterval))
+		c.heartbeat.lastSent.After(c.now().Add(-c.TransportProfile().ResendInterval))
 }
 
 func (c *Conversation) maybeRetransmit() ([]messageWithHeader, error) {
+	c.trimOutbox()
 	if !c.shouldRetransmit() {
+		if c.msgState == encrypted {
+			c.dropQueuedMessages(errQueuedMessageExpired)
+		}
 		return nil, nil
 	}
 
@@ -147,3 +178,18 @@ func (c *Conversation) retransmit() ([]messageWithHeader, error) {
 
 	return ret, nil
 }
+
+// dropQueuedMessages forgets the messages waiting for a private conversation because of the
+// RequireEncryption policy, and lets the user know that they were not sent
+func (c *Conversation) dropQueuedMessages(reason error) {
+	if c.resend.mayRetransmit != retransmitExact {
+		return
+	}
+
+	msgs := c.resend.pending()
+	c.resend.clear()
+
+	for _, msg := range msgs {
+		c.messageEventWithMessageAndError(MessageEventQueuedMessageNotSent, msg.m, reason, msg.opaque...)
+	}
+}
@@ -2,6 +2,7 @@ package otr3
 
 import (
 	"crypto/rand"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -64,7 +65,7 @@ func Test_maybeRetransmit_returnsNothingWhenShouldntRetransmit(t *testing.T) {
 
 func Test_maybeRetransmit_createsADataMessageWithTheExactMessageWhenAskedToRetransmitExact(t *testing.T) {
 	c := newConversation(otrV3{}, rand.Reader)
-	c.Policies.add(allowV3)
+	c.Policies.Add(PolicyAllowV3)
 	c.ourCurrentKey = bobPrivateKey
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 
@@ -91,7 +92,7 @@ func Test_maybeRetransmit_createsADataMessageWithTheExactMessageWhenAskedToRetra
 
 func Test_maybeRetransmit_createsADataMessageWithTheResendPrefixAndMessageWhenAskedToRetransmitWithPrefix(t *testing.T) {
 	c := newConversation(otrV3{}, rand.Reader)
-	c.Policies.add(allowV3)
+	c.Policies.Add(PolicyAllowV3)
 	c.ourCurrentKey = bobPrivateKey
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 
@@ -119,7 +120,7 @@ func Test_maybeRetransmit_createsADataMessageWithTheResendPrefixAndMessageWhenAs
 
 func Test_maybeRetransmit_createsADataMessageWithTheCustomResendPrefixAndMessageWhenAskedToRetransmitWithPrefix(t *testing.T) {
 	c := newConversation(otrV3{}, rand.Reader)
-	c.Policies.add(allowV3)
+	c.Policies.Add(PolicyAllowV3)
 	c.ourCurrentKey = bobPrivateKey
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 
@@ -150,7 +151,7 @@ func Test_maybeRetransmit_createsADataMessageWithTheCustomResendPrefixAndMessage
 
 func Test_maybeRetransmit_updatesLastSentWhenSendingAMessage(t *testing.T) {
 	c := newConversation(otrV3{}, rand.Reader)
-	c.Policies.add(allowV3)
+	c.Policies.Add(PolicyAllowV3)
 	c.ourCurrentKey = bobPrivateKey
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 
@@ -174,7 +175,7 @@ func Test_maybeRetransmit_updatesLastSentWhenSendingAMessage(t *testing.T) {
 
 func Test_maybeRetransmit_returnsErrorIfWeFailAtGeneratingDataMsg(t *testing.T) {
 	c := newConversation(otrV3{}, rand.Reader)
-	c.Policies.add(allowV3)
+	c.Policies.Add(PolicyAllowV3)
 	c.ourCurrentKey = bobPrivateKey
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 
@@ -193,7 +194,7 @@ func Test_maybeRetransmit_returnsErrorIfWeFailAtGeneratingDataMsg(t *testing.T)
 
 func Test_maybeRetransmit_signalsMessageEventWhenResendingMessage(t *testing.T) {
 	c := newConversation(otrV3{}, rand.Reader)
-	c.Policies.add(allowV3)
+	c.Policies.Add(PolicyAllowV3)
 	c.ourCurrentKey = bobPrivateKey
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 
@@ -215,7 +216,7 @@ func Test_maybeRetransmit_signalsMessageEventWhenResendingMessage(t *testing.T)
 
 func Test_maybeRetransmit_signalMessageEventWhenSendingMessageExact(t *testing.T) {
 	c := newConversation(otrV3{}, rand.Reader)
-	c.Policies.add(allowV3)
+	c.Policies.Add(PolicyAllowV3)
 	c.ourCurrentKey = bobPrivateKey
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 
@@ -234,3 +235,141 @@ func Test_maybeRetransmit_signalMessageEventWhenSendingMessageExact(t *testing.T
 		c.maybeRetransmit()
 	}, MessageEventMessageSent, nil, nil)
 }
+
+type recordedMessageEvent struct {
+	event   MessageEvent
+	message string
+	err     error
+	trace   []interface{}
+}
+
+func recordMessageEvents(c *Conversation) *[]recordedMessageEvent {
+	events := []recordedMessageEvent{}
+	c.SetMessageEventHandler(dynamicMessageEventHandler{func(event MessageEvent, message []byte, err error, trace ...interface{}) {
+		events = append(events, recordedMessageEvent{event, string(message), err, trace})
+	}})
+	return &events
+}
+
+func containsMessageEvent(events []recordedMessageEvent, ev recordedMessageEvent) bool {
+	for _, e := range events {
+		if reflect.DeepEqual(e, ev) {
+			return true
+		}
+	}
+	return false
+}
+
+func Test_potentialAuthError_dropsMessagesQueuedForEncryptionWhenTheAKEFails(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.Policies = Policies(PolicyAllowV3 | PolicyRequireEncryption)
+	c.Send(ValidMessage("hello"), "first")
+	c.Send(ValidMessage("again"), "second")
+	events := recordMessageEvents(c)
+
+	c.potentialAuthError(nil, errCorruptEncryptedSignature)
+
+	assertDeepEquals(t, *events, []recordedMessageEvent{
+		{MessageEventSetupError, "", errCorruptEncryptedSignature, nil},
+		{MessageEventQueuedMessageNotSent, "hello", errCorruptEncryptedSignature, []interface{}{"first"}},
+		{MessageEventQueuedMessageNotSent, "again", errCorruptEncryptedSignature, []interface{}{"second"}},
+	})
+	assertEquals(t, len(c.resend.pending()), 0)
+}
+
+func Test_potentialAuthError_keepsMessagesWaitingToBeResentWithPrefix(t *testing.T) {
+	c := &Conversation{}
+	fixtureCorrectResend(c)
+	c.resend.mayRetransmit = retransmitWithPrefix
+
+	c.potentialAuthError(nil, errCorruptEncryptedSignature)
+
+	assertEquals(t, len(c.resend.pending()), 1)
+}
+
+func Test_Send_flushesMessagesQueuedForEncryptionOnceTheConversationIsSecure(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	alice.Policies.RequireEncryption()
+	events := recordMessageEvents(alice)
+
+	toSend, _ := alice.Send(ValidMessage("hello"), "first")
+	var received []string
+	msgs := toSend
+	from, to := alice, bob
+	for len(msgs) > 0 {
+		var next []ValidMessage
+		for _, m := range msgs {
+			plain, ts, err := to.Receive(m)
+			assertNil(t, err)
+			if len(plain) > 0 {
+				received = append(received, string(plain))
+			}
+			next = append(next, ts...)
+		}
+		msgs = next
+		from, to = to, from
+	}
+
+	assertDeepEquals(t, received, []string{"hello"})
+	assertTrue(t, containsMessageEvent(*events, recordedMessageEvent{MessageEventMessageSent, "", nil, []interface{}{"first"}}))
+	assertFalse(t, containsMessageEvent(*events, recordedMessageEvent{MessageEventQueuedMessageNotSent, "hello", nil, []interface{}{"first"}}))
+}
+
+func Test_Receive_keepsMessagesQueuedForEncryptionWhenTheAKEGetsAMessageItCantUse(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	alice.Policies.RequireEncryption()
+	alice.Send(ValidMessage("hello"), "first")
+	events := recordMessageEvents(alice)
+
+	_, dhCommit, _ := alice.Receive(bob.QueryMessage())
+	_, dhKey, _ := bob.Receive(dhCommit[0])
+	decoded, _ := bob.decode(encodedMessage(dhKey[0]))
+	garbage := ValidMessage(bob.encode(decoded[:len(decoded)-10]))
+
+	_, _, err := alice.Receive(garbage)
+	assertTrue(t, err != nil)
+	assertEquals(t, len(alice.resend.pending()), 1)
+
+	var received []string
+	msgs := dhKey
+	from, to := bob, alice
+	for len(msgs) > 0 {
+		var next []ValidMessage
+		for _, m := range msgs {
+			plain, ts, err := to.Receive(m)
+			assertNil(t, err)
+			if len(plain) > 0 {
+				received = append(received, string(plain))
+			}
+			next = append(next, ts...)
+		}
+		msgs = next
+		from, to = to, from
+	}
+
+	assertDeepEquals(t, received, []string{"hello"})
+	assertFalse(t, containsMessageEvent(*events, recordedMessageEvent{MessageEventQueuedMessageNotSent, "hello", err, []interface{}{"first"}}))
+}
+
+func Test_maybeRetransmit_dropsMessagesQueuedForEncryptionThatAreTooOld(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	alice.Policies.RequireEncryption()
+
+	alice.Send(ValidMessage("hello"), "first")
+	alice.heartbeat.lastSent = time.Now().Add(-61 * time.Second)
+	events := recordMessageEvents(alice)
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	assertEquals(t, alice.IsEncrypted(), true)
+	assertTrue(t, containsMessageEvent(*events, recordedMessageEvent{MessageEventQueuedMessageNotSent, "hello", errQueuedMessageExpired, []interface{}{"first"}}))
+	assertEquals(t, len(alice.resend.pending()), 0)
+}
+
+// pendingWithoutMetadata returns the messages waiting to be resent, without when and why they were kept
+func pendingWithoutMetadata(c *Conversation) []messageToResend {
+	var ret []messageToResend
+	for _, msg := range c.resend.pending() {
+		ret = append(ret, messageToResend{m: msg.m, opaque: msg.opaque})
+	}
+	return ret
+}
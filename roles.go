@@ -0,0 +1,76 @@
+package otr3
+
+import "time"
+
+// Role tells which side of the AKE we were for a private conversation
+type Role int
+
+const (
+	// RoleUnknown means there hasn't been a private conversation
+	RoleUnknown Role = iota
+	// RoleInitiator means we sent the D-H Commit message that the AKE was finished from
+	RoleInitiator
+	// RoleResponder means the peer sent the D-H Commit message and we answered it
+	RoleResponder
+)
+
+// String returns the string representation of the Role
+func (r Role) String() string {
+	switch r {
+	case RoleUnknown:
+		return "RoleUnknown"
+	case RoleInitiator:
+		return "RoleInitiator"
+	case RoleResponder:
+		return "RoleResponder"
+	default:
+		return "ROLE: (THIS SHOULD NEVER HAPPEN)"
+	}
+}
+
+// maxSessionHistory is the number of private conversations SessionHistory remembers
+const maxSessionHistory = 16
+
+// SessionRecord describes a private conversation of this Conversation
+type SessionRecord struct {
+	// Role is the side of the AKE we were
+	Role Role
+	// SSID is the secure session id of the private conversation
+	SSID [8]byte
+	// Version is the protocol version, 2 or 3
+	Version int
+	// Began is when the AKE finished, by the clock of the conversation
+	Began time.Time
+	// End is how the private conversation ended. By is EndedByNobody while it is going on,
+	// and when it was replaced by a new AKE, for example with Refresh.
+	End SessionEnd
+}
+
+// Role returns the side of the AKE we were for the current private conversation, or the
+// last one if there isn't a private conversation right now
+func (c *Conversation) Role() Role {
+	if len(c.sessionHistory) == 0 {
+		return RoleUnknown
+	}
+	return c.sessionHistory[len(c.sessionHistory)-1].Role
+}
+
+// SessionHistory returns the last private conversations of this Conversation, oldest first.
+// The last one is the current private conversation, if there is one. Changing the result doesn't affect the conversation.
+func (c *Conversation) SessionHistory() []SessionRecord {
+	return append([]SessionRecord(nil), c.sessionHistory...)
+}
+
+func (c *Conversation) sessionBegan(role Role) {
+	record := SessionRecord{
+		Role:    role,
+		SSID:    c.ssid,
+		Version: int(c.version.protocolVersion()),
+		Began:   c.now(),
+	}
+
+	c.sessionHistory = append(c.sessionHistory, record)
+	if len(c.sessionHistory) > maxSessionHistory {
+		c.sessionHistory = append([]SessionRecord(nil), c.sessionHistory[len(c.sessionHistory)-maxSessionHistory:]...)
+	}
+}
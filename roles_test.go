@@ -0,0 +1,105 @@
+package otr3
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_Role_isUnknownBeforeThereIsAPrivateConversation(t *testing.T) {
+	c := &Conversation{}
+
+	assertEquals(t, c.Role(), RoleUnknown)
+	assertEquals(t, len(c.SessionHistory()), 0)
+}
+
+func Test_Role_isInitiatorForTheSideThatSentTheDHCommit(t *testing.T) {
+	alice, bob := benchmarkConversations()
+
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	// bob answers the query message of alice with the D-H Commit message
+	assertEquals(t, bob.Role(), RoleInitiator)
+	assertEquals(t, alice.Role(), RoleResponder)
+}
+
+func Test_Role_followsWhoStartedTheLastAKE(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	toSend, _ := alice.Refresh()
+	exchangeUntilQuiet(t, alice, bob, toSend)
+
+	assertEquals(t, alice.Role(), RoleInitiator)
+	assertEquals(t, bob.Role(), RoleResponder)
+}
+
+func Test_Role_isResponderWhenWeAnswerTheDHCommitOfThePeerInsteadOfOurs(t *testing.T) {
+	c := bobContextAtAwaitingDHKey()
+	c.ake.role = RoleInitiator
+
+	c.processAKE(msgTypeDHCommit, fixtureDHCommitMsgBody())
+
+	assertEquals(t, c.ake.role, RoleResponder)
+}
+
+func Test_SessionHistory_recordsEveryPrivateConversation(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+	alice, bob := benchmarkConversations()
+	alice.SetClock(clock)
+
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	firstSSID := alice.GetSSID()
+	clock.advance(time.Minute)
+	toSend, _ := alice.Refresh()
+	exchangeUntilQuiet(t, alice, bob, toSend)
+
+	assertDeepEquals(t, alice.SessionHistory(), []SessionRecord{
+		{Role: RoleResponder, SSID: firstSSID, Version: 3, Began: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)},
+		{Role: RoleInitiator, SSID: alice.GetSSID(), Version: 3, Began: time.Date(2016, 1, 1, 12, 1, 0, 0, time.UTC)},
+	})
+}
+
+func Test_SessionHistory_recordsHowThePrivateConversationEnded(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	bob.SetClock(clock)
+
+	toSend, _ := alice.End()
+	bob.Receive(toSend[0])
+
+	history := bob.SessionHistory()
+	assertEquals(t, len(history), 1)
+	assertDeepEquals(t, history[0].End, SessionEnd{By: EndedByThem, At: clock.now})
+	assertEquals(t, bob.Role(), RoleInitiator)
+}
+
+func Test_SessionHistory_onlyRemembersTheLastPrivateConversations(t *testing.T) {
+	c := &Conversation{version: otrV3{}}
+	for i := 0; i < maxSessionHistory+3; i++ {
+		c.ssid = [8]byte{byte(i)}
+		c.sessionBegan(RoleInitiator)
+	}
+
+	history := c.SessionHistory()
+
+	assertEquals(t, len(history), maxSessionHistory)
+	assertEquals(t, history[0].SSID, [8]byte{3})
+	assertEquals(t, history[maxSessionHistory-1].SSID, [8]byte{maxSessionHistory + 2})
+}
+
+func Test_SessionHistory_returnsACopy(t *testing.T) {
+	c := &Conversation{version: otrV3{}}
+	c.sessionBegan(RoleInitiator)
+
+	c.SessionHistory()[0].Role = RoleResponder
+
+	assertEquals(t, c.Role(), RoleInitiator)
+}
+
+func Test_Role_String(t *testing.T) {
+	assertEquals(t, RoleUnknown.String(), "RoleUnknown")
+	assertEquals(t, RoleInitiator.String(), "RoleInitiator")
+	assertEquals(t, RoleResponder.String(), "RoleResponder")
+	assertEquals(t, Role(42).String(), "ROLE: (THIS SHOULD NEVER HAPPEN)")
+}
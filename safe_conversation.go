@@ -0,0 +1,85 @@
+package otr3
+
+import "sync"
+
+// SafeConversation makes a conversation safe to use from several goroutines - for example from the
+// goroutine reading from the network and the goroutine of the user interface at the same time.
+// A Conversation itself has a single owner: its methods must not be called concurrently, since sending
+// and receiving both change the keys and the counters of the private conversation.
+//
+// Every method of a SafeConversation holds the lock for as long as the conversation works on the
+// message, so the event handlers of the conversation are called with the lock held. They must not call
+// the SafeConversation again, or they will deadlock. Once a conversation is wrapped, it should only be
+// used through the wrapper - Do gives access to the rest of the API.
+type SafeConversation struct {
+	lock sync.Mutex
+	c    *Conversation
+}
+
+// NewSafeConversation wraps the conversation so it can be used from several goroutines
+func NewSafeConversation(c *Conversation) *SafeConversation {
+	return &SafeConversation{c: c}
+}
+
+// Do calls the function with the conversation while holding the lock, so any method of the
+// conversation can be used safely. The function must not keep the conversation to use it later.
+func (s *SafeConversation) Do(f func(c *Conversation)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	f(s.c)
+}
+
+// Send works like Conversation.Send
+func (s *SafeConversation) Send(m ValidMessage, trace ...interface{}) (toSend []ValidMessage, err error) {
+	s.Do(func(c *Conversation) { toSend, err = c.Send(m, trace...) })
+	return
+}
+
+// Receive works like Conversation.Receive
+func (s *SafeConversation) Receive(m ValidMessage) (plain MessagePlaintext, toSend []ValidMessage, err error) {
+	s.Do(func(c *Conversation) { plain, toSend, err = c.Receive(m) })
+	return
+}
+
+// QueryMessage works like Conversation.QueryMessage
+func (s *SafeConversation) QueryMessage() (msg ValidMessage) {
+	s.Do(func(c *Conversation) { msg = c.QueryMessage() })
+	return
+}
+
+// IsEncrypted works like Conversation.IsEncrypted
+func (s *SafeConversation) IsEncrypted() (encrypted bool) {
+	s.Do(func(c *Conversation) { encrypted = c.IsEncrypted() })
+	return
+}
+
+// End works like Conversation.End
+func (s *SafeConversation) End() (toSend []ValidMessage, err error) {
+	s.Do(func(c *Conversation) { toSend, err = c.End() })
+	return
+}
+
+// Refresh works like Conversation.Refresh
+func (s *SafeConversation) Refresh() (toSend []ValidMessage, err error) {
+	s.Do(func(c *Conversation) { toSend, err = c.Refresh() })
+	return
+}
+
+// StartAuthenticate works like Conversation.StartAuthenticate
+func (s *SafeConversation) StartAuthenticate(question string, mutualSecret []byte) (toSend []ValidMessage, err error) {
+	s.Do(func(c *Conversation) { toSend, err = c.StartAuthenticate(question, mutualSecret) })
+	return
+}
+
+// ProvideAuthenticationSecret works like Conversation.ProvideAuthenticationSecret
+func (s *SafeConversation) ProvideAuthenticationSecret(mutualSecret []byte) (toSend []ValidMessage, err error) {
+	s.Do(func(c *Conversation) { toSend, err = c.ProvideAuthenticationSecret(mutualSecret) })
+	return
+}
+
+// AbortAuthentication works like Conversation.AbortAuthentication
+func (s *SafeConversation) AbortAuthentication() (toSend []ValidMessage, err error) {
+	s.Do(func(c *Conversation) { toSend, err = c.AbortAuthentication() })
+	return
+}
@@ -0,0 +1,74 @@
+package otr3
+
+import (
+	"sync"
+	"testing"
+)
+
+func Test_SafeConversation_sendsAndReceivesLikeTheConversation(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	safeAlice := NewSafeConversation(alice)
+	safeBob := NewSafeConversation(bob)
+
+	msg, err := safeAlice.Send(ValidMessage("hello"))
+	assertNil(t, err)
+	plain, _, err := safeBob.Receive(msg[0])
+
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+	assertEquals(t, safeAlice.IsEncrypted(), true)
+}
+
+func Test_SafeConversation_canSendAndReceiveFromDifferentGoroutines(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	safeAlice := NewSafeConversation(alice)
+
+	const count = 20
+	fromBob := make([]ValidMessage, 0, count)
+	for i := 0; i < count; i++ {
+		msg, _ := bob.Send(ValidMessage("from bob"))
+		fromBob = append(fromBob, msg[0])
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	sent := make(chan ValidMessage, count)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < count; i++ {
+			msg, err := safeAlice.Send(ValidMessage("from alice"))
+			assertNil(t, err)
+			sent <- msg[0]
+		}
+	}()
+	received := 0
+	go func() {
+		defer wg.Done()
+		for _, msg := range fromBob {
+			plain, _, err := safeAlice.Receive(msg)
+			assertNil(t, err)
+			if string(plain) == "from bob" {
+				received++
+			}
+		}
+	}()
+	wg.Wait()
+	close(sent)
+
+	assertEquals(t, received, count)
+	for msg := range sent {
+		plain, _, err := bob.Receive(msg)
+		assertNil(t, err)
+		assertDeepEquals(t, plain, MessagePlaintext("from alice"))
+	}
+}
+
+func Test_SafeConversation_DoGivesTheWrappedConversation(t *testing.T) {
+	c := &Conversation{}
+	s := NewSafeConversation(c)
+
+	var got *Conversation
+	s.Do(func(inner *Conversation) { got = inner })
+
+	assertEquals(t, got, c)
+}
@@ -0,0 +1,36 @@
+package otr3
+
+// SecretPlaintext holds received plaintext that should not stay around in memory any longer than necessary.
+// Once the caller is done with the plaintext, Wipe should be called to overwrite it.
+type SecretPlaintext struct {
+	data []byte
+}
+
+// Bytes returns the plaintext. The returned slice is overwritten when Wipe is called.
+func (s *SecretPlaintext) Bytes() []byte {
+	if s == nil {
+		return nil
+	}
+	return s.data
+}
+
+// Wipe overwrites the plaintext with zeroes
+func (s *SecretPlaintext) Wipe() {
+	if s == nil {
+		return
+	}
+	wipeBytes(s.data)
+	s.data = nil
+}
+
+// ReceiveWipeable works like Receive, but returns the plaintext in a SecretPlaintext that the caller should Wipe
+// when done with it. The conversation doesn't keep any other copy of the decrypted plaintext around.
+// The returned SecretPlaintext is nil if the message had no plaintext for the user.
+func (c *Conversation) ReceiveWipeable(m ValidMessage) (*SecretPlaintext, []ValidMessage, error) {
+	plain, toSend, err := c.Receive(m)
+	if plain == nil {
+		return nil, toSend, err
+	}
+
+	return &SecretPlaintext{data: plain}, toSend, err
+}
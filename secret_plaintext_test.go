@@ -0,0 +1,62 @@
+package otr3
+
+import (
+	"bytes"
+	"testing"
+)
+
+func Test_SecretPlaintext_Wipe_overwritesThePlaintext(t *testing.T) {
+	data := []byte("secret")
+	s := &SecretPlaintext{data: data}
+
+	s.Wipe()
+
+	assertDeepEquals(t, data, []byte{0, 0, 0, 0, 0, 0})
+	assertNil(t, s.Bytes())
+}
+
+func Test_SecretPlaintext_canBeUsedWhenNil(t *testing.T) {
+	var s *SecretPlaintext
+
+	s.Wipe()
+
+	assertNil(t, s.Bytes())
+}
+
+func Test_ReceiveWipeable_returnsTheDecryptedPlaintextInAWipeableBuffer(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	toSend, _ := alice.Send(ValidMessage("the secret plans"))
+
+	s, _, err := bob.ReceiveWipeable(toSend[0])
+	assertNil(t, err)
+	plain := s.Bytes()
+	assertDeepEquals(t, plain, []byte("the secret plans"))
+
+	s.Wipe()
+	assertDeepEquals(t, plain, make([]byte, len("the secret plans")))
+}
+
+func Test_ReceiveWipeable_returnsNilForMessagesWithoutPlaintext(t *testing.T) {
+	alice, bob := benchmarkConversations()
+
+	s, toSend, err := bob.ReceiveWipeable(alice.QueryMessage())
+
+	assertNil(t, err)
+	assertNil(t, s)
+	assertEquals(t, len(toSend), 1)
+}
+
+func Test_processDataMessage_wipesTheDecryptedMessageBuffer(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	toSend, _ := alice.Send(ValidMessage("the secret plans"))
+	decoded, _ := bob.decode(encodedMessage(toSend[0]))
+	header, body, _ := bob.parseMessageHeader(decoded)
+
+	plain, _, err := bob.processDataMessageWithRawErrors(header, body)
+
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("the secret plans"))
+	assertEquals(t, bytes.Contains(decoded, []byte("the secret plans")), false)
+}
@@ -0,0 +1,34 @@
+package otr3
+
+import "math/big"
+
+// secretScratch holds the big.Ints that values derived from secrets - like the Diffie-Hellman shared
+// secrets - are computed into. Every computation with math/big allocates a new result, and those results
+// are left for the GC to collect with the secret still in them. Computing into the same preallocated
+// big.Ints instead lets a conversation keep reusing memory it owns and wipe it as soon as the value
+// has been used. Since the scratch belongs to the conversation, only code that already changes the conversation
+// uses it - read-only code like DecryptDataMessage passes a nil scratch, so it can run concurrently.
+//
+// This only reduces the copies of secrets left in memory, it doesn't eliminate them: math/big still
+// allocates temporaries inside Exp and the other operations, and those can't be reached to be wiped.
+// SECURITY_ASSUMPTIONS.md describes what is assumed about the rest.
+type secretScratch struct {
+	sharedSecret big.Int
+}
+
+// modExp calculates g^x mod p into the scratch shared secret and returns it. The result is only
+// valid until the scratch is used or wiped again. A nil scratch calculates into a new big.Int.
+func (s *secretScratch) modExp(g, x *big.Int) *big.Int {
+	if s == nil {
+		return modExp(g, x)
+	}
+	return s.sharedSecret.Exp(g, x, p)
+}
+
+func (s *secretScratch) wipe() {
+	if s == nil {
+		return
+	}
+
+	wipeBigInt(&s.sharedSecret)
+}
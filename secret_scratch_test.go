@@ -0,0 +1,53 @@
+package otr3
+
+import (
+	"math/big"
+	"testing"
+)
+
+func Test_secretScratch_modExpCalculatesIntoTheScratch(t *testing.T) {
+	s := &secretScratch{}
+
+	res := s.modExp(big.NewInt(3), big.NewInt(5))
+
+	assertEquals(t, res, &s.sharedSecret)
+	assertEquals(t, res.Cmp(big.NewInt(243)), 0)
+}
+
+func Test_secretScratch_modExpWithoutAScratchCalculatesIntoANewNumber(t *testing.T) {
+	var s *secretScratch
+
+	res := s.modExp(big.NewInt(3), big.NewInt(5))
+
+	assertEquals(t, res.Cmp(big.NewInt(243)), 0)
+}
+
+func Test_secretScratch_wipeZeroesTheSharedSecret(t *testing.T) {
+	s := &secretScratch{}
+	res := s.modExp(g1, fixtureLong1)
+	limbs := res.Bits()
+
+	s.wipe()
+
+	assertEquals(t, s.sharedSecret.Sign(), 0)
+	for _, l := range limbs {
+		assertEquals(t, l, big.Word(0))
+	}
+}
+
+func Test_secretScratch_isWipedAfterTheAKE(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+
+	assertEquals(t, alice.secrets.sharedSecret.Sign(), 0)
+	assertEquals(t, bob.secrets.sharedSecret.Sign(), 0)
+}
+
+func Test_secretScratch_isWipedAfterExchangingDataMessages(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+
+	msg, _ := alice.Send(ValidMessage("hello"))
+	bob.Receive(msg[0])
+
+	assertEquals(t, alice.secrets.sharedSecret.Sign(), 0)
+	assertEquals(t, bob.secrets.sharedSecret.Sign(), 0)
+}
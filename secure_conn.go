@@ -0,0 +1,267 @@
+package otr3
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// maxSecureConnLine is the longest line a SecureConn reads from the stream. Every OTR message
+// is sent on a line of its own, and even an unfragmented data message is far shorter than this.
+const maxSecureConnLine = 1 << 20
+
+// SecureConn carries a private OTR conversation over any stream - for example a TCP connection - so the
+// package can be used for ad-hoc secure channels and not only over instant messaging. Every OTR message is
+// written to the stream on a line of its own. SecureClient and SecureServer run the AKE before returning,
+// and after that, Read and Write carry the plaintext in encrypted data messages. Fragmentation, heartbeats,
+// SMP and the other messages of the protocol are handled by the conversation as usual.
+//
+// Read and Write can be called from different goroutines at the same time, like with a net.Conn. Both ends have
+// to keep reading, since the conversation answers some messages on its own - for example with heartbeats.
+// The conversation should only be used through the SecureConn after it has been wrapped - Conversation gives
+// safe access to it, for example to start SMP.
+type SecureConn struct {
+	rw io.ReadWriter
+	c  *SafeConversation
+	r  *bufio.Reader
+
+	readLock  sync.Mutex
+	unread    []byte
+	writeLock sync.Mutex
+}
+
+// SecureClient starts the AKE over the stream by sending a query message, and returns once the conversation is private.
+// The conversation needs our keys and has to allow at least one protocol version. Encryption is always required
+// on a SecureConn, so PolicyRequireEncryption is set.
+//
+// The AKE alone only proves that the peer has some DSA key, so anyone who can get between the two ends of the
+// stream could finish it. The handshake therefore only succeeds if the peer used a key registered with
+// ExpectTheirKey or ExpectTheirFingerprint, or one the trust store set with SetTrustStore says is trusted.
+// Otherwise the conversation is ended without telling the peer, and an error is returned. The stream should
+// be closed after any error.
+func SecureClient(rw io.ReadWriter, c *Conversation) (*SecureConn, error) {
+	s := newSecureConn(rw, c)
+	if err := s.writeMessages([]ValidMessage{s.c.QueryMessage()}); err != nil {
+		return nil, err
+	}
+	if err := s.handshake(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SecureServer waits for the peer to start the AKE over the stream, and returns once the conversation is private.
+// The conversation is set up, and the key of the peer checked, like for SecureClient.
+func SecureServer(rw io.ReadWriter, c *Conversation) (*SecureConn, error) {
+	s := newSecureConn(rw, c)
+	if err := s.handshake(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func newSecureConn(rw io.ReadWriter, c *Conversation) *SecureConn {
+	c.Policies.RequireEncryption()
+	return &SecureConn{
+		rw: rw,
+		c:  NewSafeConversation(c),
+		r:  bufio.NewReader(rw),
+	}
+}
+
+func (s *SecureConn) handshake() error {
+	for !s.c.IsEncrypted() {
+		if _, err := s.receiveMessage(); err != nil {
+			return err
+		}
+	}
+
+	var authenticated bool
+	s.c.Do(func(c *Conversation) {
+		authenticated = (c.HasExpectedKeys() && c.IsTheirKeyExpected()) || c.IsTheirFingerprintTrusted()
+		if !authenticated {
+			c.End()
+		}
+	})
+	if !authenticated {
+		return errUnauthenticatedPeer
+	}
+	return nil
+}
+
+// Conversation returns the conversation carried over the stream
+func (s *SecureConn) Conversation() *SafeConversation {
+	return s.c
+}
+
+// Read reads the plaintext the peer has written. It returns io.EOF once the peer has ended the private conversation.
+// Anything else on the stream that carries text - like plaintext or whitespace tagged messages - makes Read return
+// an error instead, since it can't have come from the peer of the private conversation.
+func (s *SecureConn) Read(p []byte) (int, error) {
+	s.readLock.Lock()
+	defer s.readLock.Unlock()
+
+	for len(s.unread) == 0 {
+		if !s.c.IsEncrypted() {
+			return 0, io.EOF
+		}
+
+		plain, err := s.receiveMessage()
+		if err != nil {
+			return 0, err
+		}
+		s.unread = plain
+	}
+
+	n := copy(p, s.unread)
+	s.unread = s.unread[n:]
+	return n, nil
+}
+
+// receiveMessage reads one message from the stream, lets the conversation handle it and writes the replies
+func (s *SecureConn) receiveMessage() (MessagePlaintext, error) {
+	line, err := s.readLine()
+	if err != nil {
+		return nil, err
+	}
+
+	var plain MessagePlaintext
+	var toSend []ValidMessage
+	private := false
+	s.c.Do(func(c *Conversation) {
+		plain, toSend, err = c.Receive(ValidMessage(line))
+		private = c.receivedPrivately
+	})
+	if werr := s.writeMessages(toSend); werr != nil {
+		return nil, werr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Plaintext and whitespace tagged messages can be written onto the stream by anyone,
+	// so only what was decrypted from an authenticated data message is ever handed out
+	if len(plain) > 0 && !private {
+		return nil, errUnauthenticatedPlaintext
+	}
+
+	return plain, nil
+}
+
+func (s *SecureConn) readLine() ([]byte, error) {
+	var line []byte
+	for {
+		part, err := s.r.ReadSlice('\n')
+		line = append(line, part...)
+		if len(line) > maxSecureConnLine {
+			return nil, errFieldTooLong
+		}
+
+		switch err {
+		case nil:
+			return bytes.TrimRight(line, "\r\n"), nil
+		case bufio.ErrBufferFull:
+			continue
+		case io.EOF:
+			if len(line) > 0 {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, io.EOF
+		default:
+			return nil, err
+		}
+	}
+}
+
+// Write sends the plaintext to the peer in one encrypted data message, fragmented if the conversation
+// has a fragment size. Writing nothing sends nothing.
+func (s *SecureConn) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	// Encryption is required, so the conversation would keep the message until a new AKE has finished
+	if !s.c.IsEncrypted() {
+		return 0, errCannotSendUnencrypted
+	}
+
+	toSend, err := s.c.Send(ValidMessage(p))
+	if err != nil {
+		return 0, err
+	}
+
+	if err := s.writeMessages(toSend); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (s *SecureConn) writeMessages(msgs []ValidMessage) error {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	for _, m := range msgs {
+		if _, err := s.rw.Write(append(makeCopy(m), '\n')); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close ends the private conversation, telling the peer, and closes the stream if it can be closed
+func (s *SecureConn) Close() error {
+	toSend, err := s.c.End()
+	if err == nil {
+		err = s.writeMessages(toSend)
+	}
+
+	if closer, ok := s.rw.(io.Closer); ok {
+		if cerr := closer.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// LocalAddr returns the local address of the stream if it is a net.Conn, and nil otherwise
+func (s *SecureConn) LocalAddr() net.Addr {
+	if conn, ok := s.rw.(net.Conn); ok {
+		return conn.LocalAddr()
+	}
+	return nil
+}
+
+// RemoteAddr returns the remote address of the stream if it is a net.Conn, and nil otherwise
+func (s *SecureConn) RemoteAddr() net.Addr {
+	if conn, ok := s.rw.(net.Conn); ok {
+		return conn.RemoteAddr()
+	}
+	return nil
+}
+
+// SetDeadline sets the deadlines of the stream if it is a net.Conn, and returns an error otherwise
+func (s *SecureConn) SetDeadline(t time.Time) error {
+	if conn, ok := s.rw.(net.Conn); ok {
+		return conn.SetDeadline(t)
+	}
+	return errDeadlinesNotSupported
+}
+
+// SetReadDeadline sets the read deadline of the stream if it is a net.Conn, and returns an error otherwise
+func (s *SecureConn) SetReadDeadline(t time.Time) error {
+	if conn, ok := s.rw.(net.Conn); ok {
+		return conn.SetReadDeadline(t)
+	}
+	return errDeadlinesNotSupported
+}
+
+// SetWriteDeadline sets the write deadline of the stream if it is a net.Conn, and returns an error otherwise
+func (s *SecureConn) SetWriteDeadline(t time.Time) error {
+	if conn, ok := s.rw.(net.Conn); ok {
+		return conn.SetWriteDeadline(t)
+	}
+	return errDeadlinesNotSupported
+}
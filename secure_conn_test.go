@@ -0,0 +1,222 @@
+package otr3
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+)
+
+// secureConversations returns conversations that expect each other's keys, so the handshake of a SecureConn succeeds
+func secureConversations() (alice, bob *Conversation) {
+	alice, bob = benchmarkConversations()
+	alice.ExpectTheirKey(bobPrivateKey.PublicKey())
+	bob.ExpectTheirKey(alicePrivateKey.PublicKey())
+	return alice, bob
+}
+
+// secureConns runs the AKE over a pipe and returns both ends
+func secureConns(t *testing.T) (client, server *SecureConn) {
+	alice, bob := secureConversations()
+	clientSide, serverSide := net.Pipe()
+
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		server, err = SecureServer(serverSide, bob)
+		done <- err
+	}()
+
+	client, err := SecureClient(clientSide, alice)
+	assertNil(t, err)
+	assertNil(t, <-done)
+
+	return client, server
+}
+
+// writeAndKeepReading writes the message and then handles what the other end sends, like heartbeats
+func writeAndKeepReading(conn *SecureConn, msg []byte) {
+	conn.Write(msg)
+	io.Copy(ioutil.Discard, conn)
+}
+
+func Test_SecureConn_isPrivateAfterTheHandshake(t *testing.T) {
+	client, server := secureConns(t)
+
+	assertEquals(t, client.Conversation().IsEncrypted(), true)
+	assertEquals(t, server.Conversation().IsEncrypted(), true)
+}
+
+func Test_SecureConn_carriesWhatIsWrittenToTheOtherEnd(t *testing.T) {
+	client, server := secureConns(t)
+
+	go writeAndKeepReading(client, []byte("hello over a stream"))
+
+	buf := make([]byte, 5)
+	n, err := server.Read(buf)
+	assertNil(t, err)
+	assertDeepEquals(t, buf[:n], []byte("hello"))
+
+	rest := make([]byte, 100)
+	n, err = server.Read(rest)
+	assertNil(t, err)
+	assertDeepEquals(t, rest[:n], []byte(" over a stream"))
+}
+
+func Test_SecureConn_encryptsWhatIsWritten(t *testing.T) {
+	alice, bob := secureConversations()
+	var wire bytes.Buffer
+	clientSide, serverSide := net.Pipe()
+	done := make(chan *SecureConn, 1)
+	go func() {
+		server, _ := SecureServer(serverSide, bob)
+		done <- server
+	}()
+	client, _ := SecureClient(clientSide, alice)
+	<-done
+
+	client.rw = &wire
+	client.Write([]byte("a secret"))
+
+	assertEquals(t, bytes.Contains(wire.Bytes(), []byte("a secret")), false)
+	assertEquals(t, bytes.HasPrefix(wire.Bytes(), msgMarker), true)
+}
+
+func Test_SecureConn_handlesFragmentedMessages(t *testing.T) {
+	client, server := secureConns(t)
+	client.Conversation().Do(func(c *Conversation) { c.SetFragmentSize(100) })
+	long := bytes.Repeat([]byte("a long message "), 50)
+
+	go writeAndKeepReading(client, long)
+
+	buf := make([]byte, len(long))
+	_, err := io.ReadFull(server, buf)
+	assertNil(t, err)
+	assertDeepEquals(t, buf, long)
+}
+
+func Test_SecureConn_readReturnsEOFWhenThePeerEnds(t *testing.T) {
+	client, server := secureConns(t)
+
+	go client.Close()
+
+	_, err := server.Read(make([]byte, 10))
+	assertEquals(t, err, io.EOF)
+}
+
+func Test_SecureConn_writingNothingSendsNothing(t *testing.T) {
+	client, _ := secureConns(t)
+
+	n, err := client.Write(nil)
+
+	assertEquals(t, n, 0)
+	assertNil(t, err)
+}
+
+func Test_SecureConn_handshakeFailsWhenTheStreamEnds(t *testing.T) {
+	_, bob := benchmarkConversations()
+
+	_, err := SecureServer(bytes.NewBuffer(nil), bob)
+
+	assertEquals(t, err, io.EOF)
+}
+
+// handshake runs the AKE over a pipe and returns what both constructors returned
+func handshake(alice, bob *Conversation) (client, server *SecureConn, clientErr, serverErr error) {
+	clientSide, serverSide := net.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		var err error
+		server, err = SecureServer(serverSide, bob)
+		done <- err
+	}()
+	client, clientErr = SecureClient(clientSide, alice)
+	serverErr = <-done
+	return
+}
+
+func Test_SecureConn_handshakeFailsWhenThePeerIsNotAuthenticated(t *testing.T) {
+	alice, bob := benchmarkConversations()
+
+	client, server, clientErr, serverErr := handshake(alice, bob)
+
+	assertEquals(t, clientErr, errUnauthenticatedPeer)
+	assertEquals(t, serverErr, errUnauthenticatedPeer)
+	assertNil(t, client)
+	assertNil(t, server)
+	assertEquals(t, alice.IsEncrypted(), false)
+	assertEquals(t, bob.IsEncrypted(), false)
+}
+
+func Test_SecureConn_handshakeFailsWhenThePeerUsesAnUnexpectedKey(t *testing.T) {
+	alice, bob := secureConversations()
+	alice.expectedFingerprints = nil
+	alice.ExpectTheirKey(alicePrivateKey.PublicKey())
+
+	client, _, clientErr, _ := handshake(alice, bob)
+
+	assertEquals(t, clientErr, errUnauthenticatedPeer)
+	assertNil(t, client)
+}
+
+func Test_SecureConn_handshakeSucceedsWithAKeyTheTrustStoreTrusts(t *testing.T) {
+	alice, bob := secureConversations()
+	store := NewMemoryTrustStore()
+	store.Add("bob", bobPrivateKey.PublicKey().Fingerprint())
+	store.SetTrusted("bob", bobPrivateKey.PublicKey().Fingerprint(), true)
+	alice.expectedFingerprints = nil
+	alice.SetTrustStore(store, "bob")
+
+	client, server, clientErr, serverErr := handshake(alice, bob)
+
+	assertNil(t, clientErr)
+	assertNil(t, serverErr)
+	assertEquals(t, client.Conversation().IsEncrypted(), true)
+	assertEquals(t, server.Conversation().IsEncrypted(), true)
+}
+
+func Test_SecureConn_deadlinesNeedANetConn(t *testing.T) {
+	s := newSecureConn(&bytes.Buffer{}, &Conversation{})
+
+	assertEquals(t, s.SetDeadline(time.Time{}), errDeadlinesNotSupported)
+	assertNil(t, s.LocalAddr())
+}
+
+var _ net.Conn = &SecureConn{}
+
+// secureConnWithInjectedLine returns the server end of a private conversation with the line written onto its stream
+func secureConnWithInjectedLine(t *testing.T, line string) *SecureConn {
+	alice, bob := secureConversations()
+	clientSide, serverSide := net.Pipe()
+	done := make(chan *SecureConn, 1)
+	go func() {
+		server, _ := SecureServer(serverSide, bob)
+		done <- server
+	}()
+	SecureClient(clientSide, alice)
+	server := <-done
+
+	server.r = bufio.NewReader(bytes.NewBufferString(line + "\n"))
+	return server
+}
+
+func Test_SecureConn_readRejectsPlaintextWrittenOntoTheStream(t *testing.T) {
+	server := secureConnWithInjectedLine(t, "transfer all funds")
+
+	n, err := server.Read(make([]byte, 100))
+
+	assertEquals(t, n, 0)
+	assertEquals(t, err, errUnauthenticatedPlaintext)
+}
+
+func Test_SecureConn_readRejectsWhitespaceTaggedPlaintextWrittenOntoTheStream(t *testing.T) {
+	server := secureConnWithInjectedLine(t, "transfer all funds"+string(genWhitespaceTag(Policies(PolicyAllowV3))))
+
+	n, err := server.Read(make([]byte, 100))
+
+	assertEquals(t, n, 0)
+	assertEquals(t, err, errUnauthenticatedPlaintext)
+}
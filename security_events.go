@@ -12,6 +12,19 @@ const (
 	GoneSecure
 	// StillSecure is signalled when we have refreshed the security state but is still in a secure state
 	StillSecure
+	// TheirKeyExpected is signalled after GoneSecure or StillSecure if the peer used one of the keys registered with ExpectTheirKey
+	TheirKeyExpected
+	// TheirKeyUnexpected is signalled after GoneSecure or StillSecure if keys have been registered with ExpectTheirKey,
+	// but the peer used a different key. The conversation is encrypted, but we might be talking to someone else.
+	TheirKeyUnexpected
+	// TheirFingerprintNew is signalled after GoneSecure or StillSecure if the trust store didn't know any fingerprints of the peer
+	TheirFingerprintNew
+	// TheirFingerprintChanged is signalled after GoneSecure or StillSecure if the peer used a key that the trust store didn't know,
+	// but other fingerprints of the peer were known
+	TheirFingerprintChanged
+	// TheirVerificationExpired is signalled when the verification of the peer has outlived the VerificationLifetime
+	// of the conversation. No more messages can be sent until the peer is verified again
+	TheirVerificationExpired
 )
 
 // SecurityEventHandler is an interface for events that are related to changes of security status
@@ -43,6 +56,16 @@ func (s SecurityEvent) String() string {
 		return "GoneSecure"
 	case StillSecure:
 		return "StillSecure"
+	case TheirKeyExpected:
+		return "TheirKeyExpected"
+	case TheirKeyUnexpected:
+		return "TheirKeyUnexpected"
+	case TheirFingerprintNew:
+		return "TheirFingerprintNew"
+	case TheirFingerprintChanged:
+		return "TheirFingerprintChanged"
+	case TheirVerificationExpired:
+		return "TheirVerificationExpired"
 	default:
 		return "SECURITY EVENT: (THIS SHOULD NEVER HAPPEN)"
 	}
@@ -6,6 +6,11 @@ func Test_SecurityEvent_hasValidStringImplementation(t *testing.T) {
 	assertEquals(t, GoneInsecure.String(), "GoneInsecure")
 	assertEquals(t, GoneSecure.String(), "GoneSecure")
 	assertEquals(t, StillSecure.String(), "StillSecure")
+	assertEquals(t, TheirKeyExpected.String(), "TheirKeyExpected")
+	assertEquals(t, TheirKeyUnexpected.String(), "TheirKeyUnexpected")
+	assertEquals(t, TheirFingerprintNew.String(), "TheirFingerprintNew")
+	assertEquals(t, TheirFingerprintChanged.String(), "TheirFingerprintChanged")
+	assertEquals(t, TheirVerificationExpired.String(), "TheirVerificationExpired")
 	assertEquals(t, SecurityEvent(20000).String(), "SECURITY EVENT: (THIS SHOULD NEVER HAPPEN)")
 }
 
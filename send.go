@@ -7,7 +7,10 @@ import (
 
 // Send takes a human readable message from the local user, possibly encrypts
 // it and returns zero or more messages to send to the peer.
-func (c *Conversation) Send(m ValidMessage, trace ...interface{}) ([]ValidMessage, error) {
+// If the ContainPanics policy is set, a panic while handling the message is returned as an error.
+func (c *Conversation) Send(m ValidMessage, trace ...interface{}) (toSend []ValidMessage, err error) {
+	defer c.containPanic(&err)
+
 	message := makeCopy(m)
 	defer wipeBytes(message)
 
@@ -15,6 +18,14 @@ func (c *Conversation) Send(m ValidMessage, trace ...interface{}) ([]ValidMessag
 		return []ValidMessage{makeCopy(message)}, nil
 	}
 
+	c.trimOutbox()
+
+	// An encrypted empty message looks exactly like a heartbeat, so the peer couldn't tell it was sent on purpose.
+	// One that is sent in plaintext reaches the peer as it is.
+	if len(message) == 0 && c.wouldEncrypt() {
+		return nil, ErrEmptyMessage
+	}
+
 	if c.debug && bytes.Index(message, []byte(debugString)) != -1 {
 		c.dump(bufio.NewWriter(standardErrorOutput))
 		return nil, nil
@@ -33,43 +44,73 @@ func (c *Conversation) Send(m ValidMessage, trace ...interface{}) ([]ValidMessag
 	return c.withInjections(nil, newOtrError("cannot send message in current state"))
 }
 
+// wouldEncrypt returns true if a message sent now would be encrypted - right away, or once it has been queued until
+// the conversation is private
+func (c *Conversation) wouldEncrypt() bool {
+	switch c.msgState {
+	case encrypted:
+		return true
+	case plainText:
+		return c.Policies.Has(PolicyRequireEncryption)
+	}
+	return false
+}
+
 func (c *Conversation) sendMessageOnPlaintext(message ValidMessage, trace ...interface{}) ([]ValidMessage, error) {
-	if c.Policies.has(requireEncryption) {
-		c.messageEvent(MessageEventEncryptionRequired, trace...)
-		c.updateLastSent()
-		c.updateMayRetransmitTo(retransmitExact)
-		c.lastMessage(MessagePlaintext(makeCopy(message)), trace...)
-		return []ValidMessage{c.QueryMessage()}, nil
+	if c.Policies.Has(PolicyRequireEncryption) {
+		return c.queueUntilPrivate(message, trace...), nil
 	}
 
-	return []ValidMessage{makeCopy(c.appendWhitespaceTag(message))}, nil
+	return c.advertise(message), nil
+}
+
+// queueUntilPrivate keeps the message until the conversation is private, and returns the query message that starts the AKE
+func (c *Conversation) queueUntilPrivate(message ValidMessage, trace ...interface{}) []ValidMessage {
+	c.messageEvent(MessageEventEncryptionRequired, trace...)
+	c.updateLastSent()
+	c.updateMayRetransmitTo(retransmitExact)
+	c.lastMessage(MessagePlaintext(makeCopy(message)), true, trace...)
+	return []ValidMessage{c.QueryMessage()}
 }
 
 func (c *Conversation) sendMessageOnEncrypted(message ValidMessage) ([]ValidMessage, error) {
+	if c.verificationHasExpired() {
+		return nil, errVerificationExpired
+	}
+
 	result, _, err := c.createSerializedDataMessage(message, messageFlagNormal, []tlv{})
 	if err != nil {
 		c.messageEvent(MessageEventEncryptionError)
 		c.generatePotentialErrorMessage(ErrorCodeEncryptionError)
+		return result, err
+	}
+
+	if len(message) > 0 {
+		c.verifiedMessageExchanged()
 	}
 
 	return result, err
 }
 
 func (c *Conversation) sendDHCommit() (toSend messageWithHeader, err error) {
-	c.ake.wipe(true)
-	c.ake = nil
+	previous, from := c.ake, c.authState()
 
 	toSend, err = c.dhCommitMessage()
-	if err != nil {
-		return
+	if err == nil {
+		toSend, err = c.wrapMessageHeader(msgTypeDHCommit, toSend)
 	}
 
-	toSend, err = c.wrapMessageHeader(msgTypeDHCommit, toSend)
 	if err != nil {
+		// The AKE in progress, if any, continues as if nothing happened
+		c.ake.wipe(true)
+		c.ake = previous
 		return nil, err
 	}
 
-	c.ake.state = authStateAwaitingDHKey{}
+	previous.wipe(true)
+	c.setAuthState(from, authStateAwaitingDHKey{}, "send D-H Commit")
+	c.akeAttemptStarted()
+	c.akeMessageSent()
 
 	return
 }
@@ -18,7 +18,7 @@ func Test_Send_signalsMessageEventIfTryingToSendWithoutEncryptedChannel(t *testi
 	m := []byte("hello")
 	c := bobContextAfterAKE()
 	c.msgState = plainText
-	c.Policies = policies(allowV3 | requireEncryption)
+	c.Policies = Policies(PolicyAllowV3 | PolicyRequireEncryption)
 
 	c.expectMessageEvent(t, func() {
 		c.Send(m)
@@ -29,7 +29,7 @@ func Test_Send_signalsMessageEventIfTryingToSendOnAFinishedChannel(t *testing.T)
 	m := []byte("hello")
 	c := bobContextAfterAKE()
 	c.msgState = finished
-	c.Policies = policies(allowV3 | requireEncryption)
+	c.Policies = Policies(PolicyAllowV3 | PolicyRequireEncryption)
 
 	c.expectMessageEvent(t, func() {
 		c.Send(m)
@@ -41,7 +41,7 @@ func Test_Send_signalsEncryptionErrorMessageEventIfSomethingWentWrong(t *testing
 
 	c := bobContextAfterAKE()
 	c.msgState = encrypted
-	c.Policies = policies(allowV3)
+	c.Policies = Policies(PolicyAllowV3)
 	c.keys.theirKeyID = 0
 
 	c.expectMessageEvent(t, func() {
@@ -54,7 +54,7 @@ func Test_Send_callsErrorMessageHandlerAndReturnsTheResultAsAnOTRErrorMessage(t
 
 	c := bobContextAfterAKE()
 	c.msgState = encrypted
-	c.Policies = policies(allowV3)
+	c.Policies = Policies(PolicyAllowV3)
 	c.keys.theirKeyID = 0
 
 	c.errorMessageHandler = dynamicErrorMessageHandler{
@@ -73,14 +73,15 @@ func Test_Send_saveLastMessageWhenMsgIsPlainTextAndEncryptedIsExpected(t *testin
 	m := []byte("hello")
 	c := bobContextAfterAKE()
 	c.msgState = plainText
-	c.Policies = policies(allowV3 | requireEncryption)
+	c.Policies = Policies(PolicyAllowV3 | PolicyRequireEncryption)
 
 	c.Send(m)
 
-	assertDeepEquals(t, c.resend.pending(),
+	assertDeepEquals(t, pendingWithoutMetadata(c),
 		[]messageToResend{
-			messageToResend{MessagePlaintext(m), nil},
+			messageToResend{m: MessagePlaintext(m)},
 		})
+	assertTrue(t, c.resend.pending()[0].queued)
 }
 
 func Test_Send_saveLastMessageWhenMsgIsPlainTextAndEncryptedIsExpected_AndAddsAnOpaqueValueForEachMessage(t *testing.T) {
@@ -88,15 +89,15 @@ func Test_Send_saveLastMessageWhenMsgIsPlainTextAndEncryptedIsExpected_AndAddsAn
 	m2 := []byte("hello again?")
 	c := bobContextAfterAKE()
 	c.msgState = plainText
-	c.Policies = policies(allowV3 | requireEncryption)
+	c.Policies = Policies(PolicyAllowV3 | PolicyRequireEncryption)
 
 	c.Send(m, 42, "hello")
 	c.Send(m2, 15, "something")
 
-	assertDeepEquals(t, c.resend.pending(),
+	assertDeepEquals(t, pendingWithoutMetadata(c),
 		[]messageToResend{
-			messageToResend{MessagePlaintext(m), []interface{}{42, "hello"}},
-			messageToResend{MessagePlaintext(m2), []interface{}{15, "something"}},
+			messageToResend{m: MessagePlaintext(m), opaque: []interface{}{42, "hello"}},
+			messageToResend{m: MessagePlaintext(m2), opaque: []interface{}{15, "something"}},
 		})
 }
 
@@ -104,7 +105,7 @@ func Test_Send_setsMayRetransmitFlagToExpectExactResending(t *testing.T) {
 	m := []byte("hello")
 	c := bobContextAfterAKE()
 	c.msgState = plainText
-	c.Policies = policies(allowV3 | requireEncryption)
+	c.Policies = Policies(PolicyAllowV3 | PolicyRequireEncryption)
 
 	c.Send(m)
 
@@ -158,3 +159,41 @@ func Test_Send_printsDebugStatementToStderrIfGivenMagicString(t *testing.T) {
     Received_Q: 0
 `)
 }
+
+func Test_Send_rejectsAnEmptyMessageInAPrivateConversation(t *testing.T) {
+	alice, _ := encryptedConversations(t)
+
+	toSend, err := alice.Send(ValidMessage(""))
+
+	assertNil(t, toSend)
+	assertEquals(t, err, ErrEmptyMessage)
+}
+
+func Test_Send_rejectsAnEmptyMessageThatWouldBeQueuedUntilPrivate(t *testing.T) {
+	c := &Conversation{}
+	c.Policies = Policies(PolicyAllowV3 | PolicyRequireEncryption)
+
+	toSend, err := c.Send(ValidMessage{})
+
+	assertNil(t, toSend)
+	assertEquals(t, err, ErrEmptyMessage)
+}
+
+func Test_Send_sendsAnEmptyMessageInPlaintextWhenEncryptionIsntRequired(t *testing.T) {
+	c := &Conversation{}
+	c.Policies = Policies(PolicyAllowV3)
+
+	toSend, err := c.Send(ValidMessage{})
+
+	assertNil(t, err)
+	assertDeepEquals(t, toSend, []ValidMessage{ValidMessage{}})
+}
+
+func Test_Send_passesAnEmptyMessageThroughWhenOTRIsDisabled(t *testing.T) {
+	c := &Conversation{}
+
+	toSend, err := c.Send(ValidMessage(""))
+
+	assertNil(t, err)
+	assertDeepEquals(t, toSend, []ValidMessage{ValidMessage{}})
+}
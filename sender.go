@@ -0,0 +1,199 @@
+package otr3
+
+// Sender delivers the messages of a conversation over a transport that reports back whether they arrived.
+// When a conversation has a sender, SendAsync and the replies generated by Receive are handed to it
+// instead of being returned, and the transport tells the conversation the outcome with MarkDelivered or MarkFailed.
+// A conversation waits for the outcome of at most maxPendingDeliveries deliveries - beyond that the oldest one is
+// forgotten, and its outcome can't be reported anymore. Ending the conversation forgets all of them.
+// The conversations of a Manager share the sender of the master, and the ids are unique across all of them,
+// so the outcome can be reported to the Manager instead.
+type Sender interface {
+	// Send starts delivering the messages, which are the encoded fragments of one message, in order.
+	// It shouldn't wait for the outcome. The id is used to report the outcome later, and is unique for the conversation.
+	Send(id uint64, msgs []ValidMessage)
+}
+
+// maxPendingDeliveries is how many deliveries a conversation waits for the outcome of, so a transport
+// that never reports back can't make it keep a copy of every message forever
+const maxPendingDeliveries = 256
+
+type deliveryKind int
+
+const (
+	// deliveryReply is not retried - the protocol it is a part of recovers on its own, or is restarted by the user
+	deliveryReply deliveryKind = iota
+	// deliveryAKE is sent again as long as the AKE is still waiting for the peer to answer it
+	deliveryAKE
+	// deliveryMessage is a message from the user, which is sent again the way it would be sent now
+	deliveryMessage
+	// deliveryQuery starts the AKE for messages queued until the conversation is private, and is sent again while they are waiting
+	deliveryQuery
+)
+
+type delivery struct {
+	kind deliveryKind
+	// akeState is the identity of the state the AKE was in when the message was sent
+	akeState int
+	message  ValidMessage
+	trace    []interface{}
+	// private is true for a message that was encrypted, and must never be sent again in plaintext
+	private bool
+}
+
+type deliveries struct {
+	// lastID is shared by the conversations of a Manager, so an id is unique across all of them
+	lastID  *uint64
+	pending map[uint64]delivery
+}
+
+// wipe forgets all pending deliveries, and wipes the copies of the messages from the user
+func (d *deliveries) wipe() {
+	for id, p := range d.pending {
+		wipeBytes(p.message)
+		delete(d.pending, id)
+	}
+	d.pending = nil
+}
+
+// forgetOldest makes room for a new delivery by forgetting the one that has been waiting the longest
+func (d *deliveries) forgetOldest() {
+	oldest, found := uint64(0), false
+	for id := range d.pending {
+		if !found || id < oldest {
+			oldest, found = id, true
+		}
+	}
+
+	wipeBytes(d.pending[oldest].message)
+	delete(d.pending, oldest)
+}
+
+// sharedLastID returns the counter of the ids, to be shared with another conversation
+func (d *deliveries) sharedLastID() *uint64 {
+	if d.lastID == nil {
+		d.lastID = new(uint64)
+	}
+	return d.lastID
+}
+
+func (d *deliveries) nextID() uint64 {
+	id := d.sharedLastID()
+	*id++
+	return *id
+}
+
+// SetSender assigns the sender that delivers messages. Setting nil makes Receive return the replies again.
+func (c *Conversation) SetSender(s Sender) {
+	c.sender = s
+}
+
+// SendAsync works like Send, but hands the messages to the sender of the conversation instead of returning them.
+// If they can't be delivered, the message is sent again when MarkFailed is called.
+func (c *Conversation) SendAsync(m ValidMessage, trace ...interface{}) error {
+	if c.sender == nil {
+		return errNoSender
+	}
+
+	queued := c.msgState == plainText && c.Policies.Has(PolicyRequireEncryption)
+	private := c.msgState == encrypted
+	toSend, err := c.Send(m, trace...)
+	if err != nil || len(toSend) == 0 {
+		return err
+	}
+
+	d := delivery{kind: deliveryMessage, message: makeCopy(m), trace: trace, private: private}
+	if queued {
+		// The message waits for the AKE in the queue, so only the query message is ours to deliver
+		d = delivery{kind: deliveryQuery}
+	}
+
+	c.deliver(d, toSend)
+	return nil
+}
+
+// MarkDelivered tells the conversation that the messages given to the sender with the id have arrived
+func (c *Conversation) MarkDelivered(id uint64) error {
+	d, ok := c.deliveries.pending[id]
+	if !ok {
+		return errUnknownDelivery
+	}
+
+	delete(c.deliveries.pending, id)
+	wipeBytes(d.message)
+	return nil
+}
+
+// MarkFailed tells the conversation that the messages given to the sender with the id could not be delivered.
+// An AKE message is sent again if the AKE is still waiting for the peer to answer it, and a message from the user
+// is sent again the way it would be sent now - which is encrypted with the newest keys, or queued until the conversation is private.
+// A message that was encrypted is never sent again in plaintext - the deliveries still pending when the private
+// conversation ends are forgotten. Other replies are not sent again.
+func (c *Conversation) MarkFailed(id uint64) error {
+	d, ok := c.deliveries.pending[id]
+	if !ok {
+		return errUnknownDelivery
+	}
+	delete(c.deliveries.pending, id)
+
+	switch d.kind {
+	case deliveryAKE:
+		if c.ake == nil || c.ake.state.identity() != d.akeState {
+			return nil
+		}
+		toSend, err := c.ResumeAKE()
+		if err == errNoAKEInProgress {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		c.deliver(d, toSend)
+	case deliveryMessage:
+		defer wipeBytes(d.message)
+		if d.private && c.msgState != encrypted {
+			c.deliver(delivery{kind: deliveryQuery}, c.queueUntilPrivate(d.message, d.trace...))
+			return nil
+		}
+		return c.SendAsync(d.message, d.trace...)
+	case deliveryQuery:
+		if c.msgState == plainText && len(c.resend.pending()) > 0 {
+			c.deliver(d, []ValidMessage{c.QueryMessage()})
+		}
+	}
+
+	return nil
+}
+
+// PendingDeliveries returns how many messages have been given to the sender, and not yet been marked as delivered or failed
+func (c *Conversation) PendingDeliveries() int {
+	return len(c.deliveries.pending)
+}
+
+func (c *Conversation) deliver(d delivery, msgs []ValidMessage) {
+	if c.deliveries.pending == nil {
+		c.deliveries.pending = make(map[uint64]delivery)
+	}
+
+	if len(c.deliveries.pending) >= maxPendingDeliveries {
+		c.deliveries.forgetOldest()
+	}
+
+	id := c.deliveries.nextID()
+	c.deliveries.pending[id] = d
+	c.sender.Send(id, msgs)
+}
+
+// deliverReply hands a reply generated by Receive to the sender, if the conversation has one
+func (c *Conversation) deliverReply(kind ReplyKind, msgs []ValidMessage) bool {
+	if c.sender == nil {
+		return false
+	}
+
+	d := delivery{kind: deliveryReply}
+	if kind == ReplyAKE && c.ake != nil {
+		d = delivery{kind: deliveryAKE, akeState: c.ake.state.identity()}
+	}
+
+	c.deliver(d, msgs)
+	return true
+}
@@ -0,0 +1,202 @@
+package otr3
+
+import "testing"
+
+type recordingSender struct {
+	ids  []uint64
+	sent map[uint64][]ValidMessage
+}
+
+func (s *recordingSender) Send(id uint64, msgs []ValidMessage) {
+	if s.sent == nil {
+		s.sent = make(map[uint64][]ValidMessage)
+	}
+	s.ids = append(s.ids, id)
+	s.sent[id] = msgs
+}
+
+func (s *recordingSender) last() (uint64, []ValidMessage) {
+	id := s.ids[len(s.ids)-1]
+	return id, s.sent[id]
+}
+
+func withSender(c *Conversation) *recordingSender {
+	s := &recordingSender{}
+	c.SetSender(s)
+	return s
+}
+
+func Test_SendAsync_returnsErrorWithoutASender(t *testing.T) {
+	alice, _ := benchmarkConversations()
+
+	assertEquals(t, alice.SendAsync(ValidMessage("hello")), errNoSender)
+}
+
+func Test_SendAsync_handsTheMessagesToTheSender(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	s := withSender(alice)
+
+	assertNil(t, alice.SendAsync(ValidMessage("hello")))
+
+	id, msgs := s.last()
+	plain, _, err := bob.Receive(msgs[0])
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+	assertEquals(t, alice.PendingDeliveries(), 1)
+
+	assertNil(t, alice.MarkDelivered(id))
+	assertEquals(t, alice.PendingDeliveries(), 0)
+}
+
+func Test_MarkDelivered_returnsErrorForAnUnknownID(t *testing.T) {
+	alice, _ := benchmarkConversations()
+
+	assertEquals(t, alice.MarkDelivered(42), errUnknownDelivery)
+	assertEquals(t, alice.MarkFailed(42), errUnknownDelivery)
+}
+
+func Test_Receive_handsRepliesToTheSender(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	s := withSender(alice)
+
+	_, toSend, err := alice.Receive(bob.QueryMessage())
+
+	assertNil(t, err)
+	assertNil(t, toSend)
+	assertEquals(t, len(s.ids), 1)
+}
+
+func Test_MarkFailed_sendsAnAKEMessageAgainWhileTheAKEIsWaitingForIt(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	s := withSender(alice)
+	alice.Receive(bob.QueryMessage())
+	id, dhCommit := s.last()
+
+	assertNil(t, alice.MarkFailed(id))
+
+	newID, again := s.last()
+	assertTrue(t, newID != id)
+	assertDeepEquals(t, again, dhCommit)
+
+	alice.SetSender(nil)
+	exchangeUntilQuiet(t, alice, bob, again)
+	assertEquals(t, bob.IsEncrypted(), true)
+}
+
+func Test_MarkFailed_sendsARevealSignatureMessageAgainWhileTheAKEIsWaitingForTheSignature(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	s := withSender(alice)
+	alice.Receive(bob.QueryMessage())
+	_, dhCommit := s.last()
+	_, dhKey, _ := bob.Receive(dhCommit[0])
+	alice.Receive(dhKey[0])
+	id, revealSig := s.last()
+
+	assertNil(t, alice.MarkFailed(id))
+
+	_, again := s.last()
+	assertDeepEquals(t, again, revealSig)
+	alice.SetSender(nil)
+	exchangeUntilQuiet(t, alice, bob, again)
+	assertEquals(t, alice.IsEncrypted(), true)
+	assertEquals(t, bob.IsEncrypted(), true)
+}
+
+func Test_MarkFailed_doesntSendAnAKEMessageAgainOnceTheAKEHasMovedOn(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	s := withSender(alice)
+	alice.Receive(bob.QueryMessage())
+	id, dhCommit := s.last()
+	alice.SetSender(nil)
+	exchangeUntilQuiet(t, alice, bob, dhCommit)
+	alice.SetSender(s)
+
+	assertNil(t, alice.MarkFailed(id))
+
+	assertEquals(t, len(s.ids), 1)
+}
+
+func Test_MarkFailed_encryptsAMessageAgainWithTheNewestKeys(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	s := withSender(alice)
+	alice.SendAsync(ValidMessage("hello"), "trace")
+	id, first := s.last()
+
+	assertNil(t, alice.MarkFailed(id))
+
+	_, again := s.last()
+	assertTrue(t, string(again[0]) != string(first[0]))
+	plain, _, err := bob.Receive(again[0])
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+	assertEquals(t, alice.PendingDeliveries(), 1)
+}
+
+func Test_MarkFailed_neverSendsAnEncryptedMessageAgainInPlaintext(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	s := withSender(alice)
+	alice.SendAsync(ValidMessage("hello"))
+	id, _ := s.last()
+	alice.End()
+
+	assertEquals(t, alice.MarkFailed(id), errUnknownDelivery)
+
+	assertEquals(t, len(s.ids), 1)
+}
+
+func Test_End_wipesThePendingDeliveries(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	withSender(alice)
+	alice.SendAsync(ValidMessage("hello"))
+	var message ValidMessage
+	for _, d := range alice.deliveries.pending {
+		message = d.message
+	}
+
+	alice.End()
+
+	assertEquals(t, alice.PendingDeliveries(), 0)
+	assertDeepEquals(t, message, ValidMessage{0, 0, 0, 0, 0})
+}
+
+func Test_processDisconnectedTLV_wipesThePendingDeliveries(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	withSender(alice)
+	alice.SendAsync(ValidMessage("hello"))
+
+	toSend, _ := bob.End()
+	alice.Receive(toSend[0])
+
+	assertEquals(t, alice.PendingDeliveries(), 0)
+}
+
+func Test_deliver_forgetsTheOldestDeliveryWhenTooManyArePending(t *testing.T) {
+	alice, _ := benchmarkConversations()
+	s := withSender(alice)
+	for i := 0; i <= maxPendingDeliveries; i++ {
+		alice.SendAsync(ValidMessage("hello"))
+	}
+
+	assertEquals(t, alice.PendingDeliveries(), maxPendingDeliveries)
+	assertEquals(t, alice.MarkDelivered(s.ids[0]), errUnknownDelivery)
+	assertNil(t, alice.MarkDelivered(s.ids[1]))
+}
+
+func Test_MarkFailed_sendsTheQueryMessageAgainWhileMessagesAreQueued(t *testing.T) {
+	alice, _ := benchmarkConversations()
+	alice.Policies.RequireEncryption()
+	s := withSender(alice)
+	alice.SendAsync(ValidMessage("hello"))
+	id, query := s.last()
+
+	assertNil(t, alice.MarkFailed(id))
+
+	_, again := s.last()
+	assertDeepEquals(t, again, query)
+	assertEquals(t, len(alice.resend.pending()), 1)
+}
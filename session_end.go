@@ -0,0 +1,59 @@
+package otr3
+
+import "time"
+
+// EndedBy tells which side ended a private conversation
+type EndedBy int
+
+const (
+	// EndedByNobody means the private conversation hasn't ended, or there hasn't been one
+	EndedByNobody EndedBy = iota
+	// EndedByUs means End was called. The conversation is in plaintext afterwards
+	EndedByUs
+	// EndedByThem means the peer sent a disconnect message. Nothing can be sent afterwards
+	// until End is called or a new private conversation is established, so nothing is sent in plaintext by accident
+	EndedByThem
+	// EndedByPeerOffline means the Manager was told with PeerOffline that the instance of the peer went away
+	EndedByPeerOffline
+)
+
+// String returns the string representation of the EndedBy
+func (e EndedBy) String() string {
+	switch e {
+	case EndedByNobody:
+		return "EndedByNobody"
+	case EndedByUs:
+		return "EndedByUs"
+	case EndedByThem:
+		return "EndedByThem"
+	case EndedByPeerOffline:
+		return "EndedByPeerOffline"
+	default:
+		return "ENDED BY: (THIS SHOULD NEVER HAPPEN)"
+	}
+}
+
+// SessionEnd describes how the last private conversation ended, so a client can show
+// "You ended the private conversation" differently from "Bob ended the private conversation"
+type SessionEnd struct {
+	// By is the side that ended the private conversation
+	By EndedBy
+	// At is when the private conversation ended, by the clock of the conversation
+	At time.Time
+}
+
+// SessionEnd returns how the last private conversation ended. While a private conversation is going on,
+// and before the first one, By is EndedByNobody.
+func (c *Conversation) SessionEnd() SessionEnd {
+	return c.sessionEnd
+}
+
+func (c *Conversation) sessionEnded(previousMsgState msgState, by EndedBy) {
+	if previousMsgState == encrypted {
+		c.timelineEvent(timelineEventForEndedBy[by])
+		c.sessionEnd = SessionEnd{By: by, At: c.now()}
+		if len(c.sessionHistory) > 0 {
+			c.sessionHistory[len(c.sessionHistory)-1].End = c.sessionEnd
+		}
+	}
+}
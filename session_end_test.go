@@ -0,0 +1,78 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+	"time"
+)
+
+func Test_SessionEnd_isEmptyForANewConversation(t *testing.T) {
+	c := &Conversation{}
+
+	assertDeepEquals(t, c.SessionEnd(), SessionEnd{})
+}
+
+func Test_SessionEnd_isByUsWhenWeEndTheConversation(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	alice.SetClock(clock)
+
+	alice.End()
+
+	assertDeepEquals(t, alice.SessionEnd(), SessionEnd{By: EndedByUs, At: clock.now})
+}
+
+func Test_SessionEnd_isByThemWhenThePeerEndsTheConversation(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	bob.SetClock(clock)
+
+	toSend, _ := alice.End()
+	bob.Receive(toSend[0])
+
+	assertDeepEquals(t, bob.SessionEnd(), SessionEnd{By: EndedByThem, At: clock.now})
+	assertEquals(t, bob.msgState, finished)
+}
+
+func Test_SessionEnd_isntChangedByEndingAConversationThatIsntPrivate(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	toSend, _ := alice.End()
+	bob.Receive(toSend[0])
+
+	bob.End()
+
+	assertEquals(t, bob.SessionEnd().By, EndedByThem)
+}
+
+func Test_SessionEnd_isResetWhenANewPrivateConversationIsEstablished(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	toSend, _ := alice.End()
+	bob.Receive(toSend[0])
+
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	assertDeepEquals(t, alice.SessionEnd(), SessionEnd{})
+}
+
+func Test_SessionEnd_isByPeerOfflineWhenTheManagerIsToldThePeerWentAway(t *testing.T) {
+	m := NewManager(&Conversation{Rand: rand.Reader})
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	m.instances[0x1234] = c
+
+	m.PeerOffline(0x1234)
+
+	assertEquals(t, c.SessionEnd().By, EndedByPeerOffline)
+}
+
+func Test_EndedBy_String(t *testing.T) {
+	assertEquals(t, EndedByNobody.String(), "EndedByNobody")
+	assertEquals(t, EndedByUs.String(), "EndedByUs")
+	assertEquals(t, EndedByThem.String(), "EndedByThem")
+	assertEquals(t, EndedByPeerOffline.String(), "EndedByPeerOffline")
+	assertEquals(t, EndedBy(42).String(), "ENDED BY: (THIS SHOULD NEVER HAPPEN)")
+}
@@ -22,8 +22,11 @@ func (s *smp) wipe() {
 	s.question = nil
 	wipeBigInt(s.secret)
 	s.secret = nil
+	s.s1.wipe()
 	s.s1 = nil
+	s.s2.wipe()
 	s.s2 = nil
+	s.s3.wipe()
 	s.s3 = nil
 }
 
@@ -35,6 +38,22 @@ func (s *smp) ensureSMP() {
 	s.state = smpStateExpect1{}
 }
 
+// abandonSMPOfPreviousSession forgets an SMP exchange that was going on when a new AKE finished. The exchange is
+// bound to the SSID of the private conversation it was started in, and the TLVs of messages still read with the
+// previous keys are ignored, so it could never finish.
+func (c *Conversation) abandonSMPOfPreviousSession() {
+	if c.smp.state == nil {
+		return
+	}
+	if _, idle := c.smp.state.(smpStateExpect1); idle {
+		return
+	}
+
+	c.wipeSMP("AKE finished")
+	c.smp.state = smpStateExpect1{}
+	c.smpEvent(SMPEventAbort, 0)
+}
+
 // SMPQuestion returns the current SMP question and ok if there is one, and not ok if there isn't one.
 func (c *Conversation) SMPQuestion() (string, bool) {
 	if c.smp.question == nil {
@@ -67,7 +86,7 @@ func verifyZKP(d, gen, c *big.Int, ix byte, v otrVersion) bool {
 	r := modExp(g1, d)
 	s := modExp(gen, c)
 	t := hashMPIsBN(v.hash2Instance(), ix, mulMod(r, s, p))
-	return eq(c, t)
+	return eqConstantTime(c, t)
 }
 
 func verifyZKP2(g2, g3, d5, d6, pb, qb, cp *big.Int, ix byte, v otrVersion) bool {
@@ -80,21 +99,21 @@ func verifyZKP2(g2, g3, d5, d6, pb, qb, cp *big.Int, ix byte, v otrVersion) bool
 		modExp(qb, cp),
 		p)
 	t := hashMPIsBN(v.hash2Instance(), ix, l, r)
-	return eq(cp, t)
+	return eqConstantTime(cp, t)
 }
 
 func verifyZKP3(cp, g2, g3, d5, d6, pa, qa *big.Int, ix byte, v otrVersion) bool {
 	l := mulMod(modExp(g3, d5), modExp(pa, cp), p)
 	r := mulMod(mul(modExp(g1, d5), modExp(g2, d6)), modExp(qa, cp), p)
 	t := hashMPIsBN(v.hash2Instance(), ix, l, r)
-	return eq(cp, t)
+	return eqConstantTime(cp, t)
 }
 
 func verifyZKP4(cr, g3a, d7, qaqb, ra *big.Int, ix byte, v otrVersion) bool {
 	l := mulMod(modExp(g1, d7), modExp(g3a, cr), p)
 	r := mulMod(modExp(qaqb, d7), modExp(ra, cr), p)
 	t := hashMPIsBN(v.hash2Instance(), ix, l, r)
-	return eq(cr, t)
+	return eqConstantTime(cr, t)
 }
 
 func genSMPTLV(tp uint16, mpis ...*big.Int) tlv {
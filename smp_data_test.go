@@ -45,23 +45,28 @@ func fixtureSecret() *big.Int {
 	return bnFromHex("D9B2E56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 }
 
+// copyBigInt keeps the fixtures intact when a test wipes the state they were put in
+func copyBigInt(n *big.Int) *big.Int {
+	return new(big.Int).Set(n)
+}
+
 func fixtureSmp1() *smp1State {
 	var s smp1State
-	s.a2 = fixtureShort1
-	s.a3 = fixtureShort2
+	s.a2 = copyBigInt(fixtureShort1)
+	s.a3 = copyBigInt(fixtureShort2)
 	s.msg = fixtureMessage1()
 	return &s
 }
 
 func fixtureSmp2() *smp2State {
 	var s smp2State
-	s.b2 = fixtureShort1
-	s.b3 = fixtureShort2
-	s.r2 = fixtureShort3
-	s.r3 = fixtureShort4
-	s.r4 = fixtureShort5
-	s.r5 = fixtureShort6
-	s.r6 = fixtureShort7
+	s.b2 = copyBigInt(fixtureShort1)
+	s.b3 = copyBigInt(fixtureShort2)
+	s.r2 = copyBigInt(fixtureShort3)
+	s.r3 = copyBigInt(fixtureShort4)
+	s.r4 = copyBigInt(fixtureShort5)
+	s.r5 = copyBigInt(fixtureShort6)
+	s.r6 = copyBigInt(fixtureShort7)
 	s.g2 = bnFromHex("8b9e73cca287ed2f46c011090efffcfe394bed51a3ad23e9f7815d9c9c20184ddc0acc2cb0cdd3b8630c453339b6ef7158af705530e33ccac72a855164ca038da837942f3de762ea9af2942c9355dee8eb8b7ce94a3ade33d6a7c79c2a879239c08af22e6987b9345c5e093d33bc8734aaa4019f614dfd65500107756cf6d0ff4591b482d975ca6e43b9f706e969a987306a1a1b905385ffd13d7a24dabc6d513f32a46041cd760e404d1a4c7b6c0b426589ba3ec3d252110578740ccee4bcb3")
 	s.g3 = bnFromHex("75cb16d985029162aba03d37b9ef375dca716fc2a4f7d25c6e1b6c511622a47567999230706eda31e44b47c1d7f61df12f49e59142fda0af377d2c5972ad663213db031f131b2abc557e507e6ffbf4dc4a5b44cd0cdf985bc247afb2e5733513f4f022feb5e7a955611175b0ffcfe54763cf7430ce0ede472a7ab5fc0f9f039fcf476be22ec66f8b96759e44a946180f27d16d6c37067e7f1acd3b691b5d56a90b641cc9c8fdac1c41e310e469db4e2f83d28c3dda51b2a36bcbc43d70f0a093")
 	s.pb = bnFromHex("70f18724fd6263a694b82a6272e938a81f56b7373c29a4f78ee2d5dd94bf7fe8ff59d837ca2686088f62f7ec178a5b47bcdec3b6f2af7820d6583d5358a714a5cf6d943371289cce76a9cc09e04306bcffde5a6dbeb887a5e18aff1740be083e2b4a505e30fa56771d5be27984ca85e90a9d90faa278db0b5d51f334e80cfab14cb5e7fed9c6d3d0eaff5c1f3dbe698ba8f0db3517e892474cc899d46866546ea306d4f6e0a11546305c4fd50ad8e49163fb9abc3294612868d310d2e5755d4d")
@@ -73,10 +78,10 @@ func fixtureSmp2() *smp2State {
 
 func fixtureSmp3() *smp3State {
 	var s smp3State
-	s.x = fixtureShort1
-	s.r4 = fixtureShort2
-	s.r5 = fixtureShort3
-	s.r6 = fixtureShort4
+	s.x = copyBigInt(fixtureShort1)
+	s.r4 = copyBigInt(fixtureShort2)
+	s.r5 = copyBigInt(fixtureShort3)
+	s.r6 = copyBigInt(fixtureShort4)
 	s.qaqb = bnFromHex("8e98e62ca95c07b0a737fb49b810dee8793d8579ff25e5ef5372c12aa725d75f8b098d526c2b506bdd2b1ef1c0fbfb6b28565d212d156959860d04bfab1483f5d4664438cd0964815f34983ad3800fa112877ab3d86c214915b1ef7c6ae6574312a4198b91ef40aa2313da349c9936a306262f5ce3561e5ea8ff51dcc7219242ce875c8baaaa959eb15824ddfb1fa71ad16c988dafe66fa6413b2f6d8a44ec64c2ef5219449052c761dab2f44000169feb42000686a5226273e461b1f539acc9")
 	s.papb = bnFromHex("46fdd1e34adb153dcdd734cfcf83db7b9f92aa99e099515acc0e0176ee156d5d4b714fa546de0cdd277313664029b99e5826e9a780e231218f6d3b2e0d6cf45461f34541e23a029f68703e22500e0713c77aeb450c89c760f594309c79b53eb39b87c0c43b6ef542dd65fb935adde4598bf7575e8bec5bdba1636bdc8664feaa9150903ddc819422107171b368d67be6faaafc1bf42946a0b5bd1a7b0511d48affc4f3873c50eca1f75940d5aabcfbd1efc617f7d0d6e1bb360df290d500e4b5")
 	s.g3b = bnFromHex("d275468351fd48246e406ee74a8dc3db6ee335067bfa63300ce6a23867a1b2beddbdae9a8a36555fd4837f3ef8bad4f7fd5d7b4f346d7c7b7cb64bd7707eeb515902c66aa0c9323931364471ab93dd315f65c6624c956d74680863a9388cd5d89f1b5033b1cf232b8b6dcffaaea195de4e17cc1ba4c99497be18c011b2ad7742b43fa9ee3f95f7b6da02c8e894d054eb178a7822273655dc286ad15874687fe6671908d83662e7a529744ce4ea8dad49290d19dbe6caba202a825a20a27ee98a")
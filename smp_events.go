@@ -22,9 +22,20 @@ const (
 	SMPEventSuccess
 	// SMPEventFailure means update the auth progress dialog with progress_percent
 	SMPEventFailure
+	// SMPEventNotInPrivate means that authentication was attempted outside of a private conversation, and nothing was sent
+	SMPEventNotInPrivate
 )
 
 // SMPEventHandler handles SMPEvents
+// The progress percentages reported during a normal exchange are:
+//
+//	20  - we have started SMP and sent the first message
+//	25  - the peer has started SMP and we need to ask the user for the secret or answer
+//	50  - we have provided the secret and sent the second message
+//	60  - we have received the second message and sent the third message
+//	100 - the exchange has finished, either with success or failure
+//
+// Aborts, errors and cheating attempts are reported with a progress of 0.
 type SMPEventHandler interface {
 	// HandleSMPEvent should update the authentication UI with respect to SMP events
 	HandleSMPEvent(event SMPEvent, progressPercent int, question string)
@@ -39,12 +50,14 @@ func (d dynamicSMPEventHandler) HandleSMPEvent(event SMPEvent, pp int, question
 }
 
 func (c *Conversation) smpEvent(e SMPEvent, percent int) {
+	c.smpTimelineEvent(e)
 	if c.smpEventHandler != nil {
 		c.smpEventHandler.HandleSMPEvent(e, percent, "")
 	}
 }
 
 func (c *Conversation) smpEventWithQuestion(e SMPEvent, percent int, question string) {
+	c.smpTimelineEvent(e)
 	if c.smpEventHandler != nil {
 		c.smpEventHandler.HandleSMPEvent(e, percent, question)
 	}
@@ -68,6 +81,8 @@ func (s SMPEvent) String() string {
 		return "SMPEventSuccess"
 	case SMPEventFailure:
 		return "SMPEventFailure"
+	case SMPEventNotInPrivate:
+		return "SMPEventNotInPrivate"
 	default:
 		return "SMP EVENT: (THIS SHOULD NEVER HAPPEN)"
 	}
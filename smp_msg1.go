@@ -33,7 +33,13 @@ func (c *Conversation) generateSMP1Parameters() (s smp1State, err error) {
 	s.a3, err2 = c.randMPI(b)
 	s.r2, err3 = c.randMPI(b)
 	s.r3, err4 = c.randMPI(b)
-	return s, firstError(err1, err2, err3, err4)
+	wipeBytes(b)
+
+	if err = firstError(err1, err2, err3, err4); err != nil {
+		s.wipe()
+		return smp1State{}, err
+	}
+	return s, nil
 }
 
 func generateSMP1Message(s smp1State, v otrVersion) (m smp1Message) {
@@ -101,20 +101,20 @@ func Test_thatVerifySMPStartParametersCheckG3AForOtrV3(t *testing.T) {
 	assertDeepEquals(t, err, newOtrError("g3a is an invalid group element"))
 }
 
-func Test_thatVerifySMPStartParametersDoesntCheckG2AForOtrV2(t *testing.T) {
+func Test_thatVerifySMPStartParametersChecksG2AForOtrV2(t *testing.T) {
 	c := newConversation(otrV2{}, fixtureRand())
 	err := c.verifySMP1(smp1Message{
 		g2a: new(big.Int).SetInt64(1),
-		g3a: new(big.Int).SetInt64(1),
+		g3a: new(big.Int).SetInt64(3),
 		c2:  new(big.Int).SetInt64(1),
 		c3:  new(big.Int).SetInt64(1),
 		d2:  new(big.Int).SetInt64(1),
 		d3:  new(big.Int).SetInt64(1),
 	})
-	assertDeepEquals(t, err, newOtrError("c2 is not a valid zero knowledge proof"))
+	assertDeepEquals(t, err, newOtrError("g2a is an invalid group element"))
 }
 
-func Test_thatVerifySMPStartParametersDoesntCheckG3AForOtrV2(t *testing.T) {
+func Test_thatVerifySMPStartParametersChecksG3AForOtrV2(t *testing.T) {
 	c := newConversation(otrV2{}, fixtureRand())
 	err := c.verifySMP1(smp1Message{
 		g2a: new(big.Int).SetInt64(3),
@@ -124,7 +124,7 @@ func Test_thatVerifySMPStartParametersDoesntCheckG3AForOtrV2(t *testing.T) {
 		d2:  new(big.Int).SetInt64(1),
 		d3:  new(big.Int).SetInt64(1),
 	})
-	assertDeepEquals(t, err, newOtrError("c2 is not a valid zero knowledge proof"))
+	assertDeepEquals(t, err, newOtrError("g3a is an invalid group element"))
 }
 
 func Test_thatVerifySMPStartParametersChecksThatc2IsAValidZeroKnowledgeProof(t *testing.T) {
@@ -194,3 +194,12 @@ func Test_thatVerifySMPStartParametersIsOKWithAValidParameterMessageWithProtocol
 	})
 	assertDeepEquals(t, err, nil)
 }
+
+func Test_generateSMP1Parameters_doesntReturnTheValuesItGeneratedBeforeFailing(t *testing.T) {
+	s, err := newConversation(otrV2{}, fixedRand([]string{
+		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b8b",
+		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b",
+	})).generateSMP1Parameters()
+	assertDeepEquals(t, err, errShortRandomRead)
+	assertDeepEquals(t, s, smp1State{})
+}
@@ -35,8 +35,13 @@ func (c *Conversation) generateSMP2Parameters() (s smp2State, err error) {
 	s.r4, err5 = c.randMPI(b)
 	s.r5, err6 = c.randMPI(b)
 	s.r6, err7 = c.randMPI(b)
+	wipeBytes(b)
 
-	return s, firstError(err1, err2, err3, err4, err5, err6, err7)
+	if err = firstError(err1, err2, err3, err4, err5, err6, err7); err != nil {
+		s.wipe()
+		return smp2State{}, err
+	}
+	return s, nil
 }
 
 func generateSMP2Message(s *smp2State, s1 smp1Message, v otrVersion) smp2Message {
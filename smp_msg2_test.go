@@ -256,3 +256,13 @@ func Test_verifySMP2_succeedsForACorrectZKP(t *testing.T) {
 	err := otr.verifySMP2(fixtureSmp1(), fixtureMessage2())
 	assertDeepEquals(t, err, nil)
 }
+
+func Test_generateSMP2Parameters_doesntReturnTheValuesItGeneratedBeforeFailing(t *testing.T) {
+	s, err := newConversation(otrV2{}, fixedRand([]string{
+		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b8b",
+		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b8b",
+		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b",
+	})).generateSMP2Parameters()
+	assertDeepEquals(t, err, errShortRandomRead)
+	assertDeepEquals(t, s, smp2State{})
+}
@@ -30,8 +30,13 @@ func (c *Conversation) generateSMP3Parameters() (s smp3State, err error) {
 	s.r5, err2 = c.randMPI(b)
 	s.r6, err3 = c.randMPI(b)
 	s.r7, err4 = c.randMPI(b)
+	wipeBytes(b)
 
-	return s, firstError(err1, err2, err3, err4)
+	if err = firstError(err1, err2, err3, err4); err != nil {
+		s.wipe()
+		return smp3State{}, err
+	}
+	return s, nil
 }
 
 func generateSMP3Message(s *smp3State, s1 smp1State, m2 smp2Message, v otrVersion) smp3Message {
@@ -98,7 +103,7 @@ func (c *Conversation) verifySMP3ProtocolSuccess(s2 *smp2State, msg smp3Message)
 	papb := divMod(msg.pa, s2.pb, p)
 
 	rab := modExp(msg.ra, s2.b3)
-	if !eq(rab, papb) {
+	if !eqConstantTime(rab, papb) {
 		return newOtrError("protocol failed: x != y")
 	}
 
@@ -202,3 +202,12 @@ func Test_verifySMP3_failsIfCrIsNotAValidZKP(t *testing.T) {
 	err := otr.verifySMP3(fixtureSmp2(), m)
 	assertDeepEquals(t, err, newOtrError("cR is not a valid zero knowledge proof"))
 }
+
+func Test_generateSMP3Parameters_doesntReturnTheValuesItGeneratedBeforeFailing(t *testing.T) {
+	s, err := newConversation(otrV2{}, fixedRand([]string{
+		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b8b",
+		"1a2a3a4a5a6a7a8a1b2b3b4b5b6b7b",
+	})).generateSMP3Parameters()
+	assertDeepEquals(t, err, errShortRandomRead)
+	assertDeepEquals(t, s, smp3State{})
+}
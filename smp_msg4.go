@@ -42,6 +42,7 @@ func (c *Conversation) verifySMP4(s3 *smp3State, msg smp4Message) error {
 func (c *Conversation) generateSMP4Parameters() (s smp4State, err error) {
 	b := make([]byte, c.version.parameterLength())
 	s.r7, err = c.randMPI(b)
+	wipeBytes(b)
 	return
 }
 
@@ -59,7 +60,7 @@ func generateSMP4Message(s smp4State, s2 smp2State, msg3 smp3Message, v otrVersi
 
 func (c *Conversation) verifySMP4ProtocolSuccess(s1 *smp1State, s3 *smp3State, msg smp4Message) error {
 	rab := modExp(msg.rb, s1.a3)
-	if !eq(rab, s3.papb) {
+	if !eqConstantTime(rab, s3.papb) {
 		return newOtrError("protocol failed: x != y")
 	}
 
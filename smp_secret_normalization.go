@@ -0,0 +1,55 @@
+package otr3
+
+import (
+	"bytes"
+	"unicode"
+)
+
+// SMPSecretNormalization describes how the secrets given to StartAuthenticate and ProvideAuthenticationSecret
+// are changed before they are used, so that secrets typed slightly differently on the two sides still match.
+// The peer has to normalize its secret the same way, otherwise SMP fails even for the same secret - so this
+// should only be used when both sides are known to use the same normalization.
+// The zero value uses the secrets exactly as given, like other implementations do.
+type SMPSecretNormalization struct {
+	// Unicode is applied first, and should turn the secret into a normalization form. This package doesn't
+	// include the Unicode tables, so an application would for example use norm.NFC.Bytes from golang.org/x/text
+	Unicode func([]byte) []byte
+	// TrimSpace removes white space from the beginning and end of the secret
+	TrimSpace bool
+	// FoldCase makes every letter of the secret lower case
+	FoldCase bool
+}
+
+// SetSMPSecretNormalization sets how SMP secrets are normalized before they are used
+func (c *Conversation) SetSMPSecretNormalization(n SMPSecretNormalization) {
+	c.smpSecretNormalization = n
+}
+
+// SMPSecretNormalization returns how SMP secrets are normalized before they are used
+func (c *Conversation) SMPSecretNormalization() SMPSecretNormalization {
+	return c.smpSecretNormalization
+}
+
+// normalize returns the secret normalized. The secret given is never changed, and the result
+// is always a new slice, so it can be wiped without affecting the caller
+func (n SMPSecretNormalization) normalize(secret []byte) []byte {
+	result := makeCopy(secret)
+
+	if n.Unicode != nil {
+		normalized := makeCopy(n.Unicode(result))
+		wipeBytes(result)
+		result = normalized
+	}
+
+	if n.TrimSpace {
+		result = bytes.TrimFunc(result, unicode.IsSpace)
+	}
+
+	if n.FoldCase {
+		folded := bytes.ToLower(result)
+		wipeBytes(result)
+		result = folded
+	}
+
+	return result
+}
@@ -0,0 +1,83 @@
+package otr3
+
+import (
+	"bytes"
+	"testing"
+)
+
+// composeAcuteE stands in for a Unicode normalization like NFC, for the one character the tests use
+func composeAcuteE(s []byte) []byte {
+	return bytes.Replace(s, []byte("e\u0301"), []byte("\u00e9"), -1)
+}
+
+func Test_SMPSecretNormalization_usesTheSecretAsGivenByDefault(t *testing.T) {
+	assertDeepEquals(t, SMPSecretNormalization{}.normalize([]byte(" Secret ")), []byte(" Secret "))
+}
+
+func Test_SMPSecretNormalization_trimsSurroundingWhiteSpace(t *testing.T) {
+	n := SMPSecretNormalization{TrimSpace: true}
+
+	assertDeepEquals(t, n.normalize([]byte(" \tour secret\n ")), []byte("our secret"))
+}
+
+func Test_SMPSecretNormalization_foldsCase(t *testing.T) {
+	n := SMPSecretNormalization{FoldCase: true}
+
+	assertDeepEquals(t, n.normalize([]byte("Our SECRET Été")), []byte("our secret été"))
+}
+
+func Test_SMPSecretNormalization_appliesTheUnicodeNormalization(t *testing.T) {
+	n := SMPSecretNormalization{Unicode: composeAcuteE, TrimSpace: true}
+
+	assertDeepEquals(t, n.normalize([]byte(" cafe\u0301 ")), []byte("caf\u00e9"))
+}
+
+func Test_SMPSecretNormalization_doesNotChangeTheGivenSecret(t *testing.T) {
+	secret := []byte(" SECRET ")
+	n := SMPSecretNormalization{TrimSpace: true, FoldCase: true, Unicode: bytes.ToUpper}
+
+	n.normalize(secret)
+
+	assertDeepEquals(t, secret, []byte(" SECRET "))
+}
+
+func Test_Conversation_SetSMPSecretNormalization_setsTheNormalization(t *testing.T) {
+	c := &Conversation{}
+
+	c.SetSMPSecretNormalization(SMPSecretNormalization{TrimSpace: true})
+
+	assertEquals(t, c.SMPSecretNormalization().TrimSpace, true)
+}
+
+func runSMPWithSecrets(t *testing.T, n SMPSecretNormalization, ours, theirs string) SMPEvent {
+	alice, bob := benchmarkConversations()
+	alice.SetSMPSecretNormalization(n)
+	bob.SetSMPSecretNormalization(n)
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	var result SMPEvent
+	bob.SetSMPEventHandler(dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		result = event
+	}})
+
+	toSend, _ := alice.StartAuthenticate("", []byte(ours))
+	exchangeUntilQuiet(t, alice, bob, toSend)
+	toSend, _ = bob.ProvideAuthenticationSecret([]byte(theirs))
+	exchangeUntilQuiet(t, bob, alice, toSend)
+
+	return result
+}
+
+func Test_StartAuthenticate_succeedsForSecretsThatOnlyDifferCosmeticallyWhenBothSidesNormalize(t *testing.T) {
+	n := SMPSecretNormalization{Unicode: composeAcuteE, TrimSpace: true, FoldCase: true}
+
+	result := runSMPWithSecrets(t, n, " Caf\u00e9 ", "cafe\u0301")
+
+	assertEquals(t, result, SMPEventSuccess)
+}
+
+func Test_StartAuthenticate_failsForSecretsThatOnlyDifferCosmeticallyWithoutNormalization(t *testing.T) {
+	result := runSMPWithSecrets(t, SMPSecretNormalization{}, " Caf\u00e9 ", "cafe\u0301")
+
+	assertEquals(t, result, SMPEventFailure)
+}
@@ -10,6 +10,111 @@ type smpStateWaitingForSecret struct {
 	msg smp1Message
 }
 
+var smpStateMachine = registerStateMachine("SMP", smpStateExpect1{},
+	smpStateExpect1{}, smpStateWaitingForSecret{}, smpStateExpect2{}, smpStateExpect3{}, smpStateExpect4{}).
+	on("start SMP",
+		from(smpStateExpect1{}, smpStateExpect2{}),
+		from(smpStateWaitingForSecret{}, smpStateExpect2{}),
+		from(smpStateExpect2{}, smpStateExpect2{}),
+		from(smpStateExpect3{}, smpStateExpect2{}),
+		from(smpStateExpect4{}, smpStateExpect2{})).
+	on("receive SMP message 1",
+		from(smpStateExpect1{}, smpStateWaitingForSecret{}),
+		from(smpStateExpect1{}, smpStateExpect1{}),
+		from(smpStateWaitingForSecret{}, smpStateExpect1{}),
+		from(smpStateExpect2{}, smpStateExpect1{}),
+		from(smpStateExpect3{}, smpStateExpect1{}),
+		from(smpStateExpect4{}, smpStateExpect1{})).
+	on("provide SMP secret",
+		from(smpStateExpect1{}, smpStateExpect1{}),
+		from(smpStateWaitingForSecret{}, smpStateExpect3{}),
+		from(smpStateWaitingForSecret{}, smpStateExpect1{}),
+		from(smpStateExpect2{}, smpStateExpect1{}),
+		from(smpStateExpect3{}, smpStateExpect1{}),
+		from(smpStateExpect4{}, smpStateExpect1{})).
+	on("receive SMP message 2",
+		from(smpStateExpect1{}, smpStateExpect1{}),
+		from(smpStateWaitingForSecret{}, smpStateExpect1{}),
+		from(smpStateExpect2{}, smpStateExpect4{}),
+		from(smpStateExpect2{}, smpStateExpect1{}),
+		from(smpStateExpect3{}, smpStateExpect1{}),
+		from(smpStateExpect4{}, smpStateExpect1{})).
+	on("receive SMP message 3",
+		from(smpStateExpect1{}, smpStateExpect1{}),
+		from(smpStateWaitingForSecret{}, smpStateExpect1{}),
+		from(smpStateExpect2{}, smpStateExpect1{}),
+		from(smpStateExpect3{}, smpStateExpect1{}),
+		from(smpStateExpect4{}, smpStateExpect1{})).
+	on("receive SMP message 4",
+		from(smpStateExpect1{}, smpStateExpect1{}),
+		from(smpStateWaitingForSecret{}, smpStateExpect1{}),
+		from(smpStateExpect2{}, smpStateExpect1{}),
+		from(smpStateExpect3{}, smpStateExpect1{}),
+		from(smpStateExpect4{}, smpStateExpect1{})).
+	on("receive SMP abort",
+		from(smpStateExpect1{}, smpStateExpect1{}),
+		from(smpStateWaitingForSecret{}, smpStateExpect1{}),
+		from(smpStateExpect2{}, smpStateExpect1{}),
+		from(smpStateExpect3{}, smpStateExpect1{}),
+		from(smpStateExpect4{}, smpStateExpect1{})).
+	on("end conversation",
+		from(smpStateExpect1{}, smpStateExpect1{}),
+		from(smpStateWaitingForSecret{}, smpStateExpect1{}),
+		from(smpStateExpect2{}, smpStateExpect1{}),
+		from(smpStateExpect3{}, smpStateExpect1{}),
+		from(smpStateExpect4{}, smpStateExpect1{})).
+	on("receive disconnected TLV",
+		from(smpStateExpect1{}, smpStateExpect1{}),
+		from(smpStateWaitingForSecret{}, smpStateExpect1{}),
+		from(smpStateExpect2{}, smpStateExpect1{}),
+		from(smpStateExpect3{}, smpStateExpect1{}),
+		from(smpStateExpect4{}, smpStateExpect1{})).
+	on("peer offline",
+		from(smpStateExpect1{}, smpStateExpect1{}),
+		from(smpStateWaitingForSecret{}, smpStateExpect1{}),
+		from(smpStateExpect2{}, smpStateExpect1{}),
+		from(smpStateExpect3{}, smpStateExpect1{}),
+		from(smpStateExpect4{}, smpStateExpect1{})).
+	on("abort SMP",
+		from(smpStateExpect1{}, smpStateExpect1{}),
+		from(smpStateWaitingForSecret{}, smpStateExpect1{}),
+		from(smpStateExpect2{}, smpStateExpect1{}),
+		from(smpStateExpect3{}, smpStateExpect1{}),
+		from(smpStateExpect4{}, smpStateExpect1{})).
+	on("reset SMP",
+		from(smpStateExpect1{}, smpStateExpect1{}),
+		from(smpStateWaitingForSecret{}, smpStateExpect1{}),
+		from(smpStateExpect2{}, smpStateExpect1{}),
+		from(smpStateExpect3{}, smpStateExpect1{}),
+		from(smpStateExpect4{}, smpStateExpect1{})).
+	on("AKE finished",
+		from(smpStateExpect1{}, smpStateExpect1{}),
+		from(smpStateWaitingForSecret{}, smpStateExpect1{}),
+		from(smpStateExpect2{}, smpStateExpect1{}),
+		from(smpStateExpect3{}, smpStateExpect1{}),
+		from(smpStateExpect4{}, smpStateExpect1{}))
+
+// currentSMPState returns the state of SMP, which is EXPECT1 before SMP has been used
+func (c *Conversation) currentSMPState() smpState {
+	if c.smp.state == nil {
+		return smpStateExpect1{}
+	}
+	return c.smp.state
+}
+
+// setSMPState changes the state of SMP from the state it was in before the trigger, which is one of the events
+// of the state graph. Handling the event wipes the state, so the state before is given.
+func (c *Conversation) setSMPState(from, to smpState, trigger string) {
+	c.recordTransition(smpStateMachine, from, to, trigger)
+	c.smp.state = to
+}
+
+// wipeSMP forgets everything about SMP because of the trigger, which is one of the events of the state graph
+func (c *Conversation) wipeSMP(trigger string) {
+	c.recordTransition(smpStateMachine, c.currentSMPState(), smpStateExpect1{}, trigger)
+	c.smp.wipe()
+}
+
 type smpMessage interface {
 	receivedMessage(*Conversation) (smpMessage, error)
 	tlv() tlv
@@ -24,11 +129,13 @@ type smpState interface {
 	receiveMessage4(*Conversation, smp4Message) (smpState, smpMessage, error)
 	identity() int
 	identityString() string
+	String() string
 }
 
 func (c *Conversation) restartSMP() tlv {
-	var ret smpMessage
-	c.smp.state, ret, _ = sendSMPAbortAndRestartStateMachine()
+	from := c.currentSMPState()
+	to, ret, _ := c.sendSMPAbortAndRestartStateMachine()
+	c.setSMPState(from, to, "abort SMP")
 	return ret.tlv()
 }
 
@@ -36,14 +143,20 @@ func abortState(e error) (smpState, smpMessage, error) {
 	return smpStateExpect1{}, smpMessageAbort{}, e
 }
 
-func sendSMPAbortAndRestartStateMachine() (smpState, smpMessage, error) {
+// sendSMPAbortAndRestartStateMachine forgets everything generated for this run of the protocol,
+// and returns the abort message that makes the peer do the same
+func (c *Conversation) sendSMPAbortAndRestartStateMachine() (smpState, smpMessage, error) {
+	c.smp.wipe()
 	//must return nil error otherwise the abort message will be ignored
 	return abortState(nil)
 }
 
-func (c *Conversation) abortStateMachineAndNotifyCheated() (smpState, smpMessage, error) {
+// abortStateMachineAndNotifyCheated is used when the given SMP message from the peer fails verification.
+// Everything generated for this run of the protocol is forgotten, and the peer is sent an abort.
+func (c *Conversation) abortStateMachineAndNotifyCheated(message int, reason error) (smpState, smpMessage, error) {
 	c.smpEvent(SMPEventCheated, 0)
-	return sendSMPAbortAndRestartStateMachine()
+	c.messageEventWithError(MessageEventSMPVerificationFailed, SMPVerificationError{Message: message, Reason: reason})
+	return c.sendSMPAbortAndRestartStateMachine()
 }
 
 func (c *Conversation) receiveSMP(m smpMessage) (*tlv, error) {
@@ -74,9 +187,18 @@ func (c *Conversation) continueSMP(mutualSecret []byte) (*tlv, error) {
 	return &result, nil
 }
 
+// abortStateMachineBecauseOfRandomness is used when we can't generate the values for our next message.
+// The peer has done nothing wrong, so the user is told about an error instead of cheating, and everything
+// generated for this run of the protocol is forgotten.
+func (c *Conversation) abortStateMachineBecauseOfRandomness(err error) (smpState, smpMessage, error) {
+	c.smpEvent(SMPEventError, 0)
+	c.smp.wipe()
+	return abortState(err)
+}
+
 func abortStateMachineAndNotifyError(c *Conversation) (smpState, smpMessage, error) {
 	c.smpEvent(SMPEventError, 0)
-	return sendSMPAbortAndRestartStateMachine()
+	return c.sendSMPAbortAndRestartStateMachine()
 }
 
 func (smpStateBase) receiveMessage1(c *Conversation, m smp1Message) (smpState, smpMessage, error) {
@@ -102,13 +224,14 @@ func (smpStateBase) receiveMessage4(c *Conversation, m smp4Message) (smpState, s
 func (smpStateExpect1) receiveMessage1(c *Conversation, m smp1Message) (smpState, smpMessage, error) {
 	err := c.verifySMP1(m)
 	if err != nil {
-		return c.abortStateMachineAndNotifyCheated()
+		return c.abortStateMachineAndNotifyCheated(1, err)
 	}
 
 	if m.hasQuestion {
 		c.smp.question = &m.question
 		c.smpEventWithQuestion(SMPEventAskForAnswer, 25, m.question)
 	} else {
+		c.smp.question = nil
 		c.smpEvent(SMPEventAskForSecret, 25)
 	}
 
@@ -117,17 +240,22 @@ func (smpStateExpect1) receiveMessage1(c *Conversation, m smp1Message) (smpState
 
 func (s smpStateWaitingForSecret) continueMessage1(c *Conversation, mutualSecret []byte) (smpState, smpMessage, error) {
 	if !c.IsEncrypted() {
-		return abortState(errCantAuthenticateWithoutEncryption)
+		c.smpEvent(SMPEventNotInPrivate, 0)
+		return abortState(ErrAuthenticationNotInPrivate)
 	}
 
+	secret := c.smpSecretNormalization.normalize(mutualSecret)
+	defer wipeBytes(secret)
+
 	// Using ssid here should always be safe - we can't be in an encrypted state without having gone through the AKE
-	c.smp.secret = generateSMPSecret(c.theirKey.Fingerprint(), c.ourCurrentKey.PublicKey().Fingerprint(), c.ssid[:], mutualSecret, c.version)
+	c.smp.secret = generateSMPSecret(c.theirKey.Fingerprint(), c.ourCurrentKey.PublicKey().Fingerprint(), c.ssid[:], secret, c.version)
 	s2, err := c.generateSMP2(c.smp.secret, s.msg)
 	if err != nil {
-		return c.abortStateMachineAndNotifyCheated()
+		return c.abortStateMachineBecauseOfRandomness(err)
 	}
 
 	c.smp.s2 = &s2
+	c.smpEvent(SMPEventInProgress, 50)
 
 	return smpStateExpect3{}, s2.msg, nil
 }
@@ -135,12 +263,12 @@ func (s smpStateWaitingForSecret) continueMessage1(c *Conversation, mutualSecret
 func (smpStateExpect2) receiveMessage2(c *Conversation, m smp2Message) (smpState, smpMessage, error) {
 	err := c.verifySMP2(c.smp.s1, m)
 	if err != nil {
-		return c.abortStateMachineAndNotifyCheated()
+		return c.abortStateMachineAndNotifyCheated(2, err)
 	}
 
 	s3, err := c.generateSMP3(c.smp.secret, *c.smp.s1, m)
 	if err != nil {
-		return c.abortStateMachineAndNotifyCheated()
+		return c.abortStateMachineBecauseOfRandomness(err)
 	}
 
 	c.smpEvent(SMPEventInProgress, 60)
@@ -153,20 +281,21 @@ func (smpStateExpect2) receiveMessage2(c *Conversation, m smp2Message) (smpState
 func (smpStateExpect3) receiveMessage3(c *Conversation, m smp3Message) (smpState, smpMessage, error) {
 	err := c.verifySMP3(c.smp.s2, m)
 	if err != nil {
-		return c.abortStateMachineAndNotifyCheated()
+		return c.abortStateMachineAndNotifyCheated(3, err)
 	}
 
 	err = c.verifySMP3ProtocolSuccess(c.smp.s2, m)
 	if err != nil {
 		c.smpEvent(SMPEventFailure, 100)
-		return sendSMPAbortAndRestartStateMachine()
+		return c.sendSMPAbortAndRestartStateMachine()
 	}
-	c.smpEvent(SMPEventSuccess, 100)
 
+	// The peer only learns that we succeeded from our reply, so we can't report success before we have one
 	ret, err := c.generateSMP4(c.smp.secret, *c.smp.s2, m)
 	if err != nil {
-		return c.abortStateMachineAndNotifyCheated()
+		return c.abortStateMachineBecauseOfRandomness(err)
 	}
+	c.smpSucceeded()
 
 	c.smp.wipe()
 	return smpStateExpect1{}, ret.msg, nil
@@ -175,48 +304,62 @@ func (smpStateExpect3) receiveMessage3(c *Conversation, m smp3Message) (smpState
 func (smpStateExpect4) receiveMessage4(c *Conversation, m smp4Message) (smpState, smpMessage, error) {
 	err := c.verifySMP4(c.smp.s3, m)
 	if err != nil {
-		return c.abortStateMachineAndNotifyCheated()
+		return c.abortStateMachineAndNotifyCheated(4, err)
 	}
 
 	err = c.verifySMP4ProtocolSuccess(c.smp.s1, c.smp.s3, m)
 	if err != nil {
 		c.smpEvent(SMPEventFailure, 100)
-		return sendSMPAbortAndRestartStateMachine()
+		return c.sendSMPAbortAndRestartStateMachine()
 	}
-	c.smpEvent(SMPEventSuccess, 100)
+	c.smpSucceeded()
 
 	c.smp.wipe()
 	return smpStateExpect1{}, nil, nil
 }
 
 func (m smp1Message) receivedMessage(c *Conversation) (ret smpMessage, err error) {
-	c.smp.state, ret, err = c.smp.state.receiveMessage1(c, m)
+	from := c.currentSMPState()
+	to, ret, err := from.receiveMessage1(c, m)
+	c.setSMPState(from, to, "receive SMP message 1")
 	return
 }
 
 func (m smp2Message) receivedMessage(c *Conversation) (ret smpMessage, err error) {
-	c.smp.state, ret, err = c.smp.state.receiveMessage2(c, m)
+	from := c.currentSMPState()
+	to, ret, err := from.receiveMessage2(c, m)
+	c.setSMPState(from, to, "receive SMP message 2")
 	return
 }
 
 func (m smp3Message) receivedMessage(c *Conversation) (ret smpMessage, err error) {
-	c.smp.state, ret, err = c.smp.state.receiveMessage3(c, m)
+	from := c.currentSMPState()
+	to, ret, err := from.receiveMessage3(c, m)
+	c.setSMPState(from, to, "receive SMP message 3")
 	return
 }
 
 func (m smp4Message) receivedMessage(c *Conversation) (ret smpMessage, err error) {
-	c.smp.state, ret, err = c.smp.state.receiveMessage4(c, m)
+	from := c.currentSMPState()
+	to, ret, err := from.receiveMessage4(c, m)
+	c.setSMPState(from, to, "receive SMP message 4")
 	return
 }
 
+// receivedMessage handles an abort from the peer in any state. Everything generated for this run of
+// the protocol is forgotten, so both sides are back at the start
 func (m smpMessageAbort) receivedMessage(c *Conversation) (ret smpMessage, err error) {
-	c.smp.state = smpStateExpect1{}
+	from := c.currentSMPState()
+	c.smp.wipe()
+	c.setSMPState(from, smpStateExpect1{}, "receive SMP abort")
 	c.smpEvent(SMPEventAbort, 0)
 	return
 }
 
 func (c *Conversation) continueMessage(mutualSecret []byte) (ret smpMessage, err error) {
-	c.smp.state, ret, err = c.smp.state.continueMessage1(c, mutualSecret)
+	from := c.currentSMPState()
+	to, ret, err := from.continueMessage1(c, mutualSecret)
+	c.setSMPState(from, to, "provide SMP secret")
 	return
 }
 
@@ -224,7 +367,7 @@ func (smpStateExpect1) String() string          { return "SMPSTATE_EXPECT1" }
 func (smpStateExpect2) String() string          { return "SMPSTATE_EXPECT2" }
 func (smpStateExpect3) String() string          { return "SMPSTATE_EXPECT3" }
 func (smpStateExpect4) String() string          { return "SMPSTATE_EXPECT4" }
-func (smpStateWaitingForSecret) String() string { return "SMPSTATE_WAITINGFORSECRET (internal)" }
+func (smpStateWaitingForSecret) String() string { return "SMPSTATE_WAITINGFORSECRET" }
 
 func (smpStateBase) startAuthenticate(c *Conversation, question string, mutualSecret []byte) (tlvs []tlv, err error) {
 	tlvs, err = smpStateExpect1{}.startAuthenticate(c, question, mutualSecret)
@@ -234,16 +377,26 @@ func (smpStateBase) startAuthenticate(c *Conversation, question string, mutualSe
 
 func (smpStateExpect1) startAuthenticate(c *Conversation, question string, mutualSecret []byte) (tlvs []tlv, err error) {
 	if !c.IsEncrypted() {
-		return nil, errCantAuthenticateWithoutEncryption
+		c.smpEvent(SMPEventNotInPrivate, 0)
+		return nil, ErrAuthenticationNotInPrivate
 	}
 
+	normalized := c.smpSecretNormalization.normalize(mutualSecret)
+	defer wipeBytes(normalized)
+
 	// Using ssid here should always be safe - we can't be in an encrypted state without having gone through the AKE
-	c.smp.secret = generateSMPSecret(c.ourCurrentKey.PublicKey().Fingerprint(), c.theirKey.Fingerprint(), c.ssid[:], mutualSecret, c.version)
+	secret := generateSMPSecret(c.ourCurrentKey.PublicKey().Fingerprint(), c.theirKey.Fingerprint(), c.ssid[:], normalized, c.version)
 
+	// Nothing is changed until the first message has been generated, so a failure leaves a running SMP alone
 	s1, err := c.generateSMP1()
 	if err != nil {
-		return nil, errShortRandomRead
+		wipeBigInt(secret)
+		return nil, err
 	}
+	// Anything left from a run of the protocol that is being restarted is forgotten
+	from := c.currentSMPState()
+	c.smp.wipe()
+	c.smp.secret = secret
 
 	if question != "" {
 		s1.msg.hasQuestion = true
@@ -251,7 +404,9 @@ func (smpStateExpect1) startAuthenticate(c *Conversation, question string, mutua
 	}
 
 	c.smp.s1 = &s1
-	c.smp.state = smpStateExpect2{}
+	c.setSMPState(from, smpStateExpect2{}, "start SMP")
+	c.timelineEvent(TimelineSMPStarted)
+	c.smpEvent(SMPEventInProgress, 20)
 
 	return []tlv{s1.msg.tlv()}, nil
 }
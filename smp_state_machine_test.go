@@ -47,6 +47,30 @@ func Test_smpStateWaitingForSecret_goToExpectState3WhenReceivesContinueSmpMessag
 	assertEquals(t, nextState, smpStateExpect3{})
 }
 
+func Test_smpStateWaitingForSecret_continueMessage1_sendsAnSMPEventAboutSMPProgress(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.ssid = [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+	c.ourCurrentKey = bobPrivateKey
+	c.theirKey = alicePrivateKey.PublicKey()
+
+	c.expectSMPEvent(t, func() {
+		smpStateWaitingForSecret{msg: fixtureMessage1()}.continueMessage1(c, []byte("hello"))
+	}, SMPEventInProgress, 50, "")
+}
+
+func Test_smpStateExpect1_startAuthenticate_sendsAnSMPEventAboutSMPProgress(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.ssid = [8]byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08}
+	c.ourCurrentKey = bobPrivateKey
+	c.theirKey = alicePrivateKey.PublicKey()
+
+	c.expectSMPEvent(t, func() {
+		smpStateExpect1{}.startAuthenticate(c, "", []byte("hello"))
+	}, SMPEventInProgress, 20, "")
+}
+
 func Test_smpStateExpect1_receiveMessage1_setsTheSMPQuestionIfThereWasOneInTheMessage(t *testing.T) {
 	c := newConversation(otrV3{}, fixtureRand())
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
@@ -59,6 +83,17 @@ func Test_smpStateExpect1_receiveMessage1_setsTheSMPQuestionIfThereWasOneInTheMe
 	assertDeepEquals(t, v, "What's the clue?")
 }
 
+func Test_smpStateExpect1_receiveMessage1_forgetsTheQuestionOfAPreviousRunIfThereIsNoQuestionInTheMessage(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	q := "What's the clue?"
+	c.smp.question = &q
+
+	smpStateExpect1{}.receiveMessage1(c, fixtureMessage1())
+	_, ok := c.SMPQuestion()
+
+	assertFalse(t, ok)
+}
+
 func Test_smpStateExpect1_returnsSmpMessageAbortIfReceivesUnexpectedMessage(t *testing.T) {
 	state := smpStateExpect1{}
 	c := newConversation(otrV3{}, fixtureRand())
@@ -378,7 +413,7 @@ func Test_smpStateWaitingForSecret_continueMessage1_abortsSMPIfgenerateSMP2Fails
 
 	s, m, err := smpStateWaitingForSecret{msg: fixtureMessage1()}.continueMessage1(c, []byte("hello world"))
 
-	assertNil(t, err)
+	assertEquals(t, err, errShortRandomRead)
 	assertEquals(t, s, smpStateExpect1{})
 	assertEquals(t, m, smpMessageAbort{})
 }
@@ -411,7 +446,7 @@ func Test_smpStateExpect2_receiveMessage2_abortsSMPIfgenerateSMPFails(t *testing
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 	s, m, err := smpStateExpect2{}.receiveMessage2(c, fixtureMessage2())
 
-	assertNil(t, err)
+	assertEquals(t, err, errShortRandomRead)
 	assertEquals(t, s, smpStateExpect1{})
 	assertDeepEquals(t, m, smpMessageAbort{})
 }
@@ -468,7 +503,7 @@ func Test_smpStateExpect3_receiveMessage3_abortsSMPIfCantGenerateFinalParameters
 	c.smp.s2 = fixtureSmp2()
 	s, m, err := smpStateExpect3{}.receiveMessage3(c, fixtureMessage3())
 
-	assertNil(t, err)
+	assertEquals(t, err, errShortRandomRead)
 	assertEquals(t, s, smpStateExpect1{})
 	assertDeepEquals(t, m, smpMessageAbort{})
 }
@@ -484,6 +519,81 @@ func Test_smpStateExpect4_receiveMessage4_abortsSMPIfVerifySMPReturnsError(t *te
 	assertDeepEquals(t, m, smpMessageAbort{})
 }
 
+func Test_smpStateExpect1_receiveMessage1_tellsWhichMessageFailedVerification(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+
+	c.expectMessageEvent(t, func() {
+		smpStateExpect1{}.receiveMessage1(c, smp1Message{g2a: big.NewInt(1)})
+	}, MessageEventSMPVerificationFailed, nil, SMPVerificationError{Message: 1, Reason: newOtrError("g2a is an invalid group element")})
+}
+
+func Test_smpStateExpect2_receiveMessage2_tellsWhichMessageFailedVerification(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	c.smp.s1 = fixtureSmp1()
+
+	c.expectMessageEvent(t, func() {
+		smpStateExpect2{}.receiveMessage2(c, smp2Message{g2b: big.NewInt(1)})
+	}, MessageEventSMPVerificationFailed, nil, SMPVerificationError{Message: 2, Reason: newOtrError("g2b is an invalid group element")})
+}
+
+func Test_smpStateExpect3_receiveMessage3_tellsWhichMessageFailedVerification(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	c.smp.s2 = fixtureSmp2()
+
+	c.expectMessageEvent(t, func() {
+		smpStateExpect3{}.receiveMessage3(c, smp3Message{pa: big.NewInt(1)})
+	}, MessageEventSMPVerificationFailed, nil, SMPVerificationError{Message: 3, Reason: newOtrError("Pa is an invalid group element")})
+}
+
+func Test_smpStateExpect4_receiveMessage4_tellsWhichMessageFailedVerification(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	c.smp.s1 = fixtureSmp1()
+	c.smp.s3 = fixtureSmp3()
+
+	c.expectMessageEvent(t, func() {
+		smpStateExpect4{}.receiveMessage4(c, smp4Message{rb: big.NewInt(1)})
+	}, MessageEventSMPVerificationFailed, nil, SMPVerificationError{Message: 4, Reason: newOtrError("Rb is an invalid group element")})
+}
+
+func Test_smpStateExpect4_receiveMessage4_signalsCheatingIfVerifySMP4Fails(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	c.smp.s1 = fixtureSmp1()
+	c.smp.s3 = fixtureSmp3()
+
+	c.expectSMPEvent(t, func() {
+		smpStateExpect4{}.receiveMessage4(c, smp4Message{rb: big.NewInt(1)})
+	}, SMPEventCheated, 0, "")
+}
+
+func Test_smpStateExpect3_receiveMessage3_forgetsTheSecretAndStateIfVerificationFails(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c.smp.s2 = fixtureSmp2()
+
+	smpStateExpect3{}.receiveMessage3(c, smp3Message{pa: big.NewInt(1)})
+
+	assertNil(t, c.smp.secret)
+	assertNil(t, c.smp.s2)
+}
+
+func Test_smp3Message_receivedMessage_restartsSMPIfVerificationFails(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	c.smp.state = smpStateExpect3{}
+	c.smp.s2 = fixtureSmp2()
+
+	ret, err := smp3Message{pa: big.NewInt(1)}.receivedMessage(c)
+
+	assertNil(t, err)
+	assertDeepEquals(t, ret, smpMessageAbort{})
+	assertEquals(t, c.smp.state, smpStateExpect1{})
+}
+
+func Test_SMPVerificationError_tellsWhichMessageFailed(t *testing.T) {
+	err := SMPVerificationError{Message: 2, Reason: newOtrError("c2 is not a valid zero knowledge proof")}
+
+	assertEquals(t, err.Error(), "otr: SMP message 2 failed verification: otr: c2 is not a valid zero knowledge proof")
+}
+
 func Test_smpStateExpect4_receiveMessage4_abortsSMPIfProtocolFails(t *testing.T) {
 	c := newConversation(otrV3{}, fixtureRand())
 	c.smp.s1 = fixtureSmp1()
@@ -518,6 +628,64 @@ func Test_smp4Message_receivedMessage_abortsSMPIfTheUnderlyingPrimitiveDoes(t *t
 	assertDeepEquals(t, ret, smpMessageAbort{})
 }
 
+func Test_smpStateWaitingForSecret_continueMessage1_reportsAnErrorAndForgetsTheSecretIfgenerateSMP2Fails(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.Rand = fixedRand([]string{"ABCD"})
+	c.msgState = encrypted
+	c.ourCurrentKey = bobPrivateKey
+	c.theirKey = alicePrivateKey.PublicKey()
+	c.smp.state = smpStateWaitingForSecret{msg: fixtureMessage1()}
+
+	c.expectSMPEvent(t, func() {
+		c.continueMessage([]byte("hello world"))
+	}, SMPEventError, 0, "")
+
+	assertNil(t, c.smp.secret)
+	assertEquals(t, c.smp.state, smpStateExpect1{})
+}
+
+func Test_smpStateExpect2_receiveMessage2_reportsAnErrorInsteadOfCheatingIfgenerateSMP3Fails(t *testing.T) {
+	c := newConversation(otrV3{}, fixedRand([]string{"ABCD"}))
+	c.smp.s1 = fixtureSmp1()
+	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+
+	c.expectSMPEvent(t, func() {
+		smpStateExpect2{}.receiveMessage2(c, fixtureMessage2())
+	}, SMPEventError, 0, "")
+
+	assertNil(t, c.smp.secret)
+	assertNil(t, c.smp.s1)
+}
+
+func Test_smpStateExpect3_receiveMessage3_doesntReportSuccessIfItCantGenerateTheLastMessage(t *testing.T) {
+	c := newConversation(otrV3{}, fixedRand([]string{"ABCD"}))
+	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c.smp.s2 = fixtureSmp2()
+
+	c.expectSMPEvent(t, func() {
+		smpStateExpect3{}.receiveMessage3(c, fixtureMessage3())
+	}, SMPEventError, 0, "")
+}
+
+func Test_smpStateExpect1_startAuthenticate_leavesARunningSMPAloneIfgenerateSMP1Fails(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.ourCurrentKey = bobPrivateKey
+	c.theirKey = alicePrivateKey.PublicKey()
+	c.Rand = fixedRand([]string{"ABCD"})
+	secret := bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c.smp.state = smpStateExpect2{}
+	c.smp.secret = secret
+	c.smp.s1 = fixtureSmp1()
+
+	_, err := c.smp.state.startAuthenticate(c, "", []byte("hello world"))
+
+	assertEquals(t, err, errShortRandomRead)
+	assertEquals(t, c.smp.state, smpStateExpect2{})
+	assertEquals(t, c.smp.secret, secret)
+	assertDeepEquals(t, c.smp.s1, fixtureSmp1())
+}
+
 func Test_receive_returnsAnyErrorThatOccurs(t *testing.T) {
 	m := fixtureMessage2()
 	c := newConversation(otrV3{}, fixedRand([]string{"ABCD"}))
@@ -526,8 +694,8 @@ func Test_receive_returnsAnyErrorThatOccurs(t *testing.T) {
 	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
 
 	ret, err := c.receiveSMP(m)
-	assertNil(t, err)
-	assertDeepEquals(t, *ret, smpMessageAbort{}.tlv())
+	assertEquals(t, err, errShortRandomRead)
+	assertNil(t, ret)
 }
 
 func Test_smpStateExpect1_String_returnsTheCorrectString(t *testing.T) {
@@ -571,3 +739,152 @@ func Test_restartSMP_createsSMPAbort(t *testing.T) {
 	assertDeepEquals(t, c.restartSMP(), smpMessageAbort{}.tlv())
 	assertDeepEquals(t, c.smp.state, smpStateExpect1{})
 }
+
+func smpInEveryState() []smpState {
+	return []smpState{smpStateExpect1{}, smpStateExpect2{}, smpStateExpect3{}, smpStateExpect4{}, smpStateWaitingForSecret{msg: fixtureMessage1()}}
+}
+
+func Test_smpMessageAbort_receivedMessage_restartsAndForgetsEverythingInEveryState(t *testing.T) {
+	for _, state := range smpInEveryState() {
+		c := newConversation(otrV3{}, fixtureRand())
+		question := "what is the question?"
+		c.smp.state = state
+		c.smp.question = &question
+		c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+		c.smp.s1 = fixtureSmp1()
+		c.smp.s2 = fixtureSmp2()
+		c.smp.s3 = fixtureSmp3()
+
+		ret, err := smpMessageAbort{}.receivedMessage(c)
+
+		assertNil(t, ret)
+		assertNil(t, err)
+		assertEquals(t, c.smp.state, smpStateExpect1{})
+		assertNil(t, c.smp.question)
+		assertNil(t, c.smp.secret)
+		assertNil(t, c.smp.s1)
+		assertNil(t, c.smp.s2)
+		assertNil(t, c.smp.s3)
+	}
+}
+
+func Test_smpMessageAbort_receivedMessage_signalsAbortInEveryState(t *testing.T) {
+	for _, state := range smpInEveryState() {
+		c := newConversation(otrV3{}, fixtureRand())
+		c.smp.state = state
+
+		c.expectSMPEvent(t, func() {
+			smpMessageAbort{}.receivedMessage(c)
+		}, SMPEventAbort, 0, "")
+	}
+}
+
+func Test_restartSMP_forgetsEverythingFromTheAbortedRun(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	c.smp.state = smpStateExpect4{}
+	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c.smp.s1 = fixtureSmp1()
+	c.smp.s3 = fixtureSmp3()
+
+	ret := c.restartSMP()
+
+	assertDeepEquals(t, ret, smpMessageAbort{}.tlv())
+	assertEquals(t, c.smp.state, smpStateExpect1{})
+	assertNil(t, c.smp.secret)
+	assertNil(t, c.smp.s1)
+	assertNil(t, c.smp.s3)
+}
+
+func Test_smpStateExpect3_receiveMessage3_forgetsEverythingIfTheSecretsDontMatch(t *testing.T) {
+	c := newConversation(otrV3{}, fixtureRand())
+	c.smp.secret = bnFromHex("ABCDE56321F9A9F8E364607C8C82DECD8E8E6209E2CB952C7E649620F5286FE3")
+	c.smp.s2 = fixtureSmp2()
+	c.smp.s2.b3 = sub(c.smp.s2.b3, big.NewInt(1))
+
+	smpStateExpect3{}.receiveMessage3(c, fixtureMessage3())
+
+	assertNil(t, c.smp.secret)
+	assertNil(t, c.smp.s2)
+}
+
+func Test_AbortAuthentication_letsBothSidesStartOverFromTheBeginning(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	toSend, _ := alice.StartAuthenticate("where did we meet?", []byte("the park"))
+	exchangeUntilQuiet(t, alice, bob, toSend)
+	bobEvents := []SMPEvent{}
+	bob.SetSMPEventHandler(dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		bobEvents = append(bobEvents, event)
+	}})
+
+	toSend, err := alice.AbortAuthentication()
+	assertNil(t, err)
+	exchangeUntilQuiet(t, alice, bob, toSend)
+
+	assertDeepEquals(t, bobEvents, []SMPEvent{SMPEventAbort})
+	assertEquals(t, alice.smp.state, smpStateExpect1{})
+	assertEquals(t, bob.smp.state, smpStateExpect1{})
+	_, hasQuestion := bob.SMPQuestion()
+	assertFalse(t, hasQuestion)
+	_, err = bob.ProvideAuthenticationSecret([]byte("the park"))
+	assertEquals(t, err, errNotWaitingForSMPSecret)
+
+	toSend, _ = bob.StartAuthenticate("", []byte("the park"))
+	exchangeUntilQuiet(t, bob, alice, toSend)
+	toSend, _ = alice.ProvideAuthenticationSecret([]byte("the park"))
+	exchangeUntilQuiet(t, alice, bob, toSend)
+
+	assertEquals(t, bobEvents[len(bobEvents)-1], SMPEventSuccess)
+}
+
+func Test_StartAuthenticate_forgetsWhatWasLeftFromTheRunThatIsRestarted(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.ourCurrentKey = bobPrivateKey
+	c.theirKey = alicePrivateKey.PublicKey()
+	c.smp.state = smpStateExpect4{}
+	c.smp.s3 = fixtureSmp3()
+
+	_, err := c.StartAuthenticate("", []byte("hello world"))
+
+	assertNil(t, err)
+	assertNil(t, c.smp.s3)
+	assertNotNil(t, c.smp.s1)
+	assertEquals(t, c.smp.state, smpStateExpect2{})
+}
+
+func Test_SMPQuestion_isAvailableToTheResponderBeforeTheSecretIsProvided(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	var askedQuestion string
+	bob.SetSMPEventHandler(dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		if event == SMPEventAskForAnswer {
+			askedQuestion = question
+		}
+	}})
+
+	toSend, _ := alice.StartAuthenticate("where did we meet?", []byte("the park"))
+	exchangeUntilQuiet(t, alice, bob, toSend)
+	question, ok := bob.SMPQuestion()
+
+	assertTrue(t, ok)
+	assertEquals(t, question, "where did we meet?")
+	assertEquals(t, askedQuestion, "where did we meet?")
+}
+
+func Test_toSmpMessage1Q_replacesInvalidUTF8InTheQuestion(t *testing.T) {
+	m := fixtureMessage1Q()
+	m.question = "caf\xe9?"
+	t1 := m.tlv()
+
+	res, err := toSmpMessage1Q(t1, defaultFieldLimits)
+
+	assertNil(t, err)
+	assertEquals(t, res.question, "caf\uFFFD?")
+}
+
+func Test_toSmpMessage1Q_returnsAnErrorIfTheQuestionIsNotTerminated(t *testing.T) {
+	_, err := toSmpMessage1Q(tlv{tlvType: tlvTypeSMP1WithQuestion, tlvValue: []byte("where did we meet?")}, defaultFieldLimits)
+
+	assertEquals(t, err, errCorruptSMPMessage)
+}
@@ -25,3 +25,53 @@ func Test_SMPQuestion_returnsNotOKIfThereIsNoQuestion(t *testing.T) {
 	_, ok := c.SMPQuestion()
 	assertEquals(t, ok, false)
 }
+
+func Test_finishAKE_abandonsAnSMPExchangeOfThePreviousSession(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	smp1, _ := alice.StartAuthenticate("where did we meet?", []byte("the park"))
+	bob.Receive(smp1[0])
+	aliceEvents := []SMPEvent{}
+	alice.SetSMPEventHandler(dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		aliceEvents = append(aliceEvents, event)
+	}})
+
+	runNewAKE(t, alice, bob)
+
+	assertEquals(t, alice.SMPState(), "SMPSTATE_EXPECT1")
+	assertEquals(t, bob.SMPState(), "SMPSTATE_EXPECT1")
+	assertNil(t, alice.smp.secret)
+	assertNil(t, alice.smp.s1)
+	_, hasQuestion := bob.SMPQuestion()
+	assertFalse(t, hasQuestion)
+	assertDeepEquals(t, aliceEvents, []SMPEvent{SMPEventAbort})
+}
+
+func Test_finishAKE_doesNotSignalAnythingWhenNoSMPExchangeIsGoingOn(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	aliceEvents := []SMPEvent{}
+	alice.SetSMPEventHandler(dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		aliceEvents = append(aliceEvents, event)
+	}})
+
+	runNewAKE(t, alice, bob)
+
+	assertDeepEquals(t, aliceEvents, []SMPEvent{})
+}
+
+func Test_finishAKE_letsANewSMPExchangeSucceedAfterAbandoningTheOldOne(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	smp1, _ := alice.StartAuthenticate("", []byte("the park"))
+	bob.Receive(smp1[0])
+	runNewAKE(t, alice, bob)
+	succeeded := false
+	alice.SetSMPEventHandler(dynamicSMPEventHandler{func(event SMPEvent, progressPercent int, question string) {
+		succeeded = succeeded || event == SMPEventSuccess
+	}})
+
+	smp1, _ = alice.StartAuthenticate("", []byte("the park"))
+	exchangeUntilQuiet(t, alice, bob, smp1)
+	smp2, _ := bob.ProvideAuthenticationSecret([]byte("the park"))
+	exchangeUntilQuiet(t, bob, alice, smp2)
+
+	assertTrue(t, succeeded)
+}
@@ -105,8 +105,8 @@ func Test_readSmpMessage1TLV(t *testing.T) {
 	msg := fixtureMessage1()
 	tlv := msg.tlv()
 
-	parsedValue, parsedOk := tlv.smpMessage()
-	assertEquals(t, parsedOk, true)
+	parsedValue, parsedErr := tlv.smpMessage(defaultFieldLimits)
+	assertNil(t, parsedErr)
 	val, ok := parsedValue.(smp1Message)
 	assertEquals(t, ok, true)
 	assertDeepEquals(t, val, msg)
@@ -116,8 +116,8 @@ func Test_readSmpMessage1TLVWithAQuestion(t *testing.T) {
 	msg := fixtureMessage1Q()
 	tlv := msg.tlv()
 
-	parsedValue, parsedOk := tlv.smpMessage()
-	assertEquals(t, parsedOk, true)
+	parsedValue, parsedErr := tlv.smpMessage(defaultFieldLimits)
+	assertNil(t, parsedErr)
 	val, ok := parsedValue.(smp1Message)
 	assertEquals(t, ok, true)
 	assertDeepEquals(t, val, msg)
@@ -129,8 +129,8 @@ func Test_readSmpMessage1TLVWithAQuestion_willFailIfThereIsNoNulByte(t *testing.
 	tlv.tlvLength = 0
 	tlv.tlvValue = []byte{}
 
-	_, parsedOk := tlv.smpMessage()
-	assertEquals(t, parsedOk, false)
+	_, parsedErr := tlv.smpMessage(defaultFieldLimits)
+	assertNotNil(t, parsedErr)
 }
 
 func Test_readSmpMessage1TLVWithAQuestion_willHandleItCorrectlyIfTheQuestionEndsOnAByte(t *testing.T) {
@@ -139,8 +139,8 @@ func Test_readSmpMessage1TLVWithAQuestion_willHandleItCorrectlyIfTheQuestionEnds
 	tlv.tlvLength = 2
 	tlv.tlvValue = []byte{0x01, 0x00}
 
-	_, parsedOk := tlv.smpMessage()
-	assertEquals(t, parsedOk, false)
+	_, parsedErr := tlv.smpMessage(defaultFieldLimits)
+	assertNotNil(t, parsedErr)
 }
 
 func Test_readSmpMessage1TLVWithAQuestion_willHandleItCorrectlyIfANulByteIsTheOnlyContent(t *testing.T) {
@@ -149,8 +149,8 @@ func Test_readSmpMessage1TLVWithAQuestion_willHandleItCorrectlyIfANulByteIsTheOn
 	tlv.tlvLength = 1
 	tlv.tlvValue = []byte{0x00}
 
-	_, parsedOk := tlv.smpMessage()
-	assertEquals(t, parsedOk, false)
+	_, parsedErr := tlv.smpMessage(defaultFieldLimits)
+	assertNotNil(t, parsedErr)
 }
 
 func Test_readSmpMessage1TLV_ReturnsNotOKForInValidMessage1(t *testing.T) {
@@ -158,8 +158,8 @@ func Test_readSmpMessage1TLV_ReturnsNotOKForInValidMessage1(t *testing.T) {
 	tlv := msg.tlv()
 	tlv.tlvValue = tlv.tlvValue[:24]
 
-	_, parsedOk := tlv.smpMessage()
-	assertEquals(t, parsedOk, false)
+	_, parsedErr := tlv.smpMessage(defaultFieldLimits)
+	assertNotNil(t, parsedErr)
 }
 
 func Test_readSmpMessage1TLV_ReturnsNotOKIfTheNumberOfMPIsIsTooShort(t *testing.T) {
@@ -167,8 +167,8 @@ func Test_readSmpMessage1TLV_ReturnsNotOKIfTheNumberOfMPIsIsTooShort(t *testing.
 	tlv := msg.tlv()
 	tlv.tlvValue[3] = 0x01
 
-	_, parsedOk := tlv.smpMessage()
-	assertEquals(t, parsedOk, false)
+	_, parsedErr := tlv.smpMessage(defaultFieldLimits)
+	assertNotNil(t, parsedErr)
 }
 
 func Test_readSmpMessage2TLV_ReturnsNotOKForInValidMessage2(t *testing.T) {
@@ -176,8 +176,8 @@ func Test_readSmpMessage2TLV_ReturnsNotOKForInValidMessage2(t *testing.T) {
 	tlv := msg.tlv()
 	tlv.tlvValue = tlv.tlvValue[:24]
 
-	_, parsedOk := tlv.smpMessage()
-	assertEquals(t, parsedOk, false)
+	_, parsedErr := tlv.smpMessage(defaultFieldLimits)
+	assertNotNil(t, parsedErr)
 }
 
 func Test_readSmpMessage2TLV_ReturnsNotOKIfTheNumberOfMPIsIsTooShort(t *testing.T) {
@@ -185,8 +185,8 @@ func Test_readSmpMessage2TLV_ReturnsNotOKIfTheNumberOfMPIsIsTooShort(t *testing.
 	tlv := msg.tlv()
 	tlv.tlvValue[3] = 0x01
 
-	_, parsedOk := tlv.smpMessage()
-	assertEquals(t, parsedOk, false)
+	_, parsedErr := tlv.smpMessage(defaultFieldLimits)
+	assertNotNil(t, parsedErr)
 }
 
 func Test_readSmpMessage3TLV_ReturnsNotOKForInValidMessage2(t *testing.T) {
@@ -194,8 +194,8 @@ func Test_readSmpMessage3TLV_ReturnsNotOKForInValidMessage2(t *testing.T) {
 	tlv := msg.tlv()
 	tlv.tlvValue = tlv.tlvValue[:24]
 
-	_, parsedOk := tlv.smpMessage()
-	assertEquals(t, parsedOk, false)
+	_, parsedErr := tlv.smpMessage(defaultFieldLimits)
+	assertNotNil(t, parsedErr)
 }
 
 func Test_readSmpMessage3TLV_ReturnsNotOKIfTheNumberOfMPIsIsTooShort(t *testing.T) {
@@ -203,8 +203,8 @@ func Test_readSmpMessage3TLV_ReturnsNotOKIfTheNumberOfMPIsIsTooShort(t *testing.
 	tlv := msg.tlv()
 	tlv.tlvValue[3] = 0x01
 
-	_, parsedOk := tlv.smpMessage()
-	assertEquals(t, parsedOk, false)
+	_, parsedErr := tlv.smpMessage(defaultFieldLimits)
+	assertNotNil(t, parsedErr)
 }
 
 func Test_readSmpMessage4TLV_ReturnsNotOKForInValidMessage2(t *testing.T) {
@@ -212,8 +212,8 @@ func Test_readSmpMessage4TLV_ReturnsNotOKForInValidMessage2(t *testing.T) {
 	tlv := msg.tlv()
 	tlv.tlvValue = tlv.tlvValue[:24]
 
-	_, parsedOk := tlv.smpMessage()
-	assertEquals(t, parsedOk, false)
+	_, parsedErr := tlv.smpMessage(defaultFieldLimits)
+	assertNotNil(t, parsedErr)
 }
 
 func Test_readSmpMessage4TLV_ReturnsNotOKIfTheNumberOfMPIsIsTooShort(t *testing.T) {
@@ -221,30 +221,30 @@ func Test_readSmpMessage4TLV_ReturnsNotOKIfTheNumberOfMPIsIsTooShort(t *testing.
 	tlv := msg.tlv()
 	tlv.tlvValue[3] = 0x01
 
-	_, parsedOk := tlv.smpMessage()
-	assertEquals(t, parsedOk, false)
+	_, parsedErr := tlv.smpMessage(defaultFieldLimits)
+	assertNotNil(t, parsedErr)
 }
 
 func Test_toSMPMessage_ReturnsNotOKForIncorrectTLVType(t *testing.T) {
 	tlv := tlv{tlvType: 0x0A}
 
-	_, parsedOk := tlv.smpMessage()
-	assertEquals(t, parsedOk, false)
+	_, parsedErr := tlv.smpMessage(defaultFieldLimits)
+	assertNotNil(t, parsedErr)
 }
 
 func Test_toSMPMessage_ReturnsNotOKForTooShortTLV(t *testing.T) {
 	tlv := tlv{}
 
-	_, parsedOk := tlv.smpMessage()
-	assertEquals(t, parsedOk, false)
+	_, parsedErr := tlv.smpMessage(defaultFieldLimits)
+	assertNotNil(t, parsedErr)
 }
 
 func Test_readSmpMessage2TLV(t *testing.T) {
 	msg := fixtureMessage2()
 	tlv := msg.tlv()
 
-	parsedValue, parsedOk := tlv.smpMessage()
-	assertEquals(t, parsedOk, true)
+	parsedValue, parsedErr := tlv.smpMessage(defaultFieldLimits)
+	assertNil(t, parsedErr)
 	val, ok := parsedValue.(smp2Message)
 	assertEquals(t, ok, true)
 	assertDeepEquals(t, val, msg)
@@ -254,8 +254,8 @@ func Test_readSmpMessage3TLV(t *testing.T) {
 	msg := fixtureMessage3()
 	tlv := msg.tlv()
 
-	parsedValue, parsedOk := tlv.smpMessage()
-	assertEquals(t, parsedOk, true)
+	parsedValue, parsedErr := tlv.smpMessage(defaultFieldLimits)
+	assertNil(t, parsedErr)
 	val, ok := parsedValue.(smp3Message)
 	assertEquals(t, ok, true)
 	assertDeepEquals(t, val, msg)
@@ -265,8 +265,8 @@ func Test_readSmpMessage4TLV(t *testing.T) {
 	msg := fixtureMessage4()
 	tlv := msg.tlv()
 
-	parsedValue, parsedOk := tlv.smpMessage()
-	assertEquals(t, parsedOk, true)
+	parsedValue, parsedErr := tlv.smpMessage(defaultFieldLimits)
+	assertNil(t, parsedErr)
 	val, ok := parsedValue.(smp4Message)
 	assertEquals(t, ok, true)
 	assertDeepEquals(t, val, msg)
@@ -276,8 +276,8 @@ func Test_readSmpMessageAbortTLV(t *testing.T) {
 	msg := fixtureMessageAbort()
 	tlv := msg.tlv()
 
-	parsedValue, parsedOk := tlv.smpMessage()
-	assertEquals(t, parsedOk, true)
+	parsedValue, parsedErr := tlv.smpMessage(defaultFieldLimits)
+	assertNil(t, parsedErr)
 	val, ok := parsedValue.(smpMessageAbort)
 	assertEquals(t, ok, true)
 	assertDeepEquals(t, val, msg)
@@ -2,16 +2,50 @@ package otr3
 
 import "fmt"
 
+// SSIDHalf tells which half of the secure session ID should be displayed in bold. By convention,
+// the initiator of the AKE shows the first half in bold and the responder the second half, so that
+// the two users can read their bold half to each other to verify the private conversation.
+type SSIDHalf int
+
+const (
+	// SSIDFirstHalfBold means the first four bytes of the secure session ID should be displayed in bold
+	SSIDFirstHalfBold SSIDHalf = iota
+	// SSIDSecondHalfBold means the last four bytes of the secure session ID should be displayed in bold
+	SSIDSecondHalfBold
+)
+
+// String returns the string representation of the SSIDHalf
+func (h SSIDHalf) String() string {
+	switch h {
+	case SSIDFirstHalfBold:
+		return "SSIDFirstHalfBold"
+	case SSIDSecondHalfBold:
+		return "SSIDSecondHalfBold"
+	default:
+		return "SSID HALF: (THIS SHOULD NEVER HAPPEN)"
+	}
+}
+
+// BoldSSIDHalf returns which half of the secure session ID returned by GetSSID should be displayed in bold
+func (c *Conversation) BoldSSIDHalf() SSIDHalf {
+	switch c.Role() {
+	case RoleInitiator:
+		return SSIDFirstHalfBold
+	case RoleResponder:
+		return SSIDSecondHalfBold
+	}
+
+	if c.sentRevealSig {
+		return SSIDFirstHalfBold
+	}
+	return SSIDSecondHalfBold
+}
+
 // SecureSessionID returns the secure session ID as two formatted strings
 // The index returned points to the string that should be highlighted
 func (c *Conversation) SecureSessionID() (parts []string, highlightIndex int) {
 	l := fmt.Sprintf("%0x", c.ssid[0:4])
 	r := fmt.Sprintf("%0x", c.ssid[4:])
 
-	ix := 1
-	if c.sentRevealSig {
-		ix = 0
-	}
-
-	return []string{l, r}, ix
+	return []string{l, r}, int(c.BoldSSIDHalf())
 }
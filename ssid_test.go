@@ -24,3 +24,40 @@ func Test_SecureSessionID_returnsTheIndexOfTheValueThatShouldBeHighlighted(t *te
 	_, f = c.SecureSessionID()
 	assertEquals(t, f, 1)
 }
+
+func Test_BoldSSIDHalf_isTheFirstHalfForTheInitiatorAndTheSecondForTheResponder(t *testing.T) {
+	alice, bob := benchmarkConversations()
+
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	assertEquals(t, bob.BoldSSIDHalf(), SSIDFirstHalfBold)
+	assertEquals(t, alice.BoldSSIDHalf(), SSIDSecondHalfBold)
+	assertEquals(t, alice.GetSSID(), bob.GetSSID())
+}
+
+func Test_BoldSSIDHalf_followsTheRoleOfTheLatestAKE(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+
+	runNewAKE(t, alice, bob)
+
+	assertEquals(t, alice.BoldSSIDHalf(), SSIDFirstHalfBold)
+	assertEquals(t, bob.BoldSSIDHalf(), SSIDSecondHalfBold)
+}
+
+func Test_SecureSessionID_highlightsTheBoldSSIDHalf(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	aliceParts, aliceIndex := alice.SecureSessionID()
+	bobParts, bobIndex := bob.SecureSessionID()
+
+	assertDeepEquals(t, aliceParts, bobParts)
+	assertEquals(t, aliceIndex, int(alice.BoldSSIDHalf()))
+	assertEquals(t, bobIndex, int(bob.BoldSSIDHalf()))
+}
+
+func Test_SSIDHalf_String(t *testing.T) {
+	assertEquals(t, SSIDFirstHalfBold.String(), "SSIDFirstHalfBold")
+	assertEquals(t, SSIDSecondHalfBold.String(), "SSIDSecondHalfBold")
+	assertEquals(t, SSIDHalf(42).String(), "SSID HALF: (THIS SHOULD NEVER HAPPEN)")
+}
@@ -0,0 +1,116 @@
+package otr3
+
+import "fmt"
+
+// StateMachine describes one of the state machines a conversation is made of.
+// The states are named like in the debug output of a conversation.
+type StateMachine struct {
+	Name        string
+	Initial     string
+	States      []string
+	Transitions []StateTransition
+}
+
+// StateTransition is a transition between two states of a StateMachine, caused by the event On.
+// From and To are the same for events that are handled without changing the state.
+type StateTransition struct {
+	From, On, To string
+}
+
+type namedState interface {
+	identityString() string
+}
+
+var stateMachines []*StateMachine
+
+// registerStateMachine adds a state machine to the ones returned by StateGraph. The states are given as the
+// values the implementation uses for them, so the description can't refer to states that don't exist.
+func registerStateMachine(name string, initial namedState, states ...namedState) *StateMachine {
+	m := &StateMachine{Name: name, Initial: initial.identityString()}
+	for _, s := range states {
+		m.States = append(m.States, s.identityString())
+	}
+	m.mustHaveState(m.Initial)
+
+	stateMachines = append(stateMachines, m)
+	return m
+}
+
+// on registers the transitions the implementation makes when the event happens. It panics if a state
+// hasn't been registered for the state machine, so a mistake is found as soon as the package is loaded.
+func (m *StateMachine) on(event string, transitions ...[2]namedState) *StateMachine {
+	for _, t := range transitions {
+		from, to := t[0].identityString(), t[1].identityString()
+		m.mustHaveState(from)
+		m.mustHaveState(to)
+		m.Transitions = append(m.Transitions, StateTransition{From: from, On: event, To: to})
+	}
+	return m
+}
+
+// hasTransition returns true if the event is registered to make the transition
+func (m *StateMachine) hasTransition(from, on, to string) bool {
+	for _, t := range m.Transitions {
+		if t.From == from && t.On == on && t.To == to {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *StateMachine) mustHaveState(name string) {
+	for _, s := range m.States {
+		if s == name {
+			return
+		}
+	}
+	panic(fmt.Sprintf("otr3: state %s is not registered for the %s state machine", name, m.Name))
+}
+
+// from makes a transition for StateMachine.on
+func from(f, to namedState) [2]namedState {
+	return [2]namedState{f, to}
+}
+
+// StateGraph returns all message states, authentication states and SMP states,
+// and the transitions between them that are implemented. The descriptions are registered
+// together with the state types, so they can be used to check coverage programmatically.
+// Changing the result doesn't affect the package.
+func StateGraph() []StateMachine {
+	result := make([]StateMachine, len(stateMachines))
+	for i, m := range stateMachines {
+		result[i] = StateMachine{
+			Name:        m.Name,
+			Initial:     m.Initial,
+			States:      append([]string(nil), m.States...),
+			Transitions: append([]StateTransition(nil), m.Transitions...),
+		}
+	}
+	return result
+}
+
+// maxUnregisteredTransitions is how many state changes that aren't in the state graph a conversation remembers
+const maxUnregisteredTransitions = 16
+
+// unregisteredTransition is a state change a conversation made that isn't in the state graph
+type unregisteredTransition struct {
+	machine string
+	StateTransition
+}
+
+// recordTransition is called by the setters of the states for every state change. A change that isn't in the state
+// graph is remembered by the conversation, so it can be found - the conversation keeps working either way. Staying
+// in the same state is always fine, since it is what happens when an event fails.
+func (c *Conversation) recordTransition(m *StateMachine, from, to namedState, trigger string) {
+	f, t := from.identityString(), to.identityString()
+	if f == t || m.hasTransition(f, trigger, t) {
+		return
+	}
+
+	if len(c.unregisteredTransitions) < maxUnregisteredTransitions {
+		c.unregisteredTransitions = append(c.unregisteredTransitions, unregisteredTransition{
+			machine:         m.Name,
+			StateTransition: StateTransition{From: f, On: trigger, To: t},
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package otr3
+
+import "testing"
+
+func stateMachineNamed(name string) StateMachine {
+	for _, m := range StateGraph() {
+		if m.Name == name {
+			return m
+		}
+	}
+	return StateMachine{}
+}
+
+func (m StateMachine) hasState(name string) bool {
+	for _, s := range m.States {
+		if s == name {
+			return true
+		}
+	}
+	return false
+}
+
+// assertOnlyRegisteredTransitions checks that every state change the conversation made is in the state graph
+func assertOnlyRegisteredTransitions(t *testing.T, c *Conversation) {
+	for _, tr := range c.unregisteredTransitions {
+		t.Errorf("the %s state machine went from %s to %s on %q, which isn't in the state graph", tr.machine, tr.From, tr.To, tr.On)
+	}
+}
+
+// assertStepIsInTheGraph runs the step and checks that every state change it makes to the conversations
+// is one of the transitions in the state graph
+func assertStepIsInTheGraph(t *testing.T, step func(), cs ...*Conversation) {
+	step()
+
+	for _, c := range cs {
+		assertOnlyRegisteredTransitions(t, c)
+	}
+}
+
+// exchangeCheckingTheGraph works like exchangeUntilQuiet, but checks every message received against the state graph
+func exchangeCheckingTheGraph(t *testing.T, from, to *Conversation, msgs []ValidMessage) {
+	for len(msgs) > 0 {
+		var next []ValidMessage
+		for _, m := range msgs {
+			assertStepIsInTheGraph(t, func() {
+				_, toSend, err := to.Receive(m)
+				assertNil(t, err)
+				next = append(next, toSend...)
+			}, to)
+		}
+		msgs = next
+		from, to = to, from
+	}
+}
+
+func Test_StateGraph_describesTheMessageAuthenticationAndSMPStateMachines(t *testing.T) {
+	graph := StateGraph()
+
+	assertEquals(t, len(graph), 3)
+	assertDeepEquals(t, stateMachineNamed("message").States, []string{"PLAINTEXT", "ENCRYPTED", "FINISHED"})
+	assertDeepEquals(t, stateMachineNamed("authentication").States, []string{"NONE", "AWAITING_DHKEY", "AWAITING_REVEALSIG", "AWAITING_SIG"})
+	assertDeepEquals(t, stateMachineNamed("SMP").States, []string{"EXPECT1", "EXPECT1_WQ", "EXPECT2", "EXPECT3", "EXPECT4"})
+	assertEquals(t, stateMachineNamed("SMP").Initial, "EXPECT1")
+}
+
+func Test_StateGraph_onlyRefersToRegisteredStates(t *testing.T) {
+	for _, m := range StateGraph() {
+		for _, tr := range m.Transitions {
+			assertTrue(t, m.hasState(tr.From))
+			assertTrue(t, m.hasState(tr.To))
+		}
+	}
+}
+
+func Test_StateGraph_returnsACopy(t *testing.T) {
+	StateGraph()[0].States[0] = "CHANGED"
+	StateGraph()[0].Transitions = nil
+
+	assertFalse(t, StateGraph()[0].States[0] == "CHANGED")
+	assertFalse(t, len(StateGraph()[0].Transitions) == 0)
+}
+
+func Test_registerStateMachine_panicsForTransitionsToUnregisteredStates(t *testing.T) {
+	defer func() {
+		assertNotNil(t, recover())
+	}()
+
+	m := &StateMachine{Name: "test", States: []string{"NONE"}}
+	m.on("something", from(authStateNone{}, authStateAwaitingSig{}))
+}
+
+func Test_StateGraph_containsEveryTransitionOfAConversation(t *testing.T) {
+	alice, bob := benchmarkConversations()
+
+	exchangeCheckingTheGraph(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	var toSend []ValidMessage
+	assertStepIsInTheGraph(t, func() { toSend, _ = alice.StartAuthenticate("", []byte("secret")) }, alice)
+	exchangeCheckingTheGraph(t, alice, bob, toSend)
+	assertStepIsInTheGraph(t, func() { toSend, _ = bob.ProvideAuthenticationSecret([]byte("secret")) }, bob)
+	exchangeCheckingTheGraph(t, bob, alice, toSend)
+
+	assertStepIsInTheGraph(t, func() { toSend, _ = alice.StartAuthenticate("", []byte("secret")) }, alice)
+	assertStepIsInTheGraph(t, func() { toSend, _ = bob.End() }, bob)
+	exchangeCheckingTheGraph(t, bob, alice, toSend)
+	assertStepIsInTheGraph(t, func() { alice.End() }, alice)
+
+	assertFalse(t, alice.IsEncrypted())
+	assertFalse(t, bob.IsEncrypted())
+}
+
+func Test_setMsgState_recordsATransitionThatIsntInTheStateGraph(t *testing.T) {
+	c := &Conversation{}
+
+	c.setMsgState(finished, "end conversation")
+
+	assertEquals(t, c.msgState, finished)
+	assertDeepEquals(t, c.unregisteredTransitions, []unregisteredTransition{
+		{machine: "message", StateTransition: StateTransition{From: "PLAINTEXT", On: "end conversation", To: "FINISHED"}},
+	})
+}
+
+func Test_setMsgState_doesntRecordATransitionOfTheStateGraph(t *testing.T) {
+	c := &Conversation{msgState: encrypted}
+
+	c.setMsgState(plainText, "peer offline")
+
+	assertNil(t, c.unregisteredTransitions)
+}
+
+func Test_recordTransition_remembersALimitedNumberOfTransitions(t *testing.T) {
+	c := &Conversation{}
+
+	for i := 0; i <= maxUnregisteredTransitions; i++ {
+		c.setSMPState(smpStateExpect1{}, smpStateExpect4{}, "receive SMP message 1")
+	}
+
+	assertEquals(t, len(c.unregisteredTransitions), maxUnregisteredTransitions)
+}
+
+func Test_StateGraph_containsTheTransitionsOfAManager(t *testing.T) {
+	alice := managerFor(alicePrivateKey)
+	bob := managerFor(bobPrivateKey)
+
+	exchangeBetweenManagers(t, alice, bob, []ValidMessage{alice.Master().QueryMessage()})
+	bobTag := bob.Master().ourInstanceTag
+	instance := alice.Instance(bobTag)
+	instance.StartAuthenticate("", []byte("secret"))
+	alice.PeerOffline(bobTag)
+
+	assertFalse(t, instance.IsEncrypted())
+	for _, c := range []*Conversation{alice.Master(), instance, bob.Master(), bob.Instance(alice.Master().ourInstanceTag)} {
+		assertOnlyRegisteredTransitions(t, c)
+	}
+}
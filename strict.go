@@ -0,0 +1,64 @@
+package otr3
+
+import "bytes"
+
+// nonConformant decides what to do with received data that doesn't follow the specification.
+// With the StrictSpec policy the error is returned, and the data should be rejected. Otherwise
+// the problem is reported with MessageEventReceivedMessageNonConformant and nil is returned,
+// so the data can be accepted anyway.
+func (c *Conversation) nonConformant(err error) error {
+	if c.Policies.Has(PolicyStrictSpec) {
+		return err
+	}
+
+	c.messageEventWithError(MessageEventReceivedMessageNonConformant, err)
+	return nil
+}
+
+// isConformantQueryMessage returns true if the message starts with "?OTR?", "?OTRv<versions>?" or "?OTR?v<versions>?".
+// Anything can follow the query itself.
+func isConformantQueryMessage(msg ValidMessage) bool {
+	rest := msg[len(queryMarker):]
+
+	if bytes.HasPrefix(rest, []byte("?")) {
+		rest = rest[1:]
+		if !bytes.HasPrefix(rest, []byte("v")) {
+			return true
+		}
+	}
+
+	if !bytes.HasPrefix(rest, []byte("v")) {
+		return false
+	}
+	rest = rest[1:]
+
+	for len(rest) > 0 && isVersionCharacter(rest[0]) {
+		rest = rest[1:]
+	}
+
+	return bytes.HasPrefix(rest, []byte("?"))
+}
+
+func isVersionCharacter(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// isConformantEncoding returns true if the encoded message consists of only base64 characters
+// between the "?OTR:" prefix and the "." it has to end with
+func isConformantEncoding(encoded encodedMessage) bool {
+	if len(encoded) <= len(msgMarker) || encoded[len(encoded)-1] != '.' {
+		return false
+	}
+
+	for _, c := range encoded[len(msgMarker) : len(encoded)-1] {
+		if !isBase64Character(c) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isBase64Character(c byte) bool {
+	return c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '+' || c == '/' || c == '='
+}
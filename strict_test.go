@@ -0,0 +1,144 @@
+package otr3
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+func Test_isConformantQueryMessage_acceptsQueriesFollowingTheSpecification(t *testing.T) {
+	assertTrue(t, isConformantQueryMessage(ValidMessage("?OTR?")))
+	assertTrue(t, isConformantQueryMessage(ValidMessage("?OTRv3?")))
+	assertTrue(t, isConformantQueryMessage(ValidMessage("?OTRv23?")))
+	assertTrue(t, isConformantQueryMessage(ValidMessage("?OTR?v2?")))
+	assertTrue(t, isConformantQueryMessage(ValidMessage("?OTRv?")))
+	assertTrue(t, isConformantQueryMessage(ValidMessage("?OTRv3? Bob has requested a private conversation")))
+}
+
+func Test_isConformantQueryMessage_rejectsSloppyQueries(t *testing.T) {
+	assertFalse(t, isConformantQueryMessage(ValidMessage("?OTR")))
+	assertFalse(t, isConformantQueryMessage(ValidMessage("?OTRv3")))
+	assertFalse(t, isConformantQueryMessage(ValidMessage("?OTRv 3?")))
+	assertFalse(t, isConformantQueryMessage(ValidMessage("?OTR?v3")))
+	assertFalse(t, isConformantQueryMessage(ValidMessage("?OTRx")))
+}
+
+func Test_isConformantEncoding_acceptsOnlyBase64TerminatedByADot(t *testing.T) {
+	assertTrue(t, isConformantEncoding(encodedMessage("?OTR:AAMD+/==.")))
+	assertFalse(t, isConformantEncoding(encodedMessage("?OTR:AAMD")))
+	assertFalse(t, isConformantEncoding(encodedMessage("?OTR:AAMD,")))
+	assertFalse(t, isConformantEncoding(encodedMessage("?OTR:AA\nMD.")))
+	assertFalse(t, isConformantEncoding(encodedMessage("?OTR:AA MD.")))
+	assertFalse(t, isConformantEncoding(encodedMessage("?OTR:")))
+}
+
+func Test_receiveQueryMessage_acceptsASloppyQueryWithAnEventInCompatibilityMode(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.Policies = Policies(PolicyAllowV3)
+	c.SetOurKeys([]PrivateKey{bobPrivateKey})
+
+	var toSend []ValidMessage
+	var err error
+	c.expectMessageEvent(t, func() {
+		_, toSend, err = c.Receive(ValidMessage("?OTRv3"))
+	}, MessageEventReceivedMessageNonConformant, nil, errNonConformantQueryMessage)
+
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 1)
+}
+
+func Test_receiveQueryMessage_rejectsASloppyQueryInStrictMode(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.Policies = Policies(PolicyAllowV3 | PolicyStrictSpec)
+	c.SetOurKeys([]PrivateKey{bobPrivateKey})
+
+	_, toSend, err := c.Receive(ValidMessage("?OTRv3"))
+
+	assertEquals(t, err, errNonConformantQueryMessage)
+	assertNil(t, toSend)
+}
+
+func Test_receiveQueryMessage_acceptsAConformantQueryInStrictMode(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.Policies = Policies(PolicyAllowV3 | PolicyStrictSpec)
+	c.SetOurKeys([]PrivateKey{bobPrivateKey})
+
+	_, toSend, err := c.Receive(ValidMessage("?OTRv3?"))
+
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 1)
+}
+
+func dhCommitWithNewline(t *testing.T) ValidMessage {
+	alice := newConversation(otrV3{}, rand.Reader)
+	alice.Policies = Policies(PolicyAllowV3)
+	alice.SetOurKeys([]PrivateKey{alicePrivateKey})
+
+	_, toSend, err := alice.Receive(ValidMessage("?OTRv3?"))
+	assertNil(t, err)
+
+	msg := toSend[0]
+	return append(append(makeCopy(msg[:20]), '\n'), msg[20:]...)
+}
+
+func Test_decode_acceptsANewlineInTheEncodingWithAnEventInCompatibilityMode(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.Policies = Policies(PolicyAllowV3)
+	c.SetOurKeys([]PrivateKey{bobPrivateKey})
+
+	var toSend []ValidMessage
+	var err error
+	c.expectMessageEvent(t, func() {
+		_, toSend, err = c.Receive(dhCommitWithNewline(t))
+	}, MessageEventReceivedMessageNonConformant, nil, errNonConformantEncoding)
+
+	assertNil(t, err)
+	assertEquals(t, len(toSend), 1)
+}
+
+func Test_decode_rejectsANewlineInTheEncodingInStrictMode(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.Policies = Policies(PolicyAllowV3 | PolicyStrictSpec)
+	c.SetOurKeys([]PrivateKey{bobPrivateKey})
+
+	_, toSend, err := c.Receive(dhCommitWithNewline(t))
+
+	assertEquals(t, err, errNonConformantEncoding)
+	assertNil(t, toSend)
+}
+
+func Test_processSMPTLV_acceptsTrailingDataWithAnEventInCompatibilityMode(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	abort := tlv{tlvType: tlvTypeSMPAbort, tlvLength: 1, tlvValue: []byte{0x01}}
+
+	var err error
+	c.expectMessageEvent(t, func() {
+		_, err = c.processSMPTLV(abort, dataMessageExtra{})
+	}, MessageEventReceivedMessageNonConformant, nil, errNonConformantTLV)
+
+	assertNil(t, err)
+}
+
+func Test_processSMPTLV_rejectsTrailingDataInStrictMode(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.Policies.Add(PolicyStrictSpec)
+	t1 := fixtureMessage1().tlv()
+	t1.tlvValue = append(t1.tlvValue, 0x00)
+	t1.tlvLength++
+
+	_, err := c.processSMPTLV(t1, dataMessageExtra{})
+
+	assertEquals(t, err, errNonConformantTLV)
+}
+
+func Test_processSMPTLV_acceptsAConformantTLVInStrictMode(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.Policies.Add(PolicyStrictSpec)
+
+	c.doesntExpectMessageEvent(t, func() {
+		_, err := c.processSMPTLV(smpMessageAbort{}.tlv(), dataMessageExtra{})
+		assertNil(t, err)
+	})
+}
@@ -0,0 +1,105 @@
+package otr3
+
+import "time"
+
+// TimelineEventKind tells what happened at a point of the timeline of a conversation
+type TimelineEventKind int
+
+const (
+	// TimelineAKEStarted means an AKE was started, by us or by the peer
+	TimelineAKEStarted TimelineEventKind = iota
+	// TimelineAKEFinished means an AKE finished and a private conversation began
+	TimelineAKEFinished
+	// TimelineKeysRotated means the D-H keys of the private conversation were rotated
+	TimelineKeysRotated
+	// TimelineSMPStarted means we started an SMP exchange
+	TimelineSMPStarted
+	// TimelineSMPRequested means the peer started an SMP exchange
+	TimelineSMPRequested
+	// TimelineSMPSucceeded means an SMP exchange found that both sides have the same secret
+	TimelineSMPSucceeded
+	// TimelineSMPFailed means an SMP exchange found that the secrets are different
+	TimelineSMPFailed
+	// TimelineSMPCheated means an SMP message from the peer failed verification
+	TimelineSMPCheated
+	// TimelineSMPAborted means an SMP exchange was aborted by either side
+	TimelineSMPAborted
+	// TimelineEndedByUs means we ended the private conversation
+	TimelineEndedByUs
+	// TimelineEndedByThem means the peer ended the private conversation
+	TimelineEndedByThem
+	// TimelineEndedByPeerOffline means the private conversation ended because the instance of the peer went away
+	TimelineEndedByPeerOffline
+)
+
+var timelineEventKindNames = map[TimelineEventKind]string{
+	TimelineAKEStarted:         "TimelineAKEStarted",
+	TimelineAKEFinished:        "TimelineAKEFinished",
+	TimelineKeysRotated:        "TimelineKeysRotated",
+	TimelineSMPStarted:         "TimelineSMPStarted",
+	TimelineSMPRequested:       "TimelineSMPRequested",
+	TimelineSMPSucceeded:       "TimelineSMPSucceeded",
+	TimelineSMPFailed:          "TimelineSMPFailed",
+	TimelineSMPCheated:         "TimelineSMPCheated",
+	TimelineSMPAborted:         "TimelineSMPAborted",
+	TimelineEndedByUs:          "TimelineEndedByUs",
+	TimelineEndedByThem:        "TimelineEndedByThem",
+	TimelineEndedByPeerOffline: "TimelineEndedByPeerOffline",
+}
+
+// String returns the string representation of the TimelineEventKind
+func (k TimelineEventKind) String() string {
+	if name, ok := timelineEventKindNames[k]; ok {
+		return name
+	}
+	return "TIMELINE EVENT KIND: (THIS SHOULD NEVER HAPPEN)"
+}
+
+// maxTimelineEvents is the number of events Timeline remembers
+const maxTimelineEvents = 64
+
+// TimelineEvent is something that happened to the keys or the verification of a conversation
+type TimelineEvent struct {
+	// Kind is what happened
+	Kind TimelineEventKind
+	// At is when it happened, by the clock of the conversation
+	At time.Time
+	// SSID is the secure session id of the latest private conversation at the time, or all zeroes before the first one
+	SSID [8]byte
+}
+
+// Timeline returns the last things that happened to the keys and the verification of this conversation, oldest first.
+// It can be used to reconstruct what happened and when, for example when investigating a suspected
+// man-in-the-middle attack. Changing the result doesn't affect the conversation.
+func (c *Conversation) Timeline() []TimelineEvent {
+	return append([]TimelineEvent(nil), c.timeline...)
+}
+
+func (c *Conversation) timelineEvent(kind TimelineEventKind) {
+	c.timeline = append(c.timeline, TimelineEvent{Kind: kind, At: c.now(), SSID: c.ssid})
+	if len(c.timeline) > maxTimelineEvents {
+		c.timeline = append([]TimelineEvent(nil), c.timeline[len(c.timeline)-maxTimelineEvents:]...)
+	}
+}
+
+var timelineEventForSMPEvent = map[SMPEvent]TimelineEventKind{
+	SMPEventAskForSecret: TimelineSMPRequested,
+	SMPEventAskForAnswer: TimelineSMPRequested,
+	SMPEventSuccess:      TimelineSMPSucceeded,
+	SMPEventFailure:      TimelineSMPFailed,
+	SMPEventCheated:      TimelineSMPCheated,
+	SMPEventAbort:        TimelineSMPAborted,
+}
+
+var timelineEventForEndedBy = map[EndedBy]TimelineEventKind{
+	EndedByUs:          TimelineEndedByUs,
+	EndedByThem:        TimelineEndedByThem,
+	EndedByPeerOffline: TimelineEndedByPeerOffline,
+}
+
+// smpTimelineEvent records the SMP events that show the peer starting an exchange, or an exchange ending
+func (c *Conversation) smpTimelineEvent(e SMPEvent) {
+	if kind, ok := timelineEventForSMPEvent[e]; ok {
+		c.timelineEvent(kind)
+	}
+}
@@ -0,0 +1,120 @@
+package otr3
+
+import (
+	"testing"
+	"time"
+)
+
+func timelineKinds(c *Conversation) []TimelineEventKind {
+	kinds := []TimelineEventKind{}
+	for _, e := range c.Timeline() {
+		kinds = append(kinds, e.Kind)
+	}
+	return kinds
+}
+
+func withoutKeyRotations(kinds []TimelineEventKind) []TimelineEventKind {
+	res := []TimelineEventKind{}
+	for _, k := range kinds {
+		if k != TimelineKeysRotated {
+			res = append(res, k)
+		}
+	}
+	return res
+}
+
+func Test_Timeline_isEmptyBeforeAnythingHappens(t *testing.T) {
+	c := &Conversation{}
+
+	assertEquals(t, len(c.Timeline()), 0)
+}
+
+func Test_Timeline_recordsTheStartAndFinishOfTheAKE(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	clock := &fakeClock{now: time.Date(2016, 1, 1, 12, 0, 0, 0, time.UTC)}
+	alice.SetClock(clock)
+
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	assertDeepEquals(t, timelineKinds(alice), []TimelineEventKind{TimelineAKEStarted, TimelineAKEFinished})
+	assertDeepEquals(t, timelineKinds(bob), []TimelineEventKind{TimelineAKEStarted, TimelineAKEFinished})
+	finished := alice.Timeline()[1]
+	assertEquals(t, finished.At, clock.now)
+	assertEquals(t, finished.SSID, alice.GetSSID())
+}
+
+func Test_Timeline_recordsKeyRotations(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+
+	msg, _ := bob.Send(ValidMessage("hello"))
+	alice.Receive(msg[0])
+
+	kinds := timelineKinds(alice)
+	assertEquals(t, kinds[len(kinds)-1], TimelineKeysRotated)
+}
+
+func Test_Timeline_recordsAnSMPExchangeOnBothSides(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+
+	smp1, _ := alice.StartAuthenticate("", []byte("the park"))
+	exchangeUntilQuiet(t, alice, bob, smp1)
+	smp2, _ := bob.ProvideAuthenticationSecret([]byte("the park"))
+	exchangeUntilQuiet(t, bob, alice, smp2)
+
+	assertDeepEquals(t, withoutKeyRotations(timelineKinds(alice)[2:]), []TimelineEventKind{TimelineSMPStarted, TimelineSMPSucceeded})
+	assertDeepEquals(t, withoutKeyRotations(timelineKinds(bob)[2:]), []TimelineEventKind{TimelineSMPRequested, TimelineSMPSucceeded})
+}
+
+func Test_Timeline_recordsAnAbortedSMPExchange(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	smp1, _ := alice.StartAuthenticate("", []byte("the park"))
+	exchangeUntilQuiet(t, alice, bob, smp1)
+
+	abort, _ := bob.AbortAuthentication()
+	exchangeUntilQuiet(t, bob, alice, abort)
+
+	kinds := timelineKinds(alice)
+	assertEquals(t, kinds[len(kinds)-1], TimelineSMPAborted)
+}
+
+func Test_Timeline_recordsWhoEndedThePrivateConversation(t *testing.T) {
+	alice, bob := encryptedConversations(t)
+	ssid := alice.GetSSID()
+
+	disconnect, _ := alice.End()
+	bob.Receive(disconnect[0])
+
+	aliceTimeline := alice.Timeline()
+	assertEquals(t, aliceTimeline[len(aliceTimeline)-1].Kind, TimelineEndedByUs)
+	assertEquals(t, aliceTimeline[len(aliceTimeline)-1].SSID, ssid)
+	kinds := timelineKinds(bob)
+	assertEquals(t, kinds[len(kinds)-1], TimelineEndedByThem)
+}
+
+func Test_Timeline_onlyKeepsTheLatestEvents(t *testing.T) {
+	c := &Conversation{}
+
+	for i := 0; i < maxTimelineEvents+5; i++ {
+		c.timelineEvent(TimelineKeysRotated)
+	}
+	c.timelineEvent(TimelineEndedByUs)
+
+	timeline := c.Timeline()
+	assertEquals(t, len(timeline), maxTimelineEvents)
+	assertEquals(t, timeline[len(timeline)-1].Kind, TimelineEndedByUs)
+}
+
+func Test_Timeline_returnsACopy(t *testing.T) {
+	c := &Conversation{}
+	c.timelineEvent(TimelineAKEStarted)
+
+	c.Timeline()[0].Kind = TimelineEndedByThem
+
+	assertEquals(t, c.Timeline()[0].Kind, TimelineAKEStarted)
+}
+
+func Test_TimelineEventKind_String(t *testing.T) {
+	assertEquals(t, TimelineAKEFinished.String(), "TimelineAKEFinished")
+	assertEquals(t, TimelineSMPCheated.String(), "TimelineSMPCheated")
+	assertEquals(t, TimelineEventKind(-1).String(), "TIMELINE EVENT KIND: (THIS SHOULD NEVER HAPPEN)")
+}
@@ -2,6 +2,8 @@ package otr3
 
 import (
 	"bytes"
+	"math/big"
+	"strings"
 
 	"github.com/coyim/gotrax"
 )
@@ -94,29 +96,41 @@ func (c tlv) isSMPMessage() bool {
 	return c.tlvType >= tlvTypeSMP1 && c.tlvType <= tlvTypeSMP1WithQuestion
 }
 
-func (c tlv) smpMessage() (smpMessage, bool) {
+func (c tlv) smpMessage(l FieldLimits) (smpMessage, error) {
 	switch c.tlvType {
 	case tlvTypeSMP1:
-		return toSmpMessage1(c)
+		return toSmpMessage1(c, l)
 	case tlvTypeSMP1WithQuestion:
-		return toSmpMessage1Q(c)
+		return toSmpMessage1Q(c, l)
 	case tlvTypeSMP2:
-		return toSmpMessage2(c)
+		return toSmpMessage2(c, l)
 	case tlvTypeSMP3:
-		return toSmpMessage3(c)
+		return toSmpMessage3(c, l)
 	case tlvTypeSMP4:
-		return toSmpMessage4(c)
+		return toSmpMessage4(c, l)
 	case tlvTypeSMPAbort:
 		return toSmpMessageAbort(c)
 	}
 
-	return nil, false
+	return nil, errCorruptSMPMessage
 }
 
-func toSmpMessage1(t tlv) (msg smp1Message, ok bool) {
-	_, mpis, ok := gotrax.ExtractMPIs(t.tlvValue)
-	if !ok || len(mpis) < 6 {
-		return msg, false
+// smpMPIs extracts the MPIs of an SMP message, which must have at least n of them
+func smpMPIs(t tlv, l FieldLimits, n int) ([]*big.Int, error) {
+	_, mpis, err := l.extractMPIs(t.tlvValue)
+	if err != nil {
+		return nil, fieldError(err, errCorruptSMPMessage)
+	}
+	if len(mpis) < n {
+		return nil, errCorruptSMPMessage
+	}
+	return mpis, nil
+}
+
+func toSmpMessage1(t tlv, l FieldLimits) (msg smp1Message, err error) {
+	mpis, err := smpMPIs(t, l, 6)
+	if err != nil {
+		return msg, err
 	}
 	msg.g2a = mpis[0]
 	msg.c2 = mpis[1]
@@ -124,26 +138,27 @@ func toSmpMessage1(t tlv) (msg smp1Message, ok bool) {
 	msg.g3a = mpis[3]
 	msg.c3 = mpis[4]
 	msg.d3 = mpis[5]
-	return msg, true
+	return msg, nil
 }
 
-func toSmpMessage1Q(t tlv) (msg smp1Message, ok bool) {
+func toSmpMessage1Q(t tlv, l FieldLimits) (msg smp1Message, err error) {
 	nulPos := bytes.IndexByte(t.tlvValue, 0)
 	if nulPos == -1 {
-		return msg, false
+		return msg, errCorruptSMPMessage
 	}
-	question := string(t.tlvValue[:nulPos])
+	// the question is shown to the user, so anything that isn't valid UTF-8 is replaced
+	question := strings.ToValidUTF8(string(t.tlvValue[:nulPos]), "\uFFFD")
 	t.tlvValue = t.tlvValue[(nulPos + 1):]
-	msg, ok = toSmpMessage1(t)
+	msg, err = toSmpMessage1(t, l)
 	msg.hasQuestion = true
 	msg.question = question
-	return msg, ok
+	return msg, err
 }
 
-func toSmpMessage2(t tlv) (msg smp2Message, ok bool) {
-	_, mpis, ok := gotrax.ExtractMPIs(t.tlvValue)
-	if !ok || len(mpis) < 11 {
-		return msg, false
+func toSmpMessage2(t tlv, l FieldLimits) (msg smp2Message, err error) {
+	mpis, err := smpMPIs(t, l, 11)
+	if err != nil {
+		return msg, err
 	}
 	msg.g2b = mpis[0]
 	msg.c2 = mpis[1]
@@ -156,13 +171,13 @@ func toSmpMessage2(t tlv) (msg smp2Message, ok bool) {
 	msg.cp = mpis[8]
 	msg.d5 = mpis[9]
 	msg.d6 = mpis[10]
-	return msg, true
+	return msg, nil
 }
 
-func toSmpMessage3(t tlv) (msg smp3Message, ok bool) {
-	_, mpis, ok := gotrax.ExtractMPIs(t.tlvValue)
-	if !ok || len(mpis) < 8 {
-		return msg, false
+func toSmpMessage3(t tlv, l FieldLimits) (msg smp3Message, err error) {
+	mpis, err := smpMPIs(t, l, 8)
+	if err != nil {
+		return msg, err
 	}
 	msg.pa = mpis[0]
 	msg.qa = mpis[1]
@@ -172,20 +187,20 @@ func toSmpMessage3(t tlv) (msg smp3Message, ok bool) {
 	msg.ra = mpis[5]
 	msg.cr = mpis[6]
 	msg.d7 = mpis[7]
-	return msg, true
+	return msg, nil
 }
 
-func toSmpMessage4(t tlv) (msg smp4Message, ok bool) {
-	_, mpis, ok := gotrax.ExtractMPIs(t.tlvValue)
-	if !ok || len(mpis) < 3 {
-		return msg, false
+func toSmpMessage4(t tlv, l FieldLimits) (msg smp4Message, err error) {
+	mpis, err := smpMPIs(t, l, 3)
+	if err != nil {
+		return msg, err
 	}
 	msg.rb = mpis[0]
 	msg.cr = mpis[1]
 	msg.d7 = mpis[2]
-	return msg, true
+	return msg, nil
 }
 
-func toSmpMessageAbort(t tlv) (msg smpMessageAbort, ok bool) {
-	return msg, true
+func toSmpMessageAbort(t tlv) (msg smpMessageAbort, err error) {
+	return msg, nil
 }
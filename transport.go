@@ -0,0 +1,95 @@
+package otr3
+
+import "time"
+
+// TransportProfile describes the timing characteristics of the transport that carries the conversation.
+// Interactive transports deliver messages within seconds, while asynchronous or offline transports - like
+// email or store-and-forward messaging - can deliver messages hours or days later, and not always in order.
+type TransportProfile struct {
+	Name string
+	// AKETimeout is how long an AKE in progress is considered fresh. During this time, repeated
+	// query messages are ignored instead of restarting the AKE
+	AKETimeout time.Duration
+	// HeartbeatInterval is how long after sending a message we wait before sending a heartbeat.
+	// Zero means heartbeats are never sent
+	HeartbeatInterval time.Duration
+	// ResendInterval is how long after sending a message we still retransmit messages
+	// queued while the AKE was in progress
+	ResendInterval time.Duration
+	// ReorderWindow is how many data messages older than the newest one received will still be accepted,
+	// as long as they have not been received before. It can be at most 64. Zero means messages must arrive in order
+	ReorderWindow uint64
+}
+
+const maxReorderWindow = 64
+
+var (
+	// TransportProfileRealtime is the profile for interactive transports, like XMPP or IRC. This is the default.
+	TransportProfileRealtime = TransportProfile{
+		Name:              "realtime",
+		AKETimeout:        time.Minute,
+		HeartbeatInterval: 60 * time.Second,
+		ResendInterval:    60 * time.Second,
+		ReorderWindow:     0,
+	}
+	// TransportProfileAsync is the profile for asynchronous and offline transports. The AKE can take days
+	// to finish and be resumed with ResumeAKE, no heartbeats are sent since they would only add traffic
+	// to a transport where the peer might not be online, and data messages can arrive out of order.
+	TransportProfileAsync = TransportProfile{
+		Name:              "async",
+		AKETimeout:        7 * 24 * time.Hour,
+		HeartbeatInterval: 0,
+		ResendInterval:    7 * 24 * time.Hour,
+		ReorderWindow:     maxReorderWindow,
+	}
+)
+
+// SetTransportProfile sets the timing characteristics of the transport this conversation uses
+func (c *Conversation) SetTransportProfile(p TransportProfile) error {
+	if p.ReorderWindow > maxReorderWindow {
+		return newOtrErrorf("reorder window too large: %d", p.ReorderWindow)
+	}
+	c.transportProfile = &p
+	return nil
+}
+
+// TransportProfile returns the timing characteristics of the transport this conversation uses
+func (c *Conversation) TransportProfile() TransportProfile {
+	if c.transportProfile == nil {
+		return TransportProfileRealtime
+	}
+	return *c.transportProfile
+}
+
+// ResumeAKE returns the last AKE message we sent, so a handshake interrupted by the transport
+// can continue where it stopped. This is useful when the transport may have lost the message,
+// or when the application restarts the delivery of pending messages.
+// It returns an error if there is no AKE in progress that is waiting for the peer.
+func (c *Conversation) ResumeAKE() ([]ValidMessage, error) {
+	if c.ake == nil {
+		return nil, errNoAKEInProgress
+	}
+
+	var msgType byte
+	var msg []byte
+
+	switch s := c.ake.state.(type) {
+	case authStateAwaitingDHKey:
+		msgType, msg = msgTypeDHCommit, c.serializeDHCommit(c.ake.ourPublicValue)
+	case authStateAwaitingRevealSig:
+		msgType, msg = msgTypeDHKey, c.serializeDHKey()
+	case authStateAwaitingSig:
+		c.ake.lastStateChange = c.now()
+		return c.fragEncode(s.revealSigMsg), nil
+	default:
+		return nil, errNoAKEInProgress
+	}
+
+	toSend, err := c.wrapMessageHeader(msgType, msg)
+	if err != nil {
+		return nil, err
+	}
+
+	c.ake.lastStateChange = c.now()
+	return c.fragEncode(toSend), nil
+}
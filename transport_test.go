@@ -0,0 +1,157 @@
+package otr3
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_TransportProfile_isRealtimeByDefault(t *testing.T) {
+	c := &Conversation{}
+
+	assertDeepEquals(t, c.TransportProfile(), TransportProfileRealtime)
+}
+
+func Test_SetTransportProfile_setsTheProfile(t *testing.T) {
+	c := &Conversation{}
+	err := c.SetTransportProfile(TransportProfileAsync)
+
+	assertNil(t, err)
+	assertDeepEquals(t, c.TransportProfile(), TransportProfileAsync)
+}
+
+func Test_SetTransportProfile_returnsErrorIfTheReorderWindowIsTooLarge(t *testing.T) {
+	c := &Conversation{}
+	p := TransportProfileAsync
+	p.ReorderWindow = 65
+	err := c.SetTransportProfile(p)
+
+	assertEquals(t, err, newOtrError("reorder window too large: 65"))
+	assertDeepEquals(t, c.TransportProfile(), TransportProfileRealtime)
+}
+
+func Test_potentialHeartbeat_neverSendsAHeartbeatWithTheAsyncProfile(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.SetTransportProfile(TransportProfileAsync)
+	c.heartbeat.lastSent = time.Now().Add(-48 * time.Hour)
+
+	ret, err := c.potentialHeartbeat([]byte("Foo plain"))
+	assertNil(t, ret)
+	assertNil(t, err)
+}
+
+func Test_receiveQueryMessage_ignoresARepeatedQueryWithinTheAKETimeoutOfTheAsyncProfile(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	bob.SetTransportProfile(TransportProfileAsync)
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	bob.lastMessageStateChange = bob.lastMessageStateChange.Add(-24 * time.Hour)
+	_, toSend, err := bob.Receive(alice.QueryMessage())
+
+	assertNil(t, err)
+	assertNil(t, toSend)
+}
+
+func Test_shouldRetransmit_usesTheResendIntervalOfTheProfile(t *testing.T) {
+	c := &Conversation{}
+	c.resend.mayRetransmit = retransmitExact
+	c.resend.later(MessagePlaintext("hello"))
+	c.heartbeat.lastSent = time.Now().Add(-24 * time.Hour)
+
+	assertFalse(t, c.shouldRetransmit())
+
+	c.SetTransportProfile(TransportProfileAsync)
+	assertTrue(t, c.shouldRetransmit())
+}
+
+func counterMessage(ctr byte) dataMsg {
+	msg := dataMsg{senderKeyID: 1, recipientKeyID: 1}
+	msg.topHalfCtr[7] = ctr
+	return msg
+}
+
+func Test_checkMessageCounter_acceptsOlderMessagesWithinTheReorderWindow(t *testing.T) {
+	c := keyManagementContext{}
+
+	assertNil(t, c.checkMessageCounter(counterMessage(5), 4))
+	assertNil(t, c.checkMessageCounter(counterMessage(3), 4))
+	assertNil(t, c.checkMessageCounter(counterMessage(4), 4))
+	assertNil(t, c.checkMessageCounter(counterMessage(1), 4))
+	assertEquals(t, c.counterHistory.findCounterFor(1, 1).theirCounter, uint64(5))
+}
+
+func Test_checkMessageCounter_rejectsMessagesAlreadyReceivedWithinTheReorderWindow(t *testing.T) {
+	c := keyManagementContext{}
+
+	c.checkMessageCounter(counterMessage(3), 4)
+	c.checkMessageCounter(counterMessage(5), 4)
+	c.checkMessageCounter(counterMessage(4), 4)
+
+	assertEquals(t, c.checkMessageCounter(counterMessage(5), 4), newOtrConflictError("counter regressed"))
+	assertEquals(t, c.checkMessageCounter(counterMessage(4), 4), newOtrConflictError("counter regressed"))
+	assertEquals(t, c.checkMessageCounter(counterMessage(3), 4), newOtrConflictError("counter regressed"))
+}
+
+func Test_checkMessageCounter_rejectsMessagesOlderThanTheReorderWindow(t *testing.T) {
+	c := keyManagementContext{}
+
+	c.checkMessageCounter(counterMessage(10), 4)
+
+	assertEquals(t, c.checkMessageCounter(counterMessage(5), 4), newOtrConflictError("counter regressed"))
+	assertEquals(t, c.checkMessageCounter(counterMessage(0), 64), newOtrConflictError("counter regressed"))
+}
+
+func Test_Conversation_acceptsDataMessagesOutOfOrderWithTheAsyncProfile(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	alice.SetTransportProfile(TransportProfileAsync)
+	bob.SetTransportProfile(TransportProfileAsync)
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	first, _ := alice.Send(ValidMessage("first"))
+	second, _ := alice.Send(ValidMessage("second"))
+
+	plain, _, err := bob.Receive(second[0])
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("second"))
+
+	plain, _, err = bob.Receive(first[0])
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("first"))
+
+	_, _, err = bob.Receive(first[0])
+	assertEquals(t, err, newOtrConflictError("counter regressed"))
+}
+
+func Test_ResumeAKE_returnsErrorWithoutAnAKEInProgress(t *testing.T) {
+	c := &Conversation{}
+	_, err := c.ResumeAKE()
+	assertEquals(t, err, errNoAKEInProgress)
+
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	_, err = alice.ResumeAKE()
+	assertEquals(t, err, errNoAKEInProgress)
+}
+
+func Test_ResumeAKE_resendsTheLastAKEMessageSoTheHandshakeCanContinue(t *testing.T) {
+	alice, bob := benchmarkConversations()
+
+	_, dhCommit, _ := bob.Receive(alice.QueryMessage())
+	resumed, err := bob.ResumeAKE()
+	assertNil(t, err)
+	assertDeepEquals(t, resumed, dhCommit)
+
+	_, dhKey, _ := alice.Receive(resumed[0])
+	resumed, err = alice.ResumeAKE()
+	assertNil(t, err)
+	assertDeepEquals(t, resumed, dhKey)
+
+	_, revealSig, _ := bob.Receive(resumed[0])
+	resumed, err = bob.ResumeAKE()
+	assertNil(t, err)
+	assertDeepEquals(t, resumed, revealSig)
+
+	exchangeUntilQuiet(t, bob, alice, resumed)
+	assertTrue(t, alice.IsEncrypted())
+	assertTrue(t, bob.IsEncrypted())
+}
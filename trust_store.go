@@ -0,0 +1,132 @@
+package otr3
+
+import (
+	"encoding/hex"
+	"sync"
+)
+
+// TrustStore keeps track of the fingerprints we have seen for our peers and whether we trust them.
+// Peers are identified by a string chosen by the application, for example their account name.
+// An implementation can keep the fingerprints anywhere - MemoryTrustStore keeps them in memory.
+type TrustStore interface {
+	// Lookup returns whether the fingerprint is known for the peer and, if so, whether it is trusted
+	Lookup(peer string, fingerprint []byte) (known, trusted bool)
+	// HasFingerprints returns true if any fingerprints are known for the peer
+	HasFingerprints(peer string) bool
+	// Add records the fingerprint as known for the peer, without changing its trust if it was already known
+	Add(peer string, fingerprint []byte)
+	// SetTrusted records the fingerprint for the peer with the given trust
+	SetTrusted(peer string, fingerprint []byte, trusted bool)
+}
+
+// MemoryTrustStore is a TrustStore that keeps everything in memory. It is safe for concurrent use.
+type MemoryTrustStore struct {
+	lock  sync.Mutex
+	peers map[string]map[string]bool
+}
+
+// NewMemoryTrustStore returns an empty MemoryTrustStore
+func NewMemoryTrustStore() *MemoryTrustStore {
+	return &MemoryTrustStore{peers: make(map[string]map[string]bool)}
+}
+
+// Lookup implements TrustStore
+func (s *MemoryTrustStore) Lookup(peer string, fingerprint []byte) (known, trusted bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	trusted, known = s.peers[peer][hex.EncodeToString(fingerprint)]
+	return known, trusted
+}
+
+// HasFingerprints implements TrustStore
+func (s *MemoryTrustStore) HasFingerprints(peer string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return len(s.peers[peer]) > 0
+}
+
+// Add implements TrustStore
+func (s *MemoryTrustStore) Add(peer string, fingerprint []byte) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	fprs := s.fingerprintsOf(peer)
+	fpr := hex.EncodeToString(fingerprint)
+	if _, ok := fprs[fpr]; !ok {
+		fprs[fpr] = false
+	}
+}
+
+// SetTrusted implements TrustStore
+func (s *MemoryTrustStore) SetTrusted(peer string, fingerprint []byte, trusted bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.fingerprintsOf(peer)[hex.EncodeToString(fingerprint)] = trusted
+}
+
+func (s *MemoryTrustStore) fingerprintsOf(peer string) map[string]bool {
+	fprs, ok := s.peers[peer]
+	if !ok {
+		fprs = make(map[string]bool)
+		s.peers[peer] = fprs
+	}
+	return fprs
+}
+
+// SetTrustStore makes the conversation consult the given store about the fingerprints of the given peer.
+// Every time the conversation goes secure, the fingerprint of the key the peer used is looked up.
+// If it is not known yet, it is added to the store as untrusted and TheirFingerprintNew is signalled,
+// or TheirFingerprintChanged if other fingerprints were known for the peer.
+func (c *Conversation) SetTrustStore(store TrustStore, peer string) {
+	c.trustStore = store
+	c.trustStorePeer = peer
+}
+
+// SetTrustOnSMPSuccess decides whether the fingerprint of the peer is marked as trusted in the trust store
+// when SMP succeeds
+func (c *Conversation) SetTrustOnSMPSuccess(v bool) {
+	c.trustOnSMPSuccess = v
+}
+
+// IsTheirFingerprintTrusted returns true if the trust store says the fingerprint of the key the peer
+// used in the last AKE is trusted
+func (c *Conversation) IsTheirFingerprintTrusted() bool {
+	if c.trustStore == nil || c.theirKey == nil {
+		return false
+	}
+
+	_, trusted := c.trustStore.Lookup(c.trustStorePeer, c.theirKey.Fingerprint())
+	return trusted
+}
+
+func (c *Conversation) checkTheirFingerprint() {
+	if c.trustStore == nil {
+		return
+	}
+
+	fpr := c.theirKey.Fingerprint()
+	if known, _ := c.trustStore.Lookup(c.trustStorePeer, fpr); known {
+		return
+	}
+
+	changed := c.trustStore.HasFingerprints(c.trustStorePeer)
+	c.trustStore.Add(c.trustStorePeer, fpr)
+
+	if changed {
+		c.securityEvent(TheirFingerprintChanged)
+	} else {
+		c.securityEvent(TheirFingerprintNew)
+	}
+}
+
+func (c *Conversation) smpSucceeded() {
+	if c.trustOnSMPSuccess && c.trustStore != nil {
+		c.trustStore.SetTrusted(c.trustStorePeer, c.theirKey.Fingerprint(), true)
+	}
+	c.verified()
+
+	c.smpEvent(SMPEventSuccess, 100)
+}
@@ -0,0 +1,134 @@
+package otr3
+
+import "testing"
+
+func Test_MemoryTrustStore_knowsNothingWhenCreated(t *testing.T) {
+	s := NewMemoryTrustStore()
+
+	known, trusted := s.Lookup("bob", []byte{0x01})
+
+	assertEquals(t, known, false)
+	assertEquals(t, trusted, false)
+	assertEquals(t, s.HasFingerprints("bob"), false)
+}
+
+func Test_MemoryTrustStore_Add_recordsTheFingerprintAsUntrusted(t *testing.T) {
+	s := NewMemoryTrustStore()
+
+	s.Add("bob", []byte{0x01})
+	known, trusted := s.Lookup("bob", []byte{0x01})
+
+	assertEquals(t, known, true)
+	assertEquals(t, trusted, false)
+	assertEquals(t, s.HasFingerprints("bob"), true)
+	assertEquals(t, s.HasFingerprints("carol"), false)
+}
+
+func Test_MemoryTrustStore_Add_doesntChangeTheTrustOfAKnownFingerprint(t *testing.T) {
+	s := NewMemoryTrustStore()
+	s.SetTrusted("bob", []byte{0x01}, true)
+
+	s.Add("bob", []byte{0x01})
+	_, trusted := s.Lookup("bob", []byte{0x01})
+
+	assertEquals(t, trusted, true)
+}
+
+func Test_MemoryTrustStore_SetTrusted_changesTheTrust(t *testing.T) {
+	s := NewMemoryTrustStore()
+	s.SetTrusted("bob", []byte{0x01}, true)
+	s.SetTrusted("bob", []byte{0x01}, false)
+
+	known, trusted := s.Lookup("bob", []byte{0x01})
+
+	assertEquals(t, known, true)
+	assertEquals(t, trusted, false)
+}
+
+func Test_SetTrustStore_addsANewFingerprintAndSignalsTheirFingerprintNew(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	store := NewMemoryTrustStore()
+	bob.SetTrustStore(store, "alice")
+	events := collectSecurityEvents(bob)
+
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	assertDeepEquals(t, *events, []SecurityEvent{GoneSecure, TheirFingerprintNew})
+	known, trusted := store.Lookup("alice", alicePrivateKey.PublicKey().Fingerprint())
+	assertEquals(t, known, true)
+	assertEquals(t, trusted, false)
+	assertEquals(t, bob.IsTheirFingerprintTrusted(), false)
+}
+
+func Test_SetTrustStore_signalsTheirFingerprintChangedForAnUnknownFingerprintOfAKnownPeer(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	store := NewMemoryTrustStore()
+	store.SetTrusted("alice", []byte{0x01, 0x02}, true)
+	bob.SetTrustStore(store, "alice")
+	events := collectSecurityEvents(bob)
+
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	assertDeepEquals(t, *events, []SecurityEvent{GoneSecure, TheirFingerprintChanged})
+}
+
+func Test_SetTrustStore_doesntSignalAnythingForAKnownFingerprint(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	store := NewMemoryTrustStore()
+	store.SetTrusted("alice", alicePrivateKey.PublicKey().Fingerprint(), true)
+	bob.SetTrustStore(store, "alice")
+	events := collectSecurityEvents(bob)
+
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	assertDeepEquals(t, *events, []SecurityEvent{GoneSecure})
+	assertEquals(t, bob.IsTheirFingerprintTrusted(), true)
+}
+
+func runSMP(t *testing.T, alice, bob *Conversation, aliceSecret, bobSecret string) {
+	toSend, err := alice.StartAuthenticate("", []byte(aliceSecret))
+	assertNil(t, err)
+	exchangeUntilQuiet(t, alice, bob, toSend)
+
+	toSend, err = bob.ProvideAuthenticationSecret([]byte(bobSecret))
+	assertNil(t, err)
+	exchangeUntilQuiet(t, bob, alice, toSend)
+}
+
+func Test_SetTrustOnSMPSuccess_marksTheFingerprintAsTrustedWhenSMPSucceeds(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	aliceStore, bobStore := NewMemoryTrustStore(), NewMemoryTrustStore()
+	alice.SetTrustStore(aliceStore, "bob")
+	alice.SetTrustOnSMPSuccess(true)
+	bob.SetTrustStore(bobStore, "alice")
+	bob.SetTrustOnSMPSuccess(true)
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	runSMP(t, alice, bob, "the secret", "the secret")
+
+	assertEquals(t, alice.IsTheirFingerprintTrusted(), true)
+	assertEquals(t, bob.IsTheirFingerprintTrusted(), true)
+}
+
+func Test_SetTrustOnSMPSuccess_doesntTrustTheFingerprintWhenSMPFails(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	store := NewMemoryTrustStore()
+	bob.SetTrustStore(store, "alice")
+	bob.SetTrustOnSMPSuccess(true)
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	runSMP(t, alice, bob, "the secret", "another secret")
+
+	assertEquals(t, bob.IsTheirFingerprintTrusted(), false)
+}
+
+func Test_SetTrustStore_doesntTrustTheFingerprintOnSMPSuccessByDefault(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	store := NewMemoryTrustStore()
+	bob.SetTrustStore(store, "alice")
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	runSMP(t, alice, bob, "the secret", "the secret")
+
+	assertEquals(t, bob.IsTheirFingerprintTrusted(), false)
+}
@@ -0,0 +1,98 @@
+package otr3
+
+import (
+	"bytes"
+	"time"
+)
+
+// VerificationLifetime bounds how long a verification of the peer - with SMP or manually - is relied on.
+// High security deployments can use it to limit the exposure from a single compromised verification:
+// once the lifetime is over, re-keying is not enough, and the peer has to be verified again before
+// more messages can be sent. The lifetime only starts when the peer is verified.
+type VerificationLifetime struct {
+	// MaxDuration is how long after the verification messages can be sent. Zero means no limit
+	MaxDuration time.Duration
+	// MaxMessages is how many messages can be sent and received after the verification. Zero means no limit
+	MaxMessages uint64
+}
+
+type verificationContext struct {
+	lifetime    VerificationLifetime
+	fingerprint []byte
+	verifiedAt  time.Time
+	messages    uint64
+	expired     bool
+}
+
+// SetVerificationLifetime sets how long a verification of the peer is relied on
+func (c *Conversation) SetVerificationLifetime(l VerificationLifetime) {
+	c.verification.lifetime = l
+}
+
+// VerificationLifetime returns how long a verification of the peer is relied on
+func (c *Conversation) VerificationLifetime() VerificationLifetime {
+	return c.verification.lifetime
+}
+
+// MarkVerified records that the user has verified the key the peer used in the last AKE manually,
+// for example by comparing fingerprints. Succeeding with SMP does the same automatically.
+// It starts a new VerificationLifetime.
+func (c *Conversation) MarkVerified() {
+	c.verified()
+}
+
+// VerificationHasExpired returns true if the key of the peer was verified, but the verification
+// has outlived the VerificationLifetime. The peer has to be verified again before messages can be sent.
+func (c *Conversation) VerificationHasExpired() bool {
+	return c.verificationHasExpired()
+}
+
+func (c *Conversation) verified() {
+	if c.theirKey == nil {
+		return
+	}
+
+	c.verification.fingerprint = c.theirKey.Fingerprint()
+	c.verification.verifiedAt = c.now()
+	c.verification.messages = 0
+	c.verification.expired = false
+}
+
+func (c *Conversation) isVerificationCurrent() bool {
+	return c.theirKey != nil && c.verification.fingerprint != nil &&
+		bytes.Equal(c.verification.fingerprint, c.theirKey.Fingerprint())
+}
+
+func (c *Conversation) verifiedMessageExchanged() {
+	if c.isVerificationCurrent() {
+		c.verification.messages++
+	}
+	c.verificationHasExpired()
+}
+
+// verificationHasExpired checks whether the verification of the peer has expired. The first time it has,
+// the peer is no longer trusted in the trust store and TheirVerificationExpired is signalled
+func (c *Conversation) verificationHasExpired() bool {
+	if !c.isVerificationCurrent() {
+		return false
+	}
+
+	if c.verification.expired {
+		return true
+	}
+
+	l := c.verification.lifetime
+	tooOld := l.MaxDuration > 0 && c.now().Sub(c.verification.verifiedAt) >= l.MaxDuration
+	tooMany := l.MaxMessages > 0 && c.verification.messages >= l.MaxMessages
+	if !tooOld && !tooMany {
+		return false
+	}
+
+	c.verification.expired = true
+	if c.trustStore != nil {
+		c.trustStore.SetTrusted(c.trustStorePeer, c.verification.fingerprint, false)
+	}
+	c.securityEvent(TheirVerificationExpired)
+
+	return true
+}
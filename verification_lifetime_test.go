@@ -0,0 +1,113 @@
+package otr3
+
+import (
+	"testing"
+	"time"
+)
+
+func verifiedConversations(t *testing.T, l VerificationLifetime) (alice, bob *Conversation, clock *fakeClock) {
+	alice, bob = benchmarkConversations()
+	clock = &fakeClock{now: time.Now()}
+	alice.SetClock(clock)
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	alice.SetVerificationLifetime(l)
+	alice.MarkVerified()
+	return
+}
+
+func Test_VerificationHasExpired_isFalseWithoutAVerification(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	alice.SetVerificationLifetime(VerificationLifetime{MaxMessages: 1})
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	alice.Send(ValidMessage("hello"))
+	_, err := alice.Send(ValidMessage("hello"))
+
+	assertNil(t, err)
+	assertFalse(t, alice.VerificationHasExpired())
+}
+
+func Test_Send_refusesToSendAfterTheMaximumDurationOfTheVerification(t *testing.T) {
+	alice, _, clock := verifiedConversations(t, VerificationLifetime{MaxDuration: time.Hour})
+	events := collectSecurityEvents(alice)
+
+	_, err := alice.Send(ValidMessage("hello"))
+	assertNil(t, err)
+
+	clock.advance(time.Hour)
+	toSend, err := alice.Send(ValidMessage("hello"))
+
+	assertEquals(t, err, errVerificationExpired)
+	assertNil(t, toSend)
+	assertTrue(t, alice.VerificationHasExpired())
+	assertDeepEquals(t, *events, []SecurityEvent{TheirVerificationExpired})
+}
+
+func Test_Send_refusesToSendAfterTheMaximumNumberOfMessagesOfTheVerification(t *testing.T) {
+	alice, bob, _ := verifiedConversations(t, VerificationLifetime{MaxMessages: 2})
+
+	_, err := alice.Send(ValidMessage("hello"))
+	assertNil(t, err)
+
+	fromBob, _ := bob.Send(ValidMessage("hi"))
+	alice.Receive(fromBob[0])
+
+	_, err = alice.Send(ValidMessage("hello"))
+	assertEquals(t, err, errVerificationExpired)
+}
+
+func Test_Receive_stillWorksAfterTheVerificationHasExpired(t *testing.T) {
+	alice, bob, clock := verifiedConversations(t, VerificationLifetime{MaxDuration: time.Hour})
+	clock.advance(2 * time.Hour)
+
+	fromBob, _ := bob.Send(ValidMessage("hi"))
+	plain, _, err := alice.Receive(fromBob[0])
+
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hi"))
+	assertTrue(t, alice.VerificationHasExpired())
+}
+
+func Test_MarkVerified_startsANewVerificationLifetime(t *testing.T) {
+	alice, _, clock := verifiedConversations(t, VerificationLifetime{MaxDuration: time.Hour})
+	clock.advance(2 * time.Hour)
+	assertTrue(t, alice.VerificationHasExpired())
+
+	alice.MarkVerified()
+
+	_, err := alice.Send(ValidMessage("hello"))
+	assertNil(t, err)
+}
+
+func Test_VerificationHasExpired_marksTheFingerprintAsUntrusted(t *testing.T) {
+	alice, _, clock := verifiedConversations(t, VerificationLifetime{MaxDuration: time.Hour})
+	store := NewMemoryTrustStore()
+	alice.SetTrustStore(store, "bob")
+	store.SetTrusted("bob", alice.theirKey.Fingerprint(), true)
+
+	clock.advance(time.Hour)
+	alice.VerificationHasExpired()
+
+	assertFalse(t, alice.IsTheirFingerprintTrusted())
+}
+
+func Test_verificationLifetime_survivesReKeying(t *testing.T) {
+	alice, bob, clock := verifiedConversations(t, VerificationLifetime{MaxDuration: time.Hour})
+	clock.advance(30 * time.Minute)
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	clock.advance(30 * time.Minute)
+
+	_, err := alice.Send(ValidMessage("hello"))
+	assertEquals(t, err, errVerificationExpired)
+}
+
+func Test_runSMP_startsTheVerificationLifetime(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	alice.SetVerificationLifetime(VerificationLifetime{MaxMessages: 1})
+
+	runSMP(t, alice, bob, "secret", "secret")
+	alice.Send(ValidMessage("hello"))
+
+	assertTrue(t, alice.VerificationHasExpired())
+}
@@ -12,6 +12,7 @@ import (
 type otrVersion interface {
 	protocolVersion() uint16
 	parameterLength() int
+	dhExponentLength() int
 	isGroupElement(n *big.Int) bool
 	isFragmented(data []byte) bool
 	parseFragmentPrefix(c *Conversation, data []byte) (rest []byte, ignore bool, ok bool)
@@ -29,19 +30,19 @@ type otrVersion interface {
 	keyLength() int
 }
 
-func newOtrVersion(v uint16, p policies) (version otrVersion, err error) {
-	toCheck := policy(0)
+func newOtrVersion(v uint16, p Policies) (version otrVersion, err error) {
+	toCheck := Policy(0)
 	switch v {
 	case 2:
 		version = otrV2{}
-		toCheck = allowV2
+		toCheck = PolicyAllowV2
 	case 3:
 		version = otrV3{}
-		toCheck = allowV3
+		toCheck = PolicyAllowV3
 	default:
 		return nil, errUnsupportedOTRVersion
 	}
-	if !p.has(toCheck) {
+	if !p.Has(toCheck) {
 		return nil, errInvalidVersion
 	}
 	return
@@ -84,14 +85,8 @@ func (c *Conversation) commitToVersionFrom(versions int) error {
 		return nil
 	}
 
-	var version otrVersion
-
-	switch {
-	case c.Policies.has(allowV3) && versions&(1<<3) > 0:
-		version = otrV3{}
-	case c.Policies.has(allowV2) && versions&(1<<2) > 0:
-		version = otrV2{}
-	default:
+	version := bestVersionFrom(c.Policies, versions)
+	if version == nil {
 		return errUnsupportedOTRVersion
 	}
 
@@ -100,6 +95,38 @@ func (c *Conversation) commitToVersionFrom(versions int) error {
 	return c.setKeyMatchingVersion()
 }
 
+// refuseUnsupportedVersion lets the user know that the peer requires a protocol version we don't support,
+// and lets the peer know with an error message if an ErrorMessageHandler is set
+func (c *Conversation) refuseUnsupportedVersion() error {
+	c.messageEvent(MessageEventPeerRequiresUnsupportedVersion)
+	c.generatePotentialErrorMessage(ErrorCodeUnsupportedVersion)
+	return errUnsupportedOTRVersion
+}
+
+// bestVersionFrom returns the highest version offered by the peer that the policies allow, or nil if there is none
+func bestVersionFrom(p Policies, versions int) otrVersion {
+	switch {
+	case p.Has(PolicyAllowV3) && versions&(1<<3) > 0:
+		return otrV3{}
+	case p.Has(PolicyAllowV2) && versions&(1<<2) > 0:
+		return otrV2{}
+	}
+	return nil
+}
+
+// resolveVersionFrom commits to the best version the peer offers when it announces the versions it supports,
+// even if the conversation committed to another version before. The same peer can use a client that only
+// supports OTRv2 one day and one that supports OTRv3 the next. While the conversation is encrypted
+// the version never changes, since the peer we have the session with depends on it.
+func (c *Conversation) resolveVersionFrom(versions int) error {
+	best := bestVersionFrom(c.Policies, versions)
+	if c.msgState != encrypted && c.version != nil && best != nil && c.version.protocolVersion() != best.protocolVersion() {
+		c.version = nil
+	}
+
+	return c.commitToVersionFrom(versions)
+}
+
 func (c *Conversation) setKeyMatchingVersion() error {
 	for _, k := range c.ourKeys {
 		if k.IsAvailableForVersion(c.version.protocolVersion()) {
@@ -1,20 +1,24 @@
 package otr3
 
-import "testing"
+import (
+	"crypto/rand"
+	"io"
+	"testing"
+)
 
 func Test_newOtrVersion_returnsTheCorrectOTRVersionForAValidVersionNumber(t *testing.T) {
-	v, _ := newOtrVersion(3, policies(allowV3))
+	v, _ := newOtrVersion(3, Policies(PolicyAllowV3))
 	_, ok := v.(otrV3)
 	assertEquals(t, ok, true)
 }
 
 func Test_newOtrVersion_returnsUnsupportedVersionErrorIfGivenAWrongVersion(t *testing.T) {
-	_, err := newOtrVersion(4, policies(allowV3))
+	_, err := newOtrVersion(4, Policies(PolicyAllowV3))
 	assertEquals(t, err, errUnsupportedOTRVersion)
 }
 
 func Test_newOtrVersion_returnsAnErrorIfGivenAVersionThatIsntAllowedByPolicy(t *testing.T) {
-	_, err := newOtrVersion(3, policies(allowV2))
+	_, err := newOtrVersion(3, Policies(PolicyAllowV2))
 	assertEquals(t, err, errInvalidVersion)
 }
 
@@ -25,7 +29,7 @@ func Test_checkVersion_returnsErrorIfTheMessageIsCorrupt(t *testing.T) {
 }
 
 func Test_checkVersion_setsTheConversationVersionIfWeHaveNoExistingVersion(t *testing.T) {
-	c := &Conversation{Policies: policies(allowV3)}
+	c := &Conversation{Policies: Policies(PolicyAllowV3)}
 	c.ourKeys = []PrivateKey{alicePrivateKey}
 	e := c.checkVersion([]byte{0x00, 0x03})
 	assertEquals(t, e, nil)
@@ -33,7 +37,7 @@ func Test_checkVersion_setsTheConversationVersionIfWeHaveNoExistingVersion(t *te
 }
 
 func Test_checkVersion_setsTheConversationVersionIfWeHaveTheCorrectPolicy(t *testing.T) {
-	c := &Conversation{Policies: policies(allowV2)}
+	c := &Conversation{Policies: Policies(PolicyAllowV2)}
 	c.ourKeys = []PrivateKey{alicePrivateKey}
 	e := c.checkVersion([]byte{0x00, 0x02})
 	assertEquals(t, e, nil)
@@ -41,22 +45,144 @@ func Test_checkVersion_setsTheConversationVersionIfWeHaveTheCorrectPolicy(t *tes
 }
 
 func Test_checkVersion_returnsTheErrorFromNewOtrVersion(t *testing.T) {
-	c := &Conversation{Policies: policies(allowV2)}
+	c := &Conversation{Policies: Policies(PolicyAllowV2)}
 	c.ourKeys = []PrivateKey{alicePrivateKey}
 	e := c.checkVersion([]byte{0x00, 0x03})
 	assertEquals(t, e, errUnsupportedOTRVersion)
 }
 
 func Test_checkVersion_doesNotSetConversationVersionIfOneIsAlreadySet(t *testing.T) {
-	c := &Conversation{Policies: policies(allowV2 | allowV3), version: otrV3{}}
+	c := &Conversation{Policies: Policies(PolicyAllowV2 | PolicyAllowV3), version: otrV3{}}
 	c.ourKeys = []PrivateKey{alicePrivateKey}
 	c.checkVersion([]byte{0x00, 0x02})
 	assertEquals(t, otrV3{}, c.version)
 }
 
 func Test_checkVersion_returnsErrorIfCurrentVersionIsDifferentFromMessageVersion(t *testing.T) {
-	c := &Conversation{Policies: policies(allowV2 | allowV3), version: otrV3{}}
+	c := &Conversation{Policies: Policies(PolicyAllowV2 | PolicyAllowV3), version: otrV3{}}
 	c.ourKeys = []PrivateKey{alicePrivateKey}
 	e := c.checkVersion([]byte{0x00, 0x02})
 	assertEquals(t, e, errWrongProtocolVersion)
 }
+
+type countingReader struct {
+	r io.Reader
+	n int
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += n
+	return n, err
+}
+
+func Test_otrVersions_haveTheExpectedParameterSizes(t *testing.T) {
+	assertEquals(t, otrV2{}.dhExponentLength(), 40)
+	assertEquals(t, otrV3{}.dhExponentLength(), 40)
+	assertEquals(t, otrV2{}.parameterLength(), 16)
+	assertEquals(t, otrV3{}.parameterLength(), 192)
+	assertEquals(t, otrV2{}.keyLength(), 16)
+	assertEquals(t, otrV3{}.keyLength(), 16)
+	assertEquals(t, otrV2{}.truncateLength(), 20)
+	assertEquals(t, otrV3{}.truncateLength(), 20)
+}
+
+func Test_otrVersions_neverUseDHExponentsShorterThan320Bits(t *testing.T) {
+	for _, v := range []otrVersion{otrV2{}, otrV3{}} {
+		assertTrue(t, v.dhExponentLength()*8 >= 320)
+	}
+}
+
+func Test_dhCommitMessage_readsExponentSizedByTheVersion(t *testing.T) {
+	for _, v := range []otrVersion{otrV2{}, otrV3{}} {
+		cr := &countingReader{r: rand.Reader}
+		c := newConversation(v, cr)
+
+		_, err := c.dhCommitMessage()
+
+		assertNil(t, err)
+		assertEquals(t, cr.n, v.dhExponentLength()+len(c.ake.r))
+	}
+}
+
+func Test_dhKeyMessage_readsExponentSizedByTheVersion(t *testing.T) {
+	for _, v := range []otrVersion{otrV2{}, otrV3{}} {
+		cr := &countingReader{r: rand.Reader}
+		c := newConversation(v, cr)
+
+		_, err := c.dhKeyMessage()
+
+		assertNil(t, err)
+		assertEquals(t, cr.n, v.dhExponentLength())
+	}
+}
+
+func Test_generateNewDHKeyPair_readsExponentSizedByTheVersion(t *testing.T) {
+	for _, v := range []otrVersion{otrV2{}, otrV3{}} {
+		cr := &countingReader{r: rand.Reader}
+		k := keyManagementContext{}
+
+		err := k.generateNewDHKeyPair(randomExponents{cr}, v)
+
+		assertNil(t, err)
+		assertEquals(t, cr.n, v.dhExponentLength())
+	}
+}
+
+func Test_generateSMPParameters_readsParametersSizedByTheVersion(t *testing.T) {
+	for _, v := range []otrVersion{otrV2{}, otrV3{}} {
+		cr := &countingReader{r: rand.Reader}
+		c := newConversation(v, cr)
+
+		c.generateSMP1Parameters()
+		assertEquals(t, cr.n, 4*v.parameterLength())
+
+		cr.n = 0
+		c.generateSMP2Parameters()
+		assertEquals(t, cr.n, 7*v.parameterLength())
+
+		cr.n = 0
+		c.generateSMP3Parameters()
+		assertEquals(t, cr.n, 4*v.parameterLength())
+
+		cr.n = 0
+		c.generateSMP4Parameters()
+		assertEquals(t, cr.n, v.parameterLength())
+	}
+}
+
+func Test_resolveVersionFrom_switchesToTheVersionThePeerNowOffers(t *testing.T) {
+	c := newConversation(otrV3{}, rand.Reader)
+	c.Policies = Policies(PolicyAllowV2 | PolicyAllowV3)
+	c.ourKeys = []PrivateKey{alicePrivateKey}
+
+	err := c.resolveVersionFrom(1 << 2)
+
+	assertNil(t, err)
+	assertEquals(t, c.version, otrV2{})
+}
+
+func Test_resolveVersionFrom_keepsTheVersionOfAnEncryptedConversation(t *testing.T) {
+	c := newConversation(otrV2{}, rand.Reader)
+	c.Policies = Policies(PolicyAllowV2 | PolicyAllowV3)
+	c.msgState = encrypted
+
+	err := c.resolveVersionFrom(1 << 3)
+
+	assertNil(t, err)
+	assertEquals(t, c.version, otrV2{})
+}
+
+func Test_receive_startsAnOTRv2AKEWhenAPeerThatUsedOTRv3NowOnlyOffersOTRv2(t *testing.T) {
+	c := newConversation(nil, rand.Reader)
+	c.Policies = Policies(PolicyAllowV2 | PolicyAllowV3)
+	c.ourKeys = []PrivateKey{alicePrivateKey}
+
+	_, toSend, _ := c.Receive(ValidMessage("?OTRv23?"))
+	msg, _ := c.decode(encodedMessage(toSend[0]))
+	assertEquals(t, dhMsgVersion(msg), uint16(3))
+
+	_, toSend, _ = c.Receive(ValidMessage("?OTRv2?"))
+	msg, _ = c.decode(encodedMessage(toSend[0]))
+	assertEquals(t, dhMsgVersion(msg), uint16(2))
+}
@@ -28,16 +28,18 @@ func convertToWhitespace(v string) []byte {
 var (
 	// Maps to OTRL_MESSAGE_TAG_BASE
 	whitespaceTagHeader = convertToWhitespace("OT")
+	// Maps to OTRL_MESSAGE_TAG_V1. OTRv1 is not supported, so the tag is only recognized to know that the peer offers it
+	whitespaceTagV1 = []byte(" \t \t  \t ")
 )
 
-func genWhitespaceTag(p policies) []byte {
+func genWhitespaceTag(p Policies) []byte {
 	ret := whitespaceTagHeader
 
-	if p.has(allowV2) {
+	if p.Has(PolicyAllowV2) {
 		ret = append(ret, otrV2{}.whitespaceTag()...)
 	}
 
-	if p.has(allowV3) {
+	if p.Has(PolicyAllowV3) {
 		ret = append(ret, otrV3{}.whitespaceTag()...)
 	}
 
@@ -45,7 +47,7 @@ func genWhitespaceTag(p policies) []byte {
 }
 
 func (c *Conversation) appendWhitespaceTag(message []byte) []byte {
-	if !c.Policies.has(sendWhitespaceTag) || c.whitespaceState == whitespaceRejected {
+	if !c.shouldAdvertiseWithWhitespaceTag() || c.whitespaceState == whitespaceRejected {
 		return message
 	}
 
@@ -68,17 +70,22 @@ func extractWhitespaceTag(message ValidMessage) (plain MessagePlaintext, version
 			versions |= (1 << 3)
 		} else if bytes.Equal(aw, otrV2{}.whitespaceTag()) {
 			versions |= (1 << 2)
+		} else if bytes.Equal(aw, whitespaceTagV1) {
+			versions |= (1 << 1)
 		}
 	}
 
-	plain = makeCopy(append(message[:wsPos], currentData...))
+	plain = make(MessagePlaintext, 0, wsPos+len(currentData))
+	plain = append(append(plain, message[:wsPos]...), currentData...)
 	return
 }
 
 func (c *Conversation) processWhitespaceTag(message ValidMessage) (plain MessagePlaintext, toSend []messageWithHeader, err error) {
 	plain, versions := extractWhitespaceTag(message)
 
-	if !c.Policies.has(whitespaceStartAKE) {
+	// A whitespace tag in a message received while encrypted doesn't mean the peer wants a new private
+	// conversation - most likely the message was sent before the peer knew we were already talking privately
+	if !c.Policies.Has(PolicyWhitespaceStartAKE) || c.msgState == encrypted {
 		return
 	}
 
@@ -101,7 +108,12 @@ func nextAllWhite(data []byte) (allwhite []byte, rest []byte, hasAllWhite bool)
 }
 
 func (c *Conversation) startAKEFromWhitespaceTag(versions int) (toSend []messageWithHeader, err error) {
-	if err = c.commitToVersionFrom(versions); err != nil {
+	if err = c.resolveVersionFrom(versions); err == errUnsupportedOTRVersion {
+		// Unlike a query message, a whitespace tag is only a hint attached to normal plaintext, so like libotr
+		// we ignore one that offers no version we allow, instead of answering every tagged message with an error
+		return nil, nil
+	}
+	if err != nil {
 		return
 	}
 
@@ -6,7 +6,7 @@ import (
 )
 
 func Test_extractWhitespaceTag_removesTagFromMessage(t *testing.T) {
-	p := policies(allowV2)
+	p := Policies(PolicyAllowV2)
 	expectedTag := genWhitespaceTag(p)
 
 	messages := []ValidMessage{
@@ -25,8 +25,8 @@ func Test_extractWhitespaceTag_removesTagFromMessage(t *testing.T) {
 
 func Test_processWhitespaceTag_shouldNotStartAKEIfPolicyDoesNotAllow(t *testing.T) {
 	c := &Conversation{}
-	// the policy explicitly is missing whitespaceStartAKE
-	c.Policies = policies(allowV2)
+	// the policy explicitly is missing PolicyWhitespaceStartAKE
+	c.Policies = Policies(PolicyAllowV2)
 	c.ensureAKE()
 	assertEquals(t, c.ake.state, authStateNone{})
 
@@ -43,7 +43,7 @@ func Test_processWhitespaceTag_shouldNotStartAKEIfPolicyDoesNotAllow(t *testing.
 
 func Test_genWhitespace_forV2(t *testing.T) {
 	hLen := len(whitespaceTagHeader)
-	p := policies(allowV2)
+	p := Policies(PolicyAllowV2)
 	tag := genWhitespaceTag(p)
 
 	assertDeepEquals(t, tag[:hLen], whitespaceTagHeader)
@@ -52,7 +52,7 @@ func Test_genWhitespace_forV2(t *testing.T) {
 
 func Test_genWhitespace_forV3(t *testing.T) {
 	hLen := len(whitespaceTagHeader)
-	p := policies(allowV3)
+	p := Policies(PolicyAllowV3)
 	tag := genWhitespaceTag(p)
 
 	assertDeepEquals(t, tag[:hLen], whitespaceTagHeader)
@@ -63,7 +63,7 @@ func Test_genWhitespace_forV2AndV3(t *testing.T) {
 	hLen := len(whitespaceTagHeader)
 	tLen := 8
 
-	p := policies(allowV2 | allowV3)
+	p := Policies(PolicyAllowV2 | PolicyAllowV3)
 	tag := genWhitespaceTag(p)
 
 	assertDeepEquals(t, tag[:hLen], whitespaceTagHeader)
@@ -74,9 +74,9 @@ func Test_genWhitespace_forV2AndV3(t *testing.T) {
 func Test_receive_acceptsV2WhitespaceTagAndStartsAKE(t *testing.T) {
 	c := newConversation(nil, fixtureRand())
 	c.ourKeys = []PrivateKey{alicePrivateKey}
-	c.Policies = policies(allowV2 | whitespaceStartAKE)
+	c.Policies = Policies(PolicyAllowV2 | PolicyWhitespaceStartAKE)
 
-	msg := genWhitespaceTag(policies(allowV2))
+	msg := genWhitespaceTag(Policies(PolicyAllowV2))
 
 	_, enc, err := c.Receive(msg)
 	toSend, _ := c.decode(encodedMessage(enc[0]))
@@ -89,34 +89,34 @@ func Test_receive_acceptsV2WhitespaceTagAndStartsAKE(t *testing.T) {
 func Test_receive_ignoresV2WhitespaceTagIfThePolicyDoesNotHaveWhitespaceStartAKE(t *testing.T) {
 	c := newConversation(nil, fixtureRand())
 	c.ourKeys = []PrivateKey{alicePrivateKey}
-	c.Policies = policies(allowV2)
+	c.Policies = Policies(PolicyAllowV2)
 
-	msg := genWhitespaceTag(policies(allowV2))
+	msg := genWhitespaceTag(Policies(PolicyAllowV2))
 	_, enc, err := c.Receive(msg)
 
 	assertNil(t, err)
 	assertNil(t, enc)
 }
 
-func Test_receive_failsWhenReceivesV2WhitespaceTagIfV2IsNotInThePolicy(t *testing.T) {
+func Test_receive_ignoresAV2WhitespaceTagIfV2IsNotInThePolicy(t *testing.T) {
 	c := newConversation(nil, fixtureRand())
 	c.ourKeys = []PrivateKey{alicePrivateKey}
-	c.Policies = policies(allowV3 | whitespaceStartAKE)
+	c.Policies = Policies(PolicyAllowV3 | PolicyWhitespaceStartAKE)
 
-	msg := genWhitespaceTag(policies(allowV2))
+	msg := genWhitespaceTag(Policies(PolicyAllowV2))
 
 	_, toSend, err := c.Receive(msg)
 
-	assertEquals(t, err, errUnsupportedOTRVersion)
+	assertNil(t, err)
 	assertNil(t, toSend)
 }
 
 func Test_receive_acceptsV3WhitespaceTagAndStartsAKE(t *testing.T) {
 	c := newConversation(nil, fixtureRand())
 	c.ourKeys = []PrivateKey{alicePrivateKey}
-	c.Policies = policies(allowV2 | allowV3 | whitespaceStartAKE)
+	c.Policies = Policies(PolicyAllowV2 | PolicyAllowV3 | PolicyWhitespaceStartAKE)
 
-	msg := genWhitespaceTag(policies(allowV2 | allowV3))
+	msg := genWhitespaceTag(Policies(PolicyAllowV2 | PolicyAllowV3))
 
 	_, enc, err := c.Receive(msg)
 	toSend, _ := c.decode(encodedMessage(enc[0]))
@@ -129,8 +129,8 @@ func Test_receive_acceptsV3WhitespaceTagAndStartsAKE(t *testing.T) {
 func Test_receive_whiteSpaceTagWillSignalSetupErrorIfSomethingFails(t *testing.T) {
 	c := newConversation(nil, fixedRand([]string{"ABCD"}))
 	c.ourKeys = []PrivateKey{alicePrivateKey}
-	c.Policies = policies(allowV2 | allowV3 | whitespaceStartAKE)
-	msg := genWhitespaceTag(policies(allowV2 | allowV3))
+	c.Policies = Policies(PolicyAllowV2 | PolicyAllowV3 | PolicyWhitespaceStartAKE)
+	msg := genWhitespaceTag(Policies(PolicyAllowV2 | PolicyAllowV3))
 
 	c.expectMessageEvent(t, func() {
 		c.Receive(msg)
@@ -140,9 +140,9 @@ func Test_receive_whiteSpaceTagWillSignalSetupErrorIfSomethingFails(t *testing.T
 func Test_receive_ignoresV3WhitespaceTagIfThePolicyDoesNotHaveWhitespaceStartAKE(t *testing.T) {
 	c := newConversation(nil, fixtureRand())
 	c.ourKeys = []PrivateKey{alicePrivateKey}
-	c.Policies = policies(allowV2 | allowV3)
+	c.Policies = Policies(PolicyAllowV2 | PolicyAllowV3)
 
-	msg := genWhitespaceTag(policies(allowV3))
+	msg := genWhitespaceTag(Policies(PolicyAllowV3))
 
 	_, toSend, err := c.Receive(msg)
 
@@ -150,22 +150,22 @@ func Test_receive_ignoresV3WhitespaceTagIfThePolicyDoesNotHaveWhitespaceStartAKE
 	assertNil(t, toSend)
 }
 
-func Test_receive_failsWhenReceivesV3WhitespaceTagIfV3IsNotInThePolicy(t *testing.T) {
+func Test_receive_ignoresAV3WhitespaceTagIfV3IsNotInThePolicy(t *testing.T) {
 	c := newConversation(nil, fixtureRand())
 	c.ourKeys = []PrivateKey{alicePrivateKey}
-	c.Policies = policies(allowV2 | whitespaceStartAKE)
+	c.Policies = Policies(PolicyAllowV2 | PolicyWhitespaceStartAKE)
 
-	msg := genWhitespaceTag(policies(allowV3))
+	msg := genWhitespaceTag(Policies(PolicyAllowV3))
 	_, toSend, err := c.Receive(msg)
 
-	assertEquals(t, err, errUnsupportedOTRVersion)
+	assertNil(t, err)
 	assertNil(t, toSend)
 }
 
 func Test_stopAppendingWhitespaceTagsAfterReceivingAPlainMessage(t *testing.T) {
 	c := &Conversation{}
 	c.ourKeys = []PrivateKey{alicePrivateKey}
-	c.Policies = policies(allowV3 | sendWhitespaceTag)
+	c.Policies = Policies(PolicyAllowV3 | PolicySendWhitespaceTag)
 
 	toSend, err := c.Send([]byte("hi"))
 	assertEquals(t, err, nil)
@@ -186,3 +186,129 @@ func Test_stopAppendingWhitespaceTagsAfterReceivingAPlainMessage(t *testing.T) {
 	assertEquals(t, err, nil)
 	assertEquals(t, bytes.Contains(toSend[0], whitespaceTagHeader), false)
 }
+
+func Test_extractWhitespaceTag_doesntModifyTheReceivedMessage(t *testing.T) {
+	m := ValidMessage("hi" + string(genWhitespaceTag(Policies(PolicyAllowV3))) + " there")
+	original := makeCopy(m)
+
+	extractWhitespaceTag(m)
+
+	assertDeepEquals(t, m, ValidMessage(original))
+}
+
+func Test_receive_startsAKEWithTheBestVersionOfferedByBoth(t *testing.T) {
+	c := newConversation(nil, fixtureRand())
+	c.ourKeys = []PrivateKey{alicePrivateKey}
+	c.Policies = Policies(PolicyAllowV2 | PolicyAllowV3 | PolicyWhitespaceStartAKE)
+
+	msg := append(ValidMessage("hello"), genWhitespaceTag(Policies(PolicyAllowV2|PolicyAllowV3))...)
+
+	plain, enc, err := c.Receive(msg)
+	toSend, _ := c.decode(encodedMessage(enc[0]))
+
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+	assertEquals(t, dhMsgVersion(toSend), uint16(3))
+}
+
+func Test_receive_doesntStartAKEFromWhitespaceTagWhenAlreadyEncrypted(t *testing.T) {
+	c := bobContextAfterAKE()
+	c.msgState = encrypted
+	c.Policies = Policies(PolicyAllowV2 | PolicyAllowV3 | PolicyWhitespaceStartAKE)
+
+	msg := append(ValidMessage("hello"), genWhitespaceTag(Policies(PolicyAllowV3))...)
+
+	plain, toSend, err := c.Receive(msg)
+
+	assertNil(t, err)
+	assertNil(t, toSend)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+}
+
+func Test_extractWhitespaceTag_recognizesTheV1Tag(t *testing.T) {
+	m := append(append(ValidMessage("hi there"), whitespaceTagHeader...), whitespaceTagV1...)
+
+	plain, versions := extractWhitespaceTag(m)
+
+	assertDeepEquals(t, plain, MessagePlaintext("hi there"))
+	assertEquals(t, versions, 1<<1)
+}
+
+func Test_extractWhitespaceTag_recognizesAllVersionTagsInAnyOrder(t *testing.T) {
+	m := append(ValidMessage("hi"), whitespaceTagHeader...)
+	m = append(m, otrV3{}.whitespaceTag()...)
+	m = append(m, whitespaceTagV1...)
+	m = append(m, otrV2{}.whitespaceTag()...)
+
+	plain, versions := extractWhitespaceTag(m)
+
+	assertDeepEquals(t, plain, MessagePlaintext("hi"))
+	assertEquals(t, versions, 1<<1|1<<2|1<<3)
+}
+
+func Test_receive_ignoresAWhitespaceTagThatOnlyOffersV1(t *testing.T) {
+	c := newConversation(nil, fixtureRand())
+	c.ourKeys = []PrivateKey{alicePrivateKey}
+	c.Policies = Policies(PolicyAllowV2 | PolicyAllowV3 | PolicyWhitespaceStartAKE)
+	events := recordMessageEvents(c)
+
+	msg := append(append(ValidMessage("hello"), whitespaceTagHeader...), whitespaceTagV1...)
+	plain, toSend, err := c.Receive(msg)
+
+	assertNil(t, err)
+	assertNil(t, toSend)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+	assertEquals(t, len(*events), 0)
+}
+
+func Test_receive_negotiatesTheBestVersionFromMixedWhitespaceTags(t *testing.T) {
+	tags := map[string][]byte{
+		"1": whitespaceTagV1,
+		"2": otrV2{}.whitespaceTag(),
+		"3": otrV3{}.whitespaceTag(),
+	}
+	policies := map[string]Policies{
+		"2":  Policies(PolicyAllowV2),
+		"3":  Policies(PolicyAllowV3),
+		"23": Policies(PolicyAllowV2 | PolicyAllowV3),
+	}
+
+	// offered tags, our allowed versions -> negotiated version, or 0 if the tag should be ignored
+	matrix := []struct {
+		offered, allowed string
+		negotiated       uint16
+	}{
+		{"1", "2", 0}, {"1", "3", 0}, {"1", "23", 0},
+		{"2", "2", 2}, {"2", "3", 0}, {"2", "23", 2},
+		{"3", "2", 0}, {"3", "3", 3}, {"3", "23", 3},
+		{"12", "2", 2}, {"12", "3", 0}, {"12", "23", 2},
+		{"13", "2", 0}, {"13", "3", 3}, {"13", "23", 3},
+		{"23", "2", 2}, {"23", "3", 3}, {"23", "23", 3},
+		{"123", "2", 2}, {"123", "3", 3}, {"123", "23", 3},
+	}
+
+	for _, e := range matrix {
+		c := newConversation(nil, fixtureRand())
+		c.ourKeys = []PrivateKey{alicePrivateKey}
+		c.Policies = policies[e.allowed]
+		c.Policies.Add(PolicyWhitespaceStartAKE)
+
+		msg := append(ValidMessage("hello"), whitespaceTagHeader...)
+		for _, v := range e.offered {
+			msg = append(msg, tags[string(v)]...)
+		}
+
+		plain, enc, err := c.Receive(msg)
+
+		assertDeepEquals(t, plain, MessagePlaintext("hello"))
+		if e.negotiated == 0 {
+			assertNil(t, err)
+			assertNil(t, enc)
+			continue
+		}
+		assertNil(t, err)
+		toSend, _ := c.decode(encodedMessage(enc[0]))
+		assertEquals(t, dhMsgType(toSend), msgTypeDHCommit)
+		assertEquals(t, dhMsgVersion(toSend), e.negotiated)
+	}
+}
@@ -40,10 +40,13 @@ func (a *ake) wipe(wipeKeys bool) {
 	a.theirPublicValue = nil
 
 	wipeBytes(a.r[:])
+	wipeBytes(a.ssid[:])
 
 	a.wipeGX()
 	a.revealKey.wipe()
 	a.sigKey.wipe()
+	a.version = nil
+	a.role = RoleUnknown
 
 	if wipeKeys {
 		a.keys.wipe()
@@ -63,6 +66,43 @@ func (a *ake) wipeGX() {
 	a.encryptedGx = nil
 }
 
+func (k *sessionKeys) wipe() {
+	if k == nil {
+		return
+	}
+
+	wipeBytes(k.sendingAESKey)
+	wipeBytes(k.receivingAESKey)
+	k.sendingMACKey.wipe()
+	k.receivingMACKey.wipe()
+	wipeBytes(k.extraKey)
+	*k = sessionKeys{}
+}
+
+func (s *smp1State) wipe() {
+	if s == nil {
+		return
+	}
+
+	wipeBigInts(s.a2, s.a3, s.r2, s.r3)
+}
+
+func (s *smp2State) wipe() {
+	if s == nil {
+		return
+	}
+
+	wipeBigInts(s.y, s.b2, s.b3, s.r2, s.r3, s.r4, s.r5, s.r6)
+}
+
+func (s *smp3State) wipe() {
+	if s == nil {
+		return
+	}
+
+	wipeBigInts(s.x, s.r4, s.r5, s.r6, s.r7)
+}
+
 func (c *keyManagementContext) wipeKeys() {
 	if c == nil {
 		return
@@ -169,12 +209,25 @@ func wipeBytes(b []byte) {
 	copy(b, zeroes(len(b)))
 }
 
+// wipeBigInt zeroes every limb the big.Int owns, including the ones beyond its current length
+// that still hold what earlier, longer values left there
 func wipeBigInt(k *big.Int) {
 	if k == nil {
 		return
 	}
 
-	k.SetBytes(zeroes(len(k.Bytes())))
+	limbs := k.Bits()
+	limbs = limbs[:cap(limbs)]
+	for i := range limbs {
+		limbs[i] = 0
+	}
+	k.SetInt64(0)
+}
+
+func wipeBigInts(ks ...*big.Int) {
+	for _, k := range ks {
+		wipeBigInt(k)
+	}
 }
 
 func setBigInt(dst *big.Int, src *big.Int) *big.Int {
@@ -58,7 +58,7 @@ func Test_wipe_keyManagementContext(t *testing.T) {
 		theirPreviousDHPubKey: big.NewInt(6),
 		counterHistory: counterHistory{
 			counters: []*keyPairCounter{
-				&keyPairCounter{1, 1, 1, 1},
+				&keyPairCounter{1, 1, 1, 1, 1},
 			},
 		},
 		macKeyHistory: macKeyHistory{
@@ -123,3 +123,74 @@ func Test_macKeyUsage_wipe_HandlesNilWell(t *testing.T) {
 func Test_macKey_wipe_HandlesNilWell(t *testing.T) {
 	(*macKey)(nil).wipe()
 }
+
+func Test_sessionKeys_wipe_HandlesNilWell(t *testing.T) {
+	(*sessionKeys)(nil).wipe()
+}
+
+func Test_smpStates_wipe_HandlesNilWell(t *testing.T) {
+	(*smp1State)(nil).wipe()
+	(*smp2State)(nil).wipe()
+	(*smp3State)(nil).wipe()
+}
+
+func Test_wipe_sessionKeysZeroesTheBackingStores(t *testing.T) {
+	keys := calculateDHSessionKeys(nil, fixtureLong1, big.NewInt(2), big.NewInt(3), otrV3{})
+	aes, mac, extra := keys.sendingAESKey, keys.receivingMACKey, keys.extraKey
+
+	keys.wipe()
+
+	assertDeepEquals(t, keys, sessionKeys{})
+	assertDeepEquals(t, aes, zeroes(len(aes)))
+	assertDeepEquals(t, []byte(mac), zeroes(len(mac)))
+	assertDeepEquals(t, extra, zeroes(len(extra)))
+}
+
+func Test_wipe_smpZeroesTheSecretExponents(t *testing.T) {
+	s := smp{s1: fixtureSmp1(), s2: fixtureSmp2(), s3: fixtureSmp3()}
+	a2, b3, r7 := s.s1.a2, s.s2.b3, big.NewInt(7)
+	s.s3.r7 = r7
+
+	s.wipe()
+
+	assertEquals(t, a2.Sign(), 0)
+	assertEquals(t, b3.Sign(), 0)
+	assertEquals(t, r7.Sign(), 0)
+}
+
+func Test_receivingAMessage_keepsTheMACKeyToRevealAfterWipingTheSessionKeys(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	toBob, _ := alice.Send(ValidMessage("hello"))
+	exchangeUntilQuiet(t, alice, bob, toBob)
+
+	assertEquals(t, len(bob.keys.macKeyHistory.items), 1)
+	used := bob.keys.macKeyHistory.items[0]
+	keys, _ := bob.keys.calculateDHSessionKeys(nil, used.ourKeyID, used.theirKeyID, bob.version)
+	assertDeepEquals(t, used.receivingKey, keys.receivingMACKey)
+}
+
+func Test_End_wipesTheAKE(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	alice.Receive(bob.QueryMessage())
+	ake := alice.ake
+
+	alice.End()
+
+	assertNil(t, alice.ake)
+	assertNil(t, ake.secretExponent)
+	assertDeepEquals(t, ake.r, [16]byte{})
+}
+
+func Test_wipeBigInt_zeroesTheLimbsBeyondTheCurrentValue(t *testing.T) {
+	n := new(big.Int).Set(fixtureLong1)
+	limbs := n.Bits()
+	n.SetInt64(7)
+
+	wipeBigInt(n)
+
+	for _, l := range limbs[:cap(limbs)] {
+		assertEquals(t, l, big.Word(0))
+	}
+}
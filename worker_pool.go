@@ -0,0 +1,252 @@
+package otr3
+
+import (
+	"bytes"
+	"sync"
+)
+
+// WorkerPool processes messages for many conversations on a bounded number of goroutines,
+// so the transport goroutines don't have to do the expensive parts of the protocol - like the
+// modular exponentiations of the AKE - inline.
+//
+// Messages for one conversation are processed one at a time and in the order they were given,
+// so a conversation used through a pool should only be used through that pool.
+// Conversations take turns: after a message is processed, the conversation goes to the back of the line.
+// Messages that are expensive to receive - the ones that start or continue an AKE, and the data messages
+// that might carry SMP - can only occupy all but one of the workers, so a burst of handshakes can't stop
+// the messages of established conversations from being processed. A pool with a single worker has no
+// worker to spare, so it processes expensive messages too, and only the taking turns keeps them from
+// holding up the other conversations.
+type WorkerPool struct {
+	lock sync.Mutex
+	wake *sync.Cond
+
+	queues map[*Conversation][]workerPoolJob
+	ready  []*Conversation
+
+	heavy, maxHeavy int
+	closed          bool
+	workers         sync.WaitGroup
+}
+
+type workerPoolJob struct {
+	run func()
+	// received is the message a job receives, which decides whether it is heavy once the job is up
+	received ValidMessage
+	heavy    bool
+}
+
+// ReceiveCallback is called by a WorkerPool with the result of receiving a message
+type ReceiveCallback func(plain MessagePlaintext, toSend []ValidMessage, err error)
+
+// SendCallback is called by a WorkerPool with the result of sending a message
+type SendCallback func(toSend []ValidMessage, err error)
+
+// NewWorkerPool starts a WorkerPool with the given number of workers. It should be stopped with Close when not needed anymore.
+func NewWorkerPool(workers int) *WorkerPool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	p := &WorkerPool{
+		queues:   make(map[*Conversation][]workerPoolJob),
+		maxHeavy: workers - 1,
+	}
+	if p.maxHeavy == 0 {
+		p.maxHeavy = 1
+	}
+	p.wake = sync.NewCond(&p.lock)
+
+	p.workers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+
+	return p
+}
+
+// Receive queues the message to be received by the conversation. The callback is called from one of the workers.
+// If the pool has been closed, the callback is called right away with an error.
+func (p *WorkerPool) Receive(c *Conversation, m ValidMessage, done ReceiveCallback) {
+	m = makeCopy(m)
+	p.enqueue(c, workerPoolJob{
+		received: m,
+		run: func() {
+			plain, toSend, err := c.Receive(m)
+			done(plain, toSend, err)
+		},
+	}, func() { done(nil, nil, errWorkerPoolClosed) })
+}
+
+// Send queues the message to be sent in the conversation. The callback is called from one of the workers.
+// If the pool has been closed, the callback is called right away with an error.
+func (p *WorkerPool) Send(c *Conversation, m ValidMessage, done SendCallback) {
+	m = makeCopy(m)
+	p.enqueue(c, workerPoolJob{
+		run: func() {
+			toSend, err := c.Send(m)
+			done(toSend, err)
+		},
+	}, func() { done(nil, errWorkerPoolClosed) })
+}
+
+// Close stops the pool after all queued messages have been processed
+func (p *WorkerPool) Close() {
+	p.lock.Lock()
+	p.closed = true
+	p.wake.Broadcast()
+	p.lock.Unlock()
+
+	p.workers.Wait()
+}
+
+// smpMessageMinimumLength is less than the length of every SMP message we have to verify. Even the smallest
+// of them, message 4, has two values of the size of the 1536-bit group, which are 192 bytes long unless they
+// happen to start with zeros.
+const smpMessageMinimumLength = 2 * 160
+
+// isExpensiveToReceive returns true if receiving the message makes the conversation do modular exponentiations.
+// A fragment is classified by the message it completes, so it must only be called while no worker uses the conversation.
+func isExpensiveToReceive(c *Conversation, m ValidMessage) bool {
+	switch guessMessageType(m) {
+	case msgGuessQuery, msgGuessTaggedPlaintext, msgGuessDHCommit, msgGuessDHKey, msgGuessRevealSig, msgGuessSignature:
+		return true
+	case msgGuessData:
+		return mightCarrySMP(c, m)
+	case msgGuessFragment:
+		if whole := reassembledBy(c, m); whole != nil {
+			return isExpensiveToReceive(c, whole)
+		}
+	}
+	return false
+}
+
+// mightCarrySMP returns true for a data message that could carry an SMP message. What it carries is only known
+// once it has been decrypted, so every data message is assumed to while SMP is in progress, and otherwise the ones
+// that encrypt enough to start it.
+func mightCarrySMP(c *Conversation, m ValidMessage) bool {
+	if _, idle := c.currentSMPState().(smpStateExpect1); !idle {
+		return true
+	}
+	if c.version == nil {
+		return false
+	}
+
+	msg, err := b64decode(removeOTRMsgEnvelope(encodedMessage(m)))
+	if err != nil {
+		return false
+	}
+	_, body, err := c.dataMessageHeader(msg)
+	if err != nil {
+		return false
+	}
+	dataMessage := dataMsg{}
+	if err = dataMessage.deserialize(body, c.version, c.FieldLimits()); err != nil {
+		return false
+	}
+
+	return len(dataMessage.encryptedMsg) >= smpMessageMinimumLength
+}
+
+// reassembledBy returns the start of the message the fragment completes in the conversation,
+// or nil if it doesn't complete one. The conversation is not changed.
+func reassembledBy(c *Conversation, m ValidMessage) []byte {
+	body := m[len(otrv2FragmentationPrefix):]
+	if bytes.HasPrefix(m, otrv3FragmentationPrefix) {
+		// The instance tags come first, like parseFragmentPrefix expects them
+		if len(m) < 23 {
+			return nil
+		}
+		body = m[23:]
+	}
+
+	data, ix, l, ok := parseFragment(body)
+	switch {
+	case !ok || fragmentIsInvalid(ix, l) || ix != l:
+		return nil
+	case fragmentIsFirstMessage(ix, l):
+		return data
+	case fragmentIsNextMessage(c.fragmentationContext, ix, l):
+		before := c.fragmentationContext.frag
+		return append(before[:len(before):len(before)], data...)
+	}
+	return nil
+}
+
+func (p *WorkerPool) enqueue(c *Conversation, job workerPoolJob, whenClosed func()) {
+	p.lock.Lock()
+	if p.closed {
+		p.lock.Unlock()
+		whenClosed()
+		return
+	}
+
+	pending, known := p.queues[c]
+	p.queues[c] = append(pending, job)
+	if !known {
+		p.ready = append(p.ready, c)
+	}
+	p.wake.Broadcast()
+	p.lock.Unlock()
+}
+
+func (p *WorkerPool) work() {
+	defer p.workers.Done()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for {
+		c, job, ok := p.next()
+		if !ok {
+			if p.closed && len(p.queues) == 0 {
+				return
+			}
+			p.wake.Wait()
+			continue
+		}
+
+		p.lock.Unlock()
+		job.run()
+		p.lock.Lock()
+
+		p.finished(c, job)
+	}
+}
+
+// next takes the first job of the first conversation in line that can be processed now.
+// The conversation is taken out of line while the job runs, so no other worker uses it.
+func (p *WorkerPool) next() (*Conversation, workerPoolJob, bool) {
+	for i, c := range p.ready {
+		job := p.queues[c][0]
+		if job.received != nil {
+			job.heavy = isExpensiveToReceive(c, job.received)
+		}
+		if job.heavy && p.heavy >= p.maxHeavy {
+			continue
+		}
+
+		p.ready = append(p.ready[:i:i], p.ready[i+1:]...)
+		p.queues[c] = p.queues[c][1:]
+		if job.heavy {
+			p.heavy++
+		}
+		return c, job, true
+	}
+
+	return nil, workerPoolJob{}, false
+}
+
+func (p *WorkerPool) finished(c *Conversation, job workerPoolJob) {
+	if job.heavy {
+		p.heavy--
+	}
+
+	if len(p.queues[c]) > 0 {
+		p.ready = append(p.ready, c)
+	} else {
+		delete(p.queues, c)
+	}
+
+	p.wake.Broadcast()
+}
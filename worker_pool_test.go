@@ -0,0 +1,180 @@
+package otr3
+
+import (
+	"sync"
+	"testing"
+)
+
+func receiveThrough(p *WorkerPool, c *Conversation, m ValidMessage) (MessagePlaintext, []ValidMessage, error) {
+	type result struct {
+		plain  MessagePlaintext
+		toSend []ValidMessage
+		err    error
+	}
+	done := make(chan result, 1)
+	p.Receive(c, m, func(plain MessagePlaintext, toSend []ValidMessage, err error) {
+		done <- result{plain, toSend, err}
+	})
+	r := <-done
+	return r.plain, r.toSend, r.err
+}
+
+func Test_WorkerPool_runsTheAKEAndDeliversMessages(t *testing.T) {
+	p := NewWorkerPool(2)
+	defer p.Close()
+	alice, bob := benchmarkConversations()
+
+	from, to := alice, bob
+	msgs := []ValidMessage{alice.QueryMessage()}
+	for len(msgs) > 0 {
+		var next []ValidMessage
+		for _, m := range msgs {
+			_, toSend, err := receiveThrough(p, to, m)
+			assertNil(t, err)
+			next = append(next, toSend...)
+		}
+		from, to, msgs = to, from, next
+	}
+
+	assertTrue(t, alice.IsEncrypted())
+	assertTrue(t, bob.IsEncrypted())
+
+	sent := make(chan []ValidMessage, 1)
+	p.Send(alice, ValidMessage("hello"), func(toSend []ValidMessage, err error) {
+		assertNil(t, err)
+		sent <- toSend
+	})
+	plain, _, err := receiveThrough(p, bob, (<-sent)[0])
+
+	assertNil(t, err)
+	assertDeepEquals(t, plain, MessagePlaintext("hello"))
+}
+
+func Test_WorkerPool_processesTheMessagesOfAConversationInOrder(t *testing.T) {
+	p := NewWorkerPool(4)
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	var lock sync.Mutex
+	var sent []ValidMessage
+	for _, m := range []string{"one", "two", "three", "four", "five"} {
+		p.Send(alice, ValidMessage(m), func(toSend []ValidMessage, err error) {
+			lock.Lock()
+			defer lock.Unlock()
+			sent = append(sent, toSend...)
+		})
+	}
+	p.Close()
+
+	var received []string
+	for _, m := range sent {
+		plain, _, err := bob.Receive(m)
+		assertNil(t, err)
+		received = append(received, string(plain))
+	}
+
+	assertDeepEquals(t, received, []string{"one", "two", "three", "four", "five"})
+}
+
+func Test_WorkerPool_next_skipsExpensiveMessagesWhenTheirWorkersAreBusy(t *testing.T) {
+	handshaking, established := &Conversation{}, &Conversation{}
+	p := &WorkerPool{
+		queues: map[*Conversation][]workerPoolJob{
+			handshaking: {{heavy: true}},
+			established: {{heavy: false}},
+		},
+		ready:    []*Conversation{handshaking, established},
+		heavy:    1,
+		maxHeavy: 1,
+	}
+	p.wake = sync.NewCond(&p.lock)
+
+	c, job, ok := p.next()
+
+	assertTrue(t, ok)
+	assertEquals(t, c, established)
+	assertFalse(t, job.heavy)
+	assertDeepEquals(t, p.ready, []*Conversation{handshaking})
+
+	_, _, ok = p.next()
+	assertFalse(t, ok)
+
+	p.finished(established, job)
+	p.heavy = 0
+	c, _, ok = p.next()
+	assertTrue(t, ok)
+	assertEquals(t, c, handshaking)
+}
+
+func Test_WorkerPool_next_putsAConversationAtTheBackOfTheLineAfterEveryMessage(t *testing.T) {
+	busy, quiet := &Conversation{}, &Conversation{}
+	p := &WorkerPool{
+		queues: map[*Conversation][]workerPoolJob{
+			busy:  {{}, {}},
+			quiet: {{}},
+		},
+		ready:    []*Conversation{busy, quiet},
+		maxHeavy: 1,
+	}
+	p.wake = sync.NewCond(&p.lock)
+
+	c, job, _ := p.next()
+	assertEquals(t, c, busy)
+	p.finished(c, job)
+
+	c, _, _ = p.next()
+	assertEquals(t, c, quiet)
+}
+
+func Test_isExpensiveToReceive_isTrueForMessagesThatMakeUsDoTheAKE(t *testing.T) {
+	c := &Conversation{}
+
+	assertTrue(t, isExpensiveToReceive(c, ValidMessage("?OTRv3?")))
+	assertTrue(t, isExpensiveToReceive(c, ValidMessage("?OTR:AAMCAAAA.")))
+	assertFalse(t, isExpensiveToReceive(c, ValidMessage("?OTR:AAMDAAAA.")))
+	assertFalse(t, isExpensiveToReceive(c, ValidMessage("hello")))
+}
+
+func Test_isExpensiveToReceive_classifiesAFragmentByTheMessageItCompletes(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	bob.SetFragmentSize(100)
+	_, dhCommit, _ := bob.Receive(alice.QueryMessage())
+	assertTrue(t, len(dhCommit) > 1)
+
+	for _, f := range dhCommit[:len(dhCommit)-1] {
+		assertFalse(t, isExpensiveToReceive(alice, f))
+		alice.Receive(f)
+	}
+
+	assertTrue(t, isExpensiveToReceive(alice, dhCommit[len(dhCommit)-1]))
+}
+
+func Test_isExpensiveToReceive_isTrueForADataMessageLongEnoughToCarrySMP(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+
+	smp1, _ := alice.StartAuthenticate("", []byte("secret"))
+	hello, _ := alice.Send(ValidMessage("hello"))
+
+	assertTrue(t, isExpensiveToReceive(bob, smp1[0]))
+	assertFalse(t, isExpensiveToReceive(bob, hello[0]))
+}
+
+func Test_isExpensiveToReceive_isTrueForEveryDataMessageWhileSMPIsInProgress(t *testing.T) {
+	alice, bob := benchmarkConversations()
+	exchangeUntilQuiet(t, alice, bob, []ValidMessage{alice.QueryMessage()})
+	hello, _ := bob.Send(ValidMessage("hello"))
+
+	alice.StartAuthenticate("", []byte("secret"))
+
+	assertTrue(t, isExpensiveToReceive(alice, hello[0]))
+}
+
+func Test_WorkerPool_returnsErrorAfterItHasBeenClosed(t *testing.T) {
+	p := NewWorkerPool(1)
+	p.Close()
+
+	_, _, err := receiveThrough(p, &Conversation{}, ValidMessage("hello"))
+
+	assertEquals(t, err, errWorkerPoolClosed)
+}